@@ -0,0 +1,148 @@
+// Command accessconfig plans, applies and exports the declarative access config: data sources,
+// groups, group members and data source permissions described in one YAML or JSON document.
+//
+// Usage:
+//
+//	accessconfig export [-format yaml|json] [-o access.yaml]
+//	accessconfig plan -f access.yaml [-prune]
+//	accessconfig apply -f access.yaml [-prune]
+//
+// plan prints the changes apply would make without making them. apply makes them in one
+// transaction. With -prune, data sources and groups the document doesn't list are deleted.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/database"
+	"github.com/yourorg/querybase/internal/service"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("usage: accessconfig export|plan|apply [flags]")
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	file := flags.String("f", "", "access config document to plan or apply")
+	prune := flags.Bool("prune", false, "delete data sources and groups the document doesn't list")
+	format := flags.String("format", "yaml", "export format, yaml or json")
+	output := flags.String("o", "", "file to export to; standard output when empty")
+	flags.Parse(os.Args[2:])
+
+	// Load configuration
+	cfg, err := config.Load("./config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	keyring, err := service.NewKeyring(cfg.DataSourceEncryption())
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	// Connect to database
+	db, err := database.NewPostgresConnection(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to get database instance: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Credential references are validated against the configured secret providers
+	connectionManager := service.NewConnectionManager(cfg.DataSourcePool)
+	defer connectionManager.Close()
+	connectionManager.SetSecretResolver(service.NewSecretResolver(cfg.Secrets))
+	dataSourceService := service.NewDataSourceService(db, keyring)
+	dataSourceService.SetConnectionManager(connectionManager)
+	accessConfigService := service.NewAccessConfigService(db, dataSourceService)
+
+	ctx := context.Background()
+	switch command {
+	case "export":
+		accessConfig, err := accessConfigService.Export(ctx)
+		if err != nil {
+			log.Fatalf("Failed to export access config: %v", err)
+		}
+		var data []byte
+		switch *format {
+		case "yaml":
+			data, err = service.MarshalAccessConfigYAML(accessConfig)
+		case "json":
+			data, err = json.MarshalIndent(accessConfig, "", "  ")
+			data = append(data, '\n')
+		default:
+			log.Fatalf("-format must be yaml or json")
+		}
+		if err != nil {
+			log.Fatalf("Failed to export access config: %v", err)
+		}
+		if *output == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(*output, data, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", *output, err)
+		}
+
+	case "plan", "apply":
+		if *file == "" {
+			log.Fatalf("-f is required")
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *file, err)
+		}
+		accessConfig, err := service.ParseAccessConfig(data)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *file, err)
+		}
+
+		run := accessConfigService.Plan
+		if command == "apply" {
+			run = accessConfigService.Apply
+		}
+		plan, err := run(ctx, accessConfig, service.AccessConfigOptions{Prune: *prune})
+		if err != nil {
+			log.Fatalf("Failed to %s access config, nothing was changed: %v", command, err)
+		}
+		printPlan(plan)
+
+	default:
+		log.Fatalf("unknown command %q; use export, plan or apply", command)
+	}
+}
+
+// printPlan prints one line per change, like "~ datasource warehouse [max_result_rows]"
+func printPlan(plan *service.AccessConfigPlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes. The stored state matches the document.")
+		return
+	}
+	symbols := map[service.AccessConfigAction]string{
+		service.AccessConfigCreate: "+",
+		service.AccessConfigUpdate: "~",
+		service.AccessConfigDelete: "-",
+	}
+	for _, change := range plan.Changes {
+		line := fmt.Sprintf("%s %s %s", symbols[change.Action], change.Kind, change.Name)
+		if len(change.Fields) > 0 {
+			line += fmt.Sprintf(" %v", change.Fields)
+		}
+		fmt.Println(line)
+	}
+	if plan.Applied {
+		fmt.Printf("Applied %d changes.\n", len(plan.Changes))
+	} else {
+		fmt.Printf("%d changes to apply.\n", len(plan.Changes))
+	}
+}
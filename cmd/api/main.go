@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
 	"github.com/yourorg/querybase/internal/api/handlers"
 	"github.com/yourorg/querybase/internal/api/middleware"
 	"github.com/yourorg/querybase/internal/api/routes"
@@ -77,35 +79,74 @@ func main() {
 	// Initialize JWT manager
 	jwtManager := auth.NewJWTManager(cfg.JWT.Secret, cfg.JWT.ExpireHours, cfg.JWT.Issuer)
 
+	// Data source secrets are encrypted with keys of their own, not the JWT secret
+	if cfg.Encryption.Keys == "" {
+		log.Println("Warning: encryption.keys is not set. Data source secrets are encrypted with jwt.secret.")
+	}
+	keyring, err := service.NewKeyring(cfg.DataSourceEncryption())
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
 	// Initialize services
 	statsService := service.NewStatsService(db, redisClient)
 	blacklistService := service.NewTokenBlacklistService(redisClient)
 	auditService := service.NewAuditService(db)
-	queryService := service.NewQueryService(db, cfg.JWT.Secret, statsService, auditService)
+	queryService := service.NewQueryService(db, keyring, statsService, auditService)
 	approvalService := service.NewApprovalService(db, queryService, statsService)
-	dataSourceService := service.NewDataSourceService(db, cfg.JWT.Secret)
-	schemaService := service.NewSchemaService(db, cfg.JWT.Secret)
+	dataSourceService := service.NewDataSourceService(db, keyring)
+	schemaService := service.NewSchemaService(db, keyring)
+
+	// Share one connection pool per data source across services
+	connectionManager := service.NewConnectionManager(cfg.DataSourcePool)
+	defer connectionManager.Close()
+	connectionManager.SetSecretResolver(service.NewSecretResolver(cfg.Secrets))
+	queryService.SetConnectionManager(connectionManager)
+	queryService.SetRoleResultLimits(cfg.QueryLimits)
+	queryService.SetEnvironmentPolicies(cfg.Environments)
+	queryService.SetResultCache(service.NewResultCache(redisClient, cfg.ResultCache))
+	dataSourceService.SetConnectionManager(connectionManager)
+	dataSourceService.SetHealthHistory(cfg.HealthHistory)
+	schemaService.SetConnectionManager(connectionManager)
 
 	// Initialize WebSocket hub
 	wsHub := handlers.NewWebSocketHub()
 	go wsHub.Run()
 
+	// Async queries are queued for the worker, which reports completion over Redis
+	asyncQueue := asynq.NewClient(asynq.RedisClientOpt{
+		Addr:     cfg.Redis.GetRedisAddr(),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer asyncQueue.Close()
+	queryEvents := service.NewQueryEventBus(redisClient)
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, jwtManager, blacklistService)
 	queryHandler := handlers.NewQueryHandler(db, queryService)
+	queryHandler.SetAsyncExecution(asyncQueue, queryEvents)
 	approvalHandler := handlers.NewApprovalHandler(db, approvalService)
 	dataSourceHandler := handlers.NewDataSourceHandler(db, dataSourceService, queryService)
 	groupHandler := handlers.NewGroupHandler(db)
 	schemaHandler := handlers.NewSchemaHandler(db, schemaService)
 	webSocketHandler := handlers.NewWebSocketHandler(wsHub, schemaService)
+	webSocketHandler.SetQueryAuth(jwtManager, blacklistService, queryService)
 	statsHandler := handlers.NewStatsHandler(statsService)
+	scheduleHandler := handlers.NewScheduleHandler(db, service.NewScheduleService(db, queryService, service.NewNotificationService(db)))
 	multiQueryHandler := handlers.NewMultiQueryHandler(db, service.NewMultiQueryService(db, queryService, auditService, approvalService), queryService, approvalService)
+	accessConfigHandler := handlers.NewAccessConfigHandler(service.NewAccessConfigService(db, dataSourceService))
 
 	// Register WebSocket broadcast callback
 	statsService.SetStatsChangedCallback(func() {
 		webSocketHandler.BroadcastStatsChanged()
 	})
 
+	// Forward async query completion from workers to subscribed WebSocket clients
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+	go queryEvents.SubscribeQueryEvents(eventsCtx, webSocketHandler.BroadcastQueryEvent)
+
 	// Set Gin mode
 	gin.SetMode(cfg.Server.Mode)
 
@@ -136,7 +177,7 @@ func main() {
 	})
 
 	// Setup routes
-	routes.SetupRoutes(router, authHandler, queryHandler, approvalHandler, dataSourceHandler, groupHandler, schemaHandler, webSocketHandler, statsHandler, multiQueryHandler, jwtManager, blacklistService)
+	routes.SetupRoutes(router, authHandler, queryHandler, approvalHandler, dataSourceHandler, groupHandler, schemaHandler, webSocketHandler, statsHandler, multiQueryHandler, scheduleHandler, accessConfigHandler, jwtManager, blacklistService)
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
@@ -0,0 +1,48 @@
+// Command reencrypt re-encrypts every data source secret with the active encryption key.
+//
+// To rotate keys, add the new key to encryption.keys and make it encryption.active_key, restart the
+// server and the worker so they encrypt with it, then run this command. Once it is done, the old key
+// can be removed.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/database"
+	"github.com/yourorg/querybase/internal/service"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load("./config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Encryption.ActiveKey == "" {
+		log.Fatalf("encryption.active_key is not set; there is no key to re-encrypt with")
+	}
+
+	keyring, err := service.NewKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	// Connect to database
+	db, err := database.NewPostgresConnection(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to get database instance: %v", err)
+	}
+	defer sqlDB.Close()
+
+	result, err := service.ReencryptSecrets(context.Background(), db, keyring)
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt secrets, nothing was changed: %v", err)
+	}
+	log.Printf("Re-encrypted %d secrets of %d data sources with key %s", result.Secrets, result.DataSources, keyring.ActiveKeyID())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,11 +10,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 	"github.com/yourorg/querybase/internal/config"
 	"github.com/yourorg/querybase/internal/database"
 	"github.com/yourorg/querybase/internal/models"
 	"github.com/yourorg/querybase/internal/queue"
+	"github.com/yourorg/querybase/internal/service"
 	"gorm.io/gorm"
 )
 
@@ -38,6 +41,52 @@ func main() {
 
 	log.Println("Worker connected to database successfully")
 
+	// Data source secrets are encrypted with keys of their own, not the JWT secret
+	if cfg.Encryption.Keys == "" {
+		log.Println("Warning: encryption.keys is not set. Data source secrets are encrypted with jwt.secret.")
+	}
+	keyring, err := service.NewKeyring(cfg.DataSourceEncryption())
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	// Shared connection pools for data sources, reused across tasks
+	connectionManager := service.NewConnectionManager(cfg.DataSourcePool)
+	connectionManager.SetSecretResolver(service.NewSecretResolver(cfg.Secrets))
+
+	// Redis carries async query completion events to the API server and cancel requests back
+	redisClient, err := database.NewRedisConnection(&cfg.Redis)
+	if err != nil {
+		log.Printf("Warning: Failed to connect to Redis: %v. Async query events and cancellation are disabled.", err)
+	}
+	queryEvents := service.NewQueryEventBus(redisClient)
+
+	// Query service used by async query execution
+	queryService := service.NewQueryService(db, keyring, nil, service.NewAuditService(db))
+	queryService.SetConnectionManager(connectionManager)
+	queryService.SetRoleResultLimits(cfg.QueryLimits)
+	queryService.SetEnvironmentPolicies(cfg.Environments)
+	queryService.SetResultCache(service.NewResultCache(redisClient, cfg.ResultCache))
+
+	// Scheduled queries run as their owner and deliver results to notification channels
+	scheduleService := service.NewScheduleService(db, queryService, service.NewNotificationService(db))
+	scheduleService.SetDeliveryOptions(cfg.Schedules.AppURL, cfg.Schedules.MaxAttachmentBytes)
+	// Periodic schema syncs also probe data source health, recording it and the replica lag that decides where reads are routed
+	dataSourceService := service.NewDataSourceService(db, keyring)
+	dataSourceService.SetConnectionManager(connectionManager)
+	dataSourceService.SetHealthHistory(cfg.HealthHistory)
+
+	// Stored results are purged by the retention policy of their data source
+	retentionService := service.NewRetentionService(db, cfg.Retention)
+
+	// Cancel async queries running on this worker when the API asks for it
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	go queryEvents.SubscribeCancelRequests(eventsCtx, func(queryID uuid.UUID) {
+		if err := queryService.CancelQuery(eventsCtx, queryID); err == nil {
+			log.Printf("[Worker] Cancelled query %s", queryID)
+		}
+	})
+
 	// Create Redis connection for Asynq
 	redisAddr := fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
 
@@ -68,9 +117,17 @@ func main() {
 
 	// Query execution handler
 	mux.HandleFunc(queue.TypeExecuteQuery, func(ctx context.Context, t *asynq.Task) error {
+		ctx = context.WithValue(ctx, "query_service", queryService)
+		ctx = context.WithValue(ctx, "query_events", queryEvents)
 		return queue.HandleExecuteQuery(ctx, t)
 	})
 
+	// Scheduled query handler
+	mux.HandleFunc(queue.TypeRunScheduledQuery, func(ctx context.Context, t *asynq.Task) error {
+		ctx = context.WithValue(ctx, "schedule_service", scheduleService)
+		return queue.HandleRunScheduledQuery(ctx, t)
+	})
+
 	// Notification handler
 	mux.HandleFunc(queue.TypeSendNotification, func(ctx context.Context, t *asynq.Task) error {
 		return queue.HandleSendNotification(ctx, t)
@@ -78,14 +135,17 @@ func main() {
 
 	// Cleanup handler
 	mux.HandleFunc(queue.TypeCleanupOldResults, func(ctx context.Context, t *asynq.Task) error {
+		ctx = context.WithValue(ctx, "retention_service", retentionService)
 		return queue.HandleCleanupOldResults(ctx, t)
 	})
 
 	// Schema sync handler
 	mux.HandleFunc(queue.TypeSyncDataSourceSchema, func(ctx context.Context, t *asynq.Task) error {
-		// Inject DB and encryption key into context
+		// Inject DB and the keyring into context
 		ctx = context.WithValue(ctx, "db", db)
-		ctx = context.WithValue(ctx, "encryption_key", cfg.JWT.Secret)
+		ctx = context.WithValue(ctx, "keyring", keyring)
+		ctx = context.WithValue(ctx, "connection_manager", connectionManager)
+		ctx = context.WithValue(ctx, "datasource_service", dataSourceService)
 		return queue.HandleSyncDataSourceSchema(ctx, t)
 	})
 
@@ -112,6 +172,36 @@ func main() {
 		}
 	}()
 
+	// Start scheduled query poller
+	scheduleClient := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+	go func() {
+		pollInterval := cfg.Schedules.PollInterval
+		if pollInterval <= 0 {
+			pollInterval = time.Minute
+		}
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			enqueueDueSchedules(scheduleService, scheduleClient)
+		}
+	}()
+
+	// Start result retention scheduler
+	go func() {
+		interval := cfg.Retention.Interval
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		enqueueResultCleanup(scheduleClient, interval)
+		for range ticker.C {
+			enqueueResultCleanup(scheduleClient, interval)
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shutdown the worker
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -121,6 +211,12 @@ func main() {
 
 	// Graceful shutdown
 	srv.Shutdown()
+	scheduleClient.Close()
+	stopEvents()
+	connectionManager.Close()
+	if redisClient != nil {
+		redisClient.Close()
+	}
 
 	log.Println("Worker stopped")
 	os.Exit(0)
@@ -148,3 +244,33 @@ func enqueueSchemaSyncs(db *gorm.DB, redisAddr string) {
 		}
 	}
 }
+
+// enqueueDueSchedules claims the schedules that are due and enqueues a run for each
+func enqueueDueSchedules(scheduleService *service.ScheduleService, client *asynq.Client) {
+	schedules, err := scheduleService.ClaimDueSchedules(context.Background(), time.Now())
+	if err != nil {
+		log.Printf("[Schedules] Failed to claim due schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		if _, err := queue.EnqueueScheduledQuery(client, schedule.ID, *schedule.NextRunAt); err != nil {
+			log.Printf("[Schedules] Failed to enqueue run of schedule %s: %v", schedule.Name, err)
+		} else {
+			log.Printf("[Schedules] Enqueued run of schedule %s", schedule.Name)
+		}
+	}
+}
+
+// enqueueResultCleanup enqueues a cleanup of stored results, unless one is already pending
+func enqueueResultCleanup(client *asynq.Client, interval time.Duration) {
+	_, err := queue.EnqueueCleanupTask(client, interval)
+	switch {
+	case errors.Is(err, asynq.ErrDuplicateTask):
+		log.Println("[Retention] Cleanup already pending")
+	case err != nil:
+		log.Printf("[Retention] Failed to enqueue cleanup: %v", err)
+	default:
+		log.Println("[Retention] Enqueued cleanup of stored results")
+	}
+}
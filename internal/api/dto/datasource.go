@@ -3,12 +3,13 @@ package dto
 // CreateDataSourceRequest represents a create data source request
 type CreateDataSourceRequest struct {
 	Name             string                 `json:"name" binding:"required"`
-	Type             string                 `json:"type" binding:"required,oneof=postgresql mysql"`
-	Host             string                 `json:"host" binding:"required"`
-	Port             int                    `json:"port" binding:"required,min=1,max=65535"`
-	DatabaseName     string                 `json:"database_name" binding:"required"`
-	Username         string                 `json:"username" binding:"required"`
-	Password         string                 `json:"password" binding:"required"`
+	Type             string                 `json:"type" binding:"required"`
+	Host             string                 `json:"host" binding:"required_unless=Type sqlite"`
+	Port             int                    `json:"port" binding:"required_unless=Type sqlite,min=0,max=65535"`
+	DatabaseName     string                 `json:"database_name" binding:"required_unless=Type sqlite"`
+	Username         string                 `json:"username" binding:"required_unless=Type sqlite"`
+	Password         string                 `json:"password" binding:"required_unless=Type sqlite"`
+	FilePath         string                 `json:"file_path" binding:"required_if=Type sqlite"`
 	ConnectionParams map[string]interface{} `json:"connection_params"`
 }
 
@@ -18,6 +19,7 @@ type UpdateDataSourceRequest struct {
 	Host              string                 `json:"host"`
 	Port              *int                   `json:"port"`
 	DatabaseName      string                 `json:"database_name"`
+	FilePath          string                 `json:"file_path"`
 	Username          string                 `json:"username"`
 	Password          string                 `json:"password"`
 	ConnectionParams  map[string]interface{} `json:"connection_params"`
@@ -33,6 +35,7 @@ type DataSourceResponse struct {
 	Host         string `json:"host"`
 	Port         int    `json:"port"`
 	DatabaseName string `json:"database_name"`
+	FilePath     string `json:"file_path,omitempty"`
 	Username     string `json:"username"`
 	IsActive     bool   `json:"is_active"`
 	CreatedAt    string `json:"created_at"`
@@ -40,12 +43,13 @@ type DataSourceResponse struct {
 
 // TestDataSourceRequest represents a test connection request
 type TestDataSourceRequest struct {
-	Type             string                 `json:"type" binding:"required,oneof=postgresql mysql"`
-	Host             string                 `json:"host" binding:"required"`
-	Port             int                    `json:"port" binding:"required,min=1,max=65535"`
-	DatabaseName     string                 `json:"database_name" binding:"required"`
-	Username         string                 `json:"username" binding:"required"`
-	Password         string                 `json:"password" binding:"required"`
+	Type             string                 `json:"type" binding:"required"`
+	Host             string                 `json:"host" binding:"required_unless=Type sqlite"`
+	Port             int                    `json:"port" binding:"required_unless=Type sqlite,min=0,max=65535"`
+	DatabaseName     string                 `json:"database_name" binding:"required_unless=Type sqlite"`
+	Username         string                 `json:"username" binding:"required_unless=Type sqlite"`
+	Password         string                 `json:"password" binding:"required_unless=Type sqlite"`
+	FilePath         string                 `json:"file_path" binding:"required_if=Type sqlite"`
 	ConnectionParams map[string]interface{} `json:"connection_params"`
 }
 
@@ -68,12 +72,38 @@ const (
 
 // DataSourceHealthResponse represents a health check response
 type DataSourceHealthResponse struct {
-	DataSourceID string       `json:"data_source_id"`
-	Status       HealthStatus `json:"status"`
-	LatencyMs    int64        `json:"latency_ms"`
-	LastError    string       `json:"last_error,omitempty"`
-	LastChecked  string       `json:"last_checked"`
-	Message      string       `json:"message"`
+	DataSourceID string          `json:"data_source_id"`
+	Status       HealthStatus    `json:"status"`
+	LatencyMs    int64           `json:"latency_ms"`
+	LastError    string          `json:"last_error,omitempty"`
+	LastChecked  string          `json:"last_checked"`
+	Message      string          `json:"message"`
+	Replicas     []ReplicaHealth `json:"replicas,omitempty"`
+	// TLSVersion is the TLS version the connection negotiated, e.g. "TLSv1.3"
+	TLSVersion string `json:"tls_version,omitempty"`
+	// ConnectLatencyMs and PingLatencyMs split LatencyMs into opening a connection and a round trip
+	ConnectLatencyMs *int64 `json:"connect_latency_ms,omitempty"`
+	PingLatencyMs    *int64 `json:"ping_latency_ms,omitempty"`
+	ServerVersion    string `json:"server_version,omitempty"`
+}
+
+// ReplicaHealth is the health of a read replica. Routable replicas are within the lag limit of their
+// data source and serve reads.
+type ReplicaHealth struct {
+	ID         string       `json:"id"`
+	Host       string       `json:"host"`
+	Port       int          `json:"port"`
+	Status     HealthStatus `json:"status"`
+	LatencyMs  int64        `json:"latency_ms"`
+	LagSeconds *float64     `json:"lag_seconds"`
+	Routable   bool         `json:"routable"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// DataSourceReplicaRequest is a read replica endpoint in a create or update data source request
+type DataSourceReplicaRequest struct {
+	Host string `json:"host" binding:"required"`
+	Port int    `json:"port" binding:"required,min=1,max=65535"`
 }
 
 // TestAuditResponse represents the response from testing audit capability
@@ -6,6 +6,13 @@ type ExecuteQueryRequest struct {
 	QueryText    string `json:"query_text" binding:"required"`
 	Name         string `json:"name"`
 	Description  string `json:"description"`
+	Async        bool   `json:"async"` // queue a SELECT for the worker and return its query ID immediately
+	// Parameters holds values for :name placeholders, bound as driver parameters
+	Parameters map[string]interface{} `json:"parameters"`
+	// SavedQueryID applies the parameter declarations of a saved query to the values
+	SavedQueryID string `json:"saved_query_id"`
+	// Refresh runs a SELECT on the data source even when the result cache has it
+	Refresh bool `json:"refresh"`
 }
 
 // ExecuteQueryResponse represents a query execution response
@@ -14,26 +21,61 @@ type ExecuteQueryResponse struct {
 	Status           string                   `json:"status"`
 	RowCount         *int                     `json:"row_count"`
 	ExecutionTime    *int                     `json:"execution_time_ms"`
-	Data             []map[string]interface{} `json:"data"`
+	Data             []map[string]interface{} `json:"data"` // rows keyed by ColumnInfo.Key
+	Rows             [][]interface{}          `json:"rows"` // values in column order
 	Columns          []ColumnInfo             `json:"columns"`
 	ErrorMessage     string                   `json:"error_message,omitempty"`
 	RequiresApproval bool                     `json:"requires_approval"`
 	ApprovalID       string                   `json:"approval_id,omitempty"`
 	Validation       *ValidationResult        `json:"validation,omitempty"`
+	Truncated        bool                     `json:"truncated"`
+	Limit            *ResultLimitInfo         `json:"limit,omitempty"`
+	ResultsURL       string                   `json:"results_url,omitempty"`
+	Cached           bool                     `json:"cached"`               // served from the result cache
+	CachedAt         *string                  `json:"cached_at,omitempty"`  // when the cached rows were computed
+	CostGuard        *CostGuardInfo           `json:"cost_guard,omitempty"` // set when the planner estimate exceeded a cost guard threshold
+}
+
+// CostGuardInfo reports the planner estimate of a SELECT and the cost guard rule it exceeded
+type CostGuardInfo struct {
+	Rule          string   `json:"rule"`   // max_cost or max_rows
+	Action        string   `json:"action"` // block, warn or approval
+	Threshold     float64  `json:"threshold"`
+	EstimatedCost *float64 `json:"estimated_cost"` // null when the database reports no cost (MySQL)
+	EstimatedRows float64  `json:"estimated_rows"`
+	Message       string   `json:"message"`
+}
+
+// ResultLimitInfo describes the limit that truncated a SELECT result
+type ResultLimitInfo struct {
+	Type      string `json:"type"` // max_rows or max_bytes
+	Value     int64  `json:"value"`
+	Message   string `json:"message"`
+	ExportURL string `json:"export_url"`
 }
 
 // ColumnInfo represents column metadata
 type ColumnInfo struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
+	Key  string `json:"key,omitempty"` // unique key of the column in data objects, differs from Name for duplicates
 }
 
 // SaveQueryRequest represents a save query request
 type SaveQueryRequest struct {
-	DataSourceID string `json:"data_source_id" binding:"required"`
-	QueryText    string `json:"query_text" binding:"required"`
-	Name         string `json:"name"`
-	Description  string `json:"description"`
+	DataSourceID string                              `json:"data_source_id" binding:"required"`
+	QueryText    string                              `json:"query_text" binding:"required"`
+	Name         string                              `json:"name"`
+	Description  string                              `json:"description"`
+	Parameters   map[string]QueryParameterDefinition `json:"parameters"` // keyed by placeholder name without the colon
+}
+
+// QueryParameterDefinition declares a :name parameter of a saved query
+type QueryParameterDefinition struct {
+	Type          string        `json:"type"` // string, integer, number, boolean, date or timestamp
+	Default       interface{}   `json:"default,omitempty"`
+	AllowedValues []interface{} `json:"allowed_values,omitempty"`
+	Description   string        `json:"description,omitempty"`
 }
 
 // QueryListResponse represents a list of queries
@@ -75,27 +117,50 @@ type PaginationMeta struct {
 
 // PaginatedResultDTO represents paginated query results
 type PaginatedResultDTO struct {
-	QueryID       string                   `json:"query_id"`
-	RowCount      int                      `json:"row_count"`
-	Columns       []ColumnInfo             `json:"columns"`
-	Data          []map[string]interface{} `json:"data"`
-	Metadata      PaginationMeta           `json:"metadata"`
-	SortColumn    string                   `json:"sort_column,omitempty"`
-	SortDirection string                   `json:"sort_direction,omitempty"`
-}
-
-// ExportFormat represents the export format type
+	QueryID        string                   `json:"query_id"`
+	RowCount       int                      `json:"row_count"`
+	Columns        []ColumnInfo             `json:"columns"`
+	Data           []map[string]interface{} `json:"data"` // rows keyed by ColumnInfo.Key
+	Rows           [][]interface{}          `json:"rows"` // values in column order
+	Metadata       PaginationMeta           `json:"metadata"`
+	SortColumn     string                   `json:"sort_column,omitempty"`
+	SortDirection  string                   `json:"sort_direction,omitempty"`
+	Truncated      bool                     `json:"truncated"`
+	Limit          *ResultLimitInfo         `json:"limit,omitempty"`
+	Mode           string                   `json:"mode"`                      // stored or database
+	FallbackReason string                   `json:"fallback_reason,omitempty"` // why database mode used the stored result
+}
+
+// ExportFormat represents the export format type.
+// Any format registered with service.RegisterExporter is accepted.
 type ExportFormat string
 
 const (
-	ExportFormatCSV  ExportFormat = "csv"
-	ExportFormatJSON ExportFormat = "json"
+	ExportFormatCSV      ExportFormat = "csv"
+	ExportFormatJSON     ExportFormat = "json"
+	ExportFormatNDJSON   ExportFormat = "ndjson"
+	ExportFormatXLSX     ExportFormat = "xlsx"
+	ExportFormatParquet  ExportFormat = "parquet"
+	ExportFormatSQL      ExportFormat = "sql"
+	ExportFormatMarkdown ExportFormat = "markdown"
+)
+
+// ExportMode selects where exported rows come from
+type ExportMode string
+
+const (
+	// ExportModeStored exports the result stored by the last execution
+	ExportModeStored ExportMode = "stored"
+	// ExportModeStream re-runs the query and streams every row from the data source
+	ExportModeStream ExportMode = "stream"
 )
 
 // ExportQueryRequest represents a query export request
 type ExportQueryRequest struct {
-	QueryID string       `json:"query_id" binding:"required"`
-	Format  ExportFormat `json:"format" binding:"required,oneof=csv json"`
+	QueryID   string       `json:"query_id" binding:"required"`
+	Format    ExportFormat `json:"format" binding:"required"`
+	Mode      ExportMode   `json:"mode" binding:"omitempty,oneof=stored stream"`
+	TableName string       `json:"table_name"` // target table for sql exports
 }
 
 // ExportQueryResponse represents a query export response
@@ -0,0 +1,55 @@
+package dto
+
+// CreateScheduleRequest represents a request to run a saved query on a schedule
+type CreateScheduleRequest struct {
+	QueryID              string                 `json:"query_id" binding:"required"`
+	NotificationConfigID string                 `json:"notification_config_id" binding:"required"`
+	Name                 string                 `json:"name" binding:"required"`
+	CronExpression       string                 `json:"cron_expression" binding:"required"`
+	Timezone             string                 `json:"timezone"`
+	Parameters           map[string]interface{} `json:"parameters"`
+	Delivery             string                 `json:"delivery" binding:"omitempty,oneof=attachment link"`
+}
+
+// UpdateScheduleRequest represents a schedule update; omitted fields are unchanged
+type UpdateScheduleRequest struct {
+	NotificationConfigID *string                `json:"notification_config_id"`
+	Name                 *string                `json:"name"`
+	CronExpression       *string                `json:"cron_expression"`
+	Timezone             *string                `json:"timezone"`
+	Parameters           map[string]interface{} `json:"parameters"`
+	Delivery             *string                `json:"delivery" binding:"omitempty,oneof=attachment link"`
+	IsActive             *bool                  `json:"is_active"`
+}
+
+// ScheduleResponse represents a schedule
+type ScheduleResponse struct {
+	ID                   string                 `json:"id"`
+	QueryID              string                 `json:"query_id"`
+	UserID               string                 `json:"user_id"`
+	NotificationConfigID string                 `json:"notification_config_id"`
+	Name                 string                 `json:"name"`
+	CronExpression       string                 `json:"cron_expression"`
+	Timezone             string                 `json:"timezone"`
+	Parameters           map[string]interface{} `json:"parameters,omitempty"`
+	Delivery             string                 `json:"delivery"`
+	IsActive             bool                   `json:"is_active"`
+	DisabledReason       string                 `json:"disabled_reason,omitempty"`
+	NextRunAt            *string                `json:"next_run_at"`
+	LastRunAt            *string                `json:"last_run_at"`
+	CreatedAt            string                 `json:"created_at"`
+}
+
+// ScheduleRunResponse represents one run of a schedule
+type ScheduleRunResponse struct {
+	ID            string  `json:"id"`
+	QueryID       *string `json:"query_id"`
+	Status        string  `json:"status"`
+	RowCount      *int    `json:"row_count"`
+	Delivery      string  `json:"delivery,omitempty"`
+	DeliveryError string  `json:"delivery_error,omitempty"`
+	ErrorMessage  string  `json:"error_message,omitempty"`
+	ScheduledFor  string  `json:"scheduled_for"`
+	StartedAt     string  `json:"started_at"`
+	FinishedAt    *string `json:"finished_at"`
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourorg/querybase/internal/service"
+)
+
+// maxAccessConfigBytes caps the size of an uploaded access config document
+const maxAccessConfigBytes = 10 << 20
+
+// AccessConfigHandler handles the declarative access config endpoints
+type AccessConfigHandler struct {
+	accessConfigService *service.AccessConfigService
+}
+
+// NewAccessConfigHandler creates a new access config handler
+func NewAccessConfigHandler(accessConfigService *service.AccessConfigService) *AccessConfigHandler {
+	return &AccessConfigHandler{
+		accessConfigService: accessConfigService,
+	}
+}
+
+// ExportAccessConfig returns the data sources, groups, members and permissions as a document (admin only)
+func (h *AccessConfigHandler) ExportAccessConfig(c *gin.Context) {
+	config, err := h.accessConfigService.Export(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export access config"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "yaml") {
+	case "json":
+		c.JSON(http.StatusOK, config)
+	case "yaml":
+		data, err := service.MarshalAccessConfigYAML(config)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export access config"})
+			return
+		}
+		c.Data(http.StatusOK, "application/yaml", data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be yaml or json"})
+	}
+}
+
+// PlanAccessConfig returns the changes applying the uploaded document would make (admin only)
+func (h *AccessConfigHandler) PlanAccessConfig(c *gin.Context) {
+	h.reconcile(c, h.accessConfigService.Plan)
+}
+
+// ApplyAccessConfig reconciles the stored state with the uploaded document (admin only)
+func (h *AccessConfigHandler) ApplyAccessConfig(c *gin.Context) {
+	h.reconcile(c, h.accessConfigService.Apply)
+}
+
+// reconcile reads the document and options of a plan or apply request and runs it
+func (h *AccessConfigHandler) reconcile(c *gin.Context, run func(context.Context, *service.AccessConfig, service.AccessConfigOptions) (*service.AccessConfigPlan, error)) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAccessConfigBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read access config: " + err.Error()})
+		return
+	}
+	config, err := service.ParseAccessConfig(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var options service.AccessConfigOptions
+	if prune := c.Query("prune"); prune != "" {
+		if options.Prune, err = strconv.ParseBool(prune); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "prune must be true or false"})
+			return
+		}
+	}
+
+	plan, err := run(c, config, options)
+	if err != nil {
+		if isAccessConfigInputError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// isAccessConfigInputError reports whether a plan or apply failed on the document rather than the server
+func isAccessConfigInputError(err error) bool {
+	for _, target := range []error{
+		service.ErrInvalidAccessConfig,
+		service.ErrInvalidSessionInit,
+		service.ErrInvalidSQLitePath,
+		service.ErrInvalidTLSConfig,
+		service.ErrInvalidSSHConfig,
+		service.ErrInvalidCredentialSource,
+		service.ErrInvalidEnvironment,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
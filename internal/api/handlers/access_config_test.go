@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yourorg/querybase/internal/api/middleware"
+	"github.com/yourorg/querybase/internal/auth"
+	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/service"
+	testauth "github.com/yourorg/querybase/internal/testutils/auth"
+	"github.com/yourorg/querybase/internal/testutils/fixtures"
+)
+
+// setupAccessConfigTestDB creates a SQLite database file with the tables an access config covers.
+// Apply runs in a transaction, which a per-connection :memory: database wouldn't share with the test.
+func setupAccessConfigTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "querybase.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Group{},
+		&models.UserGroup{},
+		&models.DataSource{},
+		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+	)
+	require.NoError(t, err)
+
+	return db
+}
+
+// setupAccessConfigTestRouter serves the access config routes behind the admin check, as the API does
+func setupAccessConfigTestRouter(t *testing.T, db *gorm.DB) (*gin.Engine, *auth.JWTManager) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	jwtManager := auth.NewJWTManager(testauth.TestJWTSecret, testauth.TestJWTExpireTime, testauth.TestJWTIssuer)
+	dataSourceService := service.NewDataSourceService(db, service.NewLegacyKeyring("0123456789abcdef0123456789abcdef"))
+	accessConfigHandler := NewAccessConfigHandler(service.NewAccessConfigService(db, dataSourceService))
+
+	accessConfig := router.Group("/api/v1/config")
+	accessConfig.Use(middleware.AuthMiddleware(jwtManager, nil), middleware.RequireAdmin())
+	{
+		accessConfig.GET("/export", accessConfigHandler.ExportAccessConfig)
+		accessConfig.POST("/plan", accessConfigHandler.PlanAccessConfig)
+		accessConfig.POST("/apply", accessConfigHandler.ApplyAccessConfig)
+	}
+
+	return router, jwtManager
+}
+
+// testAccessConfigDocument is a SQLite data source and a group whose only member may read it
+func testAccessConfigDocument(t *testing.T, member *models.User) service.AccessConfig {
+	return service.AccessConfig{
+		Version: service.AccessConfigVersion,
+		DataSources: []service.DataSourceConfig{
+			{Name: "edge", Type: string(models.DataSourceTypeSQLite), FilePath: filepath.Join(t.TempDir(), "edge.db")},
+		},
+		Groups: []service.GroupConfig{
+			{
+				Name:        "analysts",
+				Members:     []string{member.Email},
+				Permissions: []service.GroupPermissionConfig{{DataSource: "edge", CanRead: true}},
+			},
+		},
+	}
+}
+
+// decodeAccessConfigPlan reads the plan of a plan or apply response
+func decodeAccessConfigPlan(t *testing.T, body []byte) service.AccessConfigPlan {
+	var plan service.AccessConfigPlan
+	require.NoError(t, json.Unmarshal(body, &plan))
+	return plan
+}
+
+func TestAccessConfigHandler_PlanApplyExport(t *testing.T) {
+	db := setupAccessConfigTestDB(t)
+	router, jwtManager := setupAccessConfigTestRouter(t, db)
+	token := tokenForUser(t, jwtManager, fixtures.CreateTestAdminUser(t, db))
+	member := fixtures.CreateTestRegularUser(t, db)
+	document := testAccessConfigDocument(t, member)
+
+	// Planning lists the changes and makes none
+	w := serveJSON(router, http.MethodPost, "/api/v1/config/plan", token, document)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	plan := decodeAccessConfigPlan(t, w.Body.Bytes())
+	assert.False(t, plan.Applied)
+	assert.Len(t, plan.Changes, 4)
+	var groups int64
+	db.Model(&models.Group{}).Where("name = ?", "analysts").Count(&groups)
+	assert.Zero(t, groups)
+
+	w = serveJSON(router, http.MethodPost, "/api/v1/config/apply", token, document)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	plan = decodeAccessConfigPlan(t, w.Body.Bytes())
+	assert.True(t, plan.Applied)
+	assert.Len(t, plan.Changes, 4)
+	db.Model(&models.Group{}).Where("name = ?", "analysts").Count(&groups)
+	assert.Equal(t, int64(1), groups)
+
+	// Once applied, the document matches the stored state
+	w = serveJSON(router, http.MethodPost, "/api/v1/config/plan", token, document)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, decodeAccessConfigPlan(t, w.Body.Bytes()).Changes)
+
+	w = serveJSON(router, http.MethodGet, "/api/v1/config/export?format=json", token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var exported service.AccessConfig
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exported))
+	require.Len(t, exported.DataSources, 1)
+	assert.Equal(t, "edge", exported.DataSources[0].Name)
+	require.Len(t, exported.Groups, 1)
+	assert.Equal(t, []string{member.Email}, exported.Groups[0].Members)
+
+	w = serveJSON(router, http.MethodGet, "/api/v1/config/export", token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "name: analysts")
+}
+
+func TestAccessConfigHandler_InvalidRequests_ReturnBadRequest(t *testing.T) {
+	db := setupAccessConfigTestDB(t)
+	router, jwtManager := setupAccessConfigTestRouter(t, db)
+	token := tokenForUser(t, jwtManager, fixtures.CreateTestAdminUser(t, db))
+	member := fixtures.CreateTestRegularUser(t, db)
+
+	wrongVersion := testAccessConfigDocument(t, member)
+	wrongVersion.Version = 2
+	unknownMember := testAccessConfigDocument(t, member)
+	unknownMember.Groups[0].Members = []string{"nobody@example.com"}
+	unknownDataSource := testAccessConfigDocument(t, member)
+	unknownDataSource.Groups[0].Permissions[0].DataSource = "missing"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"not a document", http.MethodPost, "/api/v1/config/plan", "version: [1"},
+		{"unsupported version", http.MethodPost, "/api/v1/config/plan", wrongVersion},
+		{"unknown member", http.MethodPost, "/api/v1/config/apply", unknownMember},
+		{"permission on unknown data source", http.MethodPost, "/api/v1/config/apply", unknownDataSource},
+		{"invalid prune", http.MethodPost, "/api/v1/config/apply?prune=maybe", testAccessConfigDocument(t, member)},
+		{"invalid export format", http.MethodGet, "/api/v1/config/export?format=xml", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveJSON(router, tt.method, tt.path, token, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+
+	// Failed applies change nothing
+	var dataSources int64
+	db.Model(&models.DataSource{}).Count(&dataSources)
+	assert.Zero(t, dataSources)
+}
+
+func TestAccessConfigHandler_RequiresAdmin(t *testing.T) {
+	db := setupAccessConfigTestDB(t)
+	router, jwtManager := setupAccessConfigTestRouter(t, db)
+	user := fixtures.CreateTestRegularUser(t, db)
+	document := testAccessConfigDocument(t, user)
+
+	for _, route := range []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodGet, "/api/v1/config/export", nil},
+		{http.MethodPost, "/api/v1/config/plan", document},
+		{http.MethodPost, "/api/v1/config/apply", document},
+	} {
+		w := serveJSON(router, route.method, route.path, tokenForUser(t, jwtManager, user), route.body)
+		assert.Equal(t, http.StatusForbidden, w.Code, route.path)
+
+		w = serveJSON(router, route.method, route.path, "", route.body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, route.path)
+	}
+
+	var dataSources int64
+	db.Model(&models.DataSource{}).Count(&dataSources)
+	assert.Zero(t, dataSources)
+}
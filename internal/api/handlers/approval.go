@@ -383,6 +383,10 @@ func (h *ApprovalHandler) StartTransaction(c *gin.Context) {
 
 	// Start transaction with audit mode
 	transaction, err := h.approvalService.StartTransaction(c, approvalID, userID, auditMode)
+	if errors.Is(err, service.ErrSelectApprovalHasNoTransaction) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("[StartTransaction] ERROR approvalID=%s userID=%s: %v", approvalID, userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
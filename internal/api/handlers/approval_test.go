@@ -130,6 +130,7 @@ func setupApprovalTestDB(t *testing.T) *gorm.DB {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
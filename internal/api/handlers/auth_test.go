@@ -33,6 +33,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.Group{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -40,6 +41,8 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.ApprovalReview{},
 		&models.NotificationConfig{},
 		&models.Notification{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
 	)
 	require.NoError(t, err)
 
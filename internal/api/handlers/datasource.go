@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -36,13 +37,44 @@ func NewDataSourceHandler(db *gorm.DB, dataSourceService *service.DataSourceServ
 // CreateDataSource creates a new data source (admin only)
 func (h *DataSourceHandler) CreateDataSource(c *gin.Context) {
 	var req struct {
-		Name         string `json:"name" binding:"required"`
-		Type         string `json:"type" binding:"required,oneof=postgresql mysql"`
-		Host         string `json:"host" binding:"required"`
-		Port         int    `json:"port" binding:"required,min=1,max=65535"`
-		DatabaseName string `json:"database_name" binding:"required"`
-		Username     string `json:"username" binding:"required"`
-		Password     string `json:"password" binding:"required"`
+		Name                    string                         `json:"name" binding:"required"`
+		Type                    string                         `json:"type" binding:"required"`
+		Host                    string                         `json:"host" binding:"required_unless=Type sqlite"`
+		Port                    int                            `json:"port" binding:"required_unless=Type sqlite,min=0,max=65535"`
+		DatabaseName            string                         `json:"database_name" binding:"required_unless=Type sqlite"`
+		Username                string                         `json:"username" binding:"required_unless=Type sqlite"`
+		Password                string                         `json:"password"`
+		FilePath                string                         `json:"file_path" binding:"required_if=Type sqlite"`
+		Environment             string                         `json:"environment"`
+		StatementTimeoutSeconds *int                           `json:"statement_timeout_seconds" binding:"omitempty,min=0,max=86400"`
+		MaxResultRows           *int                           `json:"max_result_rows" binding:"omitempty,min=0"`
+		MaxResultBytes          *int64                         `json:"max_result_bytes" binding:"omitempty,min=0"`
+		ResultMaxAgeHours       *int                           `json:"result_max_age_hours" binding:"omitempty,min=0"`
+		ResultMaxTotalBytes     *int64                         `json:"result_max_total_bytes" binding:"omitempty,min=0"`
+		ResultKeepLastPerUser   *int                           `json:"result_keep_last_per_user" binding:"omitempty,min=0"`
+		ResultCacheTTLSeconds   int                            `json:"result_cache_ttl_seconds" binding:"omitempty,min=0,max=86400"`
+		CostGuardMaxCost        float64                        `json:"cost_guard_max_cost" binding:"omitempty,min=0"`
+		CostGuardMaxRows        int64                          `json:"cost_guard_max_rows" binding:"omitempty,min=0"`
+		CostGuardAction         string                         `json:"cost_guard_action" binding:"omitempty,oneof=block warn approval"`
+		Replicas                []dto.DataSourceReplicaRequest `json:"replicas" binding:"omitempty,dive"`
+		MaxReplicaLagSeconds    *int                           `json:"max_replica_lag_seconds" binding:"omitempty,min=0"`
+		SessionInitStatements   []string                       `json:"session_init_statements"`
+		// TLS settings; the PEM-encoded certificates and key are stored encrypted and never returned
+		TLSMode       string `json:"tls_mode" binding:"omitempty,oneof=disable require verify-ca verify-full"`
+		TLSServerName string `json:"tls_server_name"`
+		TLSCACert     string `json:"tls_ca_cert"`
+		TLSClientCert string `json:"tls_client_cert"`
+		TLSClientKey  string `json:"tls_client_key"`
+		// SSH tunnel through a bastion; the private key and password are stored encrypted and never returned
+		SSHHost       string `json:"ssh_host"`
+		SSHPort       int    `json:"ssh_port" binding:"omitempty,min=1,max=65535"`
+		SSHUser       string `json:"ssh_user"`
+		SSHPrivateKey string `json:"ssh_private_key"`
+		SSHPassword   string `json:"ssh_password"`
+		SSHKnownHosts string `json:"ssh_known_hosts"`
+		// Where the password is read from; other sources than encrypted name a secret in credential_ref
+		CredentialSource string `json:"credential_source" binding:"omitempty,oneof=encrypted env file http"`
+		CredentialRef    string `json:"credential_ref"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -50,21 +82,57 @@ func (h *DataSourceHandler) CreateDataSource(c *gin.Context) {
 		return
 	}
 
+	// Any type with a registered driver can be created
+	if _, err := service.LookupDataSourceDriver(models.DataSourceType(req.Type)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	input := &service.CreateDataSourceInput{
-		Name:         req.Name,
-		Type:         req.Type,
-		Host:         req.Host,
-		Port:         req.Port,
-		DatabaseName: req.DatabaseName,
-		Username:     req.Username,
-		Password:     req.Password,
+		Name:                    req.Name,
+		Type:                    req.Type,
+		Host:                    req.Host,
+		Port:                    req.Port,
+		DatabaseName:            req.DatabaseName,
+		Username:                req.Username,
+		Password:                req.Password,
+		FilePath:                req.FilePath,
+		Environment:             req.Environment,
+		StatementTimeoutSeconds: req.StatementTimeoutSeconds,
+		MaxResultRows:           req.MaxResultRows,
+		MaxResultBytes:          req.MaxResultBytes,
+		ResultMaxAgeHours:       req.ResultMaxAgeHours,
+		ResultMaxTotalBytes:     req.ResultMaxTotalBytes,
+		ResultKeepLastPerUser:   req.ResultKeepLastPerUser,
+		ResultCacheTTLSeconds:   req.ResultCacheTTLSeconds,
+		CostGuardMaxCost:        req.CostGuardMaxCost,
+		CostGuardMaxRows:        req.CostGuardMaxRows,
+		CostGuardAction:         req.CostGuardAction,
+		Replicas:                replicaInputs(req.Replicas),
+		MaxReplicaLagSeconds:    req.MaxReplicaLagSeconds,
+		SessionInitStatements:   req.SessionInitStatements,
+		TLSMode:                 req.TLSMode,
+		TLSServerName:           req.TLSServerName,
+		TLSCACert:               req.TLSCACert,
+		TLSClientCert:           req.TLSClientCert,
+		TLSClientKey:            req.TLSClientKey,
+		SSHHost:                 req.SSHHost,
+		SSHPort:                 req.SSHPort,
+		SSHUser:                 req.SSHUser,
+		SSHPrivateKey:           req.SSHPrivateKey,
+		SSHPassword:             req.SSHPassword,
+		SSHKnownHosts:           req.SSHKnownHosts,
+		CredentialSource:        req.CredentialSource,
+		CredentialRef:           req.CredentialRef,
 	}
 
 	dataSource, err := h.dataSourceService.CreateDataSource(c, input)
 	if err != nil {
 		// Return detailed error message to help users troubleshoot
 		errorMsg := err.Error()
-		if strings.Contains(errorMsg, "duplicate key") || strings.Contains(errorMsg, "already exists") {
+		if errors.Is(err, service.ErrInvalidSessionInit) || errors.Is(err, service.ErrInvalidSQLitePath) || errors.Is(err, service.ErrInvalidTLSConfig) || errors.Is(err, service.ErrInvalidSSHConfig) || errors.Is(err, service.ErrInvalidCredentialSource) || errors.Is(err, service.ErrInvalidEnvironment) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errorMsg})
+		} else if strings.Contains(errorMsg, "duplicate key") || strings.Contains(errorMsg, "already exists") {
 			c.JSON(http.StatusConflict, gin.H{"error": "A data source with this name already exists"})
 		} else if strings.Contains(errorMsg, "encrypt") {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt database password. Please contact administrator."})
@@ -75,15 +143,42 @@ func (h *DataSourceHandler) CreateDataSource(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"id":         dataSource.ID.String(),
-		"name":       dataSource.Name,
-		"type":       string(dataSource.Type),
-		"host":       dataSource.Host,
-		"port":       dataSource.Port,
-		"database":   dataSource.GetDatabase(),
-		"username":   dataSource.Username,
-		"is_active":  dataSource.IsActive,
-		"created_at": dataSource.CreatedAt,
+		"id":                        dataSource.ID.String(),
+		"name":                      dataSource.Name,
+		"type":                      string(dataSource.Type),
+		"environment":               dataSource.Environment,
+		"host":                      dataSource.Host,
+		"port":                      dataSource.Port,
+		"database":                  dataSource.GetDatabase(),
+		"file_path":                 dataSource.FilePath,
+		"username":                  dataSource.Username,
+		"is_active":                 dataSource.IsActive,
+		"created_at":                dataSource.CreatedAt,
+		"statement_timeout_seconds": dataSource.StatementTimeoutSeconds,
+		"max_result_rows":           dataSource.MaxResultRows,
+		"max_result_bytes":          dataSource.MaxResultBytes,
+		"result_max_age_hours":      dataSource.ResultMaxAgeHours,
+		"result_max_total_bytes":    dataSource.ResultMaxTotalBytes,
+		"result_keep_last_per_user": dataSource.ResultKeepLastPerUser,
+		"result_cache_ttl_seconds":  dataSource.ResultCacheTTLSeconds,
+		"cost_guard_max_cost":       dataSource.CostGuardMaxCost,
+		"cost_guard_max_rows":       dataSource.CostGuardMaxRows,
+		"cost_guard_action":         dataSource.CostGuardAction,
+		"max_replica_lag_seconds":   dataSource.MaxReplicaLagSeconds,
+		"replicas":                  dataSource.Replicas,
+		"session_init_statements":   sessionInitStatements(dataSource),
+		"tls_mode":                  dataSource.TLSMode,
+		"tls_server_name":           dataSource.TLSServerName,
+		"has_tls_ca_cert":           dataSource.EncryptedTLSCACert != "",
+		"has_tls_client_cert":       dataSource.EncryptedTLSClientCert != "",
+		"ssh_host":                  dataSource.SSHHost,
+		"ssh_port":                  dataSource.SSHPort,
+		"ssh_user":                  dataSource.SSHUser,
+		"ssh_known_hosts":           dataSource.SSHKnownHosts,
+		"has_ssh_private_key":       dataSource.EncryptedSSHPrivateKey != "",
+		"has_ssh_password":          dataSource.EncryptedSSHPassword != "",
+		"credential_source":         dataSource.CredentialSource,
+		"credential_ref":            dataSource.CredentialRef,
 	})
 }
 
@@ -118,16 +213,43 @@ func (h *DataSourceHandler) ListDataSources(c *gin.Context) {
 		}
 
 		response[i] = gin.H{
-			"id":          ds.ID.String(),
-			"name":        ds.Name,
-			"type":        string(ds.Type),
-			"host":        ds.Host,
-			"port":        ds.Port,
-			"database":    ds.GetDatabase(),
-			"username":    ds.Username,
-			"is_active":   ds.IsActive,
-			"created_at":  ds.CreatedAt,
-			"permissions": perms,
+			"id":                        ds.ID.String(),
+			"name":                      ds.Name,
+			"type":                      string(ds.Type),
+			"environment":               ds.Environment,
+			"host":                      ds.Host,
+			"port":                      ds.Port,
+			"database":                  ds.GetDatabase(),
+			"file_path":                 ds.FilePath,
+			"username":                  ds.Username,
+			"is_active":                 ds.IsActive,
+			"created_at":                ds.CreatedAt,
+			"statement_timeout_seconds": ds.StatementTimeoutSeconds,
+			"max_result_rows":           ds.MaxResultRows,
+			"max_result_bytes":          ds.MaxResultBytes,
+			"result_max_age_hours":      ds.ResultMaxAgeHours,
+			"result_max_total_bytes":    ds.ResultMaxTotalBytes,
+			"result_keep_last_per_user": ds.ResultKeepLastPerUser,
+			"result_cache_ttl_seconds":  ds.ResultCacheTTLSeconds,
+			"cost_guard_max_cost":       ds.CostGuardMaxCost,
+			"cost_guard_max_rows":       ds.CostGuardMaxRows,
+			"cost_guard_action":         ds.CostGuardAction,
+			"max_replica_lag_seconds":   ds.MaxReplicaLagSeconds,
+			"replicas":                  ds.Replicas,
+			"session_init_statements":   sessionInitStatements(&ds),
+			"tls_mode":                  ds.TLSMode,
+			"tls_server_name":           ds.TLSServerName,
+			"has_tls_ca_cert":           ds.EncryptedTLSCACert != "",
+			"has_tls_client_cert":       ds.EncryptedTLSClientCert != "",
+			"ssh_host":                  ds.SSHHost,
+			"ssh_port":                  ds.SSHPort,
+			"ssh_user":                  ds.SSHUser,
+			"ssh_known_hosts":           ds.SSHKnownHosts,
+			"has_ssh_private_key":       ds.EncryptedSSHPrivateKey != "",
+			"has_ssh_password":          ds.EncryptedSSHPassword != "",
+			"credential_source":         ds.CredentialSource,
+			"credential_ref":            ds.CredentialRef,
+			"permissions":               perms,
 		}
 	}
 
@@ -168,17 +290,44 @@ func (h *DataSourceHandler) GetDataSource(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":          dataSource.ID.String(),
-		"name":        dataSource.Name,
-		"type":        string(dataSource.Type),
-		"host":        dataSource.Host,
-		"port":        dataSource.Port,
-		"database":    dataSource.GetDatabase(),
-		"username":    dataSource.Username,
-		"is_active":   dataSource.IsActive,
-		"created_at":  dataSource.CreatedAt,
-		"updated_at":  dataSource.UpdatedAt,
-		"permissions": perms,
+		"id":                        dataSource.ID.String(),
+		"name":                      dataSource.Name,
+		"type":                      string(dataSource.Type),
+		"environment":               dataSource.Environment,
+		"host":                      dataSource.Host,
+		"port":                      dataSource.Port,
+		"database":                  dataSource.GetDatabase(),
+		"file_path":                 dataSource.FilePath,
+		"username":                  dataSource.Username,
+		"is_active":                 dataSource.IsActive,
+		"created_at":                dataSource.CreatedAt,
+		"updated_at":                dataSource.UpdatedAt,
+		"statement_timeout_seconds": dataSource.StatementTimeoutSeconds,
+		"max_result_rows":           dataSource.MaxResultRows,
+		"max_result_bytes":          dataSource.MaxResultBytes,
+		"result_max_age_hours":      dataSource.ResultMaxAgeHours,
+		"result_max_total_bytes":    dataSource.ResultMaxTotalBytes,
+		"result_keep_last_per_user": dataSource.ResultKeepLastPerUser,
+		"result_cache_ttl_seconds":  dataSource.ResultCacheTTLSeconds,
+		"cost_guard_max_cost":       dataSource.CostGuardMaxCost,
+		"cost_guard_max_rows":       dataSource.CostGuardMaxRows,
+		"cost_guard_action":         dataSource.CostGuardAction,
+		"max_replica_lag_seconds":   dataSource.MaxReplicaLagSeconds,
+		"replicas":                  dataSource.Replicas,
+		"session_init_statements":   sessionInitStatements(dataSource),
+		"tls_mode":                  dataSource.TLSMode,
+		"tls_server_name":           dataSource.TLSServerName,
+		"has_tls_ca_cert":           dataSource.EncryptedTLSCACert != "",
+		"has_tls_client_cert":       dataSource.EncryptedTLSClientCert != "",
+		"ssh_host":                  dataSource.SSHHost,
+		"ssh_port":                  dataSource.SSHPort,
+		"ssh_user":                  dataSource.SSHUser,
+		"ssh_known_hosts":           dataSource.SSHKnownHosts,
+		"has_ssh_private_key":       dataSource.EncryptedSSHPrivateKey != "",
+		"has_ssh_password":          dataSource.EncryptedSSHPassword != "",
+		"credential_source":         dataSource.CredentialSource,
+		"credential_ref":            dataSource.CredentialRef,
+		"permissions":               perms,
 	})
 }
 
@@ -187,14 +336,48 @@ func (h *DataSourceHandler) UpdateDataSource(c *gin.Context) {
 	dataSourceID := c.Param("id")
 
 	var req struct {
-		Name         string `json:"name"`
-		Type         string `json:"type" binding:"omitempty,oneof=postgresql mysql"`
-		Host         string `json:"host"`
-		Port         int    `json:"port" binding:"omitempty,min=1,max=65535"`
-		DatabaseName string `json:"database_name"`
-		Username     string `json:"username"`
-		Password     string `json:"password"`
-		IsActive     *bool  `json:"is_active"`
+		Name                    string `json:"name"`
+		Type                    string `json:"type"`
+		Host                    string `json:"host"`
+		Port                    int    `json:"port" binding:"omitempty,min=1,max=65535"`
+		DatabaseName            string `json:"database_name"`
+		Username                string `json:"username"`
+		Password                string `json:"password"`
+		FilePath                string `json:"file_path"`
+		Environment             string `json:"environment"`
+		IsActive                *bool  `json:"is_active"`
+		StatementTimeoutSeconds *int   `json:"statement_timeout_seconds" binding:"omitempty,min=0,max=86400"`
+		MaxResultRows           *int   `json:"max_result_rows" binding:"omitempty,min=0"`
+		MaxResultBytes          *int64 `json:"max_result_bytes" binding:"omitempty,min=0"`
+		// Retention overrides; -1 clears the override so the global setting applies again
+		ResultMaxAgeHours     *int     `json:"result_max_age_hours" binding:"omitempty,min=-1"`
+		ResultMaxTotalBytes   *int64   `json:"result_max_total_bytes" binding:"omitempty,min=-1"`
+		ResultKeepLastPerUser *int     `json:"result_keep_last_per_user" binding:"omitempty,min=-1"`
+		ResultCacheTTLSeconds *int     `json:"result_cache_ttl_seconds" binding:"omitempty,min=0,max=86400"`
+		CostGuardMaxCost      *float64 `json:"cost_guard_max_cost" binding:"omitempty,min=0"`
+		CostGuardMaxRows      *int64   `json:"cost_guard_max_rows" binding:"omitempty,min=0"`
+		CostGuardAction       string   `json:"cost_guard_action" binding:"omitempty,oneof=block warn approval"`
+		// Replicas replaces the replica list when present; [] removes all replicas
+		Replicas             *[]dto.DataSourceReplicaRequest `json:"replicas" binding:"omitempty,dive"`
+		MaxReplicaLagSeconds *int                            `json:"max_replica_lag_seconds" binding:"omitempty,min=0"`
+		// SessionInitStatements replaces the session init statements when present; [] removes them
+		SessionInitStatements *[]string `json:"session_init_statements"`
+		// TLS settings; an empty server name, certificate or key removes it
+		TLSMode       string  `json:"tls_mode" binding:"omitempty,oneof=disable require verify-ca verify-full"`
+		TLSServerName *string `json:"tls_server_name"`
+		TLSCACert     *string `json:"tls_ca_cert"`
+		TLSClientCert *string `json:"tls_client_cert"`
+		TLSClientKey  *string `json:"tls_client_key"`
+		// SSH tunnel settings; an empty ssh_host connects directly again
+		SSHHost       *string `json:"ssh_host"`
+		SSHPort       *int    `json:"ssh_port" binding:"omitempty,min=1,max=65535"`
+		SSHUser       *string `json:"ssh_user"`
+		SSHPrivateKey *string `json:"ssh_private_key"`
+		SSHPassword   *string `json:"ssh_password"`
+		SSHKnownHosts *string `json:"ssh_known_hosts"`
+		// Credential source of the password; switching back to encrypted needs a password
+		CredentialSource string  `json:"credential_source" binding:"omitempty,oneof=encrypted env file http"`
+		CredentialRef    *string `json:"credential_ref"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -202,21 +385,61 @@ func (h *DataSourceHandler) UpdateDataSource(c *gin.Context) {
 		return
 	}
 
+	if req.Type != "" {
+		if _, err := service.LookupDataSourceDriver(models.DataSourceType(req.Type)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	input := &service.UpdateDataSourceInput{
-		Name:         req.Name,
-		Type:         req.Type,
-		Host:         req.Host,
-		Port:         req.Port,
-		DatabaseName: req.DatabaseName,
-		Username:     req.Username,
-		Password:     req.Password,
-		IsActive:     req.IsActive,
+		Name:                    req.Name,
+		Type:                    req.Type,
+		Host:                    req.Host,
+		Port:                    req.Port,
+		DatabaseName:            req.DatabaseName,
+		Username:                req.Username,
+		Password:                req.Password,
+		FilePath:                req.FilePath,
+		Environment:             req.Environment,
+		IsActive:                req.IsActive,
+		StatementTimeoutSeconds: req.StatementTimeoutSeconds,
+		MaxResultRows:           req.MaxResultRows,
+		MaxResultBytes:          req.MaxResultBytes,
+		ResultMaxAgeHours:       req.ResultMaxAgeHours,
+		ResultMaxTotalBytes:     req.ResultMaxTotalBytes,
+		ResultKeepLastPerUser:   req.ResultKeepLastPerUser,
+		ResultCacheTTLSeconds:   req.ResultCacheTTLSeconds,
+		CostGuardMaxCost:        req.CostGuardMaxCost,
+		CostGuardMaxRows:        req.CostGuardMaxRows,
+		CostGuardAction:         req.CostGuardAction,
+		MaxReplicaLagSeconds:    req.MaxReplicaLagSeconds,
+		SessionInitStatements:   req.SessionInitStatements,
+		TLSMode:                 req.TLSMode,
+		TLSServerName:           req.TLSServerName,
+		TLSCACert:               req.TLSCACert,
+		TLSClientCert:           req.TLSClientCert,
+		TLSClientKey:            req.TLSClientKey,
+		SSHHost:                 req.SSHHost,
+		SSHPort:                 req.SSHPort,
+		SSHUser:                 req.SSHUser,
+		SSHPrivateKey:           req.SSHPrivateKey,
+		SSHPassword:             req.SSHPassword,
+		SSHKnownHosts:           req.SSHKnownHosts,
+		CredentialSource:        req.CredentialSource,
+		CredentialRef:           req.CredentialRef,
+	}
+	if req.Replicas != nil {
+		replicas := replicaInputs(*req.Replicas)
+		input.Replicas = &replicas
 	}
 
 	dataSource, err := h.dataSourceService.UpdateDataSource(c, dataSourceID, input)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Data source not found"})
+		} else if errors.Is(err, service.ErrInvalidSessionInit) || errors.Is(err, service.ErrInvalidSQLitePath) || errors.Is(err, service.ErrInvalidTLSConfig) || errors.Is(err, service.ErrInvalidSSHConfig) || errors.Is(err, service.ErrInvalidCredentialSource) || errors.Is(err, service.ErrInvalidEnvironment) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		} else {
 			// Return detailed error message
 			errorMsg := err.Error()
@@ -230,18 +453,63 @@ func (h *DataSourceHandler) UpdateDataSource(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":         dataSource.ID.String(),
-		"name":       dataSource.Name,
-		"type":       string(dataSource.Type),
-		"host":       dataSource.Host,
-		"port":       dataSource.Port,
-		"database":   dataSource.GetDatabase(),
-		"username":   dataSource.Username,
-		"is_active":  dataSource.IsActive,
-		"updated_at": dataSource.UpdatedAt,
+		"id":                        dataSource.ID.String(),
+		"name":                      dataSource.Name,
+		"type":                      string(dataSource.Type),
+		"environment":               dataSource.Environment,
+		"host":                      dataSource.Host,
+		"port":                      dataSource.Port,
+		"database":                  dataSource.GetDatabase(),
+		"file_path":                 dataSource.FilePath,
+		"username":                  dataSource.Username,
+		"is_active":                 dataSource.IsActive,
+		"updated_at":                dataSource.UpdatedAt,
+		"statement_timeout_seconds": dataSource.StatementTimeoutSeconds,
+		"max_result_rows":           dataSource.MaxResultRows,
+		"max_result_bytes":          dataSource.MaxResultBytes,
+		"result_max_age_hours":      dataSource.ResultMaxAgeHours,
+		"result_max_total_bytes":    dataSource.ResultMaxTotalBytes,
+		"result_keep_last_per_user": dataSource.ResultKeepLastPerUser,
+		"result_cache_ttl_seconds":  dataSource.ResultCacheTTLSeconds,
+		"cost_guard_max_cost":       dataSource.CostGuardMaxCost,
+		"cost_guard_max_rows":       dataSource.CostGuardMaxRows,
+		"cost_guard_action":         dataSource.CostGuardAction,
+		"max_replica_lag_seconds":   dataSource.MaxReplicaLagSeconds,
+		"replicas":                  dataSource.Replicas,
+		"session_init_statements":   sessionInitStatements(dataSource),
+		"tls_mode":                  dataSource.TLSMode,
+		"tls_server_name":           dataSource.TLSServerName,
+		"has_tls_ca_cert":           dataSource.EncryptedTLSCACert != "",
+		"has_tls_client_cert":       dataSource.EncryptedTLSClientCert != "",
+		"ssh_host":                  dataSource.SSHHost,
+		"ssh_port":                  dataSource.SSHPort,
+		"ssh_user":                  dataSource.SSHUser,
+		"ssh_known_hosts":           dataSource.SSHKnownHosts,
+		"has_ssh_private_key":       dataSource.EncryptedSSHPrivateKey != "",
+		"has_ssh_password":          dataSource.EncryptedSSHPassword != "",
+		"credential_source":         dataSource.CredentialSource,
+		"credential_ref":            dataSource.CredentialRef,
 	})
 }
 
+// sessionInitStatements returns the session init statements of a data source for a response
+func sessionInitStatements(dataSource *models.DataSource) []string {
+	statements, err := service.DecodeSessionInitStatements(dataSource)
+	if err != nil {
+		log.Printf("[DataSource] Invalid session init statements on %s: %v", dataSource.Name, err)
+	}
+	return statements
+}
+
+// replicaInputs converts the replica endpoints of a request
+func replicaInputs(replicas []dto.DataSourceReplicaRequest) []service.ReplicaInput {
+	inputs := make([]service.ReplicaInput, len(replicas))
+	for i, replica := range replicas {
+		inputs[i] = service.ReplicaInput{Host: replica.Host, Port: replica.Port}
+	}
+	return inputs
+}
+
 // DeleteDataSource deletes a data source (admin only)
 func (h *DataSourceHandler) DeleteDataSource(c *gin.Context) {
 	dataSourceID := c.Param("id")
@@ -263,28 +531,7 @@ func (h *DataSourceHandler) TestConnection(c *gin.Context) {
 	dataSourceID := c.Param("id")
 
 	if err := h.dataSourceService.TestConnection(c, dataSourceID); err != nil {
-		// Provide detailed connection error messages
-		errorMsg := err.Error()
-		var userMessage string
-
-		if strings.Contains(errorMsg, "connection refused") {
-			userMessage = "Connection refused. Please verify the host and port are correct and the database server is running."
-		} else if strings.Contains(errorMsg, "timeout") {
-			userMessage = "Connection timeout. Please check network connectivity and firewall settings."
-		} else if strings.Contains(errorMsg, "authentication failed") || strings.Contains(errorMsg, "Access denied") {
-			userMessage = "Authentication failed. Please verify the username and password are correct."
-		} else if strings.Contains(errorMsg, "database") && strings.Contains(errorMsg, "does not exist") {
-			userMessage = "Database not found. Please verify the database name is correct."
-		} else if strings.Contains(errorMsg, "no such host") || strings.Contains(errorMsg, "unknown host") {
-			userMessage = "Host not found. Please verify the hostname or IP address."
-		} else {
-			userMessage = fmt.Sprintf("Connection failed: %s", errorMsg)
-		}
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   userMessage,
-		})
+		c.JSON(http.StatusBadRequest, connectionTestFailure(err))
 		return
 	}
 
@@ -294,6 +541,48 @@ func (h *DataSourceHandler) TestConnection(c *gin.Context) {
 	})
 }
 
+// connectionTestFailure describes a failed connection test. The stage tells whether reading the
+// password, the SSH hop to the bastion or the database itself failed.
+func connectionTestFailure(err error) gin.H {
+	errorMsg := err.Error()
+	if errors.Is(err, service.ErrSSHTunnel) || errors.Is(err, service.ErrInvalidSSHConfig) {
+		return gin.H{
+			"success": false,
+			"stage":   "ssh_tunnel",
+			"error":   fmt.Sprintf("SSH tunnel failed. Please verify the bastion host, SSH credentials and pinned host key: %s", errorMsg),
+		}
+	}
+	if errors.Is(err, service.ErrSecretUnavailable) || errors.Is(err, service.ErrInvalidCredentialSource) {
+		return gin.H{
+			"success": false,
+			"stage":   "credentials",
+			"error":   fmt.Sprintf("The password could not be read from its credential source: %s", errorMsg),
+		}
+	}
+
+	// Provide detailed connection error messages
+	var userMessage string
+	if strings.Contains(errorMsg, "connection refused") {
+		userMessage = "Connection refused. Please verify the host and port are correct and the database server is running."
+	} else if strings.Contains(errorMsg, "timeout") {
+		userMessage = "Connection timeout. Please check network connectivity and firewall settings."
+	} else if strings.Contains(errorMsg, "authentication failed") || strings.Contains(errorMsg, "Access denied") {
+		userMessage = "Authentication failed. Please verify the username and password are correct."
+	} else if strings.Contains(errorMsg, "database") && strings.Contains(errorMsg, "does not exist") {
+		userMessage = "Database not found. Please verify the database name is correct."
+	} else if strings.Contains(errorMsg, "no such host") || strings.Contains(errorMsg, "unknown host") {
+		userMessage = "Host not found. Please verify the hostname or IP address."
+	} else {
+		userMessage = fmt.Sprintf("Connection failed: %s", errorMsg)
+	}
+
+	return gin.H{
+		"success": false,
+		"stage":   "database",
+		"error":   userMessage,
+	}
+}
+
 // TestConnectionWithParams tests the connection to a data source with raw parameters
 func (h *DataSourceHandler) TestConnectionWithParams(c *gin.Context) {
 	var req service.TestConnectionInput
@@ -304,28 +593,7 @@ func (h *DataSourceHandler) TestConnectionWithParams(c *gin.Context) {
 	}
 
 	if err := h.dataSourceService.TestConnectionWithParams(c, &req); err != nil {
-		// Provide detailed connection error messages
-		errorMsg := err.Error()
-		var userMessage string
-
-		if strings.Contains(errorMsg, "connection refused") {
-			userMessage = "Connection refused. Please verify the host and port are correct and the database server is running."
-		} else if strings.Contains(errorMsg, "timeout") {
-			userMessage = "Connection timeout. Please check network connectivity and firewall settings."
-		} else if strings.Contains(errorMsg, "authentication failed") || strings.Contains(errorMsg, "Access denied") {
-			userMessage = "Authentication failed. Please verify the username and password are correct."
-		} else if strings.Contains(errorMsg, "database") && strings.Contains(errorMsg, "does not exist") {
-			userMessage = "Database not found. Please verify the database name is correct."
-		} else if strings.Contains(errorMsg, "no such host") || strings.Contains(errorMsg, "unknown host") {
-			userMessage = "Host not found. Please verify the hostname or IP address."
-		} else {
-			userMessage = fmt.Sprintf("Connection failed: %s", errorMsg)
-		}
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   userMessage,
-		})
+		c.JSON(http.StatusBadRequest, connectionTestFailure(err))
 		return
 	}
 
@@ -429,12 +697,58 @@ func (h *DataSourceHandler) CheckHealth(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, dto.DataSourceHealthResponse{
-		DataSourceID: dataSourceID,
-		Status:       result.Status,
-		LatencyMs:    result.LatencyMs,
-		LastError:    result.Error,
-		LastChecked:  time.Now().Format("2006-01-02T15:04:05Z07:00"),
-		Message:      result.Message,
+		DataSourceID:     dataSourceID,
+		Status:           result.Status,
+		LatencyMs:        result.LatencyMs,
+		LastError:        result.Error,
+		LastChecked:      time.Now().Format("2006-01-02T15:04:05Z07:00"),
+		Message:          result.Message,
+		Replicas:         result.Replicas,
+		TLSVersion:       result.TLSVersion,
+		ConnectLatencyMs: result.ConnectLatencyMs,
+		PingLatencyMs:    result.PingLatencyMs,
+		ServerVersion:    result.ServerVersion,
+	})
+}
+
+// GetHealthHistory returns the uptime, latency and incidents of a data source over time
+func (h *DataSourceHandler) GetHealthHistory(c *gin.Context) {
+	dataSourceID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	// Verify data source exists
+	var dataSource models.DataSource
+	if err := h.db.First(&dataSource, "id = ?", dataSourceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data source not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch data source"})
+		}
+		return
+	}
+
+	// Check if user has permission to access this data source
+	if !h.checkReadPermission(userID, dataSourceID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to access this data source"})
+		return
+	}
+
+	history, err := h.dataSourceService.GetHealthHistory(c, dataSource.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch health history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetPoolStats returns connection pool statistics for all data sources (admin only)
+func (h *DataSourceHandler) GetPoolStats(c *gin.Context) {
+	stats := h.dataSourceService.GetPoolStats(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"pools": stats,
+		"total": len(stats),
 	})
 }
 
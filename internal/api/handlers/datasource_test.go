@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/api/middleware"
+	"github.com/yourorg/querybase/internal/auth"
+	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/service"
+	testauth "github.com/yourorg/querybase/internal/testutils/auth"
+	"github.com/yourorg/querybase/internal/testutils/fixtures"
+)
+
+// setupDataSourceTestDB creates an in-memory SQLite database with data sources, permissions and health probes
+func setupDataSourceTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Group{},
+		&models.UserGroup{},
+		&models.DataSource{},
+		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+		&models.DataSourceHealthCheck{},
+	)
+	require.NoError(t, err)
+
+	return db
+}
+
+// setupDataSourceTestRouter serves the health history route with the real handler and service
+func setupDataSourceTestRouter(t *testing.T, db *gorm.DB) (*gin.Engine, *auth.JWTManager) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	jwtManager := auth.NewJWTManager(testauth.TestJWTSecret, testauth.TestJWTExpireTime, testauth.TestJWTIssuer)
+	keyring := service.NewLegacyKeyring("0123456789abcdef0123456789abcdef")
+	dataSourceHandler := NewDataSourceHandler(db, service.NewDataSourceService(db, keyring), service.NewQueryService(db, keyring, nil, nil))
+
+	datasources := router.Group("/api/v1/datasources")
+	datasources.Use(middleware.AuthMiddleware(jwtManager, nil))
+	{
+		datasources.GET("/:id/health/history", dataSourceHandler.GetHealthHistory)
+	}
+
+	return router, jwtManager
+}
+
+// recordHealthProbe stores a probe of a data source checked at the given time
+func recordHealthProbe(t *testing.T, db *gorm.DB, dataSourceID uuid.UUID, checkedAt time.Time, status dto.HealthStatus) {
+	probe := &models.DataSourceHealthCheck{
+		ID:           uuid.New(),
+		DataSourceID: dataSourceID,
+		CheckedAt:    checkedAt,
+		Source:       models.HealthProbeCheck,
+		Status:       string(status),
+	}
+	if status == dto.HealthStatusUnhealthy {
+		probe.ErrorClass = models.HealthErrorRefused
+		probe.Error = "connection refused"
+	} else {
+		latency := int64(12)
+		probe.ConnectLatencyMs = &latency
+		probe.PingLatencyMs = &latency
+	}
+	require.NoError(t, db.Create(probe).Error)
+}
+
+func TestGetHealthHistory_ReturnsWindowsIncidentsAndProbes(t *testing.T) {
+	db := setupDataSourceTestDB(t)
+	router, jwtManager := setupDataSourceTestRouter(t, db)
+	admin := fixtures.CreateTestAdminUser(t, db)
+	dataSource := fixtures.CreateTestDataSource(t, db, "health-ds-"+uuid.New().String()[:8])
+
+	now := time.Now()
+	recordHealthProbe(t, db, dataSource.ID, now.Add(-2*time.Hour), dto.HealthStatusHealthy)
+	recordHealthProbe(t, db, dataSource.ID, now.Add(-10*time.Minute), dto.HealthStatusUnhealthy)
+	// Probes of other data sources are not reported
+	recordHealthProbe(t, db, uuid.New(), now.Add(-5*time.Minute), dto.HealthStatusHealthy)
+
+	w := serveJSON(router, http.MethodGet, "/api/v1/datasources/"+dataSource.ID.String()+"/health/history", tokenForUser(t, jwtManager, admin), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var history service.HealthHistory
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, dataSource.ID, history.DataSourceID)
+	require.Len(t, history.Windows, 3)
+	assert.Equal(t, "24h", history.Windows[0].Window)
+	assert.Equal(t, 2, history.Windows[0].Probes)
+	require.NotNil(t, history.Windows[0].UptimePercent)
+	assert.InDelta(t, 50.0, *history.Windows[0].UptimePercent, 0.01)
+
+	// The failing probe opens an incident that is still ongoing
+	require.Len(t, history.Incidents, 1)
+	assert.Nil(t, history.Incidents[0].EndedAt)
+	assert.Equal(t, models.HealthErrorRefused, history.Incidents[0].ErrorClass)
+
+	require.Len(t, history.RecentProbes, 2)
+	assert.Equal(t, string(dto.HealthStatusUnhealthy), history.RecentProbes[0].Status, "newest probe first")
+}
+
+func TestGetHealthHistory_AccessControl(t *testing.T) {
+	db := setupDataSourceTestDB(t)
+	router, jwtManager := setupDataSourceTestRouter(t, db)
+	dataSource := fixtures.CreateTestDataSource(t, db, "health-ds-"+uuid.New().String()[:8])
+	recordHealthProbe(t, db, dataSource.ID, time.Now().Add(-time.Minute), dto.HealthStatusHealthy)
+	path := "/api/v1/datasources/" + dataSource.ID.String() + "/health/history"
+
+	reader := fixtures.CreateTestRegularUser(t, db)
+	readers := fixtures.CreateTestGroupWithUniqueName(t, db)
+	require.NoError(t, fixtures.AddUserToGroup(db, reader.ID, readers.ID))
+	_, err := fixtures.GrantPermission(db, readers.ID, dataSource.ID, true, false, false)
+	require.NoError(t, err)
+
+	// A group permission without read access doesn't count
+	approver := fixtures.CreateTestRegularUser(t, db)
+	approvers := fixtures.CreateTestGroupWithUniqueName(t, db)
+	require.NoError(t, fixtures.AddUserToGroup(db, approver.ID, approvers.ID))
+	permission, err := fixtures.GrantPermission(db, approvers.ID, dataSource.ID, false, false, true)
+	require.NoError(t, err)
+	// can_read defaults to true, so Create doesn't store false
+	require.NoError(t, db.Model(permission).Update("can_read", false).Error)
+
+	outsider := fixtures.CreateTestRegularUser(t, db)
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		expected int
+	}{
+		{"reader", path, tokenForUser(t, jwtManager, reader), http.StatusOK},
+		{"no read permission", path, tokenForUser(t, jwtManager, approver), http.StatusForbidden},
+		{"no group", path, tokenForUser(t, jwtManager, outsider), http.StatusForbidden},
+		{"unknown data source", "/api/v1/datasources/" + uuid.New().String() + "/health/history", tokenForUser(t, jwtManager, reader), http.StatusNotFound},
+		{"no token", path, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveJSON(router, http.MethodGet, tt.path, tt.token, nil)
+			assert.Equal(t, tt.expected, w.Code, w.Body.String())
+		})
+	}
+}
@@ -191,13 +191,6 @@ func (h *MultiQueryHandler) ExecuteMultiQuery(c *gin.Context) {
 		}
 	}
 
-	// Check if user is admin
-	user, _ := c.Get("user")
-	isAdmin := false
-	if u, ok := user.(*models.User); ok {
-		isAdmin = u.Role == models.RoleAdmin
-	}
-
 	// Block execution only for UPDATE/DELETE operations that would affect 0 rows
 	// INSERT operations with 0 rows can still proceed to approval
 	hasUpdateOrDelete := false
@@ -217,15 +210,26 @@ func (h *MultiQueryHandler) ExecuteMultiQuery(c *gin.Context) {
 		return
 	}
 
-	// Non-admin users require approval for write operations that affect rows
-	// Only admins can execute write queries directly
-	requiresApproval := !isAdmin && impact.RequiresApproval && impact.TotalEstimatedRows > 0
+	var dataSource models.DataSource
+	if err := h.db.First(&dataSource, "id = ?", dataSourceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data source not found"})
+		return
+	}
+
+	// The environment policy of the data source decides whether the statements need approval.
+	// Write operations that affect no rows have nothing to review.
+	operationType := models.OperationSelect
+	if impact.RequiresApproval {
+		operationType = models.OperationUpdate // Use most restrictive type
+	}
+	requiresApproval := h.querySvc.ApprovalRequired(userUUID, &dataSource, operationType) &&
+		(operationType == models.OperationSelect || impact.TotalEstimatedRows > 0)
 
 	if requiresApproval {
 		approval := &models.ApprovalRequest{
 			ID:            uuid.New(),
 			RequestedBy:   userUUID,
-			OperationType: models.OperationUpdate, // Use most restrictive type
+			OperationType: operationType,
 			QueryText:     fullQueryText,
 			DataSourceID:  dataSourceID,
 			Status:        models.ApprovalStatusPending,
@@ -245,7 +249,7 @@ func (h *MultiQueryHandler) ExecuteMultiQuery(c *gin.Context) {
 		return
 	}
 
-	// Execute immediately for admins or SELECT-only queries
+	// Execute immediately when the policy needs no approval
 	// Create a temporary transaction and execute it (no approval needed, so pass nil)
 	transaction, err := h.multiQuerySvc.CreateMultiQueryTransaction(c.Request.Context(), nil, dataSourceID, queryTexts, userUUID)
 	if err != nil {
@@ -108,6 +108,7 @@ func setupMultiQueryTestDB(t *testing.T) *gorm.DB {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
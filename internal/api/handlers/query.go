@@ -4,16 +4,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 	"github.com/yourorg/querybase/internal/api/dto"
 	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/queue"
 	"github.com/yourorg/querybase/internal/service"
 	"gorm.io/gorm"
 )
@@ -22,6 +26,8 @@ import (
 type QueryHandler struct {
 	db           *gorm.DB
 	queryService *service.QueryService
+	asyncQueue   *asynq.Client
+	queryEvents  *service.QueryEventBus
 }
 
 // NewQueryHandler creates a new query handler
@@ -32,6 +38,13 @@ func NewQueryHandler(db *gorm.DB, queryService *service.QueryService) *QueryHand
 	}
 }
 
+// SetAsyncExecution enables async query execution through the worker queue.
+// Query events are used to cancel queries running on a worker.
+func (h *QueryHandler) SetAsyncExecution(asyncQueue *asynq.Client, queryEvents *service.QueryEventBus) {
+	h.asyncQueue = asyncQueue
+	h.queryEvents = queryEvents
+}
+
 // ExecuteQuery executes a SQL query
 func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 	var req dto.ExecuteQueryRequest
@@ -59,8 +72,33 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 		return
 	}
 
+	// Parameter declarations of the saved query the text came from
+	var definitions []models.QueryParameter
+	if req.SavedQueryID != "" {
+		savedQuery, err := h.queryService.GetQuery(c, req.SavedQueryID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Saved query not found"})
+			return
+		}
+		if definitions, err = service.DecodeQueryParameters(savedQuery); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Check the parameter values now; the placeholders also make the text parseable
+	sqlText := req.QueryText
+	if len(req.Parameters) > 0 || len(definitions) > 0 {
+		bound, _, err := service.BindQueryParameters(req.QueryText, definitions, req.Parameters, dataSource.Type)
+		if err != nil {
+			respondParameterError(c, err)
+			return
+		}
+		sqlText = bound
+	}
+
 	// Validate SQL syntax using dialect-specific AST parser before touching the DB
-	if err := service.ValidateSQLWithDialect(req.QueryText, dataSource.Type); err != nil {
+	if err := service.ValidateSQLWithDialect(sqlText, dataSource.Type); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "SQL syntax error",
 			"details": err.Error(),
@@ -71,8 +109,40 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 	// Detect operation type
 	operationType := service.DetectOperationType(req.QueryText)
 
+	// Write operations are reviewed as literal SQL, so they can't take parameters
+	if sqlText != req.QueryText && operationType != models.OperationSelect {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parameters are only supported for SELECT queries"})
+		return
+	}
+
+	// Only SELECTs run on the worker; writes go through approval or run directly
+	if req.Async && operationType != models.OperationSelect {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Async execution is only supported for SELECT queries"})
+		return
+	}
+
+	// Parse userID as UUID
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// The environment policy of the data source decides what goes through approval
+	approvalRequired := h.queryService.ApprovalRequired(userUUID, &dataSource, operationType)
+
+	if approvalRequired && operationType == models.OperationSelect {
+		// Approved queries run as literal SQL
+		if sqlText != req.QueryText {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parameterized queries can't be sent for approval"})
+			return
+		}
+		h.createApprovalForQuery(c, req, dataSource, userID, operationType)
+		return
+	}
+
 	// For write operations, validate first before creating approval
-	if service.RequiresApproval(operationType) {
+	if approvalRequired {
 		// Validate the write query to check if it would affect any rows
 		validation, err := h.queryService.PreviewAndValidateWriteQuery(c, req.QueryText, &dataSource)
 		if err != nil {
@@ -97,10 +167,9 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 		return
 	}
 
-	// Parse userID as UUID
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	// Writes the policy lets run directly still need write access
+	if service.RequiresApproval(operationType) && !h.checkWritePermission(c, userID, dataSource.ID.String()) {
+		respondWriteDenied(c, &dataSource)
 		return
 	}
 
@@ -115,6 +184,19 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 		OperationType: operationType,
 		Status:        models.StatusRunning,
 	}
+	if query.Parameters, err = service.EncodeQueryParameters(definitions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if query.ParameterValues, err = service.EncodeParameterValues(req.Parameters); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Async {
+		h.enqueueQuery(c, query, req.Refresh)
+		return
+	}
 
 	// Save query to database BEFORE executing (needed for foreign key constraint)
 	if err := h.db.Create(query).Error; err != nil {
@@ -125,10 +207,28 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 	startTime := time.Now()
 
 	// Execute the query
-	result, err := h.queryService.ExecuteQuery(c, query, &dataSource)
+	// Use the request context so a client disconnect stops the query on the server
+	result, err := h.queryService.ExecuteQueryWithOptions(c.Request.Context(), query, &dataSource, service.ExecuteOptions{
+		Refresh: req.Refresh,
+	})
 	if err != nil {
+		var guardErr *service.CostGuardError
 		if strings.Contains(err.Error(), "permission denied") {
 			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else if errors.Is(err, service.ErrQueryCancelled) {
+			c.JSON(http.StatusOK, dto.ExecuteQueryResponse{
+				QueryID:      query.ID.String(),
+				Status:       string(models.StatusCancelled),
+				ErrorMessage: err.Error(),
+			})
+		} else if errors.Is(err, service.ErrQueryTimeout) {
+			c.JSON(http.StatusRequestTimeout, gin.H{"error": err.Error(), "query_id": query.ID.String()})
+		} else if errors.Is(err, service.ErrReadOnlyViolation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "query_id": query.ID.String()})
+		} else if errors.Is(err, service.ErrApprovalRequired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "query_id": query.ID.String()})
+		} else if errors.As(err, &guardErr) {
+			respondCostGuard(c, query, guardErr)
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -141,45 +241,143 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 		query.ID.String(), result.RowCount, len(result.Data), result.ColumnNames)
 
 	// Parse results
-	var data []map[string]interface{}
-	if result.Data != "" {
-		if err := json.Unmarshal([]byte(result.Data), &data); err != nil {
-			log.Printf("[ExecuteQuery] Failed to parse data JSON: %v", err)
-			data = []map[string]interface{}{}
-		}
-	} else {
-		data = []map[string]interface{}{}
+	set, err := service.DecodeQueryResult(result)
+	if err != nil {
+		log.Printf("[ExecuteQuery] Failed to parse result data: %v", err)
+		set = &service.ResultSet{Rows: [][]interface{}{}}
+	}
+
+	log.Printf("[ExecuteQuery] Parsed data: %d rows", len(set.Rows))
+
+	c.JSON(http.StatusOK, dto.ExecuteQueryResponse{
+		QueryID:          query.ID.String(),
+		Status:           "completed",
+		RowCount:         &result.RowCount,
+		ExecutionTime:    &executionTime,
+		Data:             set.RowMaps(),
+		Rows:             set.Rows,
+		Columns:          resultColumns(set.Columns, set.ColumnTypes),
+		RequiresApproval: false,
+		Truncated:        result.Truncated,
+		Limit:            resultLimitInfo(result),
+		Cached:           result.CachedAt != nil,
+		CachedAt:         formatOptionalTime(result.CachedAt),
+		CostGuard:        costGuardWarning(query, &dataSource),
+	})
+}
+
+// costGuardInfo converts a cost guard violation for the response
+func costGuardInfo(violation *service.CostGuardViolation) *dto.CostGuardInfo {
+	return &dto.CostGuardInfo{
+		Rule:          violation.Rule,
+		Action:        string(violation.Action),
+		Threshold:     violation.Threshold,
+		EstimatedCost: violation.Estimate.Cost,
+		EstimatedRows: violation.Estimate.Rows,
+		Message:       violation.Message(),
 	}
+}
 
-	log.Printf("[ExecuteQuery] Parsed data: %d rows", len(data))
+// costGuardWarning reports the threshold an executed SELECT exceeded on a data source that only warns
+func costGuardWarning(query *models.Query, dataSource *models.DataSource) *dto.CostGuardInfo {
+	if query.CostGuardRule == "" || query.EstimatedRows == nil {
+		return nil
+	}
 
-	// Parse column names from JSON string
-	var columnNames []string
-	json.Unmarshal([]byte(result.ColumnNames), &columnNames)
+	violation := service.EvaluateCostGuard(dataSource, &service.CostEstimate{Cost: query.EstimatedCost, Rows: *query.EstimatedRows})
+	if violation == nil {
+		return nil
+	}
+	return costGuardInfo(violation)
+}
 
-	// Parse column types from JSON string
-	var columnTypes []string
-	json.Unmarshal([]byte(result.ColumnTypes), &columnTypes)
+// respondCostGuard reports a SELECT stopped by the cost guard: sent for approval (202) or blocked (422)
+func respondCostGuard(c *gin.Context, query *models.Query, guardErr *service.CostGuardError) {
+	violation := guardErr.Violation
+	if violation.ApprovalID != nil {
+		c.JSON(http.StatusAccepted, dto.ExecuteQueryResponse{
+			QueryID:          query.ID.String(),
+			Status:           "pending_approval",
+			ErrorMessage:     guardErr.Error(),
+			RequiresApproval: true,
+			ApprovalID:       violation.ApprovalID.String(),
+			CostGuard:        costGuardInfo(violation),
+		})
+		return
+	}
+
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      guardErr.Error(),
+		"query_id":   query.ID.String(),
+		"cost_guard": costGuardInfo(violation),
+	})
+}
 
-	// Build column info with names and types
+// enqueueQuery saves a SELECT as pending and hands it to the worker queue.
+// refresh makes the worker skip the result cache.
+func (h *QueryHandler) enqueueQuery(c *gin.Context, query *models.Query, refresh bool) {
+	if h.asyncQueue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Asynchronous execution is not available"})
+		return
+	}
+
+	query.Status = models.StatusPending
+	query.IsAsync = true
+	if err := h.db.Create(query).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save query"})
+		return
+	}
+
+	_, err := queue.EnqueueQueryExecution(h.asyncQueue, &queue.ExecuteQueryPayload{
+		QueryID:      query.ID.String(),
+		DataSourceID: query.DataSourceID.String(),
+		SQL:          query.QueryText,
+		UserID:       query.UserID.String(),
+		Refresh:      refresh,
+	})
+	if err != nil {
+		log.Printf("[ExecuteQuery] Failed to enqueue query %s: %v", query.ID, err)
+		h.db.Model(query).Updates(map[string]interface{}{
+			"status":        models.StatusFailed,
+			"error_message": "failed to enqueue query",
+		})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to enqueue query"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.ExecuteQueryResponse{
+		QueryID:    query.ID.String(),
+		Status:     string(models.StatusPending),
+		ResultsURL: fmt.Sprintf("/api/v1/queries/%s/results", query.ID),
+	})
+}
+
+// resultColumns builds the column metadata of a result. Key is the column's key in row objects.
+func resultColumns(columnNames, columnTypes []string) []dto.ColumnInfo {
+	keys := service.ResultColumnKeys(columnNames)
 	columns := make([]dto.ColumnInfo, len(columnNames))
 	for i, col := range columnNames {
 		colType := "unknown"
 		if i < len(columnTypes) && columnTypes[i] != "" {
 			colType = columnTypes[i]
 		}
-		columns[i] = dto.ColumnInfo{Name: col, Type: colType}
+		columns[i] = dto.ColumnInfo{Name: col, Type: colType, Key: keys[i]}
 	}
+	return columns
+}
 
-	c.JSON(http.StatusOK, dto.ExecuteQueryResponse{
-		QueryID:          query.ID.String(),
-		Status:           "completed",
-		RowCount:         &result.RowCount,
-		ExecutionTime:    &executionTime,
-		Data:             data,
-		Columns:          columns,
-		RequiresApproval: false,
-	})
+// resultLimitInfo describes the limit that truncated a stored result, or nil if it is complete
+func resultLimitInfo(result *models.QueryResult) *dto.ResultLimitInfo {
+	if !result.Truncated {
+		return nil
+	}
+
+	return &dto.ResultLimitInfo{
+		Type:      result.TruncatedBy,
+		Value:     result.ResultLimit,
+		Message:   service.TruncationMessage(result.TruncatedBy, result.ResultLimit),
+		ExportURL: "/api/v1/queries/export",
+	}
 }
 
 // SaveQuery saves a query for later use
@@ -220,6 +418,17 @@ func (h *QueryHandler) SaveQuery(c *gin.Context) {
 		Status:        models.StatusPending,
 	}
 
+	// Declared parameters are kept in the order they appear in the query
+	definitions := parameterDefinitions(req.QueryText, req.Parameters)
+	if err := service.ValidateParameterDefinitions(req.QueryText, definitions); err != nil {
+		respondParameterError(c, err)
+		return
+	}
+	if query.Parameters, err = service.EncodeQueryParameters(definitions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := h.queryService.SaveQuery(c, query); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save query"})
 		return
@@ -231,6 +440,56 @@ func (h *QueryHandler) SaveQuery(c *gin.Context) {
 	})
 }
 
+// parameterDefinitions converts the declared parameters of a save request, ordered by first use in the query
+func parameterDefinitions(queryText string, parameters map[string]dto.QueryParameterDefinition) []models.QueryParameter {
+	if len(parameters) == 0 {
+		return nil
+	}
+
+	names := service.ParseQueryParameters(queryText)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	var unused []string
+	for name := range parameters {
+		if !seen[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+
+	var definitions []models.QueryParameter
+	for _, name := range append(names, unused...) {
+		param, ok := parameters[name]
+		if !ok {
+			continue
+		}
+		paramType := models.QueryParameterType(param.Type)
+		if paramType == "" {
+			paramType = models.ParameterTypeString
+		}
+		definitions = append(definitions, models.QueryParameter{
+			Name:          name,
+			Type:          paramType,
+			Default:       param.Default,
+			AllowedValues: param.AllowedValues,
+			Description:   param.Description,
+		})
+	}
+	return definitions
+}
+
+// respondParameterError answers a request whose query parameters are invalid
+func respondParameterError(c *gin.Context, err error) {
+	var paramErr *service.ParameterError
+	if errors.As(err, &paramErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "parameter": paramErr.Name})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
 // GetQuery retrieves a query by ID
 func (h *QueryHandler) GetQuery(c *gin.Context) {
 	queryID := c.Param("id")
@@ -259,48 +518,48 @@ func (h *QueryHandler) GetQuery(c *gin.Context) {
 	var result models.QueryResult
 	h.db.Where("query_id = ?", queryID).Order("stored_at DESC").First(&result)
 
-	var data []map[string]interface{}
-	if result.Data != "" {
-		if err := json.Unmarshal([]byte(result.Data), &data); err != nil {
-			log.Printf("[GetQuery] Failed to parse data JSON: %v", err)
-			data = []map[string]interface{}{}
-		}
-	} else {
-		data = []map[string]interface{}{}
+	set, err := service.DecodeQueryResult(&result)
+	if err != nil {
+		log.Printf("[GetQuery] Failed to parse result data: %v", err)
+		set = &service.ResultSet{Rows: [][]interface{}{}}
 	}
 
-	// Parse column names from JSON string
-	var columnNames []string
-	if result.ColumnNames != "" {
-		if err := json.Unmarshal([]byte(result.ColumnNames), &columnNames); err != nil {
-			log.Printf("[GetQuery] Failed to parse column names JSON: %v", err)
-			columnNames = []string{}
-		}
-	} else {
-		columnNames = []string{}
+	definitions, err := service.DecodeQueryParameters(query)
+	if err != nil {
+		log.Printf("[GetQuery] Failed to parse query parameters: %v", err)
 	}
-
-	// Build column info
-	columns := make([]dto.ColumnInfo, len(columnNames))
-	for i, col := range columnNames {
-		columns[i] = dto.ColumnInfo{Name: col, Type: "unknown"}
+	parameterValues, err := service.DecodeParameterValues(query)
+	if err != nil {
+		log.Printf("[GetQuery] Failed to parse parameter values: %v", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":             query.ID.String(),
-		"name":           query.Name,
-		"description":    query.Description,
-		"query_text":     query.QueryText,
-		"data_source_id": query.DataSourceID.String(),
-		"operation_type": string(query.OperationType),
-		"status":         string(query.Status),
-		"user_id":        query.UserID.String(),
-		"created_at":     query.CreatedAt,
+		"id":               query.ID.String(),
+		"name":             query.Name,
+		"description":      query.Description,
+		"query_text":       query.QueryText,
+		"data_source_id":   query.DataSourceID.String(),
+		"operation_type":   string(query.OperationType),
+		"status":           string(query.Status),
+		"is_async":         query.IsAsync,
+		"error_message":    query.ErrorMessage,
+		"estimated_cost":   query.EstimatedCost,
+		"estimated_rows":   query.EstimatedRows,
+		"cost_guard_rule":  query.CostGuardRule,
+		"parameters":       definitions,
+		"parameter_values": parameterValues,
+		"user_id":          query.UserID.String(),
+		"created_at":       query.CreatedAt,
 		"results": gin.H{
 			"query_id":  result.QueryID.String(),
 			"row_count": result.RowCount,
-			"columns":   columns,
-			"data":      data,
+			"columns":   resultColumns(set.Columns, set.ColumnTypes),
+			"data":      set.RowMaps(),
+			"rows":      set.Rows,
+			"truncated": result.Truncated,
+			"limit":     resultLimitInfo(&result),
+			"purged_at": formatOptionalTime(result.PurgedAt),
+			"cached_at": formatOptionalTime(result.CachedAt),
 		},
 	})
 }
@@ -372,6 +631,91 @@ func (h *QueryHandler) DeleteQuery(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Query deleted successfully"})
 }
 
+// CancelQuery cancels a running query
+func (h *QueryHandler) CancelQuery(c *gin.Context) {
+	queryID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	id, err := uuid.Parse(queryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query ID"})
+		return
+	}
+
+	var query models.Query
+	if err := h.db.First(&query, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Query not found"})
+		return
+	}
+
+	// Check permission (only owner or admin can cancel)
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err == nil {
+		if user.Role != models.RoleAdmin && query.UserID.String() != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+	}
+
+	// Async queries still waiting in the queue are cancelled before a worker picks them up
+	if query.IsAsync && query.Status == models.StatusPending {
+		cancelled, err := h.queryService.CancelPendingQuery(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if cancelled {
+			query.Status = models.StatusCancelled
+			query.ErrorMessage = service.ErrQueryCancelled.Error()
+			if err := h.queryEvents.PublishQueryEvent(c.Request.Context(), service.NewQueryEvent(&query)); err != nil {
+				log.Printf("[CancelQuery] Failed to publish cancellation of query %s: %v", query.ID, err)
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"query_id": query.ID.String(),
+				"status":   string(models.StatusCancelled),
+				"message":  "Query cancelled before execution",
+			})
+			return
+		}
+		// A worker claimed the query in the meantime
+		query.Status = models.StatusRunning
+	}
+
+	if query.Status != models.StatusRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Query is not running (status: %s)", query.Status)})
+		return
+	}
+
+	if err := h.queryService.CancelQuery(c.Request.Context(), id); err != nil {
+		if !errors.Is(err, service.ErrQueryNotRunning) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The query may be running on a worker; ask it to cancel
+		if !h.queryEvents.Enabled() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Query is not running on this server"})
+			return
+		}
+		if err := h.queryEvents.RequestCancel(c.Request.Context(), id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"query_id": query.ID.String(),
+			"status":   string(models.StatusRunning),
+			"message":  "Cancellation requested",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query_id": query.ID.String(),
+		"status":   string(models.StatusCancelled),
+		"message":  "Query cancelled successfully",
+	})
+}
+
 // PreviewWriteQuery previews the rows affected by a DELETE/UPDATE query before submission
 func (h *QueryHandler) PreviewWriteQuery(c *gin.Context) {
 	var req dto.PreviewWriteQueryRequest
@@ -468,16 +812,12 @@ func (h *QueryHandler) PreviewInsertQuery(c *gin.Context) {
 	})
 }
 
-// createApprovalForQuery creates an approval request for write operations
+// createApprovalForQuery creates an approval request for a write operation, or a SELECT the environment
+// policy of the data source sends to approval
 func (h *QueryHandler) createApprovalForQuery(c *gin.Context, req dto.ExecuteQueryRequest, dataSource models.DataSource, userID string, operationType models.OperationType) {
-	// Check if user has write permission
-	if !h.checkWritePermission(c, userID, dataSource.ID.String()) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":       "Insufficient permissions to submit write operations",
-			"code":        "PERMISSION_DENIED_WRITE",
-			"data_source": dataSource.Name,
-			"hint":        "Contact your admin to get write access on this data source.",
-		})
+	// Check if user has write permission; SELECTs only need the read access checked before
+	if operationType != models.OperationSelect && !h.checkWritePermission(c, userID, dataSource.ID.String()) {
+		respondWriteDenied(c, &dataSource)
 		return
 	}
 
@@ -517,7 +857,33 @@ func (h *QueryHandler) createApprovalForQuery(c *gin.Context, req dto.ExecuteQue
 		Status:        models.ApprovalStatusPending,
 	}
 
-	if err := h.db.Create(approval).Error; err != nil {
+	// An approved SELECT runs as this query of the requester, which holds its result
+	queryID := uuid.New()
+	var query *models.Query
+	if operationType == models.OperationSelect {
+		query = &models.Query{
+			ID:               queryID,
+			DataSourceID:     dataSource.ID,
+			UserID:           userUUID,
+			QueryText:        req.QueryText,
+			Name:             req.Name,
+			Description:      req.Description,
+			OperationType:    operationType,
+			Status:           models.StatusPending,
+			RequiresApproval: true,
+		}
+		approval.QueryID = &query.ID
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if query != nil {
+			if err := tx.Create(query).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(approval).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create approval request"})
 		return
 	}
@@ -526,13 +892,23 @@ func (h *QueryHandler) createApprovalForQuery(c *gin.Context, req dto.ExecuteQue
 	// This will be implemented when we add the notification service
 
 	c.JSON(http.StatusAccepted, dto.ExecuteQueryResponse{
-		QueryID:          uuid.New().String(),
+		QueryID:          queryID.String(),
 		Status:           "pending_approval",
 		RequiresApproval: true,
 		ApprovalID:       approval.ID.String(),
 	})
 }
 
+// respondWriteDenied responds to a write operation of a user without write access
+func respondWriteDenied(c *gin.Context, dataSource *models.DataSource) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":       "Insufficient permissions to submit write operations",
+		"code":        "PERMISSION_DENIED_WRITE",
+		"data_source": dataSource.Name,
+		"hint":        "Contact your admin to get write access on this data source.",
+	})
+}
+
 // checkReadPermission checks if user has read permission on data source
 func (h *QueryHandler) checkReadPermission(c *gin.Context, userID, dataSourceID string) bool {
 	uID, err := uuid.Parse(userID)
@@ -569,7 +945,8 @@ func (h *QueryHandler) checkWritePermission(c *gin.Context, userID, dataSourceID
 	return perms.CanWrite
 }
 
-// ListQueryHistory retrieves query execution history
+// ListQueryHistory lists query history matching the filters in the query string.
+// Admins see the history of all users and can filter by user_id; other users see their own.
 func (h *QueryHandler) ListQueryHistory(c *gin.Context) {
 	userID := c.GetString("user_id")
 
@@ -581,34 +958,23 @@ func (h *QueryHandler) ListQueryHistory(c *gin.Context) {
 	}
 	offset := (page - 1) * limit
 
-	// Optional filters
-	dataSourceID := c.Query("data_source_id")
-	status := c.Query("status")
-	operationType := c.Query("operation_type")
-	search := c.Query("search")
-
-	history, total, err := h.queryService.ListQueryHistory(c, userID, limit, offset, search)
+	filter, err := historyFilterFromQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch query history"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Apply filters after retrieval (simple approach)
-	if dataSourceID != "" || status != "" || operationType != "" {
-		filtered := history[:0]
-		for _, h := range history {
-			if dataSourceID != "" && h.DataSourceID.String() != dataSourceID {
-				continue
-			}
-			if status != "" && string(h.Status) != status {
-				continue
-			}
-			if operationType != "" && string(h.OperationType) != operationType {
-				continue
-			}
-			filtered = append(filtered, h)
+	history, total, err := h.queryService.SearchQueryHistory(c, userID, filter, limit, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidHistoryFilter):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "permission denied"):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch query history"})
 		}
-		history = filtered
+		return
 	}
 
 	response := make([]gin.H, len(history))
@@ -617,6 +983,8 @@ func (h *QueryHandler) ListQueryHistory(c *gin.Context) {
 			"id":                entry.ID.String(),
 			"query_id":          entry.QueryID,
 			"user_id":           entry.UserID.String(),
+			"username":          entry.User.Username,
+			"user_email":        entry.User.Email,
 			"data_source_id":    entry.DataSourceID.String(),
 			"data_source_name":  entry.DataSource.Name,
 			"query_text":        entry.QueryText,
@@ -625,6 +993,7 @@ func (h *QueryHandler) ListQueryHistory(c *gin.Context) {
 			"row_count":         entry.RowCount,
 			"execution_time_ms": entry.ExecutionTimeMs,
 			"error_message":     entry.ErrorMessage,
+			"cache_hit":         entry.CacheHit,
 			"executed_at":       entry.ExecutedAt,
 		}
 	}
@@ -637,6 +1006,71 @@ func (h *QueryHandler) ListQueryHistory(c *gin.Context) {
 	})
 }
 
+// historyFilterFromQuery parses the history filters of a request. Dates are RFC 3339 timestamps
+// or YYYY-MM-DD days; a day in "to" includes the whole day.
+func historyFilterFromQuery(c *gin.Context) (service.HistoryFilter, error) {
+	filter := service.HistoryFilter{
+		OperationType: models.OperationType(c.Query("operation_type")),
+		Status:        models.QueryStatus(c.Query("status")),
+		Search:        c.Query("search"),
+		SortBy:        c.Query("sort_by"),
+		SortOrder:     c.Query("sort_order"),
+	}
+
+	if value := c.Query("user_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id")
+		}
+		filter.UserID = &id
+	}
+	if value := c.Query("data_source_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid data_source_id")
+		}
+		filter.DataSourceID = &id
+	}
+	if value := c.Query("min_execution_time_ms"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < 0 {
+			return filter, fmt.Errorf("min_execution_time_ms must be a non-negative integer")
+		}
+		filter.MinExecutionTimeMs = ms
+	}
+
+	for _, bound := range []struct {
+		name     string
+		target   **time.Time
+		endOfDay bool
+	}{
+		{"from", &filter.From, false},
+		{"to", &filter.To, true},
+	} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			day, dayErr := time.Parse("2006-01-02", value)
+			if dayErr != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", bound.name)
+			}
+			t = day
+			if bound.endOfDay {
+				t = day.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		*bound.target = &t
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, fmt.Errorf("to must not be before from")
+	}
+
+	return filter, nil
+}
+
 // ExplainQuery explains a query execution plan
 func (h *QueryHandler) ExplainQuery(c *gin.Context) {
 	var req dto.ExplainQueryRequest
@@ -738,6 +1172,24 @@ func (h *QueryHandler) GetQueryResults(c *gin.Context) {
 		}
 	}
 
+	// Async queries have no results until the worker finishes them
+	switch {
+	case query.IsAsync && query.Status == models.StatusPending, query.Status == models.StatusRunning:
+		c.JSON(http.StatusAccepted, gin.H{
+			"query_id": query.ID.String(),
+			"status":   string(query.Status),
+			"message":  "Query has not finished yet",
+		})
+		return
+	case query.Status == models.StatusFailed, query.Status == models.StatusCancelled:
+		c.JSON(http.StatusConflict, gin.H{
+			"query_id": query.ID.String(),
+			"status":   string(query.Status),
+			"error":    query.ErrorMessage,
+		})
+		return
+	}
+
 	// Parse pagination parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "100"))
@@ -763,6 +1215,53 @@ func (h *QueryHandler) GetQueryResults(c *gin.Context) {
 		return
 	}
 
+	// Database mode re-runs the query for this page; queries that can't be wrapped use the stored result
+	var fallbackReason string
+	if c.Query("mode") == service.PaginationModeDatabase {
+		var dataSource models.DataSource
+		if err := h.db.First(&dataSource, "id = ?", query.DataSourceID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data source not found"})
+			return
+		}
+
+		userUUID, _ := uuid.Parse(userID)
+		set, metadata, err := h.queryService.GetPaginatedResultsFromDataSource(ctx, userUUID, &query, &dataSource, page, perPage, sortColumn, sortDirection)
+		var guardErr *service.CostGuardError
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, dto.PaginatedResultDTO{
+				QueryID:       queryID,
+				RowCount:      len(set.Rows),
+				Columns:       resultColumns(set.Columns, set.ColumnTypes),
+				Data:          set.RowMaps(),
+				Rows:          set.Rows,
+				Metadata:      paginationMetaDTO(metadata),
+				SortColumn:    sortColumn,
+				SortDirection: sortDirection,
+				Mode:          service.PaginationModeDatabase,
+			})
+			return
+		case errors.Is(err, service.ErrCannotPaginateOnDataSource):
+			log.Printf("[GetQueryResults] Falling back to stored results for query %s: %v", queryID, err)
+			fallbackReason = err.Error()
+		case strings.Contains(err.Error(), "permission denied"):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, service.ErrQueryTimeout):
+			c.JSON(http.StatusRequestTimeout, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, service.ErrReadOnlyViolation):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errors.As(err, &guardErr):
+			respondCostGuard(c, &query, guardErr)
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Get query result from database to fetch column types
 	var queryResult models.QueryResult
 	if err := h.db.Where("query_id = ?", queryID).First(&queryResult).Error; err != nil {
@@ -770,6 +1269,22 @@ func (h *QueryHandler) GetQueryResults(c *gin.Context) {
 		return
 	}
 
+	// The retention policy removed the stored rows; the query can still be re-run on the data source
+	if queryResult.PurgedAt != nil {
+		response := gin.H{
+			"error":     service.ErrResultPurged.Error(),
+			"query_id":  queryID,
+			"purged_at": queryResult.PurgedAt.Format(time.RFC3339),
+		}
+		if fallbackReason != "" {
+			response["fallback_reason"] = fallbackReason
+		} else {
+			response["hint"] = "Use mode=database to re-run the query for this page"
+		}
+		c.JSON(http.StatusGone, response)
+		return
+	}
+
 	// Parse column types from database
 	var columnTypes []string
 	json.Unmarshal([]byte(queryResult.ColumnTypes), &columnTypes)
@@ -780,34 +1295,36 @@ func (h *QueryHandler) GetQueryResults(c *gin.Context) {
 		return
 	}
 
-	// Build column info with names and types
-	columns := make([]dto.ColumnInfo, len(columnNames))
-	for i, col := range columnNames {
-		colType := "unknown"
-		if i < len(columnTypes) && columnTypes[i] != "" {
-			colType = columnTypes[i]
-		}
-		columns[i] = dto.ColumnInfo{Name: col, Type: colType}
-	}
+	resultPage := &service.ResultSet{Columns: columnNames, Rows: rows}
 
 	c.JSON(http.StatusOK, dto.PaginatedResultDTO{
-		QueryID:  queryID,
-		RowCount: len(rows),
-		Columns:  columns,
-		Data:     rows,
-		Metadata: dto.PaginationMeta{
-			Page:       metadata.Page,
-			PerPage:    metadata.PerPage,
-			TotalPages: metadata.TotalPages,
-			TotalRows:  metadata.TotalRows,
-			HasNext:    metadata.HasNext,
-			HasPrev:    metadata.HasPrev,
-		},
-		SortColumn:    sortColumn,
-		SortDirection: sortDirection,
+		QueryID:        queryID,
+		RowCount:       len(rows),
+		Columns:        resultColumns(columnNames, columnTypes),
+		Data:           resultPage.RowMaps(),
+		Rows:           rows,
+		Metadata:       paginationMetaDTO(metadata),
+		SortColumn:     sortColumn,
+		SortDirection:  sortDirection,
+		Truncated:      queryResult.Truncated,
+		Limit:          resultLimitInfo(&queryResult),
+		Mode:           service.PaginationModeStored,
+		FallbackReason: fallbackReason,
 	})
 }
 
+// paginationMetaDTO converts service pagination metadata for a response
+func paginationMetaDTO(metadata *service.PaginationMeta) dto.PaginationMeta {
+	return dto.PaginationMeta{
+		Page:       metadata.Page,
+		PerPage:    metadata.PerPage,
+		TotalPages: metadata.TotalPages,
+		TotalRows:  metadata.TotalRows,
+		HasNext:    metadata.HasNext,
+		HasPrev:    metadata.HasPrev,
+	}
+}
+
 // ExportQuery exports query results in CSV or JSON format
 func (h *QueryHandler) ExportQuery(c *gin.Context) {
 	var req dto.ExportQueryRequest
@@ -816,6 +1333,12 @@ func (h *QueryHandler) ExportQuery(c *gin.Context) {
 		return
 	}
 
+	exporter, ok := service.GetExporter(string(req.Format))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Format must be one of: %s", strings.Join(service.ExportFormats(), ", "))})
+		return
+	}
+
 	userID := c.GetString("user_id")
 
 	// Verify query exists and user has access
@@ -845,21 +1368,115 @@ func (h *QueryHandler) ExportQuery(c *gin.Context) {
 		return
 	}
 
+	if req.Mode == dto.ExportModeStream {
+		h.streamExport(c, &query, req.Format)
+		return
+	}
+
 	// Export the query results
 	ctx := c.Request.Context()
-	data, contentType, err := h.queryService.ExportQuery(ctx, queryUUID, string(req.Format))
+	data, contentType, err := h.queryService.ExportQueryWithOptions(ctx, queryUUID, string(req.Format), service.ExportOptions{
+		TableName: req.TableName,
+	})
+	if errors.Is(err, service.ErrResultPurged) {
+		c.JSON(http.StatusGone, gin.H{
+			"error": err.Error(),
+			"hint":  "Use mode=stream to export the rows from the data source",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Set headers for file download
-	filename := fmt.Sprintf("query_%s.%s", req.QueryID, req.Format)
+	filename := fmt.Sprintf("query_%s.%s", req.QueryID, exporter.FileExtension())
 	c.Header("Content-Type", contentType)
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	c.Data(http.StatusOK, contentType, data)
 }
 
+// streamExport re-runs a query and streams every row from the data source into the response
+func (h *QueryHandler) streamExport(c *gin.Context, query *models.Query, format dto.ExportFormat) {
+	userID := c.GetString("user_id")
+
+	if format != dto.ExportFormatCSV && format != dto.ExportFormatNDJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stream exports support csv and ndjson formats"})
+		return
+	}
+
+	// Failed and cancelled queries may have been stopped by the cost guard or sent for approval,
+	// so they are not re-run; see GetQueryResults
+	if query.Status == models.StatusFailed || query.Status == models.StatusCancelled {
+		c.JSON(http.StatusConflict, gin.H{
+			"query_id": query.ID.String(),
+			"status":   string(query.Status),
+			"error":    query.ErrorMessage,
+		})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var dataSource models.DataSource
+	if err := h.db.First(&dataSource, "id = ?", query.DataSourceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data source not found"})
+		return
+	}
+
+	// The query is re-run, so the exporting user needs read access to the data source now
+	if !h.checkReadPermission(c, userID, dataSource.ID.String()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to read from this data source"})
+		return
+	}
+
+	// No Content-Length is set, so the response is sent with chunked transfer encoding
+	filename := fmt.Sprintf("query_%s.%s", query.ID.String(), format)
+	_, contentType, _ := service.NewStreamRowWriter(string(format), io.Discard)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+
+	rowCount, err := h.queryService.StreamExportQuery(c.Request.Context(), userUUID, query, &dataSource, string(format), c.Writer)
+	if err != nil {
+		if c.Writer.Written() {
+			// Headers and part of the file are already sent; the client sees a truncated download
+			log.Printf("[ExportQuery] Stream export of query %s aborted after %d rows: %v", query.ID, rowCount, err)
+			return
+		}
+
+		// Nothing was sent yet, so replace the download headers with a JSON error
+		c.Header("Content-Disposition", "")
+		c.Header("Content-Type", "")
+		var guardErr *service.CostGuardError
+		if strings.Contains(err.Error(), "permission denied") {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else if strings.Contains(err.Error(), "only SELECT") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, service.ErrQueryTimeout) {
+			c.JSON(http.StatusRequestTimeout, gin.H{"error": err.Error()})
+		} else if errors.Is(err, service.ErrReadOnlyViolation) || errors.Is(err, service.ErrApprovalRequired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else if errors.As(err, &guardErr) {
+			respondCostGuard(c, query, guardErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// An empty result set still produces a valid (header-only) file
+	if !c.Writer.Written() {
+		c.Status(http.StatusOK)
+	}
+
+	log.Printf("[ExportQuery] Streamed %d rows for query %s", rowCount, query.ID)
+}
+
 // ValidateQuery validates SQL syntax using the dialect-specific AST parser for the given data source
 func (h *QueryHandler) ValidateQuery(c *gin.Context) {
 	var req dto.ValidateQueryRequest
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/yourorg/querybase/internal/api/middleware"
 	"github.com/yourorg/querybase/internal/auth"
 	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/service"
 	testauth "github.com/yourorg/querybase/internal/testutils/auth"
 	"github.com/yourorg/querybase/internal/testutils/fixtures"
 )
@@ -149,6 +151,7 @@ func setupQueryTestDB(t *testing.T) *gorm.DB {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -4341,6 +4344,11 @@ func (h *testExportQueryHandler) ExportQuery(c *gin.Context) {
 		return
 	}
 
+	if _, ok := service.GetExporter(string(req.Format)); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Format must be one of: %s", strings.Join(service.ExportFormats(), ", "))})
+		return
+	}
+
 	userID := c.GetString("user_id")
 
 	// Verify query exists
@@ -4484,7 +4492,7 @@ func TestExportQuery_InvalidFormat_ReturnsBadRequest(t *testing.T) {
 	admin := fixtures.CreateTestAdminUser(t, db)
 	token, _ := jwtManager.GenerateToken(admin.ID, admin.Email, string(models.RoleAdmin))
 
-	// Invalid format should fail binding validation
+	// Formats without a registered exporter are rejected
 	invalidReq := `{"query_id": "550e8400-e29b-41d4-a716-446655440000", "format": "xml"}`
 	req, _ := http.NewRequest("POST", "/api/v1/queries/export", bytes.NewBuffer([]byte(invalidReq)))
 	req.Header.Set("Content-Type", "application/json")
@@ -5194,3 +5202,117 @@ func TestCheckWritePermission_InvalidDataSourceID_ReturnsFalse(t *testing.T) {
 	assert.False(t, result, "Invalid data source ID should return false")
 	mockService.AssertNotCalled(t, "GetEffectivePermissions")
 }
+
+// =============================================================================
+// CancelQuery Tests
+// =============================================================================
+
+// setupRealQueryRouter serves the cancel and export routes with the real query handler
+func setupRealQueryRouter(t *testing.T, db *gorm.DB) (*gin.Engine, *auth.JWTManager) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	jwtManager := auth.NewJWTManager(testauth.TestJWTSecret, testauth.TestJWTExpireTime, testauth.TestJWTIssuer)
+	queryService := service.NewQueryService(db, service.NewLegacyKeyring("0123456789abcdef0123456789abcdef"), nil, nil)
+	queryHandler := NewQueryHandler(db, queryService)
+
+	queries := router.Group("/api/v1/queries")
+	queries.Use(middleware.AuthMiddleware(jwtManager, nil))
+	queries.POST("/:id/cancel", queryHandler.CancelQuery)
+	queries.POST("/export", queryHandler.ExportQuery)
+
+	return router, jwtManager
+}
+
+// createCancelTestQuery stores a query of the user with the given status
+func createCancelTestQuery(t *testing.T, db *gorm.DB, user *models.User, status models.QueryStatus, isAsync bool) *models.Query {
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  uuid.New(),
+		UserID:        user.ID,
+		QueryText:     "SELECT pg_sleep(60)",
+		OperationType: models.OperationSelect,
+		Status:        status,
+		IsAsync:       isAsync,
+	}
+	require.NoError(t, db.Create(query).Error)
+	return query
+}
+
+// TestCancelQuery_PendingAsyncQuery_CancelsBeforeExecution tests that a queued query is cancelled by its owner
+func TestCancelQuery_PendingAsyncQuery_CancelsBeforeExecution(t *testing.T) {
+	db := setupQueryTestDB(t)
+	router, jwtManager := setupRealQueryRouter(t, db)
+	owner := fixtures.CreateTestRegularUser(t, db)
+	query := createCancelTestQuery(t, db, owner, models.StatusPending, true)
+
+	w := serveJSON(router, http.MethodPost, "/api/v1/queries/"+query.ID.String()+"/cancel", tokenForUser(t, jwtManager, owner), nil)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"cancelled"`)
+	var stored models.Query
+	require.NoError(t, db.First(&stored, "id = ?", query.ID).Error)
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+}
+
+// TestCancelQuery_AccessControl tests that only the owner or an admin can cancel a query
+func TestCancelQuery_AccessControl(t *testing.T) {
+	db := setupQueryTestDB(t)
+	router, jwtManager := setupRealQueryRouter(t, db)
+	owner := fixtures.CreateTestRegularUser(t, db)
+	query := createCancelTestQuery(t, db, owner, models.StatusPending, true)
+	path := "/api/v1/queries/" + query.ID.String() + "/cancel"
+
+	w := serveJSON(router, http.MethodPost, path, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serveJSON(router, http.MethodPost, path, tokenForUser(t, jwtManager, fixtures.CreateTestRegularUser(t, db)), nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var stored models.Query
+	require.NoError(t, db.First(&stored, "id = ?", query.ID).Error)
+	assert.Equal(t, models.StatusPending, stored.Status)
+
+	w = serveJSON(router, http.MethodPost, path, tokenForUser(t, jwtManager, fixtures.CreateTestAdminUser(t, db)), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestCancelQuery_InvalidRequests tests the status codes of queries that can't be cancelled
+func TestCancelQuery_InvalidRequests(t *testing.T) {
+	db := setupQueryTestDB(t)
+	router, jwtManager := setupRealQueryRouter(t, db)
+	owner := fixtures.CreateTestRegularUser(t, db)
+	token := tokenForUser(t, jwtManager, owner)
+
+	w := serveJSON(router, http.MethodPost, "/api/v1/queries/not-a-uuid/cancel", token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveJSON(router, http.MethodPost, "/api/v1/queries/"+uuid.New().String()+"/cancel", token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	completed := createCancelTestQuery(t, db, owner, models.StatusCompleted, false)
+	w = serveJSON(router, http.MethodPost, "/api/v1/queries/"+completed.ID.String()+"/cancel", token, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Running, but neither on this server nor reachable on a worker without Redis
+	running := createCancelTestQuery(t, db, owner, models.StatusRunning, false)
+	w = serveJSON(router, http.MethodPost, "/api/v1/queries/"+running.ID.String()+"/cancel", token, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// TestExportQuery_StreamFailedQuery_ReturnsConflict tests that queries stopped before they ran aren't re-run by a stream export
+func TestExportQuery_StreamFailedQuery_ReturnsConflict(t *testing.T) {
+	db := setupQueryTestDB(t)
+	router, jwtManager := setupRealQueryRouter(t, db)
+	owner := fixtures.CreateTestRegularUser(t, db)
+	token := tokenForUser(t, jwtManager, owner)
+
+	for _, status := range []models.QueryStatus{models.StatusFailed, models.StatusCancelled} {
+		query := createCancelTestQuery(t, db, owner, status, false)
+		w := serveJSON(router, http.MethodPost, "/api/v1/queries/export", token, dto.ExportQueryRequest{
+			QueryID: query.ID.String(),
+			Format:  dto.ExportFormatCSV,
+			Mode:    dto.ExportModeStream,
+		})
+		assert.Equal(t, http.StatusConflict, w.Code, string(status))
+	}
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/service"
+	"gorm.io/gorm"
+)
+
+// ScheduleHandler handles scheduled query endpoints
+type ScheduleHandler struct {
+	db              *gorm.DB
+	scheduleService *service.ScheduleService
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(db *gorm.DB, scheduleService *service.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		db:              db,
+		scheduleService: scheduleService,
+	}
+}
+
+// CreateSchedule schedules a saved SELECT query for the current user
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var req dto.CreateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	queryID, err := uuid.Parse(req.QueryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query ID"})
+		return
+	}
+	configID, err := uuid.Parse(req.NotificationConfigID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification config ID"})
+		return
+	}
+
+	schedule := &models.QuerySchedule{
+		QueryID:              queryID,
+		UserID:               userID,
+		NotificationConfigID: configID,
+		Name:                 req.Name,
+		CronExpression:       req.CronExpression,
+		Timezone:             req.Timezone,
+		Delivery:             models.ScheduleDelivery(req.Delivery),
+	}
+	if schedule.ParameterValues, err = service.EncodeParameterValues(req.Parameters); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.scheduleService.CreateSchedule(c, schedule); err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduleResponse(schedule))
+}
+
+// ListSchedules lists the schedules of the current user, or all schedules for admins
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	schedules, total, err := h.scheduleService.ListSchedules(c, user.ID, user.Role == models.RoleAdmin, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedules"})
+		return
+	}
+
+	response := make([]dto.ScheduleResponse, len(schedules))
+	for i := range schedules {
+		response[i] = scheduleResponse(&schedules[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": response,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// GetSchedule returns a schedule
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduleResponse(schedule))
+}
+
+// UpdateSchedule changes a schedule. Setting is_active re-enables a schedule that was disabled,
+// after checking the owner has access again.
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c)
+	if !ok {
+		return
+	}
+
+	var req dto.UpdateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.NotificationConfigID != nil {
+		configID, err := uuid.Parse(*req.NotificationConfigID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification config ID"})
+			return
+		}
+		schedule.NotificationConfigID = configID
+	}
+	if req.Name != nil {
+		schedule.Name = *req.Name
+	}
+	if req.CronExpression != nil {
+		schedule.CronExpression = *req.CronExpression
+	}
+	if req.Timezone != nil {
+		schedule.Timezone = *req.Timezone
+	}
+	if req.Delivery != nil {
+		schedule.Delivery = models.ScheduleDelivery(*req.Delivery)
+	}
+	if req.IsActive != nil {
+		schedule.IsActive = *req.IsActive
+	}
+	if req.Parameters != nil {
+		values, err := service.EncodeParameterValues(req.Parameters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule.ParameterValues = values
+	}
+
+	if err := h.scheduleService.UpdateSchedule(c, schedule); err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	updated, err := h.scheduleService.GetSchedule(c, schedule.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, scheduleResponse(updated))
+}
+
+// DeleteSchedule deletes a schedule and its run history
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleService.DeleteSchedule(c, schedule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+// ListScheduleRuns returns the run history of a schedule, newest first
+func (h *ScheduleHandler) ListScheduleRuns(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	runs, total, err := h.scheduleService.ListScheduleRuns(c, schedule.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule runs"})
+		return
+	}
+
+	response := make([]dto.ScheduleRunResponse, len(runs))
+	for i, run := range runs {
+		response[i] = dto.ScheduleRunResponse{
+			ID:            run.ID.String(),
+			Status:        string(run.Status),
+			RowCount:      run.RowCount,
+			Delivery:      string(run.Delivery),
+			DeliveryError: run.DeliveryError,
+			ErrorMessage:  run.ErrorMessage,
+			ScheduledFor:  run.ScheduledFor.Format(time.RFC3339),
+			StartedAt:     run.StartedAt.Format(time.RFC3339),
+			FinishedAt:    formatOptionalTime(run.FinishedAt),
+		}
+		if run.QueryID != nil {
+			queryID := run.QueryID.String()
+			response[i].QueryID = &queryID
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":  response,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// currentUser loads the authenticated user, responding with an error if it can't
+func (h *ScheduleHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// loadSchedule loads the schedule in the URL if the current user owns it or is an admin
+func (h *ScheduleHandler) loadSchedule(c *gin.Context) (*models.QuerySchedule, bool) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	schedule, err := h.scheduleService.GetSchedule(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule"})
+		}
+		return nil, false
+	}
+
+	if user.Role != models.RoleAdmin && schedule.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return schedule, true
+}
+
+// respondScheduleError maps schedule validation and permission errors to status codes
+func respondScheduleError(c *gin.Context, err error) {
+	var paramErr *service.ParameterError
+	switch {
+	case errors.As(err, &paramErr):
+		respondParameterError(c, err)
+	case errors.Is(err, service.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case strings.Contains(err.Error(), "permission denied"):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// scheduleResponse converts a schedule to its API representation
+func scheduleResponse(schedule *models.QuerySchedule) dto.ScheduleResponse {
+	parameters, _ := service.DecodeParameterValues(&models.Query{ParameterValues: schedule.ParameterValues})
+
+	return dto.ScheduleResponse{
+		ID:                   schedule.ID.String(),
+		QueryID:              schedule.QueryID.String(),
+		UserID:               schedule.UserID.String(),
+		NotificationConfigID: schedule.NotificationConfigID.String(),
+		Name:                 schedule.Name,
+		CronExpression:       schedule.CronExpression,
+		Timezone:             schedule.Timezone,
+		Parameters:           parameters,
+		Delivery:             string(schedule.Delivery),
+		IsActive:             schedule.IsActive,
+		DisabledReason:       schedule.DisabledReason,
+		NextRunAt:            formatOptionalTime(schedule.NextRunAt),
+		LastRunAt:            formatOptionalTime(schedule.LastRunAt),
+		CreatedAt:            schedule.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// formatOptionalTime formats a nullable timestamp as RFC 3339
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/api/middleware"
+	"github.com/yourorg/querybase/internal/auth"
+	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/service"
+	testauth "github.com/yourorg/querybase/internal/testutils/auth"
+	"github.com/yourorg/querybase/internal/testutils/fixtures"
+)
+
+// tokenForUser issues an access token for a stored user
+func tokenForUser(t *testing.T, jwtManager *auth.JWTManager, user *models.User) string {
+	token, err := jwtManager.GenerateToken(user.ID, user.Email, string(user.Role))
+	require.NoError(t, err)
+	return token
+}
+
+// serveJSON sends a request with an optional JSON body and access token to the router
+func serveJSON(router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", createAuthHeader(token))
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// setupScheduleTestDB creates an in-memory SQLite database with the tables schedules need
+func setupScheduleTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Group{},
+		&models.UserGroup{},
+		&models.DataSource{},
+		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+		&models.Query{},
+		&models.QueryResult{},
+		&models.QueryHistory{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
+	)
+	require.NoError(t, err)
+
+	// SQLite can't scan the text[] notification events, so the table is created without them
+	require.NoError(t, db.Exec(`CREATE TABLE notification_configs (
+		id TEXT PRIMARY KEY,
+		group_id TEXT NOT NULL,
+		webhook_url TEXT NOT NULL,
+		channel TEXT NOT NULL DEFAULT 'google_chat',
+		is_active NUMERIC DEFAULT true,
+		created_at DATETIME,
+		updated_at DATETIME
+	)`).Error)
+
+	return db
+}
+
+// setupScheduleTestRouter serves the schedule routes with the real handler and service
+func setupScheduleTestRouter(t *testing.T, db *gorm.DB) (*gin.Engine, *auth.JWTManager) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	jwtManager := auth.NewJWTManager(testauth.TestJWTSecret, testauth.TestJWTExpireTime, testauth.TestJWTIssuer)
+	queryService := service.NewQueryService(db, service.NewLegacyKeyring("0123456789abcdef0123456789abcdef"), nil, nil)
+	scheduleHandler := NewScheduleHandler(db, service.NewScheduleService(db, queryService, service.NewNotificationService(db)))
+
+	schedules := router.Group("/api/v1/schedules")
+	schedules.Use(middleware.AuthMiddleware(jwtManager, nil))
+	{
+		schedules.POST("", scheduleHandler.CreateSchedule)
+		schedules.GET("", scheduleHandler.ListSchedules)
+		schedules.GET("/:id", scheduleHandler.GetSchedule)
+		schedules.PUT("/:id", scheduleHandler.UpdateSchedule)
+		schedules.DELETE("/:id", scheduleHandler.DeleteSchedule)
+		schedules.GET("/:id/runs", scheduleHandler.ListScheduleRuns)
+	}
+
+	return router, jwtManager
+}
+
+// scheduleFixture is a user who may read a data source, a query saved by that user, and a
+// notification channel of the user's group
+type scheduleFixture struct {
+	owner                *models.User
+	query                *models.Query
+	notificationConfigID uuid.UUID
+}
+
+func createScheduleFixture(t *testing.T, db *gorm.DB) *scheduleFixture {
+	owner := fixtures.CreateTestUser(t, db, models.RoleUser)
+	group := fixtures.CreateTestGroupWithUniqueName(t, db)
+	require.NoError(t, fixtures.AddUserToGroup(db, owner.ID, group.ID))
+	dataSource := fixtures.CreateTestDataSource(t, db, "schedule-ds-"+uuid.New().String()[:8])
+	_, err := fixtures.GrantPermission(db, group.ID, dataSource.ID, true, false, false)
+	require.NoError(t, err)
+
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  dataSource.ID,
+		UserID:        owner.ID,
+		QueryText:     "SELECT * FROM orders",
+		Name:          "Orders",
+		OperationType: models.OperationSelect,
+		Status:        models.StatusCompleted,
+	}
+	require.NoError(t, db.Create(query).Error)
+
+	configID := uuid.New()
+	require.NoError(t, db.Exec("INSERT INTO notification_configs (id, group_id, webhook_url, channel) VALUES (?, ?, ?, ?)",
+		configID, group.ID, "https://chat.example.com/webhook", models.NotificationChannelGoogleChat).Error)
+
+	return &scheduleFixture{owner: owner, query: query, notificationConfigID: configID}
+}
+
+// createScheduleRequest is a daily schedule of the fixture's saved query
+func (f *scheduleFixture) createScheduleRequest() dto.CreateScheduleRequest {
+	return dto.CreateScheduleRequest{
+		QueryID:              f.query.ID.String(),
+		NotificationConfigID: f.notificationConfigID.String(),
+		Name:                 "Daily orders",
+		CronExpression:       "0 9 * * *",
+		Timezone:             "UTC",
+	}
+}
+
+func TestScheduleHandler_CreateReadUpdateDelete(t *testing.T) {
+	db := setupScheduleTestDB(t)
+	router, jwtManager := setupScheduleTestRouter(t, db)
+	fixture := createScheduleFixture(t, db)
+	token := tokenForUser(t, jwtManager, fixture.owner)
+
+	w := serveJSON(router, http.MethodPost, "/api/v1/schedules", token, fixture.createScheduleRequest())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created dto.ScheduleResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, created.IsActive)
+	assert.NotNil(t, created.NextRunAt)
+	path := "/api/v1/schedules/" + created.ID
+
+	w = serveJSON(router, http.MethodGet, "/api/v1/schedules", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Schedules []dto.ScheduleResponse `json:"schedules"`
+		Total     int64                  `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.EqualValues(t, 1, list.Total)
+
+	w = serveJSON(router, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveJSON(router, http.MethodPut, path, token, map[string]interface{}{"name": "Orders at noon", "cron_expression": "0 12 * * *"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated dto.ScheduleResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "Orders at noon", updated.Name)
+	assert.Equal(t, "0 12 * * *", updated.CronExpression)
+
+	// Runs are recorded by the worker
+	scheduleID := uuid.MustParse(created.ID)
+	now := time.Now()
+	require.NoError(t, db.Create(&models.QueryScheduleRun{
+		ID:           uuid.New(),
+		ScheduleID:   scheduleID,
+		Status:       models.ScheduleRunSucceeded,
+		ScheduledFor: now,
+		StartedAt:    now,
+		FinishedAt:   &now,
+	}).Error)
+	w = serveJSON(router, http.MethodGet, path+"/runs", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var runs struct {
+		Runs  []dto.ScheduleRunResponse `json:"runs"`
+		Total int64                     `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	assert.EqualValues(t, 1, runs.Total)
+
+	w = serveJSON(router, http.MethodDelete, path, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveJSON(router, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var remaining int64
+	db.Model(&models.QueryScheduleRun{}).Where("schedule_id = ?", scheduleID).Count(&remaining)
+	assert.Zero(t, remaining, "runs are deleted with the schedule")
+}
+
+func TestScheduleHandler_InvalidRequests_ReturnBadRequest(t *testing.T) {
+	db := setupScheduleTestDB(t)
+	router, jwtManager := setupScheduleTestRouter(t, db)
+	fixture := createScheduleFixture(t, db)
+	token := tokenForUser(t, jwtManager, fixture.owner)
+
+	req := fixture.createScheduleRequest()
+	req.CronExpression = "every day"
+	w := serveJSON(router, http.MethodPost, "/api/v1/schedules", token, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = fixture.createScheduleRequest()
+	req.QueryID = "not-a-uuid"
+	w = serveJSON(router, http.MethodPost, "/api/v1/schedules", token, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = fixture.createScheduleRequest()
+	req.Delivery = "email"
+	w = serveJSON(router, http.MethodPost, "/api/v1/schedules", token, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	require.NoError(t, db.Model(fixture.query).Updates(map[string]interface{}{
+		"query_text":     "DELETE FROM orders",
+		"operation_type": models.OperationDelete,
+	}).Error)
+	w = serveJSON(router, http.MethodPost, "/api/v1/schedules", token, fixture.createScheduleRequest())
+	assert.Equal(t, http.StatusBadRequest, w.Code, "only SELECT queries can be scheduled")
+}
+
+func TestScheduleHandler_AccessControl(t *testing.T) {
+	db := setupScheduleTestDB(t)
+	router, jwtManager := setupScheduleTestRouter(t, db)
+	fixture := createScheduleFixture(t, db)
+	ownerToken := tokenForUser(t, jwtManager, fixture.owner)
+	otherToken := tokenForUser(t, jwtManager, fixtures.CreateTestUser(t, db, models.RoleUser))
+	adminToken := tokenForUser(t, jwtManager, fixtures.CreateTestUser(t, db, models.RoleAdmin))
+
+	w := serveJSON(router, http.MethodPost, "/api/v1/schedules", ownerToken, fixture.createScheduleRequest())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created dto.ScheduleResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	path := "/api/v1/schedules/" + created.ID
+
+	w = serveJSON(router, http.MethodGet, path, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Another user can't see or change the schedule, nor schedule the owner's query
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, path},
+		{http.MethodPut, path},
+		{http.MethodDelete, path},
+		{http.MethodGet, path + "/runs"},
+	} {
+		w = serveJSON(router, request.method, request.path, otherToken, map[string]interface{}{"name": "Mine now"})
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", request.method, request.path)
+	}
+	w = serveJSON(router, http.MethodGet, "/api/v1/schedules", otherToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":0`)
+	w = serveJSON(router, http.MethodPost, "/api/v1/schedules", otherToken, fixture.createScheduleRequest())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Admins see every schedule
+	w = serveJSON(router, http.MethodGet, path, adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveJSON(router, http.MethodGet, "/api/v1/schedules", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+
+	// Re-enabling a schedule checks the owner still has access
+	require.NoError(t, db.Where("user_id = ?", fixture.owner.ID).Delete(&models.UserGroup{}).Error)
+	w = serveJSON(router, http.MethodPut, path, ownerToken, map[string]interface{}{"is_active": true})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -3,11 +3,17 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/yourorg/querybase/internal/auth"
+	"github.com/yourorg/querybase/internal/models"
 	"github.com/yourorg/querybase/internal/service"
 )
 
@@ -23,6 +29,10 @@ type WebSocketHub struct {
 	broadcast  chan []byte
 	register   chan *websocket.Conn
 	unregister chan *websocket.Conn
+
+	// querySubscribers holds the connections waiting for each async query to finish
+	querySubscribers map[uuid.UUID]map[*websocket.Conn]bool
+	subscribersMutex sync.Mutex
 }
 
 // NewWebSocketHub creates a new WebSocket hub
@@ -32,6 +42,8 @@ func NewWebSocketHub() *WebSocketHub {
 		register:   make(chan *websocket.Conn),
 		unregister: make(chan *websocket.Conn),
 		clients:    make(map[*websocket.Conn]bool),
+
+		querySubscribers: make(map[uuid.UUID]map[*websocket.Conn]bool),
 	}
 }
 
@@ -46,6 +58,7 @@ func (h *WebSocketHub) Run() {
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
+				h.unsubscribeAll(client)
 				client.Close()
 				log.Printf("WebSocket client disconnected. Total clients: %d", len(h.clients))
 			}
@@ -64,6 +77,46 @@ func (h *WebSocketHub) Broadcast(message []byte) {
 	}
 }
 
+// subscribeQuery registers a connection for the completion event of a query
+func (h *WebSocketHub) subscribeQuery(queryID uuid.UUID, client *websocket.Conn) {
+	h.subscribersMutex.Lock()
+	defer h.subscribersMutex.Unlock()
+
+	if h.querySubscribers[queryID] == nil {
+		h.querySubscribers[queryID] = make(map[*websocket.Conn]bool)
+	}
+	h.querySubscribers[queryID][client] = true
+}
+
+// unsubscribeAll removes a connection from every query subscription
+func (h *WebSocketHub) unsubscribeAll(client *websocket.Conn) {
+	h.subscribersMutex.Lock()
+	defer h.subscribersMutex.Unlock()
+
+	for queryID, subscribers := range h.querySubscribers {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.querySubscribers, queryID)
+		}
+	}
+}
+
+// SendToQuerySubscribers sends a message to the connections subscribed to a query and
+// drops the subscription, since a query finishes only once
+func (h *WebSocketHub) SendToQuerySubscribers(queryID uuid.UUID, message []byte) {
+	h.subscribersMutex.Lock()
+	subscribers := h.querySubscribers[queryID]
+	delete(h.querySubscribers, queryID)
+	h.subscribersMutex.Unlock()
+
+	for client := range subscribers {
+		if err := client.WriteMessage(websocket.TextMessage, message); err != nil {
+			log.Printf("Error sending message to client: %v", err)
+			h.unregister <- client
+		}
+	}
+}
+
 // WebSocketUpgradeConfig configures WebSocket upgrade
 var WebSocketUpgradeConfig = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -77,6 +130,11 @@ var WebSocketUpgradeConfig = websocket.Upgrader{
 type WebSocketHandler struct {
 	hub           *WebSocketHub
 	schemaService *service.SchemaService
+
+	// Authentication of query subscriptions; see SetQueryAuth
+	jwtManager   *auth.JWTManager
+	blacklist    *service.TokenBlacklistService
+	queryService *service.QueryService
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
@@ -87,8 +145,46 @@ func NewWebSocketHandler(hub *WebSocketHub, schemaService *service.SchemaService
 	}
 }
 
+// SetQueryAuth enables subscribe_query. Connections authenticate with their access token, and
+// may only subscribe to their own queries unless they belong to an admin.
+func (h *WebSocketHandler) SetQueryAuth(jwtManager *auth.JWTManager, blacklist *service.TokenBlacklistService, queryService *service.QueryService) {
+	h.jwtManager = jwtManager
+	h.blacklist = blacklist
+	h.queryService = queryService
+}
+
+// authenticate validates the access token of a connection, from the token query parameter
+// (browsers can't set headers on a WebSocket) or the Authorization header. A connection
+// without a token is anonymous and gets nil claims.
+func (h *WebSocketHandler) authenticate(c *gin.Context) (*auth.Claims, error) {
+	token := c.Query("token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" || h.jwtManager == nil {
+		return nil, nil
+	}
+
+	claims, err := h.jwtManager.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if h.blacklist != nil {
+		if isBlacklisted, _ := h.blacklist.IsBlacklisted(c.Request.Context(), claims.ID); isBlacklisted {
+			return nil, errors.New("token has been revoked")
+		}
+	}
+	return claims, nil
+}
+
 // HandleWebSocket handles WebSocket connection upgrades
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
+	claims, err := h.authenticate(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
 	conn, err := WebSocketUpgradeConfig.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -130,13 +226,13 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 				continue
 			}
 
-			h.handleMessage(c.Request.Context(), conn, &wsMsg)
+			h.handleMessage(c.Request.Context(), conn, claims, &wsMsg)
 		}
 	}
 }
 
-// handleMessage processes incoming WebSocket messages
-func (h *WebSocketHandler) handleMessage(ctx context.Context, conn *websocket.Conn, msg *WebSocketMessage) {
+// handleMessage processes incoming WebSocket messages. claims is nil for anonymous connections.
+func (h *WebSocketHandler) handleMessage(ctx context.Context, conn *websocket.Conn, claims *auth.Claims, msg *WebSocketMessage) {
 	switch msg.Type {
 	case "get_schema":
 		// Client requests schema for a data source
@@ -178,6 +274,46 @@ func (h *WebSocketHandler) handleMessage(ctx context.Context, conn *websocket.Co
 		ackBytes, _ := json.Marshal(ackMsg)
 		conn.WriteMessage(websocket.TextMessage, ackBytes)
 
+	case "subscribe_query":
+		// Subscribe to the completion of an async query the connection's user submitted
+		payload, ok := msg.Payload.(map[string]interface{})
+		if !ok {
+			h.sendError(conn, "Invalid payload format")
+			return
+		}
+
+		queryIDStr, _ := payload["query_id"].(string)
+		queryID, err := uuid.Parse(queryIDStr)
+		if err != nil {
+			h.sendError(conn, "query_id is required")
+			return
+		}
+
+		if claims == nil || h.queryService == nil {
+			h.sendError(conn, "Authentication required to subscribe to queries")
+			return
+		}
+		query, err := h.queryService.GetQuery(ctx, queryID.String())
+		if err != nil {
+			h.sendError(conn, "Query not found")
+			return
+		}
+		if claims.Role != string(models.RoleAdmin) && query.UserID != claims.UserID {
+			h.sendError(conn, "Access denied")
+			return
+		}
+
+		h.hub.subscribeQuery(queryID, conn)
+		ackMsg := WebSocketMessage{
+			Type: "subscribed_query",
+			Payload: map[string]string{
+				"query_id": queryID.String(),
+				"message":  "Subscribed to query completion",
+			},
+		}
+		ackBytes, _ := json.Marshal(ackMsg)
+		conn.WriteMessage(websocket.TextMessage, ackBytes)
+
 	case "subscribe_stats":
 		// Subscribe to global dashboard stat updates
 		ackMsg := WebSocketMessage{
@@ -242,3 +378,19 @@ func (h *WebSocketHandler) BroadcastStatsChanged() {
 
 	h.hub.Broadcast(messageBytes)
 }
+
+// BroadcastQueryEvent notifies the subscribers of an async query that it has finished
+func (h *WebSocketHandler) BroadcastQueryEvent(event service.QueryEvent) {
+	message := WebSocketMessage{
+		Type:    "query_completed",
+		Payload: event,
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling query_completed: %v", err)
+		return
+	}
+
+	h.hub.SendToQuerySubscribers(event.QueryID, messageBytes)
+}
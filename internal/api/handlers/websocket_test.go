@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/yourorg/querybase/internal/auth"
+	"github.com/yourorg/querybase/internal/models"
+	"github.com/yourorg/querybase/internal/service"
+	testauth "github.com/yourorg/querybase/internal/testutils/auth"
+	"github.com/yourorg/querybase/internal/testutils/fixtures"
+)
+
+// setupWebSocketTestServer serves the WebSocket handler with query subscriptions enabled
+func setupWebSocketTestServer(t *testing.T, db *gorm.DB) (*httptest.Server, *auth.JWTManager) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	jwtManager := auth.NewJWTManager(testauth.TestJWTSecret, testauth.TestJWTExpireTime, testauth.TestJWTIssuer)
+	hub := NewWebSocketHub()
+	go hub.Run()
+	webSocketHandler := NewWebSocketHandler(hub, nil)
+	webSocketHandler.SetQueryAuth(jwtManager, nil, service.NewQueryService(db, service.NewLegacyKeyring("0123456789abcdef0123456789abcdef"), nil, nil))
+	router.GET("/ws", webSocketHandler.HandleWebSocket)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, jwtManager
+}
+
+// dialWebSocket opens a socket, with the token unless it is empty, and reads the welcome message
+func dialWebSocket(t *testing.T, server *httptest.Server, token string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	if token != "" {
+		url += "?token=" + token
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	var welcome WebSocketMessage
+	require.NoError(t, conn.ReadJSON(&welcome))
+	require.Equal(t, "connected", welcome.Type)
+	return conn
+}
+
+// subscribeQuery sends subscribe_query and returns the reply
+func subscribeQuery(t *testing.T, conn *websocket.Conn, queryID uuid.UUID) WebSocketMessage {
+	require.NoError(t, conn.WriteJSON(WebSocketMessage{
+		Type:    "subscribe_query",
+		Payload: map[string]string{"query_id": queryID.String()},
+	}))
+	var reply WebSocketMessage
+	require.NoError(t, conn.ReadJSON(&reply))
+	return reply
+}
+
+func TestWebSocket_SubscribeQuery_RequiresOwnerOrAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	server, jwtManager := setupWebSocketTestServer(t, db)
+
+	owner := fixtures.CreateTestUser(t, db, models.RoleUser)
+	other := fixtures.CreateTestUser(t, db, models.RoleUser)
+	admin := fixtures.CreateTestUser(t, db, models.RoleAdmin)
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  uuid.New(),
+		UserID:        owner.ID,
+		QueryText:     "SELECT 1",
+		OperationType: models.OperationSelect,
+		Status:        models.StatusPending,
+	}
+	require.NoError(t, db.Create(query).Error)
+
+	tokenFor := func(user *models.User) string {
+		token, err := jwtManager.GenerateToken(user.ID, user.Email, string(user.Role))
+		require.NoError(t, err)
+		return token
+	}
+
+	// Anonymous sockets may connect, but not subscribe
+	reply := subscribeQuery(t, dialWebSocket(t, server, ""), query.ID)
+	assert.Equal(t, "error", reply.Type)
+
+	reply = subscribeQuery(t, dialWebSocket(t, server, tokenFor(other)), query.ID)
+	assert.Equal(t, "error", reply.Type)
+	assert.Equal(t, "Access denied", reply.Payload.(map[string]interface{})["error"])
+
+	reply = subscribeQuery(t, dialWebSocket(t, server, tokenFor(owner)), query.ID)
+	assert.Equal(t, "subscribed_query", reply.Type)
+
+	reply = subscribeQuery(t, dialWebSocket(t, server, tokenFor(admin)), query.ID)
+	assert.Equal(t, "subscribed_query", reply.Type)
+
+	reply = subscribeQuery(t, dialWebSocket(t, server, tokenFor(owner)), uuid.New())
+	assert.Equal(t, "error", reply.Type)
+}
+
+func TestWebSocket_InvalidToken_ReturnsUnauthorized(t *testing.T) {
+	db := setupTestDB(t)
+	server, _ := setupWebSocketTestServer(t, db)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=not-a-token"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -14,7 +14,7 @@ import (
 )
 
 // SetupRoutes configures all API routes
-func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHandler *handlers.QueryHandler, approvalHandler *handlers.ApprovalHandler, dataSourceHandler *handlers.DataSourceHandler, groupHandler *handlers.GroupHandler, schemaHandler *handlers.SchemaHandler, webSocketHandler *handlers.WebSocketHandler, statsHandler *handlers.StatsHandler, multiQueryHandler *handlers.MultiQueryHandler, jwtManager *auth.JWTManager, blacklist *service.TokenBlacklistService) {
+func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHandler *handlers.QueryHandler, approvalHandler *handlers.ApprovalHandler, dataSourceHandler *handlers.DataSourceHandler, groupHandler *handlers.GroupHandler, schemaHandler *handlers.SchemaHandler, webSocketHandler *handlers.WebSocketHandler, statsHandler *handlers.StatsHandler, multiQueryHandler *handlers.MultiQueryHandler, scheduleHandler *handlers.ScheduleHandler, accessConfigHandler *handlers.AccessConfigHandler, jwtManager *auth.JWTManager, blacklist *service.TokenBlacklistService) {
 	// Serve static files from the "web/out" directory
 	// This assumes the frontend has been built to this directory
 	router.Use(func(c *gin.Context) {
@@ -163,6 +163,7 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHan
 				queries.GET("/:id", queryHandler.GetQuery)
 				queries.GET("/:id/results", queryHandler.GetQueryResults)
 				queries.DELETE("/:id", queryHandler.DeleteQuery)
+				queries.POST("/:id/cancel", queryHandler.CancelQuery)
 
 				// Query history routes
 				queries.GET("/history", queryHandler.ListQueryHistory)
@@ -188,6 +189,17 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHan
 				queries.POST("/multi/:id/rollback", multiQueryHandler.RollbackMultiQuery)
 			}
 
+			// Scheduled query routes
+			schedules := protected.Group("/schedules")
+			{
+				schedules.POST("", scheduleHandler.CreateSchedule)
+				schedules.GET("", scheduleHandler.ListSchedules)
+				schedules.GET("/:id", scheduleHandler.GetSchedule)
+				schedules.PUT("/:id", scheduleHandler.UpdateSchedule)
+				schedules.DELETE("/:id", scheduleHandler.DeleteSchedule)
+				schedules.GET("/:id/runs", scheduleHandler.ListScheduleRuns)
+			}
+
 			// Approval routes
 			approvals := protected.Group("/approvals")
 			{
@@ -232,6 +244,7 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHan
 				datasources.GET("/:id/permissions", dataSourceHandler.GetPermissions)
 				datasources.POST("/:id/test", dataSourceHandler.TestConnection)
 				datasources.GET("/:id/health", dataSourceHandler.CheckHealth)
+				datasources.GET("/:id/health/history", dataSourceHandler.GetHealthHistory)
 				datasources.GET("/:id/approvers", approvalHandler.GetEligibleApprovers)
 			}
 
@@ -243,11 +256,20 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHan
 				{
 					adminDatasources.POST("", dataSourceHandler.CreateDataSource)
 					adminDatasources.POST("/test", dataSourceHandler.TestConnectionWithParams)
+					adminDatasources.GET("/pool-stats", dataSourceHandler.GetPoolStats)
 					adminDatasources.PUT("/:id", dataSourceHandler.UpdateDataSource)
 					adminDatasources.DELETE("/:id", dataSourceHandler.DeleteDataSource)
 					adminDatasources.PUT("/:id/permissions", dataSourceHandler.SetPermissions)
 					adminDatasources.POST("/:id/test-audit", dataSourceHandler.TestAuditCapability)
 				}
+
+				// Declarative access config: data sources, groups, members and permissions as one document
+				accessConfig := admin.Group("/config")
+				{
+					accessConfig.GET("/export", accessConfigHandler.ExportAccessConfig)
+					accessConfig.POST("/plan", accessConfigHandler.PlanAccessConfig)
+					accessConfig.POST("/apply", accessConfigHandler.ApplyAccessConfig)
+				}
 			}
 
 			// // Data source routes (to be implemented)
@@ -264,6 +286,7 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, queryHan
 		}
 	}
 
-	// WebSocket endpoint (no auth required for simplicity, can be added later)
+	// WebSocket endpoint. Authentication is optional and checked by the handler: an access token
+	// in the token query parameter is required to subscribe to query completion.
 	router.GET("/ws", webSocketHandler.HandleWebSocket)
 }
@@ -10,11 +10,21 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	CORS     CORSConfig     `mapstructure:"cors"`
+	Server         ServerConfig         `mapstructure:"server"`
+	Database       DatabaseConfig       `mapstructure:"database"`
+	Redis          RedisConfig          `mapstructure:"redis"`
+	JWT            JWTConfig            `mapstructure:"jwt"`
+	CORS           CORSConfig           `mapstructure:"cors"`
+	DataSourcePool DataSourcePoolConfig `mapstructure:"datasource_pool"`
+	QueryLimits    QueryLimitsConfig    `mapstructure:"query_limits"`
+	Schedules      SchedulesConfig      `mapstructure:"schedules"`
+	Retention      RetentionConfig      `mapstructure:"result_retention"`
+	ResultCache    ResultCacheConfig    `mapstructure:"result_cache"`
+	Secrets        SecretsConfig        `mapstructure:"secrets"`
+	Encryption     EncryptionConfig     `mapstructure:"encryption"`
+	HealthHistory  HealthHistoryConfig  `mapstructure:"health_history"`
+	// Environments maps a data source environment (dev, staging, prod or custom) to its policy
+	Environments map[string]EnvironmentPolicyConfig `mapstructure:"environments"`
 }
 
 // ServerConfig represents the server configuration
@@ -64,6 +74,106 @@ type CORSConfig struct {
 	MaxAge int `mapstructure:"max_age"`
 }
 
+// DataSourcePoolConfig represents the connection pool settings used for each data source
+type DataSourcePoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+}
+
+// QueryLimitsConfig represents result size limits applied per user role
+type QueryLimitsConfig struct {
+	// Roles maps a user role (admin, user, viewer) to its result limits
+	Roles map[string]ResultLimitConfig `mapstructure:"roles"`
+}
+
+// ResultLimitConfig represents the maximum size of a stored SELECT result (0 = unlimited)
+type ResultLimitConfig struct {
+	MaxRows  int   `mapstructure:"max_rows"`
+	MaxBytes int64 `mapstructure:"max_bytes"`
+}
+
+// EnvironmentPolicyConfig represents the rules queries on the data sources of an environment follow
+type EnvironmentPolicyConfig struct {
+	// RequiredApprovals is how many approvals a request needs; 0 runs writes without approval
+	RequiredApprovals int `mapstructure:"required_approvals"`
+	// SelectRequiresApproval sends SELECTs to approval like writes
+	SelectRequiresApproval bool `mapstructure:"select_requires_approval"`
+	// MaxRows caps SELECT results on top of the data source and role limits (0 = unlimited)
+	MaxRows int `mapstructure:"max_rows"`
+	// AllowAdminDirectExecution lets admins run any query without approval
+	AllowAdminDirectExecution bool `mapstructure:"allow_admin_direct_execution"`
+}
+
+// SchedulesConfig represents the settings of scheduled query runs
+type SchedulesConfig struct {
+	// PollInterval is how often the worker looks for due schedules
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// AppURL is the base URL of the web app used in result links
+	AppURL string `mapstructure:"app_url"`
+	// MaxAttachmentBytes is the largest CSV sent as a file; larger results are sent as a link
+	MaxAttachmentBytes int64 `mapstructure:"max_attachment_bytes"`
+}
+
+// RetentionConfig represents how long stored query results are kept (0 disables a rule).
+// Data sources can override each rule.
+type RetentionConfig struct {
+	// Interval is how often the worker purges results
+	Interval time.Duration `mapstructure:"interval"`
+	// MaxAge purges results stored longer ago than this
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// MaxTotalBytes purges the oldest results of a data source beyond this total size
+	MaxTotalBytes int64 `mapstructure:"max_total_bytes"`
+	// KeepLastPerUser keeps only the newest N results of each user on a data source
+	KeepLastPerUser int `mapstructure:"keep_last_per_user"`
+}
+
+// ResultCacheConfig represents the Redis cache of SELECT results. Caching is enabled per
+// data source by setting its result cache TTL.
+type ResultCacheConfig struct {
+	// MaxEntryBytes skips caching results larger than this (0 means no limit)
+	MaxEntryBytes int64 `mapstructure:"max_entry_bytes"`
+}
+
+// SecretsConfig represents the external stores data source passwords can be read from at connect time
+type SecretsConfig struct {
+	// CacheTTL is how long a resolved secret is reused before it is read again
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	// EnvPrefix is the prefix of the environment variables data sources may read, so that
+	// they can't read the server's own settings
+	EnvPrefix string `mapstructure:"env_prefix"`
+	// FileDir is the directory secret files are mounted in; file references are relative to it
+	FileDir string            `mapstructure:"file_dir"`
+	HTTP    SecretsHTTPConfig `mapstructure:"http"`
+}
+
+// SecretsHTTPConfig represents an HTTP secrets manager. A secret is read with GET {URL}/{reference},
+// which returns a JSON object holding the secret in ValueField. Empty URL disables the provider.
+type SecretsHTTPConfig struct {
+	URL        string        `mapstructure:"url"`
+	Token      string        `mapstructure:"token"` // sent as a bearer token
+	ValueField string        `mapstructure:"value_field"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// HealthHistoryConfig represents how the health probes of data sources are kept
+type HealthHistoryConfig struct {
+	// Retention is how long probes are kept; older ones are deleted as new ones are recorded
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// EncryptionConfig represents the keys data source secrets are encrypted with
+type EncryptionConfig struct {
+	// ActiveKey is the ID of the key new secrets are encrypted with
+	ActiveKey string `mapstructure:"active_key"`
+	// Keys is a comma-separated list of id:key pairs of 32-character keys. Every key listed can
+	// decrypt, so a retired key stays listed until its secrets are re-encrypted.
+	Keys string `mapstructure:"keys"`
+	// LegacyKey decrypts secrets stored without a key ID, which were encrypted with jwt.secret
+	LegacyKey string `mapstructure:"legacy_key"`
+}
+
 // Load loads the configuration from file and environment variables
 func Load(path string) (*Config, error) {
 	viper.SetConfigFile(path)
@@ -82,6 +192,36 @@ func Load(path string) (*Config, error) {
 	viper.SetDefault("cors.allowed_origins", "http://localhost:3000,http://localhost:3001,http://localhost:8080")
 	viper.SetDefault("cors.allow_credentials", true)
 	viper.SetDefault("cors.max_age", 86400) // 24 hours
+	viper.SetDefault("datasource_pool.max_open_conns", 10)
+	viper.SetDefault("datasource_pool.max_idle_conns", 2)
+	viper.SetDefault("datasource_pool.conn_max_lifetime", 30*time.Minute)
+	viper.SetDefault("datasource_pool.conn_max_idle_time", 5*time.Minute)
+	viper.SetDefault("query_limits.roles.admin.max_rows", 100000)
+	viper.SetDefault("query_limits.roles.admin.max_bytes", 200*1024*1024)
+	viper.SetDefault("query_limits.roles.user.max_rows", 10000)
+	viper.SetDefault("query_limits.roles.user.max_bytes", 50*1024*1024)
+	viper.SetDefault("query_limits.roles.viewer.max_rows", 5000)
+	viper.SetDefault("query_limits.roles.viewer.max_bytes", 20*1024*1024)
+	viper.SetDefault("environments.dev.required_approvals", 0)
+	viper.SetDefault("environments.dev.allow_admin_direct_execution", true)
+	viper.SetDefault("environments.staging.required_approvals", 1)
+	viper.SetDefault("environments.staging.allow_admin_direct_execution", true)
+	viper.SetDefault("environments.prod.required_approvals", 1)
+	viper.SetDefault("environments.prod.allow_admin_direct_execution", false)
+	viper.SetDefault("schedules.poll_interval", time.Minute)
+	viper.SetDefault("schedules.app_url", "http://localhost:3000")
+	viper.SetDefault("schedules.max_attachment_bytes", 10*1024*1024)
+	viper.SetDefault("result_retention.interval", time.Hour)
+	viper.SetDefault("result_retention.max_age", 30*24*time.Hour)
+	viper.SetDefault("result_retention.max_total_bytes", 1024*1024*1024)
+	viper.SetDefault("result_retention.keep_last_per_user", 100)
+	viper.SetDefault("result_cache.max_entry_bytes", 5*1024*1024)
+	viper.SetDefault("secrets.cache_ttl", time.Minute)
+	viper.SetDefault("secrets.env_prefix", "QUERYBASE_SECRET_")
+	viper.SetDefault("secrets.file_dir", "/run/secrets")
+	viper.SetDefault("secrets.http.value_field", "value")
+	viper.SetDefault("secrets.http.timeout", 5*time.Second)
+	viper.SetDefault("health_history.retention", 30*24*time.Hour)
 
 	// Allow environment variables to override config
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
@@ -99,6 +239,15 @@ func Load(path string) (*Config, error) {
 	return &config, nil
 }
 
+// DataSourceEncryption returns the encryption settings of data source secrets. Without keys, secrets
+// are still encrypted with the JWT secret, as they were before encryption keys were configured.
+func (c *Config) DataSourceEncryption() EncryptionConfig {
+	if c.Encryption.Keys == "" && c.Encryption.LegacyKey == "" {
+		return EncryptionConfig{LegacyKey: c.JWT.Secret}
+	}
+	return c.Encryption
+}
+
 // GetDatabaseDSN returns the database connection string
 func (c *DatabaseConfig) GetDatabaseDSN() string {
 	// Default to PostgreSQL if dialect not specified
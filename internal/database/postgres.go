@@ -51,6 +51,8 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.Group{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+		&models.DataSourceHealthCheck{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -61,5 +63,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.ApprovalComment{},
 		&models.NotificationConfig{},
 		&models.Notification{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
 	)
 }
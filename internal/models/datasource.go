@@ -13,6 +13,7 @@ type DataSourceType string
 const (
 	DataSourceTypePostgreSQL DataSourceType = "postgresql"
 	DataSourceTypeMySQL      DataSourceType = "mysql"
+	DataSourceTypeSQLite     DataSourceType = "sqlite"
 )
 
 // Legacy constants for compatibility
@@ -30,28 +31,93 @@ const (
 	AuditCapabilityUnknown   AuditCapability = "unknown"    // Not yet tested
 )
 
+// CostGuardAction is what happens to a SELECT whose EXPLAIN estimate exceeds a cost guard threshold
+type CostGuardAction string
+
+const (
+	CostGuardBlock    CostGuardAction = "block"    // The query is rejected
+	CostGuardWarn     CostGuardAction = "warn"     // The query runs and the response carries a warning
+	CostGuardApproval CostGuardAction = "approval" // The query is sent through the approval workflow
+)
+
+// DataSourceTLSMode is how a connection to a data source uses TLS. The modes follow PostgreSQL's sslmode.
+type DataSourceTLSMode string
+
+const (
+	TLSModeDisable    DataSourceTLSMode = "disable"     // Plaintext connections
+	TLSModeRequire    DataSourceTLSMode = "require"     // Encrypted, without verifying the server certificate
+	TLSModeVerifyCA   DataSourceTLSMode = "verify-ca"   // Encrypted, and the server certificate is signed by a trusted CA
+	TLSModeVerifyFull DataSourceTLSMode = "verify-full" // Encrypted, and the server certificate is trusted and names the server
+)
+
+// CredentialSource is where the password of a data source is read from
+type CredentialSource string
+
+const (
+	CredentialSourceEncrypted CredentialSource = "encrypted" // Stored encrypted with the data source
+	CredentialSourceEnv       CredentialSource = "env"       // An environment variable of the server and worker
+	CredentialSourceFile      CredentialSource = "file"      // A file mounted on the server and worker
+	CredentialSourceHTTP      CredentialSource = "http"      // The HTTP secrets manager
+)
+
+// Built-in data source environments. Any other name is a custom environment, which
+// follows the prod policy unless it has its own.
+const (
+	EnvironmentDev     = "dev"
+	EnvironmentStaging = "staging"
+	EnvironmentProd    = "prod"
+)
+
 // DataSource represents a database connection
 type DataSource struct {
-	ID                uuid.UUID              `gorm:"type:uuid;primary_key" json:"id"`
-	Name              string                 `gorm:"not null" json:"name"`
-	Type              DataSourceType         `gorm:"not null" json:"type"`
-	Host              string                 `gorm:"not null" json:"host"`
-	Port              int                    `gorm:"not null" json:"port"`
-	DatabaseName      string                 `gorm:"not null" json:"database_name"`
-	Username          string                 `gorm:"not null" json:"username"`
-	EncryptedPassword string                 `gorm:"type:text;not null" json:"-"`
-	ConnectionParams  string                 `gorm:"type:jsonb;default:'{}'" json:"connection_params"`
-	IsActive          bool                   `gorm:"default:true" json:"is_active"`
-	IsHealthy         bool                   `gorm:"default:true" json:"is_healthy"`
-	AuditRowThreshold int                    `gorm:"default:1000" json:"audit_row_threshold"`
-	AuditCapability   AuditCapability        `gorm:"default:'unknown'" json:"audit_capability"`
-	LastSchemaSync    *time.Time             `json:"last_schema_sync"`
-	LastHealthCheck   *time.Time             `json:"last_health_check"`
-	CreatedBy         *uuid.UUID             `gorm:"type:uuid" json:"created_by"`
-	CreatedAt         time.Time              `json:"created_at"`
-	UpdatedAt         time.Time              `json:"updated_at"`
-	DeletedAt         gorm.DeletedAt         `gorm:"index" json:"-"`
-	Permissions       []DataSourcePermission `gorm:"foreignKey:DataSourceID" json:"-"`
+	ID                      uuid.UUID              `gorm:"type:uuid;primary_key" json:"id"`
+	Name                    string                 `gorm:"not null" json:"name"`
+	Type                    DataSourceType         `gorm:"not null" json:"type"`
+	Environment             string                 `gorm:"not null;default:'prod'" json:"environment"` // selects the approval and row limit policy
+	Host                    string                 `gorm:"not null" json:"host"`
+	Port                    int                    `gorm:"not null" json:"port"`
+	DatabaseName            string                 `gorm:"not null" json:"database_name"`
+	FilePath                string                 `gorm:"not null;default:''" json:"file_path"` // database file of SQLite data sources, which have no host or credentials
+	Username                string                 `gorm:"not null" json:"username"`
+	EncryptedPassword       string                 `gorm:"type:text;not null" json:"-"`
+	CredentialSource        CredentialSource       `gorm:"not null;default:'encrypted'" json:"credential_source"`
+	CredentialRef           string                 `gorm:"not null;default:''" json:"credential_ref"` // variable, file or secret name the password is read from at connect time
+	ConnectionParams        string                 `gorm:"type:jsonb;default:'{}'" json:"connection_params"`
+	IsActive                bool                   `gorm:"default:true" json:"is_active"`
+	IsHealthy               bool                   `gorm:"default:true" json:"is_healthy"`
+	AuditRowThreshold       int                    `gorm:"default:1000" json:"audit_row_threshold"`
+	AuditCapability         AuditCapability        `gorm:"default:'unknown'" json:"audit_capability"`
+	StatementTimeoutSeconds int                    `gorm:"not null;default:300" json:"statement_timeout_seconds"`
+	MaxResultRows           int                    `gorm:"not null;default:10000" json:"max_result_rows"`
+	MaxResultBytes          int64                  `gorm:"not null;default:52428800" json:"max_result_bytes"`
+	ResultMaxAgeHours       *int                   `json:"result_max_age_hours"`                               // retention override; nil uses the global setting, 0 disables the rule
+	ResultMaxTotalBytes     *int64                 `json:"result_max_total_bytes"`                             // retention override; nil uses the global setting, 0 disables the rule
+	ResultKeepLastPerUser   *int                   `json:"result_keep_last_per_user"`                          // retention override; nil uses the global setting, 0 disables the rule
+	ResultCacheTTLSeconds   int                    `gorm:"not null;default:0" json:"result_cache_ttl_seconds"` // SELECT results are cached in Redis this long; 0 disables the cache
+	CostGuardMaxCost        float64                `gorm:"not null;default:0" json:"cost_guard_max_cost"`      // highest planner cost a SELECT may have; 0 disables the rule
+	CostGuardMaxRows        int64                  `gorm:"not null;default:0" json:"cost_guard_max_rows"`      // highest planner row estimate a SELECT may have; 0 disables the rule
+	CostGuardAction         CostGuardAction        `gorm:"not null;default:'block'" json:"cost_guard_action"`
+	MaxReplicaLagSeconds    int                    `gorm:"not null;default:30" json:"max_replica_lag_seconds"` // reads fall back to the primary when replicas lag more
+	SessionInitStatements   *string                `gorm:"type:jsonb" json:"-"`                                // JSON []string of SET statements run on every new connection
+	TLSMode                 DataSourceTLSMode      `gorm:"not null;default:'disable'" json:"tls_mode"`
+	TLSServerName           string                 `gorm:"not null;default:''" json:"tls_server_name"` // name the server certificate must have; empty uses the host
+	EncryptedTLSCACert      string                 `gorm:"type:text;not null;default:''" json:"-"`     // PEM CA bundle; empty trusts the system roots
+	EncryptedTLSClientCert  string                 `gorm:"type:text;not null;default:''" json:"-"`     // PEM client certificate for mutual TLS
+	EncryptedTLSClientKey   string                 `gorm:"type:text;not null;default:''" json:"-"`     // PEM private key of the client certificate
+	SSHHost                 string                 `gorm:"not null;default:''" json:"ssh_host"`        // bastion the data source is reached through; empty connects directly
+	SSHPort                 int                    `gorm:"not null;default:22" json:"ssh_port"`
+	SSHUser                 string                 `gorm:"not null;default:''" json:"ssh_user"`
+	EncryptedSSHPrivateKey  string                 `gorm:"type:text;not null;default:''" json:"-"`
+	EncryptedSSHPassword    string                 `gorm:"type:text;not null;default:''" json:"-"`
+	SSHKnownHosts           string                 `gorm:"type:text;not null;default:''" json:"ssh_known_hosts"` // known_hosts lines pinning the host key of the bastion
+	LastSchemaSync          *time.Time             `json:"last_schema_sync"`
+	LastHealthCheck         *time.Time             `json:"last_health_check"`
+	CreatedBy               *uuid.UUID             `gorm:"type:uuid" json:"created_by"`
+	CreatedAt               time.Time              `json:"created_at"`
+	UpdatedAt               time.Time              `json:"updated_at"`
+	DeletedAt               gorm.DeletedAt         `gorm:"index" json:"-"`
+	Permissions             []DataSourcePermission `gorm:"foreignKey:DataSourceID" json:"-"`
+	Replicas                []DataSourceReplica    `gorm:"foreignKey:DataSourceID" json:"replicas,omitempty"`
 }
 
 // TableName specifies the table name for DataSource
@@ -59,6 +125,69 @@ func (DataSource) TableName() string {
 	return "data_sources"
 }
 
+// DataSourceReplica is a read replica of a data source. Replicas share the database name and
+// credentials of their data source; only the endpoint differs.
+type DataSourceReplica struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	DataSourceID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"data_source_id"`
+	Host          string     `gorm:"not null" json:"host"`
+	Port          int        `gorm:"not null" json:"port"`
+	IsHealthy     bool       `gorm:"not null;default:false" json:"is_healthy"` // reachable at the last health check
+	LagSeconds    *float64   `json:"lag_seconds"`                              // replication lag at the last health check; nil when unknown
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for DataSourceReplica
+func (DataSourceReplica) TableName() string {
+	return "data_source_replicas"
+}
+
+// HealthProbeSource is what ran a health probe of a data source
+type HealthProbeSource string
+
+const (
+	HealthProbeCheck      HealthProbeSource = "health_check" // A health check requested through the API
+	HealthProbeSchemaSync HealthProbeSource = "schema_sync"  // The periodic schema sync of the worker
+)
+
+// HealthErrorClass is why a health probe failed
+type HealthErrorClass string
+
+const (
+	HealthErrorCredentials HealthErrorClass = "credentials"        // The password could not be read or decrypted
+	HealthErrorSSHTunnel   HealthErrorClass = "ssh_tunnel"         // The SSH bastion could not be reached
+	HealthErrorTLS         HealthErrorClass = "tls"                // The TLS handshake failed
+	HealthErrorAuth        HealthErrorClass = "auth"               // The database refused the credentials
+	HealthErrorDNS         HealthErrorClass = "dns"                // The host name did not resolve
+	HealthErrorRefused     HealthErrorClass = "connection_refused" // Nothing listens on the host and port
+	HealthErrorTimeout     HealthErrorClass = "timeout"            // The database did not answer in time
+	HealthErrorOther       HealthErrorClass = "other"
+)
+
+// DataSourceHealthCheck is one health probe of a data source. Probes are kept as a time series
+// for uptime and latency history.
+type DataSourceHealthCheck struct {
+	ID                uuid.UUID         `gorm:"type:uuid;primary_key" json:"id"`
+	DataSourceID      uuid.UUID         `gorm:"type:uuid;not null;index:idx_data_source_health_checks_checked_at,priority:1" json:"data_source_id"`
+	CheckedAt         time.Time         `gorm:"not null;index:idx_data_source_health_checks_checked_at,priority:2" json:"checked_at"`
+	Source            HealthProbeSource `gorm:"not null" json:"source"`
+	Status            string            `gorm:"not null" json:"status"` // healthy, degraded or unhealthy
+	ConnectLatencyMs  *int64            `json:"connect_latency_ms"`     // time to open a connection; nil when it failed
+	PingLatencyMs     *int64            `json:"ping_latency_ms"`        // round trip on the open connection; nil when it failed
+	ErrorClass        HealthErrorClass  `gorm:"not null;default:''" json:"error_class,omitempty"`
+	Error             string            `gorm:"type:text;not null;default:''" json:"error,omitempty"`
+	ServerVersion     string            `gorm:"not null;default:''" json:"server_version,omitempty"`
+	ReplicaLagSeconds *float64          `json:"replica_lag_seconds"` // largest lag of the replicas; nil without measured replicas
+}
+
+// TableName specifies the table name for DataSourceHealthCheck
+func (DataSourceHealthCheck) TableName() string {
+	return "data_source_health_checks"
+}
+
 // GetPassword returns the encrypted password
 func (ds *DataSource) GetPassword() string {
 	return ds.EncryptedPassword
@@ -69,6 +198,16 @@ func (ds *DataSource) SetPassword(password string) {
 	ds.EncryptedPassword = password
 }
 
+// UsesSSHTunnel reports whether the data source is reached through an SSH bastion
+func (ds *DataSource) UsesSSHTunnel() bool {
+	return ds.SSHHost != ""
+}
+
+// UsesExternalCredentials reports whether the password of the data source is read from a secret provider
+func (ds *DataSource) UsesExternalCredentials() bool {
+	return ds.CredentialSource != "" && ds.CredentialSource != CredentialSourceEncrypted
+}
+
 // GetDatabase returns the database name
 func (ds *DataSource) GetDatabase() string {
 	return ds.DatabaseName
@@ -32,16 +32,27 @@ const (
 	NotificationFailed  = NotificationStatusFailed
 )
 
-// NotificationConfig represents Google Chat webhook configuration
+// NotificationChannel represents the kind of endpoint behind a webhook URL
+type NotificationChannel string
+
+const (
+	// NotificationChannelGoogleChat posts Google Chat cards; files can't be attached
+	NotificationChannelGoogleChat NotificationChannel = "google_chat"
+	// NotificationChannelWebhook posts JSON, or multipart/form-data when a file is attached
+	NotificationChannelWebhook NotificationChannel = "webhook"
+)
+
+// NotificationConfig represents a webhook configuration of a group
 type NotificationConfig struct {
-	ID                 uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
-	GroupID            uuid.UUID `gorm:"type:uuid;not null" json:"group_id"`
-	WebhookURL         string    `gorm:"type:text;not null" json:"webhook_url"`
-	IsActive           bool      `gorm:"default:true" json:"is_active"`
-	NotificationEvents []string  `gorm:"type:text[];not null;default:'{approval_request,approval_status_change,query_result}'" json:"notification_events"`
-	CreatedAt          time.Time `json:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at"`
-	Group              Group     `gorm:"foreignKey:GroupID" json:"-"`
+	ID                 uuid.UUID           `gorm:"type:uuid;primary_key" json:"id"`
+	GroupID            uuid.UUID           `gorm:"type:uuid;not null" json:"group_id"`
+	WebhookURL         string              `gorm:"type:text;not null" json:"webhook_url"`
+	Channel            NotificationChannel `gorm:"size:20;not null;default:google_chat" json:"channel"`
+	IsActive           bool                `gorm:"default:true" json:"is_active"`
+	NotificationEvents []string            `gorm:"type:text[];not null;default:'{approval_request,approval_status_change,query_result}'" json:"notification_events"`
+	CreatedAt          time.Time           `json:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at"`
+	Group              Group               `gorm:"foreignKey:GroupID" json:"-"`
 }
 
 // TableName specifies the table name for NotificationConfig
@@ -15,6 +15,7 @@ const (
 	StatusRunning   QueryStatus = "running"
 	StatusCompleted QueryStatus = "completed"
 	StatusFailed    QueryStatus = "failed"
+	StatusCancelled QueryStatus = "cancelled"
 )
 
 // Compatibility constants with QueryStatus prefix
@@ -23,6 +24,7 @@ const (
 	QueryStatusRunning   = StatusRunning
 	QueryStatusCompleted = StatusCompleted
 	QueryStatusFailed    = StatusFailed
+	QueryStatusCancelled = StatusCancelled
 )
 
 // OperationType represents the type of SQL operation
@@ -64,6 +66,12 @@ type Query struct {
 	ExecutionTimeMs  *int           `json:"execution_time_ms"`
 	ErrorMessage     string         `json:"error_message"`
 	RequiresApproval bool           `gorm:"default:false" json:"requires_approval"`
+	IsAsync          bool           `gorm:"not null;default:false" json:"is_async"` // queued for execution by a worker
+	Parameters       *string        `gorm:"type:jsonb" json:"-"`                    // JSON []QueryParameter declared for :name placeholders
+	ParameterValues  *string        `gorm:"type:jsonb" json:"-"`                    // JSON object of the values bound when the query ran
+	EstimatedCost    *float64       `json:"estimated_cost"`                         // planner cost from the cost guard's EXPLAIN
+	EstimatedRows    *float64       `json:"estimated_rows"`                         // planner row estimate from the cost guard's EXPLAIN
+	CostGuardRule    string         `json:"cost_guard_rule,omitempty"`              // the cost guard threshold the estimate exceeded
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
@@ -72,22 +80,59 @@ type Query struct {
 	Result           *QueryResult   `gorm:"foreignKey:QueryID" json:"result,omitempty"`
 }
 
+// QueryParameterType is the declared type of a query parameter
+type QueryParameterType string
+
+const (
+	ParameterTypeString    QueryParameterType = "string"
+	ParameterTypeInteger   QueryParameterType = "integer"
+	ParameterTypeNumber    QueryParameterType = "number"
+	ParameterTypeBoolean   QueryParameterType = "boolean"
+	ParameterTypeDate      QueryParameterType = "date"
+	ParameterTypeTimestamp QueryParameterType = "timestamp"
+)
+
+// QueryParameter declares a named :parameter of a saved query.
+// A parameter without a default must be given a value at execution time.
+type QueryParameter struct {
+	Name          string             `json:"name"`
+	Type          QueryParameterType `json:"type"`
+	Default       interface{}        `json:"default,omitempty"`
+	AllowedValues []interface{}      `json:"allowed_values,omitempty"`
+	Description   string             `json:"description,omitempty"`
+}
+
 // TableName specifies the table name for Query
 func (Query) TableName() string {
 	return "queries"
 }
 
+// Encodings of QueryResult.Data
+const (
+	// ResultFormatObjects is the legacy encoding: a JSON array of objects keyed by column name.
+	// Columns with the same name overwrite each other.
+	ResultFormatObjects = "objects"
+	// ResultFormatRows is a JSON array of arrays holding the values in ColumnNames order
+	ResultFormatRows = "rows"
+)
+
 // QueryResult represents stored query results (for result history)
 type QueryResult struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
-	QueryID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"query_id"`
-	Data        string    `gorm:"type:jsonb;not null" json:"data"`
-	ColumnNames string    `gorm:"type:jsonb;not null" json:"column_names"` // JSON string of []string
-	ColumnTypes string    `gorm:"type:jsonb;not null" json:"column_types"` // JSON string of []string
-	RowCount    int       `gorm:"not null" json:"row_count"`
-	StoredAt    time.Time `gorm:"column:stored_at;default:CURRENT_TIMESTAMP" json:"stored_at"`
-	SizeBytes   int       `json:"size_bytes"`
-	Query       Query     `gorm:"foreignKey:QueryID" json:"query,omitempty"`
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	QueryID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"query_id"`
+	Data        string     `gorm:"type:jsonb;not null" json:"data"`
+	DataFormat  string     `gorm:"size:20;not null;default:objects" json:"data_format"` // ResultFormatRows or ResultFormatObjects
+	ColumnNames string     `gorm:"type:jsonb;not null" json:"column_names"`             // JSON string of []string
+	ColumnTypes string     `gorm:"type:jsonb;not null" json:"column_types"`             // JSON string of []string
+	RowCount    int        `gorm:"not null" json:"row_count"`
+	StoredAt    time.Time  `gorm:"column:stored_at;default:CURRENT_TIMESTAMP" json:"stored_at"`
+	SizeBytes   int        `json:"size_bytes"`
+	Truncated   bool       `gorm:"not null;default:false" json:"truncated"`
+	TruncatedBy string     `gorm:"size:20" json:"truncated_by,omitempty"` // max_rows or max_bytes
+	ResultLimit int64      `json:"result_limit,omitempty"`
+	PurgedAt    *time.Time `json:"purged_at,omitempty"` // set when the retention policy removed the data
+	CachedAt    *time.Time `json:"cached_at,omitempty"` // set when the rows came from the result cache; the time they were computed
+	Query       Query      `gorm:"foreignKey:QueryID" json:"query,omitempty"`
 }
 
 // TableName specifies the table name for QueryResult
@@ -107,8 +152,10 @@ type QueryHistory struct {
 	RowCount        *int          `json:"row_count"`
 	ExecutionTimeMs *int          `json:"execution_time_ms"`
 	ErrorMessage    string        `json:"error_message"`
+	CacheHit        bool          `gorm:"not null;default:false" json:"cache_hit"` // served from the result cache without running on the data source
 	ExecutedAt      time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"executed_at"`
 	DataSource      DataSource    `gorm:"foreignKey:DataSourceID" json:"data_source,omitempty"`
+	User            User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
 // TableName specifies the table name for QueryHistory
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduleDelivery represents how the result of a scheduled run is delivered
+type ScheduleDelivery string
+
+const (
+	// ScheduleDeliveryAttachment sends the result as a CSV file, or a link when the channel can't take files
+	ScheduleDeliveryAttachment ScheduleDelivery = "attachment"
+	// ScheduleDeliveryLink sends a link to the result in QueryBase
+	ScheduleDeliveryLink ScheduleDelivery = "link"
+)
+
+// ScheduleRunStatus represents the outcome of a scheduled run
+type ScheduleRunStatus string
+
+const (
+	ScheduleRunRunning   ScheduleRunStatus = "running"
+	ScheduleRunSucceeded ScheduleRunStatus = "succeeded"
+	ScheduleRunFailed    ScheduleRunStatus = "failed"
+	ScheduleRunSkipped   ScheduleRunStatus = "skipped" // the schedule was disabled instead of running
+)
+
+// QuerySchedule runs a saved SELECT query on a cron schedule with the permissions of its owner
+type QuerySchedule struct {
+	ID                   uuid.UUID        `gorm:"type:uuid;primary_key" json:"id"`
+	QueryID              uuid.UUID        `gorm:"type:uuid;not null;index" json:"query_id"`
+	UserID               uuid.UUID        `gorm:"type:uuid;not null;index" json:"user_id"`
+	NotificationConfigID uuid.UUID        `gorm:"type:uuid;not null" json:"notification_config_id"`
+	Name                 string           `gorm:"not null" json:"name"`
+	CronExpression       string           `gorm:"size:100;not null" json:"cron_expression"`
+	Timezone             string           `gorm:"size:64;not null;default:UTC" json:"timezone"`
+	ParameterValues      *string          `gorm:"type:jsonb" json:"-"` // JSON object bound to the parameters of the saved query
+	Delivery             ScheduleDelivery `gorm:"size:20;not null;default:attachment" json:"delivery"`
+	IsActive             bool             `gorm:"not null;default:true" json:"is_active"`
+	DisabledReason       string           `json:"disabled_reason,omitempty"`
+	NextRunAt            *time.Time       `gorm:"index" json:"next_run_at"`
+	LastRunAt            *time.Time       `json:"last_run_at"`
+	CreatedAt            time.Time        `json:"created_at"`
+	UpdatedAt            time.Time        `json:"updated_at"`
+	Query                Query            `gorm:"foreignKey:QueryID" json:"-"`
+	User                 User             `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName specifies the table name for QuerySchedule
+func (QuerySchedule) TableName() string {
+	return "query_schedules"
+}
+
+// QueryScheduleRun records one run of a schedule
+type QueryScheduleRun struct {
+	ID            uuid.UUID         `gorm:"type:uuid;primary_key" json:"id"`
+	ScheduleID    uuid.UUID         `gorm:"type:uuid;not null;index" json:"schedule_id"`
+	QueryID       *uuid.UUID        `gorm:"type:uuid" json:"query_id"` // the executed query, whose result is kept in history
+	Status        ScheduleRunStatus `gorm:"size:20;not null" json:"status"`
+	RowCount      *int              `json:"row_count"`
+	Delivery      ScheduleDelivery  `gorm:"size:20" json:"delivery,omitempty"` // how the result was actually delivered
+	DeliveryError string            `json:"delivery_error,omitempty"`
+	ErrorMessage  string            `json:"error_message,omitempty"`
+	ScheduledFor  time.Time         `json:"scheduled_for"`
+	StartedAt     time.Time         `json:"started_at"`
+	FinishedAt    *time.Time        `json:"finished_at"`
+}
+
+// TableName specifies the table name for QueryScheduleRun
+func (QueryScheduleRun) TableName() string {
+	return "query_schedule_runs"
+}
@@ -21,6 +21,7 @@ const (
 	TypeSendNotification     = "notification:send"
 	TypeCleanupOldResults    = "query:cleanup_results"
 	TypeSyncDataSourceSchema = "datasource:sync_schema"
+	TypeRunScheduledQuery    = "schedule:run"
 )
 
 // ExecuteQueryPayload represents the payload for query execution task
@@ -30,6 +31,7 @@ type ExecuteQueryPayload struct {
 	DataSourceID string `json:"data_source_id"`
 	SQL          string `json:"sql"`
 	UserID       string `json:"user_id"`
+	Refresh      bool   `json:"refresh,omitempty"` // skip the result cache
 }
 
 // SendNotificationPayload represents the payload for sending notifications
@@ -46,6 +48,12 @@ type SyncDataSourceSchemaPayload struct {
 	ForceRefresh bool   `json:"force_refresh"` // true for manual sync
 }
 
+// RunScheduledQueryPayload represents the payload for a scheduled query run
+type RunScheduledQueryPayload struct {
+	ScheduleID   string    `json:"schedule_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
 // EnqueueQueryExecution enqueues a query execution task
 func EnqueueQueryExecution(client *asynq.Client, payload *ExecuteQueryPayload) (*asynq.TaskInfo, error) {
 	data, err := json.Marshal(payload)
@@ -55,12 +63,13 @@ func EnqueueQueryExecution(client *asynq.Client, payload *ExecuteQueryPayload) (
 
 	task := asynq.NewTask(TypeExecuteQuery, data)
 
-	// Enqueue with options
+	// Enqueue with options. The statement timeout of the data source bounds the query itself,
+	// the task timeout only guards against a worker that hangs.
 	info, err := client.Enqueue(
 		task,
 		asynq.Queue("queries"),
 		asynq.MaxRetry(3),
-		asynq.Timeout(300), // 5 minutes timeout
+		asynq.Timeout(time.Hour),
 	)
 
 	if err != nil {
@@ -93,14 +102,19 @@ func EnqueueNotification(client *asynq.Client, payload *SendNotificationPayload)
 	return info, nil
 }
 
-// EnqueueCleanupTask enqueues a task to cleanup old query results
-func EnqueueCleanupTask(client *asynq.Client) (*asynq.TaskInfo, error) {
+// EnqueueCleanupTask enqueues a task to cleanup old query results. Workers enqueue it on the
+// retention interval; uniqueness keeps one pending cleanup when several workers run.
+func EnqueueCleanupTask(client *asynq.Client, interval time.Duration) (*asynq.TaskInfo, error) {
 	task := asynq.NewTask(TypeCleanupOldResults, nil)
 
+	// The completed task keeps its report so the last cleanups can be inspected
 	info, err := client.Enqueue(
 		task,
 		asynq.Queue("maintenance"),
 		asynq.MaxRetry(1),
+		asynq.Timeout(time.Hour),
+		asynq.Unique(interval),
+		asynq.Retention(7*24*time.Hour),
 	)
 
 	if err != nil {
@@ -145,6 +159,33 @@ func EnqueueSchemaSync(client *asynq.Client, dataSourceID string, forceRefresh b
 	return info, nil
 }
 
+// EnqueueScheduledQuery enqueues a run of a schedule that was claimed for scheduledFor
+func EnqueueScheduledQuery(client *asynq.Client, scheduleID uuid.UUID, scheduledFor time.Time) (*asynq.TaskInfo, error) {
+	data, err := json.Marshal(&RunScheduledQueryPayload{
+		ScheduleID:   scheduleID.String(),
+		ScheduledFor: scheduledFor,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeRunScheduledQuery, data)
+
+	// Not retried: every attempt would add a run to the history and deliver the result again
+	info, err := client.Enqueue(
+		task,
+		asynq.Queue("queries"),
+		asynq.MaxRetry(0),
+		asynq.Timeout(time.Hour),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	return info, nil
+}
+
 // HandleExecuteQuery handles query execution tasks
 func HandleExecuteQuery(ctx context.Context, t *asynq.Task) error {
 	var payload ExecuteQueryPayload
@@ -152,16 +193,86 @@ func HandleExecuteQuery(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 
+	// Get query service from context (injected by worker)
+	queryService, ok := ctx.Value("query_service").(*service.QueryService)
+	if !ok || queryService == nil {
+		return errors.New("query service not found in context")
+	}
+	queryEvents, _ := ctx.Value("query_events").(*service.QueryEventBus)
+
+	queryID, err := uuid.Parse(payload.QueryID)
+	if err != nil {
+		return fmt.Errorf("invalid query ID %q: %w", payload.QueryID, asynq.SkipRetry)
+	}
+
 	log.Printf("[Task] Executing query %s for data source %s", payload.QueryID, payload.DataSourceID)
 
-	// TODO: Implement actual query execution
-	// This would call the query service to execute the query
-	// For now, we just log it
+	query, err := queryService.RunQueuedQueryWithOptions(ctx, queryID, service.ExecuteOptions{Refresh: payload.Refresh})
+	if errors.Is(err, service.ErrQueryNotPending) {
+		log.Printf("[Task] Skipping query %s with status %s", payload.QueryID, query.Status)
+		return nil
+	}
+	if query == nil {
+		// The query could not be loaded or claimed; let asynq retry
+		return err
+	}
+
+	if pubErr := queryEvents.PublishQueryEvent(context.Background(), service.NewQueryEvent(query)); pubErr != nil {
+		log.Printf("[Task] Failed to publish completion of query %s: %v", payload.QueryID, pubErr)
+	}
+
+	if errors.Is(err, service.ErrQueryCancelled) {
+		log.Printf("[Task] Query %s was cancelled", payload.QueryID)
+		return nil
+	}
+	if errors.Is(err, service.ErrCostGuardApprovalRequired) {
+		// The query stays pending and runs once its approval is approved
+		log.Printf("[Task] Query %s was sent for approval by the cost guard", payload.QueryID)
+		return nil
+	}
+	if err != nil {
+		// The failure is recorded on the query; running it again would not help
+		log.Printf("[Task] Query %s finished with status %s: %v", payload.QueryID, query.Status, err)
+		return fmt.Errorf("query %s failed: %v: %w", payload.QueryID, err, asynq.SkipRetry)
+	}
 
 	log.Printf("[Task] Query execution completed for query %s", payload.QueryID)
 	return nil
 }
 
+// HandleRunScheduledQuery handles scheduled query runs
+func HandleRunScheduledQuery(ctx context.Context, t *asynq.Task) error {
+	var payload RunScheduledQueryPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	// Get schedule service from context (injected by worker)
+	scheduleService, ok := ctx.Value("schedule_service").(*service.ScheduleService)
+	if !ok || scheduleService == nil {
+		return errors.New("schedule service not found in context")
+	}
+
+	scheduleID, err := uuid.Parse(payload.ScheduleID)
+	if err != nil {
+		return fmt.Errorf("invalid schedule ID %q: %w", payload.ScheduleID, asynq.SkipRetry)
+	}
+
+	log.Printf("[Task] Running schedule %s due at %s", payload.ScheduleID, payload.ScheduledFor.Format(time.RFC3339))
+
+	run, err := scheduleService.RunSchedule(ctx, scheduleID, payload.ScheduledFor)
+	if errors.Is(err, service.ErrScheduleInactive) {
+		log.Printf("[Task] Skipping schedule %s: it was disabled after being claimed", payload.ScheduleID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Task] Schedule %s run %s finished with status %s", payload.ScheduleID, run.ID, run.Status)
+	return nil
+}
+
 // HandleSendNotification handles notification tasks
 func HandleSendNotification(ctx context.Context, t *asynq.Task) error {
 	var payload SendNotificationPayload
@@ -178,14 +289,31 @@ func HandleSendNotification(ctx context.Context, t *asynq.Task) error {
 	return nil
 }
 
-// HandleCleanupOldResults handles cleanup of old query results
+// HandleCleanupOldResults purges stored query results according to the retention policy
 func HandleCleanupOldResults(ctx context.Context, t *asynq.Task) error {
+	// Get retention service from context (injected by worker)
+	retentionService, ok := ctx.Value("retention_service").(*service.RetentionService)
+	if !ok || retentionService == nil {
+		return errors.New("retention service not found in context")
+	}
+
 	log.Printf("[Task] Cleaning up old query results")
 
-	// TODO: Implement actual cleanup logic
-	// Delete query results older than retention period
+	report, err := retentionService.PurgeResults(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to purge query results: %w", err)
+	}
 
-	log.Printf("[Task] Cleanup completed")
+	log.Printf("[Task] Cleanup completed: purged %d results from %d data sources, reclaimed %d bytes (%v)",
+		report.ResultsPurged, report.DataSources, report.BytesReclaimed, report.ByRule)
+
+	// The result writer is only set for tasks dequeued by a server
+	if writer := t.ResultWriter(); writer != nil {
+		data, _ := json.Marshal(report)
+		if _, err := writer.Write(data); err != nil {
+			log.Printf("[Task] Failed to write cleanup report: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -210,16 +338,25 @@ func HandleSyncDataSourceSchema(ctx context.Context, t *asynq.Task) error {
 
 	log.Printf("[Schema Sync] Syncing schema for data source: %s (%s)", dataSource.Name, payload.DataSourceID)
 
-	// Get encryption key from context (injected by worker)
-	encryptionKey, ok := ctx.Value("encryption_key").(string)
-	if !ok || encryptionKey == "" {
-		// Fallback to empty string if not in context (shouldn't happen)
-		encryptionKey = ""
-		log.Printf("[Schema Sync] Warning: encryption_key not found in context")
+	// Every periodic sync probes the data source for its health history. The probe measures
+	// replica lag too, so reads stop going to lagging replicas.
+	if dataSourceService, ok := ctx.Value("datasource_service").(*service.DataSourceService); ok {
+		if _, err := dataSourceService.ProbeHealth(ctx, &dataSource, models.HealthProbeSchemaSync); err != nil {
+			log.Printf("[Schema Sync] Failed to probe health of %s: %v", dataSource.Name, err)
+		}
+	}
+
+	// Get the keyring from context (injected by worker)
+	keyring, ok := ctx.Value("keyring").(*service.Keyring)
+	if !ok {
+		return fmt.Errorf("keyring not found in context")
 	}
 
 	// Create schema service
-	schemaService := service.NewSchemaService(db, encryptionKey)
+	schemaService := service.NewSchemaService(db, keyring)
+	if connectionManager, ok := ctx.Value("connection_manager").(*service.ConnectionManager); ok {
+		schemaService.SetConnectionManager(connectionManager)
+	}
 
 	// Fetch schema from database
 	_, err := schemaService.GetSchema(ctx, payload.DataSourceID)
@@ -0,0 +1,1042 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAccessConfig is returned for an access config document that can't be applied
+var ErrInvalidAccessConfig = errors.New("invalid access config")
+
+// AccessConfigVersion is the version of the access config document format
+const AccessConfigVersion = 1
+
+// Column defaults of data source settings, which an access config document may leave out
+const (
+	defaultStatementTimeoutSeconds = 300
+	defaultMaxResultRows           = 10000
+	defaultMaxResultBytes          = 52428800
+	defaultMaxReplicaLagSeconds    = 30
+	defaultSSHPort                 = 22
+)
+
+// AccessConfig is a document describing the desired data sources, groups, group members and
+// data source permissions. It is read from and written as YAML or JSON, so the access model can
+// live in git. Secrets are never part of it: passwords are referenced with credential_source and
+// credential_ref, and TLS and SSH keys are left as they are stored.
+type AccessConfig struct {
+	Version     int                `json:"version" yaml:"version"`
+	DataSources []DataSourceConfig `json:"datasources" yaml:"datasources"`
+	Groups      []GroupConfig      `json:"groups" yaml:"groups"`
+}
+
+// DataSourceConfig is a data source in an access config document. Data sources are matched by
+// name. Settings that are left out take their defaults.
+type DataSourceConfig struct {
+	Name         string `json:"name" yaml:"name"`
+	Type         string `json:"type" yaml:"type"`
+	Environment  string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Host         string `json:"host,omitempty" yaml:"host,omitempty"`
+	Port         int    `json:"port,omitempty" yaml:"port,omitempty"`
+	DatabaseName string `json:"database_name,omitempty" yaml:"database_name,omitempty"`
+	FilePath     string `json:"file_path,omitempty" yaml:"file_path,omitempty"`
+	Username     string `json:"username,omitempty" yaml:"username,omitempty"`
+	// CredentialSource is env, file or http for new data sources, as the document holds no password.
+	// encrypted keeps the password stored with an existing data source.
+	CredentialSource        string          `json:"credential_source,omitempty" yaml:"credential_source,omitempty"`
+	CredentialRef           string          `json:"credential_ref,omitempty" yaml:"credential_ref,omitempty"`
+	IsActive                *bool           `json:"is_active,omitempty" yaml:"is_active,omitempty"`
+	StatementTimeoutSeconds *int            `json:"statement_timeout_seconds,omitempty" yaml:"statement_timeout_seconds,omitempty"`
+	MaxResultRows           *int            `json:"max_result_rows,omitempty" yaml:"max_result_rows,omitempty"`
+	MaxResultBytes          *int64          `json:"max_result_bytes,omitempty" yaml:"max_result_bytes,omitempty"`
+	ResultMaxAgeHours       *int            `json:"result_max_age_hours,omitempty" yaml:"result_max_age_hours,omitempty"`
+	ResultMaxTotalBytes     *int64          `json:"result_max_total_bytes,omitempty" yaml:"result_max_total_bytes,omitempty"`
+	ResultKeepLastPerUser   *int            `json:"result_keep_last_per_user,omitempty" yaml:"result_keep_last_per_user,omitempty"`
+	ResultCacheTTLSeconds   int             `json:"result_cache_ttl_seconds,omitempty" yaml:"result_cache_ttl_seconds,omitempty"`
+	CostGuardMaxCost        float64         `json:"cost_guard_max_cost,omitempty" yaml:"cost_guard_max_cost,omitempty"`
+	CostGuardMaxRows        int64           `json:"cost_guard_max_rows,omitempty" yaml:"cost_guard_max_rows,omitempty"`
+	CostGuardAction         string          `json:"cost_guard_action,omitempty" yaml:"cost_guard_action,omitempty"`
+	MaxReplicaLagSeconds    *int            `json:"max_replica_lag_seconds,omitempty" yaml:"max_replica_lag_seconds,omitempty"`
+	Replicas                []ReplicaConfig `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+	SessionInitStatements   []string        `json:"session_init_statements,omitempty" yaml:"session_init_statements,omitempty"`
+	TLSMode                 string          `json:"tls_mode,omitempty" yaml:"tls_mode,omitempty"`
+	TLSServerName           string          `json:"tls_server_name,omitempty" yaml:"tls_server_name,omitempty"`
+	SSHHost                 string          `json:"ssh_host,omitempty" yaml:"ssh_host,omitempty"`
+	SSHPort                 int             `json:"ssh_port,omitempty" yaml:"ssh_port,omitempty"`
+	SSHUser                 string          `json:"ssh_user,omitempty" yaml:"ssh_user,omitempty"`
+	SSHKnownHosts           string          `json:"ssh_known_hosts,omitempty" yaml:"ssh_known_hosts,omitempty"`
+}
+
+// ReplicaConfig is a read replica endpoint of a data source
+type ReplicaConfig struct {
+	Host string `json:"host" yaml:"host"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+// GroupConfig is a group in an access config document. The members and permissions of a group
+// in the document are exactly the ones it lists.
+type GroupConfig struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Members are the emails or usernames of existing users
+	Members     []string                `json:"members,omitempty" yaml:"members,omitempty"`
+	Permissions []GroupPermissionConfig `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+// GroupPermissionConfig is what a group may do on a data source, named by its name
+type GroupPermissionConfig struct {
+	DataSource string `json:"datasource" yaml:"datasource"`
+	CanRead    bool   `json:"can_read" yaml:"can_read"`
+	CanWrite   bool   `json:"can_write" yaml:"can_write"`
+	CanApprove bool   `json:"can_approve" yaml:"can_approve"`
+}
+
+// AccessConfigOptions controls how an access config document is reconciled
+type AccessConfigOptions struct {
+	// Prune deletes the data sources and groups the document doesn't list
+	Prune bool
+}
+
+// AccessConfigAction is what a change does
+type AccessConfigAction string
+
+const (
+	AccessConfigCreate AccessConfigAction = "create"
+	AccessConfigUpdate AccessConfigAction = "update"
+	AccessConfigDelete AccessConfigAction = "delete"
+)
+
+// AccessConfigKind is what a change is made to
+type AccessConfigKind string
+
+const (
+	AccessConfigDataSource AccessConfigKind = "datasource"
+	AccessConfigGroup      AccessConfigKind = "group"
+	AccessConfigMembership AccessConfigKind = "membership" // named group/user
+	AccessConfigPermission AccessConfigKind = "permission" // named group/datasource
+)
+
+// AccessConfigChange is one change between the stored state and an access config document
+type AccessConfigChange struct {
+	Action AccessConfigAction `json:"action"`
+	Kind   AccessConfigKind   `json:"kind"`
+	Name   string             `json:"name"`
+	// Fields are the settings an update changes
+	Fields []string `json:"fields,omitempty"`
+}
+
+// AccessConfigPlan lists the changes that reconcile the stored state with a document
+type AccessConfigPlan struct {
+	Changes []AccessConfigChange `json:"changes"`
+	// Applied is set when the changes were made
+	Applied bool `json:"applied"`
+}
+
+// AccessConfigService plans, applies and exports access config documents
+type AccessConfigService struct {
+	db          *gorm.DB
+	dataSources *DataSourceService
+}
+
+// NewAccessConfigService creates a new access config service. Data sources are created and
+// updated through the data source service, so they are validated like API changes.
+func NewAccessConfigService(db *gorm.DB, dataSources *DataSourceService) *AccessConfigService {
+	return &AccessConfigService{
+		db:          db,
+		dataSources: dataSources,
+	}
+}
+
+// ParseAccessConfig reads an access config document from YAML or JSON. Unknown keys are
+// rejected, so a mistyped setting doesn't go unnoticed.
+func ParseAccessConfig(data []byte) (*AccessConfig, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var config AccessConfig
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessConfig, err)
+	}
+	return &config, nil
+}
+
+// MarshalAccessConfigYAML writes an access config document as YAML
+func MarshalAccessConfigYAML(config *AccessConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Plan returns the changes that applying a document would make, without making them
+func (s *AccessConfigService) Plan(ctx context.Context, config *AccessConfig, options AccessConfigOptions) (*AccessConfigPlan, error) {
+	return s.reconcile(ctx, s.db.WithContext(ctx), config, options, false)
+}
+
+// Apply makes the changes that reconcile the stored state with a document. The changes are
+// made in one transaction, so a document that fails halfway changes nothing.
+func (s *AccessConfigService) Apply(ctx context.Context, config *AccessConfig, options AccessConfigOptions) (*AccessConfigPlan, error) {
+	var plan *AccessConfigPlan
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		plan, err = s.reconcile(ctx, tx, config, options, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+// Export describes the stored data sources, groups, members and permissions as a document
+func (s *AccessConfigService) Export(ctx context.Context) (*AccessConfig, error) {
+	state, err := loadAccessState(s.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &AccessConfig{
+		Version:     AccessConfigVersion,
+		DataSources: make([]DataSourceConfig, 0, len(state.dataSources)),
+		Groups:      make([]GroupConfig, 0, len(state.groups)),
+	}
+	for i := range state.dataSources {
+		dataSource, err := exportDataSource(&state.dataSources[i])
+		if err != nil {
+			return nil, err
+		}
+		config.DataSources = append(config.DataSources, dataSource)
+	}
+	for _, group := range state.groups {
+		config.Groups = append(config.Groups, state.exportGroup(group))
+	}
+	return config, nil
+}
+
+// accessState is the stored state an access config document is compared with
+type accessState struct {
+	dataSources []models.DataSource // ordered by name
+	groups      []models.Group      // ordered by name
+	users       map[uuid.UUID]string
+	members     map[uuid.UUID][]uuid.UUID // group ID to user IDs
+	permissions map[uuid.UUID][]models.DataSourcePermission
+}
+
+// loadAccessState loads the data sources, groups, members and permissions
+func loadAccessState(db *gorm.DB) (*accessState, error) {
+	state := &accessState{
+		users:       make(map[uuid.UUID]string),
+		members:     make(map[uuid.UUID][]uuid.UUID),
+		permissions: make(map[uuid.UUID][]models.DataSourcePermission),
+	}
+	if err := db.Preload("Replicas").Order("name").Find(&state.dataSources).Error; err != nil {
+		return nil, fmt.Errorf("failed to load data sources: %w", err)
+	}
+	if err := db.Order("name").Find(&state.groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to load groups: %w", err)
+	}
+
+	var users []models.User
+	if err := db.Select("id", "email").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+	for _, user := range users {
+		state.users[user.ID] = user.Email
+	}
+
+	var memberships []models.UserGroup
+	if err := db.Find(&memberships).Error; err != nil {
+		return nil, fmt.Errorf("failed to load group members: %w", err)
+	}
+	for _, membership := range memberships {
+		// Memberships of deleted users are not part of the access model
+		if _, ok := state.users[membership.UserID]; ok {
+			state.members[membership.GroupID] = append(state.members[membership.GroupID], membership.UserID)
+		}
+	}
+	for _, members := range state.members {
+		sort.Slice(members, func(i, j int) bool { return state.users[members[i]] < state.users[members[j]] })
+	}
+
+	var permissions []models.DataSourcePermission
+	if err := db.Find(&permissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+	for _, permission := range permissions {
+		state.permissions[permission.GroupID] = append(state.permissions[permission.GroupID], permission)
+	}
+	return state, nil
+}
+
+// dataSourceNames returns the names of the stored data sources by ID
+func (s *accessState) dataSourceNames() map[uuid.UUID]string {
+	names := make(map[uuid.UUID]string, len(s.dataSources))
+	for _, dataSource := range s.dataSources {
+		names[dataSource.ID] = dataSource.Name
+	}
+	return names
+}
+
+// exportGroup describes a stored group, its members and its permissions
+func (s *accessState) exportGroup(group models.Group) GroupConfig {
+	config := GroupConfig{Name: group.Name, Description: group.Description}
+	for _, userID := range s.members[group.ID] {
+		config.Members = append(config.Members, s.users[userID])
+	}
+
+	names := s.dataSourceNames()
+	for _, permission := range s.permissions[group.ID] {
+		// Permissions on deleted data sources no longer grant anything
+		name, ok := names[permission.DataSourceID]
+		if !ok {
+			continue
+		}
+		config.Permissions = append(config.Permissions, GroupPermissionConfig{
+			DataSource: name,
+			CanRead:    permission.CanRead,
+			CanWrite:   permission.CanWrite,
+			CanApprove: permission.CanApprove,
+		})
+	}
+	sort.Slice(config.Permissions, func(i, j int) bool {
+		return config.Permissions[i].DataSource < config.Permissions[j].DataSource
+	})
+	return config
+}
+
+// exportDataSource describes a stored data source with every setting spelled out
+func exportDataSource(dataSource *models.DataSource) (DataSourceConfig, error) {
+	statements, err := DecodeSessionInitStatements(dataSource)
+	if err != nil {
+		return DataSourceConfig{}, err
+	}
+	isActive := dataSource.IsActive
+	statementTimeout := dataSource.StatementTimeoutSeconds
+	maxResultRows := dataSource.MaxResultRows
+	maxResultBytes := dataSource.MaxResultBytes
+	maxReplicaLag := dataSource.MaxReplicaLagSeconds
+
+	config := DataSourceConfig{
+		Name:                    dataSource.Name,
+		Type:                    string(dataSource.Type),
+		Environment:             dataSource.Environment,
+		Host:                    dataSource.Host,
+		Port:                    dataSource.Port,
+		DatabaseName:            dataSource.DatabaseName,
+		FilePath:                dataSource.FilePath,
+		Username:                dataSource.Username,
+		CredentialSource:        string(dataSource.CredentialSource),
+		CredentialRef:           dataSource.CredentialRef,
+		IsActive:                &isActive,
+		StatementTimeoutSeconds: &statementTimeout,
+		MaxResultRows:           &maxResultRows,
+		MaxResultBytes:          &maxResultBytes,
+		ResultMaxAgeHours:       dataSource.ResultMaxAgeHours,
+		ResultMaxTotalBytes:     dataSource.ResultMaxTotalBytes,
+		ResultKeepLastPerUser:   dataSource.ResultKeepLastPerUser,
+		ResultCacheTTLSeconds:   dataSource.ResultCacheTTLSeconds,
+		CostGuardMaxCost:        dataSource.CostGuardMaxCost,
+		CostGuardMaxRows:        dataSource.CostGuardMaxRows,
+		CostGuardAction:         string(dataSource.CostGuardAction),
+		MaxReplicaLagSeconds:    &maxReplicaLag,
+		SessionInitStatements:   statements,
+		TLSMode:                 string(dataSource.TLSMode),
+		TLSServerName:           dataSource.TLSServerName,
+		SSHHost:                 dataSource.SSHHost,
+		SSHPort:                 dataSource.SSHPort,
+		SSHUser:                 dataSource.SSHUser,
+		SSHKnownHosts:           dataSource.SSHKnownHosts,
+	}
+	if config.Environment == "" {
+		config.Environment = models.EnvironmentProd
+	}
+	if config.CredentialSource == "" {
+		config.CredentialSource = string(models.CredentialSourceEncrypted)
+	}
+	if config.CostGuardAction == "" {
+		config.CostGuardAction = string(models.CostGuardBlock)
+	}
+	if config.TLSMode == "" {
+		config.TLSMode = string(models.TLSModeDisable)
+	}
+	if config.SSHPort == 0 {
+		config.SSHPort = defaultSSHPort
+	}
+	for _, replica := range dataSource.Replicas {
+		config.Replicas = append(config.Replicas, ReplicaConfig{Host: replica.Host, Port: replica.Port})
+	}
+	sortReplicas(config.Replicas)
+	return config, nil
+}
+
+// normalize checks a document and fills in the defaults of the settings it leaves out
+func (c *AccessConfig) normalize() error {
+	if c.Version != AccessConfigVersion {
+		return fmt.Errorf("%w: version must be %d", ErrInvalidAccessConfig, AccessConfigVersion)
+	}
+
+	dataSources := make(map[string]bool, len(c.DataSources))
+	for i := range c.DataSources {
+		dataSource := &c.DataSources[i]
+		if err := dataSource.normalize(); err != nil {
+			return fmt.Errorf("data source %q: %w", dataSource.Name, err)
+		}
+		if dataSources[dataSource.Name] {
+			return fmt.Errorf("%w: data source %q is listed twice", ErrInvalidAccessConfig, dataSource.Name)
+		}
+		dataSources[dataSource.Name] = true
+	}
+
+	groups := make(map[string]bool, len(c.Groups))
+	for i := range c.Groups {
+		group := &c.Groups[i]
+		group.Name = strings.TrimSpace(group.Name)
+		if group.Name == "" {
+			return fmt.Errorf("%w: every group needs a name", ErrInvalidAccessConfig)
+		}
+		if groups[group.Name] {
+			return fmt.Errorf("%w: group %q is listed twice", ErrInvalidAccessConfig, group.Name)
+		}
+		groups[group.Name] = true
+
+		members := make(map[string]bool, len(group.Members))
+		for j, member := range group.Members {
+			member = strings.TrimSpace(member)
+			if member == "" || members[member] {
+				return fmt.Errorf("%w: group %q lists an empty or repeated member", ErrInvalidAccessConfig, group.Name)
+			}
+			members[member] = true
+			group.Members[j] = member
+		}
+
+		permissions := make(map[string]bool, len(group.Permissions))
+		for j := range group.Permissions {
+			permission := &group.Permissions[j]
+			permission.DataSource = strings.TrimSpace(permission.DataSource)
+			if permission.DataSource == "" || permissions[permission.DataSource] {
+				return fmt.Errorf("%w: group %q has a permission without a data source or two on %q",
+					ErrInvalidAccessConfig, group.Name, permission.DataSource)
+			}
+			permissions[permission.DataSource] = true
+		}
+	}
+	return nil
+}
+
+// normalize checks a data source of a document and fills in its defaults, as the data source
+// service stores them
+func (c *DataSourceConfig) normalize() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("%w: every data source needs a name", ErrInvalidAccessConfig)
+	}
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	if _, err := LookupDataSourceDriver(models.DataSourceType(c.Type)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAccessConfig, err)
+	}
+
+	environment, err := NormalizeEnvironment(c.Environment)
+	if err != nil {
+		return err
+	}
+	c.Environment = environment
+
+	if models.DataSourceType(c.Type) == models.DataSourceTypeSQLite {
+		if c.FilePath, err = NormalizeSQLitePath(c.FilePath); err != nil {
+			return err
+		}
+		if c.DatabaseName == "" {
+			c.DatabaseName = "main"
+		}
+	}
+
+	source, err := NormalizeCredentialSource(c.CredentialSource)
+	if err != nil {
+		return err
+	}
+	c.CredentialSource = string(source)
+	c.CredentialRef = strings.TrimSpace(c.CredentialRef)
+	if source == models.CredentialSourceEncrypted && c.CredentialRef != "" {
+		return fmt.Errorf("%w: credential_ref is only read from env, file or http", ErrInvalidCredentialSource)
+	}
+
+	tlsMode, err := NormalizeTLSMode(c.TLSMode)
+	if err != nil {
+		return err
+	}
+	c.TLSMode = string(tlsMode)
+
+	if c.SessionInitStatements, err = NormalizeSessionInitStatements(c.SessionInitStatements); err != nil {
+		return err
+	}
+	if len(c.SessionInitStatements) == 0 {
+		c.SessionInitStatements = nil
+	}
+
+	switch models.CostGuardAction(c.CostGuardAction) {
+	case "":
+		c.CostGuardAction = string(models.CostGuardBlock)
+	case models.CostGuardBlock, models.CostGuardWarn, models.CostGuardApproval:
+	default:
+		return fmt.Errorf("%w: cost_guard_action must be block, warn or approval", ErrInvalidAccessConfig)
+	}
+
+	defaultInt(&c.StatementTimeoutSeconds, defaultStatementTimeoutSeconds)
+	defaultInt(&c.MaxResultRows, defaultMaxResultRows)
+	defaultInt(&c.MaxReplicaLagSeconds, defaultMaxReplicaLagSeconds)
+	if c.MaxResultBytes == nil {
+		maxResultBytes := int64(defaultMaxResultBytes)
+		c.MaxResultBytes = &maxResultBytes
+	}
+	if c.IsActive == nil {
+		isActive := true
+		c.IsActive = &isActive
+	}
+	if c.SSHPort == 0 {
+		c.SSHPort = defaultSSHPort
+	}
+	if len(c.Replicas) == 0 {
+		c.Replicas = nil
+	}
+	sortReplicas(c.Replicas)
+	return nil
+}
+
+// reconcile compares a document with the stored state and, when apply is set, makes the changes
+func (s *AccessConfigService) reconcile(ctx context.Context, db *gorm.DB, config *AccessConfig, options AccessConfigOptions, apply bool) (*AccessConfigPlan, error) {
+	if err := config.normalize(); err != nil {
+		return nil, err
+	}
+	state, err := loadAccessState(db)
+	if err != nil {
+		return nil, err
+	}
+	r := &accessReconciler{
+		ctx:         ctx,
+		db:          db,
+		dataSources: s.dataSources.withDB(db),
+		state:       state,
+		apply:       apply,
+		plan:        &AccessConfigPlan{Changes: []AccessConfigChange{}},
+	}
+
+	if err := r.reconcileDataSources(config.DataSources); err != nil {
+		return nil, err
+	}
+	for _, group := range config.Groups {
+		if err := r.reconcileGroup(group); err != nil {
+			return nil, fmt.Errorf("group %q: %w", group.Name, err)
+		}
+	}
+	if options.Prune {
+		if err := r.prune(config); err != nil {
+			return nil, err
+		}
+	}
+	return r.plan, nil
+}
+
+// accessReconciler holds the state of one plan or apply
+type accessReconciler struct {
+	ctx         context.Context
+	db          *gorm.DB
+	dataSources *DataSourceService
+	state       *accessState
+	apply       bool
+	plan        *AccessConfigPlan
+	// dataSourceIDs are the IDs of the data sources by name, including the ones created by this
+	// apply; a data source that is only planned has uuid.Nil
+	dataSourceIDs map[string]uuid.UUID
+}
+
+// change records a change of the plan
+func (r *accessReconciler) change(action AccessConfigAction, kind AccessConfigKind, name string, fields ...string) {
+	r.plan.Changes = append(r.plan.Changes, AccessConfigChange{Action: action, Kind: kind, Name: name, Fields: fields})
+}
+
+// reconcileDataSources creates and updates the data sources of a document
+func (r *accessReconciler) reconcileDataSources(desired []DataSourceConfig) error {
+	stored := make(map[string][]*models.DataSource, len(r.state.dataSources))
+	r.dataSourceIDs = make(map[string]uuid.UUID, len(r.state.dataSources))
+	for i := range r.state.dataSources {
+		dataSource := &r.state.dataSources[i]
+		stored[dataSource.Name] = append(stored[dataSource.Name], dataSource)
+		r.dataSourceIDs[dataSource.Name] = dataSource.ID
+	}
+
+	for _, config := range desired {
+		matches := stored[config.Name]
+		switch {
+		case len(matches) > 1:
+			return fmt.Errorf("%w: %d data sources are named %q; rename all but one through the API",
+				ErrInvalidAccessConfig, len(matches), config.Name)
+		case len(matches) == 0:
+			r.change(AccessConfigCreate, AccessConfigDataSource, config.Name)
+			if !r.apply {
+				r.dataSourceIDs[config.Name] = uuid.Nil
+				continue
+			}
+			dataSource, err := r.dataSources.CreateDataSource(r.ctx, createDataSourceInput(config))
+			if err != nil {
+				return fmt.Errorf("data source %q: %w", config.Name, err)
+			}
+			// New data sources are active; the document may say otherwise
+			if !*config.IsActive {
+				if err := r.db.Model(dataSource).Update("is_active", false).Error; err != nil {
+					return fmt.Errorf("failed to create data source %q: %w", config.Name, err)
+				}
+			}
+			r.dataSourceIDs[config.Name] = dataSource.ID
+		default:
+			current, err := exportDataSource(matches[0])
+			if err != nil {
+				return err
+			}
+			fields := changedFields(current, config)
+			if len(fields) == 0 {
+				continue
+			}
+			r.change(AccessConfigUpdate, AccessConfigDataSource, config.Name, fields...)
+			if !r.apply {
+				continue
+			}
+			if _, err := r.dataSources.UpdateDataSource(r.ctx, matches[0].ID.String(), updateDataSourceInput(config, fields)); err != nil {
+				return fmt.Errorf("data source %q: %w", config.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileGroup creates or updates a group of a document, then its members and permissions
+func (r *accessReconciler) reconcileGroup(config GroupConfig) error {
+	var group *models.Group
+	for i := range r.state.groups {
+		if r.state.groups[i].Name == config.Name {
+			group = &r.state.groups[i]
+		}
+	}
+
+	switch {
+	case group == nil:
+		r.change(AccessConfigCreate, AccessConfigGroup, config.Name)
+		if r.apply {
+			created, err := r.createGroup(config)
+			if err != nil {
+				return err
+			}
+			group = created
+		}
+	case group.Description != config.Description:
+		r.change(AccessConfigUpdate, AccessConfigGroup, config.Name, "description")
+		if r.apply {
+			if err := r.db.Model(group).Update("description", config.Description).Error; err != nil {
+				return fmt.Errorf("failed to update group: %w", err)
+			}
+		}
+	}
+
+	groupID := uuid.Nil
+	if group != nil {
+		groupID = group.ID
+	}
+	if err := r.reconcileMembers(config, groupID); err != nil {
+		return err
+	}
+	return r.reconcilePermissions(config, groupID)
+}
+
+// createGroup creates a group. A deleted group of the same name is restored without its former
+// members and permissions, as group names stay taken after a delete.
+func (r *accessReconciler) createGroup(config GroupConfig) (*models.Group, error) {
+	var group models.Group
+	err := r.db.Unscoped().Where("name = ?", config.Name).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		group = models.Group{Name: config.Name, Description: config.Description}
+		if err := r.db.Create(&group).Error; err != nil {
+			return nil, fmt.Errorf("failed to create group: %w", err)
+		}
+		return &group, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	if err := r.clearGroup(group.ID); err != nil {
+		return nil, err
+	}
+	if err := r.db.Unscoped().Model(&group).Updates(map[string]interface{}{
+		"description": config.Description,
+		"deleted_at":  nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore group: %w", err)
+	}
+	return &group, nil
+}
+
+// clearGroup removes the members and permissions of a group
+func (r *accessReconciler) clearGroup(groupID uuid.UUID) error {
+	if err := r.db.Where("group_id = ?", groupID).Delete(&models.UserGroup{}).Error; err != nil {
+		return fmt.Errorf("failed to remove group members: %w", err)
+	}
+	if err := r.db.Where("group_id = ?", groupID).Delete(&models.DataSourcePermission{}).Error; err != nil {
+		return fmt.Errorf("failed to remove group permissions: %w", err)
+	}
+	return nil
+}
+
+// reconcileMembers adds and removes members so a group has exactly the listed users
+func (r *accessReconciler) reconcileMembers(config GroupConfig, groupID uuid.UUID) error {
+	wanted := make(map[uuid.UUID]string, len(config.Members))
+	for _, member := range config.Members {
+		var user models.User
+		if err := r.db.Select("id", "email").Where("email = ? OR username = ?", member, member).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: member %q is not a user", ErrInvalidAccessConfig, member)
+			}
+			return fmt.Errorf("failed to look up member %q: %w", member, err)
+		}
+		if _, ok := wanted[user.ID]; ok {
+			return fmt.Errorf("%w: member %q is listed twice", ErrInvalidAccessConfig, member)
+		}
+		wanted[user.ID] = user.Email
+	}
+
+	current := make(map[uuid.UUID]bool)
+	for _, userID := range r.state.members[groupID] {
+		current[userID] = true
+	}
+
+	for _, userID := range sortedByValue(wanted) {
+		if current[userID] {
+			continue
+		}
+		r.change(AccessConfigCreate, AccessConfigMembership, config.Name+"/"+wanted[userID])
+		if r.apply {
+			if err := r.db.Create(&models.UserGroup{UserID: userID, GroupID: groupID}).Error; err != nil {
+				return fmt.Errorf("failed to add member %s: %w", wanted[userID], err)
+			}
+		}
+	}
+	for _, userID := range r.state.members[groupID] {
+		if _, ok := wanted[userID]; ok {
+			continue
+		}
+		r.change(AccessConfigDelete, AccessConfigMembership, config.Name+"/"+r.state.users[userID])
+		if r.apply {
+			if err := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.UserGroup{}).Error; err != nil {
+				return fmt.Errorf("failed to remove member %s: %w", r.state.users[userID], err)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcilePermissions creates, updates and deletes permissions so a group has exactly the
+// listed ones
+func (r *accessReconciler) reconcilePermissions(config GroupConfig, groupID uuid.UUID) error {
+	names := r.state.dataSourceNames()
+	current := make(map[string]models.DataSourcePermission)
+	for _, permission := range r.state.permissions[groupID] {
+		if name, ok := names[permission.DataSourceID]; ok {
+			current[name] = permission
+		}
+	}
+
+	wanted := make(map[string]bool, len(config.Permissions))
+	for _, permission := range config.Permissions {
+		wanted[permission.DataSource] = true
+		name := config.Name + "/" + permission.DataSource
+		dataSourceID, ok := r.dataSourceIDs[permission.DataSource]
+		if !ok {
+			return fmt.Errorf("%w: permission on unknown data source %q", ErrInvalidAccessConfig, permission.DataSource)
+		}
+		columns := map[string]interface{}{
+			"can_read":    permission.CanRead,
+			"can_write":   permission.CanWrite,
+			"can_approve": permission.CanApprove,
+		}
+
+		existing, ok := current[permission.DataSource]
+		if !ok {
+			r.change(AccessConfigCreate, AccessConfigPermission, name)
+			if !r.apply {
+				continue
+			}
+			created := &models.DataSourcePermission{ID: uuid.New(), DataSourceID: dataSourceID, GroupID: groupID}
+			// Create skips false flags in favour of the column defaults, so they are set after
+			if err := r.db.Create(created).Error; err != nil {
+				return fmt.Errorf("failed to create permission on %q: %w", permission.DataSource, err)
+			}
+			if err := r.db.Model(created).Updates(columns).Error; err != nil {
+				return fmt.Errorf("failed to create permission on %q: %w", permission.DataSource, err)
+			}
+			continue
+		}
+
+		var fields []string
+		if existing.CanRead != permission.CanRead {
+			fields = append(fields, "can_read")
+		}
+		if existing.CanWrite != permission.CanWrite {
+			fields = append(fields, "can_write")
+		}
+		if existing.CanApprove != permission.CanApprove {
+			fields = append(fields, "can_approve")
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		r.change(AccessConfigUpdate, AccessConfigPermission, name, fields...)
+		if r.apply {
+			if err := r.db.Model(&existing).Updates(columns).Error; err != nil {
+				return fmt.Errorf("failed to update permission on %q: %w", permission.DataSource, err)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(current) {
+		if wanted[name] {
+			continue
+		}
+		r.change(AccessConfigDelete, AccessConfigPermission, config.Name+"/"+name)
+		if r.apply {
+			if err := r.db.Delete(&models.DataSourcePermission{}, "id = ?", current[name].ID).Error; err != nil {
+				return fmt.Errorf("failed to delete permission on %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// prune deletes the groups and data sources a document doesn't list
+func (r *accessReconciler) prune(config *AccessConfig) error {
+	listedGroups := make(map[string]bool, len(config.Groups))
+	for _, group := range config.Groups {
+		listedGroups[group.Name] = true
+	}
+	for _, group := range r.state.groups {
+		if listedGroups[group.Name] {
+			continue
+		}
+		r.change(AccessConfigDelete, AccessConfigGroup, group.Name)
+		if !r.apply {
+			continue
+		}
+		if err := r.clearGroup(group.ID); err != nil {
+			return err
+		}
+		if err := r.db.Delete(&models.Group{}, "id = ?", group.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete group %q: %w", group.Name, err)
+		}
+	}
+
+	listedDataSources := make(map[string]bool, len(config.DataSources))
+	for _, dataSource := range config.DataSources {
+		listedDataSources[dataSource.Name] = true
+	}
+	for _, dataSource := range r.state.dataSources {
+		if listedDataSources[dataSource.Name] {
+			continue
+		}
+		r.change(AccessConfigDelete, AccessConfigDataSource, dataSource.Name)
+		if !r.apply {
+			continue
+		}
+		if err := r.dataSources.DeleteDataSource(r.ctx, dataSource.ID.String()); err != nil {
+			return fmt.Errorf("data source %q: %w", dataSource.Name, err)
+		}
+	}
+	return nil
+}
+
+// changedFields returns the document keys of the settings that differ between two data sources
+func changedFields(current, desired DataSourceConfig) []string {
+	var fields []string
+	currentValue, desiredValue := reflect.ValueOf(current), reflect.ValueOf(desired)
+	for i := 0; i < currentValue.NumField(); i++ {
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), desiredValue.Field(i).Interface()) {
+			name, _, _ := strings.Cut(currentValue.Type().Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// createDataSourceInput returns the input that creates a data source of a document
+func createDataSourceInput(config DataSourceConfig) *CreateDataSourceInput {
+	return &CreateDataSourceInput{
+		Name:                    config.Name,
+		Type:                    config.Type,
+		Host:                    config.Host,
+		Port:                    config.Port,
+		DatabaseName:            config.DatabaseName,
+		Username:                config.Username,
+		Environment:             config.Environment,
+		CredentialSource:        config.CredentialSource,
+		CredentialRef:           config.CredentialRef,
+		FilePath:                config.FilePath,
+		StatementTimeoutSeconds: config.StatementTimeoutSeconds,
+		MaxResultRows:           config.MaxResultRows,
+		MaxResultBytes:          config.MaxResultBytes,
+		ResultMaxAgeHours:       config.ResultMaxAgeHours,
+		ResultMaxTotalBytes:     config.ResultMaxTotalBytes,
+		ResultKeepLastPerUser:   config.ResultKeepLastPerUser,
+		ResultCacheTTLSeconds:   config.ResultCacheTTLSeconds,
+		CostGuardMaxCost:        config.CostGuardMaxCost,
+		CostGuardMaxRows:        config.CostGuardMaxRows,
+		CostGuardAction:         config.CostGuardAction,
+		Replicas:                replicaInputs(config.Replicas),
+		MaxReplicaLagSeconds:    config.MaxReplicaLagSeconds,
+		SessionInitStatements:   config.SessionInitStatements,
+		TLSMode:                 config.TLSMode,
+		TLSServerName:           config.TLSServerName,
+		SSHHost:                 config.SSHHost,
+		SSHPort:                 config.SSHPort,
+		SSHUser:                 config.SSHUser,
+		SSHKnownHosts:           config.SSHKnownHosts,
+	}
+}
+
+// updateDataSourceInput returns the input that changes the given settings of a data source to
+// the ones of a document. Only changed settings are set, so unchanged ones are not validated again.
+func updateDataSourceInput(config DataSourceConfig, fields []string) *UpdateDataSourceInput {
+	input := &UpdateDataSourceInput{}
+	for _, field := range fields {
+		switch field {
+		case "type":
+			input.Type = config.Type
+		case "environment":
+			input.Environment = config.Environment
+		case "host":
+			input.Host = config.Host
+		case "port":
+			input.Port = config.Port
+		case "database_name":
+			input.DatabaseName = config.DatabaseName
+		case "file_path":
+			input.FilePath = config.FilePath
+		case "username":
+			input.Username = config.Username
+		case "credential_source", "credential_ref":
+			input.CredentialSource = config.CredentialSource
+			input.CredentialRef = &config.CredentialRef
+		case "is_active":
+			input.IsActive = config.IsActive
+		case "statement_timeout_seconds":
+			input.StatementTimeoutSeconds = config.StatementTimeoutSeconds
+		case "max_result_rows":
+			input.MaxResultRows = config.MaxResultRows
+		case "max_result_bytes":
+			input.MaxResultBytes = config.MaxResultBytes
+		// A retention override the document leaves out is cleared, so the global setting applies
+		case "result_max_age_hours":
+			input.ResultMaxAgeHours = orNegative(config.ResultMaxAgeHours)
+		case "result_max_total_bytes":
+			input.ResultMaxTotalBytes = orNegative(config.ResultMaxTotalBytes)
+		case "result_keep_last_per_user":
+			input.ResultKeepLastPerUser = orNegative(config.ResultKeepLastPerUser)
+		case "result_cache_ttl_seconds":
+			input.ResultCacheTTLSeconds = &config.ResultCacheTTLSeconds
+		case "cost_guard_max_cost":
+			input.CostGuardMaxCost = &config.CostGuardMaxCost
+		case "cost_guard_max_rows":
+			input.CostGuardMaxRows = &config.CostGuardMaxRows
+		case "cost_guard_action":
+			input.CostGuardAction = config.CostGuardAction
+		case "max_replica_lag_seconds":
+			input.MaxReplicaLagSeconds = config.MaxReplicaLagSeconds
+		case "replicas":
+			replicas := replicaInputs(config.Replicas)
+			input.Replicas = &replicas
+		case "session_init_statements":
+			statements := config.SessionInitStatements
+			input.SessionInitStatements = &statements
+		case "tls_mode":
+			input.TLSMode = config.TLSMode
+		case "tls_server_name":
+			input.TLSServerName = &config.TLSServerName
+		case "ssh_host":
+			input.SSHHost = &config.SSHHost
+		case "ssh_port":
+			input.SSHPort = &config.SSHPort
+		case "ssh_user":
+			input.SSHUser = &config.SSHUser
+		case "ssh_known_hosts":
+			input.SSHKnownHosts = &config.SSHKnownHosts
+		}
+	}
+	return input
+}
+
+// replicaInputs converts the replicas of a document to data source service input
+func replicaInputs(replicas []ReplicaConfig) []ReplicaInput {
+	inputs := make([]ReplicaInput, 0, len(replicas))
+	for _, replica := range replicas {
+		inputs = append(inputs, ReplicaInput{Host: replica.Host, Port: replica.Port})
+	}
+	return inputs
+}
+
+// sortReplicas orders replicas by endpoint, as their order has no meaning
+func sortReplicas(replicas []ReplicaConfig) {
+	sort.Slice(replicas, func(i, j int) bool {
+		if replicas[i].Host != replicas[j].Host {
+			return replicas[i].Host < replicas[j].Host
+		}
+		return replicas[i].Port < replicas[j].Port
+	})
+}
+
+// defaultInt points an unset setting at its default
+func defaultInt(value **int, fallback int) {
+	if *value == nil {
+		*value = &fallback
+	}
+}
+
+// orNegative returns a retention override, or -1 to clear it when it is unset
+func orNegative[T int | int64](value *T) *T {
+	if value == nil {
+		cleared := T(-1)
+		return &cleared
+	}
+	return value
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedByValue returns the keys of a map ordered by their values
+func sortedByValue(values map[uuid.UUID]string) []uuid.UUID {
+	keys := make([]uuid.UUID, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return values[keys[i]] < values[keys[j]] })
+	return keys
+}
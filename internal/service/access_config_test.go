@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// testAccessConfig is a document with a data source whose password is read from the environment,
+// and a group of two users that may read it
+const testAccessConfig = `
+version: 1
+datasources:
+  - name: warehouse
+    type: postgresql
+    environment: staging
+    host: db.internal
+    port: 5432
+    database_name: app
+    username: querybase
+    credential_source: env
+    credential_ref: QUERYBASE_SECRET_WAREHOUSE
+    max_result_rows: 500
+    replicas:
+      - host: replica-1.internal
+        port: 5432
+groups:
+  - name: analysts
+    description: Read access to the warehouse
+    members: [%s, %s]
+    permissions:
+      - datasource: warehouse
+        can_read: true
+`
+
+func parseTestAccessConfig(t *testing.T, document string) *AccessConfig {
+	config, err := ParseAccessConfig([]byte(document))
+	require.NoError(t, err)
+	return config
+}
+
+// changeNames lists the changes of a plan as "action kind name"
+func changeNames(plan *AccessConfigPlan) []string {
+	names := make([]string, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		names = append(names, fmt.Sprintf("%s %s %s", change.Action, change.Kind, change.Name))
+	}
+	return names
+}
+
+func newTestAccessConfigService(db *gorm.DB) *AccessConfigService {
+	return NewAccessConfigService(db, NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey)))
+}
+
+func TestAccessConfigService_PlanApplyAndExport(t *testing.T) {
+	db := setupTestDB(t)
+	service := newTestAccessConfigService(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, models.RoleUser)
+	bob := createTestUser(t, db, models.RoleUser)
+	document := fmt.Sprintf(testAccessConfig, alice.Email, bob.Username)
+
+	// Planning changes nothing
+	plan, err := service.Plan(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{})
+	require.NoError(t, err)
+	assert.False(t, plan.Applied)
+	assert.ElementsMatch(t, []string{
+		"create datasource warehouse",
+		"create group analysts",
+		"create membership analysts/" + alice.Email,
+		"create membership analysts/" + bob.Email,
+		"create permission analysts/warehouse",
+	}, changeNames(plan))
+	var count int64
+	db.Model(&models.DataSource{}).Count(&count)
+	assert.Zero(t, count)
+
+	plan, err = service.Apply(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{})
+	require.NoError(t, err)
+	assert.True(t, plan.Applied)
+	assert.Len(t, plan.Changes, 5)
+
+	var dataSource models.DataSource
+	require.NoError(t, db.Preload("Replicas").First(&dataSource, "name = ?", "warehouse").Error)
+	assert.Equal(t, models.EnvironmentStaging, dataSource.Environment)
+	assert.Equal(t, models.CredentialSourceEnv, dataSource.CredentialSource)
+	assert.Equal(t, 500, dataSource.MaxResultRows)
+	assert.Equal(t, 300, dataSource.StatementTimeoutSeconds)
+	require.Len(t, dataSource.Replicas, 1)
+
+	var group models.Group
+	require.NoError(t, db.First(&group, "name = ?", "analysts").Error)
+	db.Model(&models.UserGroup{}).Where("group_id = ?", group.ID).Count(&count)
+	assert.EqualValues(t, 2, count)
+	var permission models.DataSourcePermission
+	require.NoError(t, db.First(&permission, "group_id = ? AND data_source_id = ?", group.ID, dataSource.ID).Error)
+	assert.True(t, permission.CanRead)
+	assert.False(t, permission.CanWrite)
+
+	// The stored state now matches the document, and its export
+	plan, err = service.Plan(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+
+	exported, err := service.Export(ctx)
+	require.NoError(t, err)
+	require.Len(t, exported.Groups, 1)
+	members := []string{alice.Email, bob.Email}
+	sort.Strings(members)
+	assert.Equal(t, members, exported.Groups[0].Members, "members are exported in order")
+	yamlDocument, err := MarshalAccessConfigYAML(exported)
+	require.NoError(t, err)
+	assert.NotContains(t, string(yamlDocument), "encrypted_password")
+	plan, err = service.Plan(ctx, parseTestAccessConfig(t, string(yamlDocument)), AccessConfigOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes, "an export applies without changes")
+}
+
+func TestAccessConfigService_UpdateAndPrune(t *testing.T) {
+	db := setupTestDB(t)
+	service := newTestAccessConfigService(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, models.RoleUser)
+	bob := createTestUser(t, db, models.RoleUser)
+	_, err := service.Apply(ctx, parseTestAccessConfig(t, fmt.Sprintf(testAccessConfig, alice.Email, bob.Email)), AccessConfigOptions{})
+	require.NoError(t, err)
+
+	// Created through the API, and not in the document
+	legacy := createTestDataSource(t, db)
+	require.NoError(t, db.Create(&models.Group{Name: "contractors"}).Error)
+
+	document := fmt.Sprintf(`
+version: 1
+datasources:
+  - name: warehouse
+    type: postgresql
+    environment: staging
+    host: db.internal
+    port: 5432
+    database_name: app
+    username: querybase
+    credential_source: env
+    credential_ref: QUERYBASE_SECRET_WAREHOUSE
+    is_active: false
+groups:
+  - name: analysts
+    description: Read access to the warehouse
+    members: [%s]
+    permissions:
+      - datasource: warehouse
+        can_read: true
+        can_write: true
+`, alice.Email)
+
+	plan, err := service.Plan(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"update datasource warehouse",
+		"delete membership analysts/" + bob.Email,
+		"update permission analysts/warehouse",
+	}, changeNames(plan))
+	assert.Equal(t, []string{"is_active", "max_result_rows", "replicas"}, plan.Changes[0].Fields)
+	assert.Equal(t, []string{"can_write"}, plan.Changes[2].Fields)
+
+	plan, err = service.Apply(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{Prune: true})
+	require.NoError(t, err)
+	assert.Contains(t, changeNames(plan), "delete group contractors")
+	assert.Contains(t, changeNames(plan), "delete datasource "+legacy.Name)
+
+	var dataSource models.DataSource
+	require.NoError(t, db.Preload("Replicas").First(&dataSource, "name = ?", "warehouse").Error)
+	assert.False(t, dataSource.IsActive)
+	assert.Equal(t, defaultMaxResultRows, dataSource.MaxResultRows)
+	assert.Empty(t, dataSource.Replicas)
+	assert.ErrorIs(t, db.First(&models.DataSource{}, "id = ?", legacy.ID).Error, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, db.First(&models.Group{}, "name = ?", "contractors").Error, gorm.ErrRecordNotFound)
+
+	plan, err = service.Plan(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{Prune: true})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+}
+
+func TestAccessConfigService_InvalidDocuments(t *testing.T) {
+	db := setupTestDB(t)
+	service := newTestAccessConfigService(db)
+	ctx := context.Background()
+	alice := createTestUser(t, db, models.RoleUser)
+
+	_, err := ParseAccessConfig([]byte("version: 1\ndatasources:\n  - name: warehouse\n    pasword: hunter2\n"))
+	assert.ErrorIs(t, err, ErrInvalidAccessConfig, "unknown keys are rejected")
+
+	// A document holds no passwords, so a new data source needs a secret reference
+	_, err = service.Apply(ctx, parseTestAccessConfig(t, `
+version: 1
+datasources:
+  - {name: warehouse, type: postgresql, host: db.internal, port: 5432, database_name: app, username: querybase}
+`), AccessConfigOptions{})
+	assert.ErrorIs(t, err, ErrInvalidCredentialSource)
+
+	for name, document := range map[string]string{
+		"version":             "version: 2\n",
+		"unknown type":        "version: 1\ndatasources:\n  - {name: a, type: oracle}\n",
+		"duplicate group":     "version: 1\ngroups:\n  - {name: a}\n  - {name: a}\n",
+		"unknown data source": "version: 1\ngroups:\n  - {name: a, permissions: [{datasource: missing, can_read: true}]}\n",
+	} {
+		_, err := service.Plan(ctx, parseTestAccessConfig(t, document), AccessConfigOptions{})
+		assert.ErrorIs(t, err, ErrInvalidAccessConfig, name)
+	}
+
+	// A failure halfway through an apply changes nothing
+	_, err = service.Apply(ctx, parseTestAccessConfig(t, fmt.Sprintf(`
+version: 1
+groups:
+  - {name: analysts, members: [%s]}
+  - {name: viewers, members: [nobody@example.com]}
+`, alice.Email)), AccessConfigOptions{})
+	assert.ErrorIs(t, err, ErrInvalidAccessConfig)
+	assert.ErrorIs(t, db.First(&models.Group{}, "name = ?", "analysts").Error, gorm.ErrRecordNotFound)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -12,6 +13,10 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrSelectApprovalHasNoTransaction is returned when a transaction is started for an approved SELECT,
+// which runs as the requester's query instead
+var ErrSelectApprovalHasNoTransaction = errors.New("approved SELECTs run as the requester's query, not in a transaction")
+
 // ApprovalService handles approval workflow logic
 type ApprovalService struct {
 	db           *gorm.DB
@@ -211,6 +216,8 @@ func (s *ApprovalService) ReviewApproval(ctx context.Context, review *ReviewInpu
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	s.runApprovedSelect(ctx, approval.ID)
+
 	// TODO: Send notification to requester
 
 	return approvalReview, nil
@@ -238,51 +245,16 @@ func (s *ApprovalService) GetEligibleApprovers(ctx context.Context, dataSourceID
 
 // updateApprovalStatus updates the approval status based on reviews
 func (s *ApprovalService) updateApprovalStatus(ctx context.Context, approvalID uuid.UUID) {
-	var reviews []models.ApprovalReview
-	s.db.Where("approval_request_id = ?", approvalID).Find(&reviews)
-
-	if len(reviews) == 0 {
-		return
-	}
-
-	// If any review is rejected, mark as rejected
-	for _, review := range reviews {
-		if review.Decision == models.ApprovalDecisionRejected {
-			now := time.Now()
-			s.db.Model(&models.ApprovalRequest{}).
-				Where("id = ?", approvalID).
-				Updates(map[string]interface{}{
-					"status":       models.ApprovalStatusRejected,
-					"completed_at": now,
-				})
-			return
-		}
-	}
-
-	// If we have at least one approval, mark as approved.
-	// Execution is NOT triggered here — the approver must use the StartTransaction →
-	// CommitTransaction flow to execute with audit capture and explicit confirmation.
-	for _, review := range reviews {
-		if review.Decision == models.ApprovalDecisionApproved {
-			now := time.Now()
-			s.db.Model(&models.ApprovalRequest{}).
-				Where("id = ?", approvalID).
-				Updates(map[string]interface{}{
-					"status":       models.ApprovalStatusApproved,
-					"completed_at": now,
-				})
-
-			// Trigger stats update
-			if s.statsService != nil {
-				var tempApp models.ApprovalRequest
-				s.db.Select("requested_by").First(&tempApp, "id = ?", approvalID)
-				s.statsService.TriggerStatsChanged(tempApp.RequestedBy.String())
-			}
-			return
-		}
+	if err := s.updateApprovalStatusTx(s.db.WithContext(ctx), approvalID); err != nil {
+		log.Printf("[Approval] Failed to update the status of approval %s: %v", approvalID, err)
 	}
 }
 
+// updateApprovalStatusTx rejects a request on any rejection and approves it once it has the
+// approvals the environment of its data source requires.
+// Execution is NOT triggered here — approved SELECTs are run by ReviewApproval once the review is
+// committed, and writes wait for the approver to use the StartTransaction → CommitTransaction flow
+// to execute with audit capture and explicit confirmation.
 func (s *ApprovalService) updateApprovalStatusTx(tx *gorm.DB, approvalID uuid.UUID) error {
 	var reviews []models.ApprovalReview
 	if err := tx.Where("approval_request_id = ?", approvalID).Find(&reviews).Error; err != nil {
@@ -294,40 +266,74 @@ func (s *ApprovalService) updateApprovalStatusTx(tx *gorm.DB, approvalID uuid.UU
 	}
 
 	now := time.Now()
+	approvals := 0
 	for _, review := range reviews {
-		if review.Decision == models.ApprovalDecisionRejected {
+		switch review.Decision {
+		case models.ApprovalDecisionRejected:
 			return tx.Model(&models.ApprovalRequest{}).
 				Where("id = ?", approvalID).
 				Updates(map[string]interface{}{
 					"status":       models.ApprovalStatusRejected,
 					"completed_at": now,
 				}).Error
+		case models.ApprovalDecisionApproved:
+			approvals++
 		}
 	}
 
-	for _, review := range reviews {
-		if review.Decision == models.ApprovalDecisionApproved {
-			if err := tx.Model(&models.ApprovalRequest{}).
-				Where("id = ?", approvalID).
-				Updates(map[string]interface{}{
-					"status":       models.ApprovalStatusApproved,
-					"completed_at": now,
-				}).Error; err != nil {
-				return err
-			}
+	var approval models.ApprovalRequest
+	if err := tx.Preload("DataSource").First(&approval, "id = ?", approvalID).Error; err != nil {
+		return err
+	}
+	if approvals < s.queryService.EnvironmentPolicy(approval.DataSource.Environment).ApprovalsNeeded() {
+		return nil
+	}
 
-			if s.statsService != nil {
-				var tempApp models.ApprovalRequest
-				tx.Select("requested_by").First(&tempApp, "id = ?", approvalID)
-				s.statsService.TriggerStatsChanged(tempApp.RequestedBy.String())
-			}
-			return nil
-		}
+	if err := tx.Model(&models.ApprovalRequest{}).
+		Where("id = ?", approvalID).
+		Updates(map[string]interface{}{
+			"status":       models.ApprovalStatusApproved,
+			"completed_at": now,
+		}).Error; err != nil {
+		return err
 	}
 
+	if s.statsService != nil {
+		s.statsService.TriggerStatsChanged(approval.RequestedBy.String())
+	}
 	return nil
 }
 
+// runApprovedSelect runs the query of a SELECT approval once the approval is approved. The query runs
+// as the requester's, like any other SELECT, and its outcome is recorded on the query rather than the review.
+func (s *ApprovalService) runApprovedSelect(ctx context.Context, approvalID uuid.UUID) {
+	var approval models.ApprovalRequest
+	if err := s.db.First(&approval, "id = ?", approvalID).Error; err != nil {
+		log.Printf("[Approval] Failed to load approval %s: %v", approvalID, err)
+		return
+	}
+	if approval.Status != models.ApprovalStatusApproved || !isSelectApproval(&approval) {
+		return
+	}
+	if approval.QueryID == nil {
+		log.Printf("[Approval] Approved SELECT %s has no query to run", approval.ID)
+		return
+	}
+
+	// The run belongs to the requester, so the reviewer closing the request doesn't cancel it
+	query, err := s.queryService.RunApprovedQuery(context.WithoutCancel(ctx), *approval.QueryID)
+	if err != nil {
+		log.Printf("[Approval] Approved query %s of approval %s did not complete: %v", *approval.QueryID, approval.ID, err)
+		return
+	}
+	log.Printf("[Approval] Approved query %s of approval %s finished with status %s", query.ID, approval.ID, query.Status)
+}
+
+// isSelectApproval reports whether an approval request is for a SELECT, which runs as the requester's query
+func isSelectApproval(approval *models.ApprovalRequest) bool {
+	return approval.OperationType == models.OperationSelect
+}
+
 // StartTransaction starts a transaction for an approval request and executes the query in preview mode
 func (s *ApprovalService) StartTransaction(ctx context.Context, approvalID, startedBy string, auditMode models.AuditMode) (*models.QueryTransaction, error) {
 	// Get the approval request
@@ -343,6 +349,11 @@ func (s *ApprovalService) StartTransaction(ctx context.Context, approvalID, star
 		return nil, fmt.Errorf("approval request must be approved before starting a transaction (current status: %s)", approval.Status)
 	}
 
+	// Approved SELECTs already ran with the limits of any other SELECT; a write transaction would bypass them
+	if isSelectApproval(&approval) {
+		return nil, ErrSelectApprovalHasNoTransaction
+	}
+
 	// Check if an active transaction already exists — return it directly
 	var existingTx models.QueryTransaction
 	err := s.db.Where("approval_id = ? AND status = ?", approvalID, models.TransactionStatusActive).First(&existingTx).Error
@@ -27,6 +27,8 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+		&models.DataSourceHealthCheck{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -35,6 +37,8 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.QueryTransaction{},
 		&models.NotificationConfig{},
 		&models.Notification{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
 		&models.ApprovalComment{},
 	)
 	require.NoError(t, err)
@@ -83,7 +87,7 @@ func TestApprovalService_CreateApprovalRequest(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -154,7 +158,7 @@ func TestApprovalService_GetApproval(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -216,7 +220,7 @@ func TestApprovalService_ListApprovals(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -326,7 +330,7 @@ func TestApprovalService_ReviewApproval(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -437,7 +441,7 @@ func TestApprovalService_GetEligibleApprovers(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users and data source
@@ -492,7 +496,7 @@ func TestGetEligibleApprovers_UserWithCanApprove_IsEligible(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create user and data source
@@ -539,7 +543,7 @@ func TestGetEligibleApprovers_UserWithoutCanApprove_IsNotEligible(t *testing.T)
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create user and data source
@@ -585,7 +589,7 @@ func TestGetEligibleApprovers_RequesterExcluded_NotInList(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create requester and another approver
@@ -648,7 +652,7 @@ func TestGetEligibleApprovers_MultipleApprovers_AllReturned(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create multiple users
@@ -730,7 +734,7 @@ func TestGetEligibleApprovers_NoEligibleApprovers_ReturnsEmpty(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create a user but don't give them can_approve permission
@@ -777,7 +781,7 @@ func TestGetEligibleApprovers_GroupInheritance_CanApproveInherited(t *testing.T)
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users
@@ -855,7 +859,7 @@ func TestGetEligibleApprovers_Admin_IsEligible(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create admin user
@@ -902,7 +906,7 @@ func TestApprovalService_StartTransaction(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -966,7 +970,7 @@ func TestApprovalService_UpdateApprovalStatus(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -1038,7 +1042,7 @@ func TestApprovalService_DuplicateReview(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -1087,7 +1091,7 @@ func TestApprovalService_ReviewNonPendingApproval(t *testing.T) {
 		t.Skip("Skipping database-dependent test in short mode")
 	}
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	user := createTestUser(t, db, models.RoleUser)
@@ -1130,7 +1134,7 @@ func TestSelfApprovalPrevention_UserCannotApproveOwnRequest(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create a non-admin user
@@ -1182,7 +1186,7 @@ func TestSelfApprovalPrevention_UserWithCanApprove_CannotSelfApprove(t *testing.
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users
@@ -1249,7 +1253,7 @@ func TestSelfApprovalPrevention_InsertOperation_Blocked(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - requester is non-admin, anotherUser is admin
@@ -1323,7 +1327,7 @@ func TestSelfApprovalPrevention_UpdateOperation_Blocked(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - requester is non-admin, anotherUser is admin
@@ -1389,7 +1393,7 @@ func TestSelfApprovalPrevention_DeleteOperation_Blocked(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - requester is non-admin, anotherUser is admin
@@ -1455,7 +1459,7 @@ func TestSelfApprovalPrevention_ErrorMessage_IsClear(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create non-admin user
@@ -1511,7 +1515,7 @@ func TestSelfApprovalPrevention_AdminCanSelfApprove(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create admin user
@@ -1568,7 +1572,7 @@ func TestDuplicateReviewPrevention_UserCannotApproveTwice(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - reviewer is admin so they can approve
@@ -1623,7 +1627,7 @@ func TestDuplicateReviewPrevention_UserCannotRejectTwice(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - reviewer is admin so they can reject
@@ -1678,7 +1682,7 @@ func TestDuplicateReviewPrevention_AdminCannotReviewTwice(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users
@@ -1733,7 +1737,7 @@ func TestDuplicateReviewPrevention_ErrorMessage_IsClear(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - reviewer is admin so they can review
@@ -1798,7 +1802,7 @@ func TestDuplicateReviewPrevention_AfterFirstReview_SecondBlocked(t *testing.T)
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users - reviewer is admin so they can review
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/config"
 	"github.com/yourorg/querybase/internal/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -25,6 +26,7 @@ func setupWorkflowDB(t *testing.T) *gorm.DB {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -34,6 +36,8 @@ func setupWorkflowDB(t *testing.T) *gorm.DB {
 		&models.QueryTransactionStatement{},
 		&models.NotificationConfig{},
 		&models.Notification{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
 		&models.ApprovalComment{},
 	)
 	require.NoError(t, err)
@@ -42,7 +46,7 @@ func setupWorkflowDB(t *testing.T) *gorm.DB {
 
 func newApprovalServices(t *testing.T, db *gorm.DB) *ApprovalService {
 	t.Helper()
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	return NewApprovalService(db, queryService, nil)
 }
 
@@ -285,6 +289,66 @@ func TestFullApprovalWorkflow_Reject(t *testing.T) {
 	assert.Equal(t, models.ApprovalStatusRejected, final.Status)
 }
 
+// TestApprovalWorkflow_ApprovedSelectRunsAsRequesterQuery verifies that approving a SELECT the cost
+// guard sent for approval runs the requester's pending query with the usual result limits.
+func TestApprovalWorkflow_ApprovedSelectRunsAsRequesterQuery(t *testing.T) {
+	db := setupWorkflowDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	queryService.SetEnvironmentPolicies(map[string]config.EnvironmentPolicyConfig{"prod": {RequiredApprovals: 1, MaxRows: 1}})
+	svc := NewApprovalService(db, queryService, nil)
+	ctx := context.Background()
+
+	requester := createTestUser(t, db, models.RoleAdmin)
+	reviewer := createTestUser(t, db, models.RoleAdmin)
+	ds := createSQLiteDataSource(t, db)
+
+	// The state the cost guard leaves a query in when it sends it for approval
+	query := &models.Query{
+		ID:               uuid.New(),
+		DataSourceID:     ds.ID,
+		UserID:           requester.ID,
+		QueryText:        "SELECT id, status FROM orders ORDER BY id",
+		OperationType:    models.OperationSelect,
+		Status:           models.StatusPending,
+		IsAsync:          true,
+		RequiresApproval: true,
+	}
+	require.NoError(t, db.Create(query).Error)
+	approval := &models.ApprovalRequest{
+		ID:            uuid.New(),
+		QueryID:       &query.ID,
+		DataSourceID:  ds.ID,
+		QueryText:     query.QueryText,
+		RequestedBy:   requester.ID,
+		OperationType: models.OperationSelect,
+		Status:        models.ApprovalStatusPending,
+	}
+	require.NoError(t, db.Create(approval).Error)
+
+	// The worker doesn't pick up a query waiting for approval
+	_, err := queryService.RunQueuedQuery(ctx, query.ID)
+	assert.ErrorIs(t, err, ErrQueryNotPending)
+
+	_, err = svc.ReviewApproval(ctx, &ReviewInput{
+		ApprovalID: approval.ID,
+		ReviewerID: reviewer.ID.String(),
+		Decision:   models.ApprovalDecisionApproved,
+	})
+	require.NoError(t, err)
+
+	var executed models.Query
+	require.NoError(t, db.First(&executed, "id = ?", query.ID).Error)
+	assert.Equal(t, models.StatusCompleted, executed.Status, executed.ErrorMessage)
+	var result models.QueryResult
+	require.NoError(t, db.First(&result, "query_id = ?", query.ID).Error)
+	assert.Equal(t, 1, result.RowCount)
+	assert.True(t, result.Truncated)
+
+	// The result is the requester's, so there's no write transaction to start
+	_, err = svc.StartTransaction(ctx, approval.ID.String(), reviewer.ID.String(), models.AuditModeCountOnly)
+	assert.ErrorIs(t, err, ErrSelectApprovalHasNoTransaction)
+}
+
 // TestApprovalWorkflow_NoDuplicateReview verifies a reviewer cannot review twice.
 func TestApprovalWorkflow_NoDuplicateReview(t *testing.T) {
 	db := setupWorkflowDB(t)
@@ -7,10 +7,8 @@ import (
 	"github.com/yourorg/querybase/internal/models"
 )
 
-// TestAuditService_BuildCountQuery tests count query generation from write queries
-func TestAuditService_BuildCountQuery(t *testing.T) {
-	auditSvc := &AuditService{}
-
+// TestBuildCountQuery tests count query generation from write queries
+func TestBuildCountQuery(t *testing.T) {
 	tests := []struct {
 		name        string
 		query       string
@@ -76,7 +74,7 @@ func TestAuditService_BuildCountQuery(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := auditSvc.buildCountQuery(tt.query)
+			result, err := buildCountQuery(tt.query)
 
 			if tt.expectError {
 				assert.Error(t, err)
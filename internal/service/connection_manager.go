@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// Default pool settings applied when the configuration leaves a value unset
+const (
+	DefaultPoolMaxOpenConns    = 10
+	DefaultPoolMaxIdleConns    = 2
+	DefaultPoolConnMaxLifetime = 30 * time.Minute
+	DefaultPoolConnMaxIdleTime = 5 * time.Minute
+)
+
+// dataSourcePool is a cached connection pool for a single data source
+type dataSourcePool struct {
+	db          *gorm.DB
+	name        string
+	fingerprint string
+	createdAt   time.Time
+}
+
+// PoolStats describes the state of a data source connection pool
+type PoolStats struct {
+	DataSourceID       uuid.UUID `json:"data_source_id"`
+	DataSourceName     string    `json:"data_source_name"`
+	MaxOpenConnections int       `json:"max_open_connections"`
+	OpenConnections    int       `json:"open_connections"`
+	InUse              int       `json:"in_use"`
+	Idle               int       `json:"idle"`
+	WaitCount          int64     `json:"wait_count"`
+	WaitDurationMs     int64     `json:"wait_duration_ms"`
+	MaxIdleClosed      int64     `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64     `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64     `json:"max_lifetime_closed"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// ConnectionManager keeps one shared connection pool per data source
+type ConnectionManager struct {
+	pools  map[uuid.UUID]*dataSourcePool
+	mu     sync.Mutex
+	config config.DataSourcePoolConfig
+	// secrets resolves the passwords of data sources with an external credential source
+	secrets *SecretResolver
+}
+
+// NewConnectionManager creates a new connection manager
+func NewConnectionManager(poolConfig config.DataSourcePoolConfig) *ConnectionManager {
+	if poolConfig.MaxOpenConns <= 0 {
+		poolConfig.MaxOpenConns = DefaultPoolMaxOpenConns
+	}
+	if poolConfig.MaxIdleConns <= 0 {
+		poolConfig.MaxIdleConns = DefaultPoolMaxIdleConns
+	}
+	if poolConfig.MaxIdleConns > poolConfig.MaxOpenConns {
+		poolConfig.MaxIdleConns = poolConfig.MaxOpenConns
+	}
+	if poolConfig.ConnMaxLifetime <= 0 {
+		poolConfig.ConnMaxLifetime = DefaultPoolConnMaxLifetime
+	}
+	if poolConfig.ConnMaxIdleTime <= 0 {
+		poolConfig.ConnMaxIdleTime = DefaultPoolConnMaxIdleTime
+	}
+
+	return &ConnectionManager{
+		pools:   make(map[uuid.UUID]*dataSourcePool),
+		config:  poolConfig,
+		secrets: NewSecretResolver(config.SecretsConfig{}),
+	}
+}
+
+// SetSecretResolver sets the resolver of external credential sources, shared by every service using the manager
+func (m *ConnectionManager) SetSecretResolver(secrets *SecretResolver) {
+	m.secrets = secrets
+}
+
+// Get returns the shared pool for a data source, opening it on first use.
+// A cached pool is replaced when the connection settings of the data source have changed.
+func (m *ConnectionManager) Get(dataSource *models.DataSource, credentials *ConnectionCredentials) (*gorm.DB, error) {
+	fingerprint := connectionFingerprint(dataSource, credentials)
+
+	m.mu.Lock()
+	pool, ok := m.pools[dataSource.ID]
+	m.mu.Unlock()
+	if ok && pool.fingerprint == fingerprint {
+		return pool.db, nil
+	}
+
+	// Open outside the lock so a slow or unreachable server doesn't block other data sources
+	db, err := openDataSource(dataSource, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(m.config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(m.config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(m.config.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(m.config.ConnMaxIdleTime)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another request may have opened the same pool while we were connecting
+	if existing, ok := m.pools[dataSource.ID]; ok {
+		if existing.fingerprint == fingerprint {
+			sqlDB.Close()
+			return existing.db, nil
+		}
+		closePool(dataSource.ID, existing)
+	}
+
+	m.pools[dataSource.ID] = &dataSourcePool{
+		db:          db,
+		name:        dataSource.Name,
+		fingerprint: fingerprint,
+		createdAt:   time.Now(),
+	}
+
+	return db, nil
+}
+
+// Ping verifies that a data source is reachable through its shared pool
+func (m *ConnectionManager) Ping(ctx context.Context, dataSource *models.DataSource, credentials *ConnectionCredentials) error {
+	db, err := m.Get(dataSource, credentials)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+// Invalidate closes and forgets the pool of a data source
+func (m *ConnectionManager) Invalidate(dataSourceID uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if pool, ok := m.pools[dataSourceID]; ok {
+		closePool(dataSourceID, pool)
+		delete(m.pools, dataSourceID)
+	}
+}
+
+// Stats returns statistics for every open pool
+func (m *ConnectionManager) Stats() []PoolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]PoolStats, 0, len(m.pools))
+	for id, pool := range m.pools {
+		sqlDB, err := pool.db.DB()
+		if err != nil {
+			continue
+		}
+
+		s := sqlDB.Stats()
+		stats = append(stats, PoolStats{
+			DataSourceID:       id,
+			DataSourceName:     pool.name,
+			MaxOpenConnections: s.MaxOpenConnections,
+			OpenConnections:    s.OpenConnections,
+			InUse:              s.InUse,
+			Idle:               s.Idle,
+			WaitCount:          s.WaitCount,
+			WaitDurationMs:     s.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      s.MaxIdleClosed,
+			MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  s.MaxLifetimeClosed,
+			CreatedAt:          pool.createdAt,
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].DataSourceName < stats[j].DataSourceName
+	})
+
+	return stats
+}
+
+// Close closes all pools
+func (m *ConnectionManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, pool := range m.pools {
+		closePool(id, pool)
+		delete(m.pools, id)
+	}
+}
+
+// closePool closes the underlying sql.DB of a pool. In-flight queries keep
+// their connection until they finish; database/sql closes it afterwards.
+func closePool(dataSourceID uuid.UUID, pool *dataSourcePool) {
+	sqlDB, err := pool.db.DB()
+	if err != nil {
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Printf("[ConnectionManager] Failed to close pool for data source %s: %v", dataSourceID, err)
+	}
+}
+
+// connectionFingerprint identifies the settings a pool was opened with
+func connectionFingerprint(dataSource *models.DataSource, credentials *ConnectionCredentials) string {
+	sessionInit := ""
+	if dataSource.SessionInitStatements != nil {
+		sessionInit = *dataSource.SessionInitStatements
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s",
+		dataSource.Type,
+		dataSource.Host,
+		dataSource.Port,
+		dataSource.GetDatabase(),
+		dataSource.FilePath,
+		dataSource.Username,
+		credentials.Password,
+		sessionInit,
+		dataSource.TLSMode,
+		dataSource.TLSServerName,
+		credentials.TLSCACert,
+		credentials.TLSClientCert,
+		credentials.TLSClientKey,
+		sshTunnelKey(dataSource, credentials),
+	)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// openDataSource opens a new connection pool to a data source.
+// Every connection of the pool runs the session init statements of the data source.
+func openDataSource(dataSource *models.DataSource, credentials *ConnectionCredentials) (*gorm.DB, error) {
+	statements, err := DecodeSessionInitStatements(dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return nil, err
+	}
+	return driver.Open(dataSource, credentials, statements)
+}
+
+// openGorm wraps an opened database/sql pool, closing it when gorm can't connect
+func openGorm(dialector gorm.Dialector, sqlDB *sql.DB) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
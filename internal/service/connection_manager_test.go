@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestNewConnectionManager_Defaults(t *testing.T) {
+	manager := NewConnectionManager(config.DataSourcePoolConfig{})
+
+	assert.Equal(t, DefaultPoolMaxOpenConns, manager.config.MaxOpenConns)
+	assert.Equal(t, DefaultPoolMaxIdleConns, manager.config.MaxIdleConns)
+	assert.Equal(t, DefaultPoolConnMaxLifetime, manager.config.ConnMaxLifetime)
+	assert.Equal(t, DefaultPoolConnMaxIdleTime, manager.config.ConnMaxIdleTime)
+
+	// Idle connections can never exceed the open connection limit
+	manager = NewConnectionManager(config.DataSourcePoolConfig{MaxOpenConns: 3, MaxIdleConns: 8, ConnMaxLifetime: time.Minute})
+	assert.Equal(t, 3, manager.config.MaxIdleConns)
+	assert.Equal(t, time.Minute, manager.config.ConnMaxLifetime)
+}
+
+func TestConnectionFingerprint(t *testing.T) {
+	dataSource := &models.DataSource{
+		ID:           uuid.New(),
+		Type:         models.DataSourceTypePostgreSQL,
+		Host:         "db.example.com",
+		Port:         5432,
+		DatabaseName: "app",
+		Username:     "querybase",
+	}
+
+	base := connectionFingerprint(dataSource, &ConnectionCredentials{Password: "secret"})
+	assert.Equal(t, base, connectionFingerprint(dataSource, &ConnectionCredentials{Password: "secret"}))
+	assert.NotEqual(t, base, connectionFingerprint(dataSource, &ConnectionCredentials{Password: "rotated"}))
+
+	changed := *dataSource
+	changed.Host = "replica.example.com"
+	assert.NotEqual(t, base, connectionFingerprint(&changed, &ConnectionCredentials{Password: "secret"}))
+
+	// Fields that don't affect the connection keep the pool
+	renamed := *dataSource
+	renamed.Name = "Renamed"
+	assert.Equal(t, base, connectionFingerprint(&renamed, &ConnectionCredentials{Password: "secret"}))
+
+	// Switching TLS on or rotating a client certificate opens a new pool
+	encrypted := *dataSource
+	encrypted.TLSMode = models.TLSModeRequire
+	assert.NotEqual(t, base, connectionFingerprint(&encrypted, &ConnectionCredentials{Password: "secret"}))
+	assert.NotEqual(t, base, connectionFingerprint(dataSource, &ConnectionCredentials{Password: "secret", TLSClientCert: "cert"}))
+}
+
+func TestConnectionManager_UnsupportedType(t *testing.T) {
+	manager := NewConnectionManager(config.DataSourcePoolConfig{})
+
+	_, err := manager.Get(&models.DataSource{ID: uuid.New(), Type: "oracle"}, &ConnectionCredentials{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported data source type")
+	assert.Empty(t, manager.Stats())
+
+	// Invalidating an unknown data source is a no-op
+	manager.Invalidate(uuid.New())
+	manager.Close()
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// Cost guard rules, named after the data source threshold they check
+const (
+	CostGuardRuleMaxCost = "max_cost"
+	CostGuardRuleMaxRows = "max_rows"
+)
+
+var (
+	// ErrCostGuardBlocked is returned when a SELECT's estimate exceeds a threshold of a data source that blocks such queries
+	ErrCostGuardBlocked = errors.New("query blocked by cost guard")
+	// ErrCostGuardApprovalRequired is returned when a SELECT's estimate exceeds a threshold and the query was sent for approval
+	ErrCostGuardApprovalRequired = errors.New("query requires approval by cost guard")
+)
+
+// postgresPlanNodeEstimate matches the estimates of a node in PostgreSQL's text EXPLAIN output,
+// e.g. "Seq Scan on orders  (cost=0.00..18334.00 rows=1000000 width=36)"
+var postgresPlanNodeEstimate = regexp.MustCompile(`cost=[\d.]+\.\.([\d.]+) rows=(\d+)`)
+
+// CostEstimate is the planner's estimate for a SELECT
+type CostEstimate struct {
+	// Cost is the total cost of the plan in planner units; nil when the database doesn't report one (MySQL)
+	Cost *float64 `json:"estimated_cost"`
+	// Rows is the largest number of rows the plan expects to produce or examine
+	Rows float64 `json:"estimated_rows"`
+}
+
+// CostGuardViolation describes the threshold a SELECT's estimate exceeded
+type CostGuardViolation struct {
+	Estimate   CostEstimate           `json:"estimate"`
+	Rule       string                 `json:"rule"` // max_cost or max_rows
+	Threshold  float64                `json:"threshold"`
+	Action     models.CostGuardAction `json:"action"`
+	ApprovalID *uuid.UUID             `json:"approval_id,omitempty"` // set when the query was sent for approval
+}
+
+// Message explains the violation to the user
+func (v *CostGuardViolation) Message() string {
+	if v.Rule == CostGuardRuleMaxCost {
+		return fmt.Sprintf("estimated cost %.2f exceeds the data source limit of %.2f", *v.Estimate.Cost, v.Threshold)
+	}
+	return fmt.Sprintf("estimated %.0f rows exceeds the data source limit of %.0f", v.Estimate.Rows, v.Threshold)
+}
+
+// CostGuardError is returned when the cost guard stops a SELECT, either blocking it or sending it for approval
+type CostGuardError struct {
+	Violation *CostGuardViolation
+	err       error
+}
+
+func (e *CostGuardError) Error() string {
+	return fmt.Sprintf("%v: %s", e.err, e.Violation.Message())
+}
+
+func (e *CostGuardError) Unwrap() error {
+	return e.err
+}
+
+// costGuardEnabled reports whether SELECTs on the data source are checked against a threshold
+func costGuardEnabled(dataSource *models.DataSource) bool {
+	return dataSource.CostGuardMaxCost > 0 || dataSource.CostGuardMaxRows > 0
+}
+
+// EvaluateCostGuard checks an estimate against the data source thresholds and returns the violation,
+// or nil when the query may run. The cost threshold is checked first; it is skipped when the database
+// doesn't report a cost.
+func EvaluateCostGuard(dataSource *models.DataSource, estimate *CostEstimate) *CostGuardViolation {
+	action := dataSource.CostGuardAction
+	if action == "" {
+		action = models.CostGuardBlock
+	}
+
+	if dataSource.CostGuardMaxCost > 0 && estimate.Cost != nil && *estimate.Cost > dataSource.CostGuardMaxCost {
+		return &CostGuardViolation{Estimate: *estimate, Rule: CostGuardRuleMaxCost, Threshold: dataSource.CostGuardMaxCost, Action: action}
+	}
+	if dataSource.CostGuardMaxRows > 0 && estimate.Rows > float64(dataSource.CostGuardMaxRows) {
+		return &CostGuardViolation{Estimate: *estimate, Rule: CostGuardRuleMaxRows, Threshold: float64(dataSource.CostGuardMaxRows), Action: action}
+	}
+	return nil
+}
+
+// EstimateQueryCost runs EXPLAIN for a bound SELECT and reads the planner's estimate
+func (s *QueryService) EstimateQueryCost(ctx context.Context, dataSource *models.DataSource, sqlText string, args []interface{}) (*CostEstimate, error) {
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite's query plan, for one, has neither costs nor row estimates
+	if _, ok := driver.(CostEstimator); !ok {
+		return nil, fmt.Errorf("%s does not estimate query costs", dataSource.Type)
+	}
+
+	explain, err := driver.ExplainStatement(false)
+	if err != nil {
+		return nil, err
+	}
+	explained, err := s.explain(ctx, dataSource, explain+" "+sqlText, args)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCostEstimate(dataSource.Type, explained.Plan)
+}
+
+// ParseCostEstimate reads the estimate from the rows of a plain EXPLAIN.
+//
+// PostgreSQL reports the total cost on the top plan node; the row estimate is the largest of any node,
+// so a full scan feeding an aggregate still counts the rows it reads. MySQL only reports rows per
+// table; tables of the same SELECT are joined, so their estimates multiply.
+func ParseCostEstimate(dsType models.DataSourceType, plan []map[string]interface{}) (*CostEstimate, error) {
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("EXPLAIN returned no plan")
+	}
+
+	driver, err := LookupDataSourceDriver(dsType)
+	if err != nil {
+		return nil, err
+	}
+	estimator, ok := driver.(CostEstimator)
+	if !ok {
+		return nil, fmt.Errorf("%s does not estimate query costs", dsType)
+	}
+	return estimator.ParseCostEstimate(plan)
+}
+
+func parsePostgresCostEstimate(plan []map[string]interface{}) (*CostEstimate, error) {
+	estimate := &CostEstimate{}
+	for _, row := range plan {
+		line, _ := row["QUERY PLAN"].(string)
+		match := postgresPlanNodeEstimate.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		rows, _ := strconv.ParseFloat(match[2], 64)
+		if rows > estimate.Rows {
+			estimate.Rows = rows
+		}
+		if estimate.Cost == nil {
+			cost, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid plan cost %q: %w", match[1], err)
+			}
+			estimate.Cost = &cost
+		}
+	}
+
+	if estimate.Cost == nil {
+		return nil, fmt.Errorf("EXPLAIN output has no cost estimate")
+	}
+	return estimate, nil
+}
+
+func parseMySQLCostEstimate(plan []map[string]interface{}) (*CostEstimate, error) {
+	joined := make(map[string]float64)
+	found := false
+	for _, row := range plan {
+		rows, ok := planNumber(row["rows"])
+		if !ok {
+			// Rows without a table, e.g. "No tables used" or a UNION result
+			continue
+		}
+		found = true
+
+		id := fmt.Sprint(row["id"])
+		if current, seen := joined[id]; seen {
+			joined[id] = current * rows
+		} else {
+			joined[id] = rows
+		}
+	}
+
+	if !found {
+		return &CostEstimate{}, nil
+	}
+
+	estimate := &CostEstimate{}
+	for _, rows := range joined {
+		if rows > estimate.Rows {
+			estimate.Rows = rows
+		}
+	}
+	return estimate, nil
+}
+
+// planNumber reads a numeric EXPLAIN column, which drivers return as a number or as text
+func planNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// checkQueryCost runs the cost guard of the data source for a bound SELECT. The estimate is recorded
+// on the query. It returns a *CostGuardError when the query must not run now; when the data source
+// sends such queries for approval, the approval request is created first and the query is left pending.
+// An approved query isn't sent for approval again.
+func (s *QueryService) checkQueryCost(ctx context.Context, query *models.Query, dataSource *models.DataSource, sqlText string, args []interface{}, approved bool) error {
+	estimate, violation := s.evaluateQueryCost(ctx, query, dataSource, sqlText, args)
+	if estimate == nil {
+		return nil
+	}
+
+	query.EstimatedCost = estimate.Cost
+	query.EstimatedRows = &estimate.Rows
+	updates := map[string]interface{}{
+		"estimated_cost": estimate.Cost,
+		"estimated_rows": estimate.Rows,
+	}
+	if violation != nil {
+		query.CostGuardRule = violation.Rule
+		updates["cost_guard_rule"] = violation.Rule
+	}
+	s.db.Model(query).Updates(updates)
+
+	if violation == nil {
+		return nil
+	}
+
+	switch violation.Action {
+	case models.CostGuardWarn:
+		log.Printf("[CostGuard] Query %s on %s: %s", query.ID, dataSource.Name, violation.Message())
+		return nil
+	case models.CostGuardApproval:
+		if approved {
+			log.Printf("[CostGuard] Running approved query %s on %s: %s", query.ID, dataSource.Name, violation.Message())
+			return nil
+		}
+		// Approvers review and run the literal SQL, so bound parameters can't be carried over
+		if len(args) > 0 {
+			violation.Action = models.CostGuardBlock
+			return &CostGuardError{Violation: violation, err: fmt.Errorf("%w (parameterized queries can't be sent for approval)", ErrCostGuardBlocked)}
+		}
+
+		approval := &models.ApprovalRequest{
+			ID:            uuid.New(),
+			QueryID:       &query.ID,
+			DataSourceID:  dataSource.ID,
+			QueryText:     query.QueryText,
+			RequestedBy:   query.UserID,
+			OperationType: models.OperationSelect,
+			Status:        models.ApprovalStatusPending,
+		}
+		if err := s.db.Create(approval).Error; err != nil {
+			return fmt.Errorf("failed to create approval request: %w", err)
+		}
+		s.db.Model(query).Updates(map[string]interface{}{
+			"requires_approval": true,
+			"status":            models.StatusPending,
+		})
+		query.RequiresApproval = true
+		query.Status = models.StatusPending
+
+		violation.ApprovalID = &approval.ID
+		return &CostGuardError{Violation: violation, err: ErrCostGuardApprovalRequired}
+	default:
+		return &CostGuardError{Violation: violation, err: ErrCostGuardBlocked}
+	}
+}
+
+// checkRerunCost runs the cost guard for a stored SELECT that is run again on its data source, for a
+// stream export or a page of results. Re-runs are never sent for approval, so a query the guard
+// would send for approval is refused like a blocked one.
+func (s *QueryService) checkRerunCost(ctx context.Context, query *models.Query, dataSource *models.DataSource, sqlText string, args []interface{}) error {
+	if !costGuardEnabled(dataSource) {
+		return nil
+	}
+
+	_, violation := s.evaluateQueryCost(ctx, query, dataSource, sqlText, args)
+	if violation == nil {
+		return nil
+	}
+
+	switch violation.Action {
+	case models.CostGuardWarn:
+		log.Printf("[CostGuard] Re-run of query %s on %s: %s", query.ID, dataSource.Name, violation.Message())
+		return nil
+	case models.CostGuardApproval:
+		violation.Action = models.CostGuardBlock
+		return &CostGuardError{Violation: violation, err: fmt.Errorf("%w (re-runs can't be sent for approval)", ErrCostGuardBlocked)}
+	default:
+		return &CostGuardError{Violation: violation, err: ErrCostGuardBlocked}
+	}
+}
+
+// evaluateQueryCost estimates a bound SELECT and checks the estimate against the data source
+// thresholds. The estimate is nil when the query can't be estimated, which the guard lets through.
+func (s *QueryService) evaluateQueryCost(ctx context.Context, query *models.Query, dataSource *models.DataSource, sqlText string, args []interface{}) (*CostEstimate, *CostGuardViolation) {
+	estimate, err := s.EstimateQueryCost(ctx, dataSource, sqlText, args)
+	if err != nil {
+		// The guard doesn't stop queries it can't estimate; a broken query fails when it runs
+		log.Printf("[CostGuard] Could not estimate query %s on %s, running it unchecked: %v", query.ID, dataSource.Name, err)
+		return nil, nil
+	}
+	return estimate, EvaluateCostGuard(dataSource, estimate)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestParseCostEstimate_PostgreSQL(t *testing.T) {
+	plan := []map[string]interface{}{
+		{"QUERY PLAN": "Aggregate  (cost=20834.00..20834.01 rows=1 width=8)"},
+		{"QUERY PLAN": "  ->  Seq Scan on orders  (cost=0.00..18334.00 rows=1000000 width=0)"},
+		{"QUERY PLAN": "        Filter: (status = 'open'::text)"},
+	}
+
+	estimate, err := ParseCostEstimate(models.DataSourceTypePostgreSQL, plan)
+	require.NoError(t, err)
+
+	// The total cost is the top node's; the rows are the largest estimate of any node
+	require.NotNil(t, estimate.Cost)
+	assert.Equal(t, 20834.01, *estimate.Cost)
+	assert.Equal(t, float64(1000000), estimate.Rows)
+
+	_, err = ParseCostEstimate(models.DataSourceTypePostgreSQL, []map[string]interface{}{{"QUERY PLAN": "Result"}})
+	assert.Error(t, err)
+}
+
+func TestParseCostEstimate_MySQL(t *testing.T) {
+	plan := []map[string]interface{}{
+		{"id": int64(1), "table": "o", "rows": int64(5000)},
+		{"id": int64(1), "table": "c", "rows": "20"},
+		{"id": int64(2), "table": "p", "rows": int64(30000)},
+		{"id": nil, "table": "<union1,2>", "rows": nil},
+	}
+
+	estimate, err := ParseCostEstimate(models.DataSourceTypeMySQL, plan)
+	require.NoError(t, err)
+
+	// Tables of the same SELECT are joined, so their estimates multiply
+	assert.Nil(t, estimate.Cost)
+	assert.Equal(t, float64(100000), estimate.Rows)
+}
+
+func TestEvaluateCostGuard(t *testing.T) {
+	cost := 5000.0
+	estimate := &CostEstimate{Cost: &cost, Rows: 200}
+
+	// No thresholds exceeded
+	dataSource := &models.DataSource{CostGuardMaxCost: 10000, CostGuardMaxRows: 1000}
+	assert.Nil(t, EvaluateCostGuard(dataSource, estimate))
+
+	// The action defaults to block
+	dataSource.CostGuardMaxCost = 1000
+	violation := EvaluateCostGuard(dataSource, estimate)
+	require.NotNil(t, violation)
+	assert.Equal(t, CostGuardRuleMaxCost, violation.Rule)
+	assert.Equal(t, models.CostGuardBlock, violation.Action)
+	assert.Equal(t, float64(1000), violation.Threshold)
+	assert.Contains(t, violation.Message(), "estimated cost 5000.00")
+
+	// Without a reported cost only the row threshold applies
+	dataSource = &models.DataSource{CostGuardMaxCost: 1000, CostGuardMaxRows: 100, CostGuardAction: models.CostGuardApproval}
+	violation = EvaluateCostGuard(dataSource, &CostEstimate{Rows: 200})
+	require.NotNil(t, violation)
+	assert.Equal(t, CostGuardRuleMaxRows, violation.Rule)
+	assert.Equal(t, models.CostGuardApproval, violation.Action)
+
+	err := &CostGuardError{Violation: violation, err: ErrCostGuardApprovalRequired}
+	assert.ErrorIs(t, err, ErrCostGuardApprovalRequired)
+	assert.Contains(t, err.Error(), "estimated 200 rows exceeds the data source limit of 100")
+}
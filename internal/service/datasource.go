@@ -2,38 +2,76 @@ package service
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
-	"io"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/config"
 	"github.com/yourorg/querybase/internal/models"
-	gormmysql "gorm.io/driver/mysql"
-	gormpostgres "gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 // DataSourceService handles data source business logic
 type DataSourceService struct {
-	db            *gorm.DB
-	encryptionKey []byte
+	db          *gorm.DB
+	keyring     *Keyring
+	connections *ConnectionManager
+	// healthRetention is how long health probes are kept
+	healthRetention time.Duration
 }
 
 // NewDataSourceService creates a new data source service
-func NewDataSourceService(db *gorm.DB, encryptionKey string) *DataSourceService {
+func NewDataSourceService(db *gorm.DB, keyring *Keyring) *DataSourceService {
 	return &DataSourceService{
-		db:            db,
-		encryptionKey: []byte(encryptionKey),
+		db:              db,
+		keyring:         keyring,
+		connections:     NewConnectionManager(config.DataSourcePoolConfig{}),
+		healthRetention: defaultHealthRetention,
 	}
 }
 
+// withDB returns a copy of the service that works on another handle of the database, such as a transaction
+func (s *DataSourceService) withDB(db *gorm.DB) *DataSourceService {
+	scoped := *s
+	scoped.db = db
+	return &scoped
+}
+
+// SetConnectionManager shares a connection manager with other services
+func (s *DataSourceService) SetConnectionManager(connections *ConnectionManager) {
+	s.connections = connections
+}
+
+// GetPoolStats returns connection pool statistics for every open data source pool
+func (s *DataSourceService) GetPoolStats(ctx context.Context) []PoolStats {
+	return s.connections.Stats()
+}
+
 // CreateDataSource creates a new data source
 func (s *DataSourceService) CreateDataSource(ctx context.Context, req *CreateDataSourceInput) (*models.DataSource, error) {
+	sessionInit, err := sessionInitColumn(models.DataSourceType(req.Type), req.SessionInitStatements)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite data sources are a database file; SQLite calls the database it opens "main"
+	databaseName := req.DatabaseName
+	var filePath string
+	if models.DataSourceType(req.Type) == models.DataSourceTypeSQLite {
+		if filePath, err = NormalizeSQLitePath(req.FilePath); err != nil {
+			return nil, err
+		}
+		if databaseName == "" {
+			databaseName = "main"
+		}
+	}
+
+	environment, err := NormalizeEnvironment(req.Environment)
+	if err != nil {
+		return nil, err
+	}
+
 	// Encrypt password
 	encryptedPassword, err := s.encryptPassword(req.Password)
 	if err != nil {
@@ -44,25 +82,83 @@ func (s *DataSourceService) CreateDataSource(ctx context.Context, req *CreateDat
 		ID:                uuid.New(),
 		Name:              req.Name,
 		Type:              models.DataSourceType(req.Type),
+		Environment:       environment,
 		Host:              req.Host,
 		Port:              req.Port,
-		DatabaseName:      req.DatabaseName,
+		DatabaseName:      databaseName,
+		FilePath:          filePath,
 		Username:          req.Username,
 		EncryptedPassword: encryptedPassword,
 		IsActive:          true,
+		// Retention overrides are nullable, so nil keeps the global setting
+		ResultMaxAgeHours:     req.ResultMaxAgeHours,
+		ResultMaxTotalBytes:   req.ResultMaxTotalBytes,
+		ResultKeepLastPerUser: req.ResultKeepLastPerUser,
+		ResultCacheTTLSeconds: req.ResultCacheTTLSeconds,
+		CostGuardMaxCost:      req.CostGuardMaxCost,
+		CostGuardMaxRows:      req.CostGuardMaxRows,
+		CostGuardAction:       models.CostGuardAction(req.CostGuardAction),
+		SessionInitStatements: sessionInit,
+	}
+	if dataSource.CostGuardAction == "" {
+		dataSource.CostGuardAction = models.CostGuardBlock
+	}
+	if err := s.setCredentialSource(dataSource, req); err != nil {
+		return nil, err
+	}
+	if err := s.setTLSSettings(dataSource, req); err != nil {
+		return nil, err
+	}
+	if err := s.setSSHSettings(dataSource, req); err != nil {
+		return nil, err
+	}
+
+	// Create skips zero values in favour of column defaults, so explicit
+	// settings (where 0 means "no limit") are applied with a map update
+	overrides := make(map[string]interface{})
+	if req.StatementTimeoutSeconds != nil {
+		dataSource.StatementTimeoutSeconds = *req.StatementTimeoutSeconds
+		overrides["statement_timeout_seconds"] = *req.StatementTimeoutSeconds
+	}
+	if req.MaxResultRows != nil {
+		dataSource.MaxResultRows = *req.MaxResultRows
+		overrides["max_result_rows"] = *req.MaxResultRows
+	}
+	if req.MaxResultBytes != nil {
+		dataSource.MaxResultBytes = *req.MaxResultBytes
+		overrides["max_result_bytes"] = *req.MaxResultBytes
+	}
+	if req.MaxReplicaLagSeconds != nil {
+		dataSource.MaxReplicaLagSeconds = *req.MaxReplicaLagSeconds
+		overrides["max_replica_lag_seconds"] = *req.MaxReplicaLagSeconds
 	}
 
 	if err := s.db.Create(dataSource).Error; err != nil {
 		return nil, fmt.Errorf("failed to create data source: %w", err)
 	}
 
+	if len(overrides) > 0 {
+		if err := s.db.Model(dataSource).Updates(overrides).Error; err != nil {
+			return nil, fmt.Errorf("failed to create data source: %w", err)
+		}
+	}
+
+	if len(req.Replicas) > 0 {
+		if err := s.setReplicas(dataSource.ID, req.Replicas); err != nil {
+			return nil, fmt.Errorf("failed to create data source: %w", err)
+		}
+		if err := s.db.Where("data_source_id = ?", dataSource.ID).Find(&dataSource.Replicas).Error; err != nil {
+			return nil, err
+		}
+	}
+
 	return dataSource, nil
 }
 
 // GetDataSource retrieves a data source by ID
 func (s *DataSourceService) GetDataSource(ctx context.Context, dataSourceID string) (*models.DataSource, error) {
 	var dataSource models.DataSource
-	err := s.db.First(&dataSource, "id = ?", dataSourceID).Error
+	err := s.db.Preload("Replicas").First(&dataSource, "id = ?", dataSourceID).Error
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +196,7 @@ func (s *DataSourceService) ListDataSourcesWithPermissions(ctx context.Context,
 
 	// Get paginated results with permissions preloaded
 	err := query.Preload("Permissions.Group").
+		Preload("Replicas").
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -142,16 +239,120 @@ func (s *DataSourceService) UpdateDataSource(ctx context.Context, dataSourceID s
 	if req.Type != "" {
 		updates["type"] = models.DataSourceType(req.Type)
 	}
+	if req.Environment != "" {
+		environment, err := NormalizeEnvironment(req.Environment)
+		if err != nil {
+			return nil, err
+		}
+		updates["environment"] = environment
+	}
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if req.StatementTimeoutSeconds != nil {
+		updates["statement_timeout_seconds"] = *req.StatementTimeoutSeconds
+	}
+	if req.MaxResultRows != nil {
+		updates["max_result_rows"] = *req.MaxResultRows
+	}
+	if req.MaxResultBytes != nil {
+		updates["max_result_bytes"] = *req.MaxResultBytes
+	}
+	// A negative retention override clears it so the global setting applies
+	if req.ResultMaxAgeHours != nil {
+		updates["result_max_age_hours"] = retentionOverride(int64(*req.ResultMaxAgeHours))
+	}
+	if req.ResultMaxTotalBytes != nil {
+		updates["result_max_total_bytes"] = retentionOverride(*req.ResultMaxTotalBytes)
+	}
+	if req.ResultKeepLastPerUser != nil {
+		updates["result_keep_last_per_user"] = retentionOverride(int64(*req.ResultKeepLastPerUser))
+	}
+	if req.ResultCacheTTLSeconds != nil {
+		updates["result_cache_ttl_seconds"] = *req.ResultCacheTTLSeconds
+	}
+	if req.CostGuardMaxCost != nil {
+		updates["cost_guard_max_cost"] = *req.CostGuardMaxCost
+	}
+	if req.CostGuardMaxRows != nil {
+		updates["cost_guard_max_rows"] = *req.CostGuardMaxRows
+	}
+	if req.CostGuardAction != "" {
+		updates["cost_guard_action"] = models.CostGuardAction(req.CostGuardAction)
+	}
+	if req.MaxReplicaLagSeconds != nil {
+		updates["max_replica_lag_seconds"] = *req.MaxReplicaLagSeconds
+	}
+	if req.FilePath != "" {
+		filePath, err := NormalizeSQLitePath(req.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		updates["file_path"] = filePath
+	}
+	if req.CredentialSource != "" || req.CredentialRef != nil ||
+		(dataSource.UsesExternalCredentials() && (req.Password != "" || req.Type != "")) {
+		credentialUpdates, err := s.credentialSourceUpdates(&dataSource, req)
+		if err != nil {
+			return nil, err
+		}
+		for column, value := range credentialUpdates {
+			updates[column] = value
+		}
+	}
+	if req.TLSMode != "" || req.TLSServerName != nil || req.TLSCACert != nil || req.TLSClientCert != nil || req.TLSClientKey != nil ||
+		(req.Type != "" && dataSource.TLSMode != models.TLSModeDisable) {
+		tlsUpdates, err := s.tlsUpdates(&dataSource, req)
+		if err != nil {
+			return nil, err
+		}
+		for column, value := range tlsUpdates {
+			updates[column] = value
+		}
+	}
+	if req.SSHHost != nil || req.SSHPort != nil || req.SSHUser != nil || req.SSHPrivateKey != nil || req.SSHPassword != nil ||
+		req.SSHKnownHosts != nil || (req.Type != "" && dataSource.UsesSSHTunnel()) {
+		sshUpdates, err := s.sshUpdates(&dataSource, req)
+		if err != nil {
+			return nil, err
+		}
+		for column, value := range sshUpdates {
+			updates[column] = value
+		}
+	}
+	if req.SessionInitStatements != nil {
+		dsType := dataSource.Type
+		if req.Type != "" {
+			dsType = models.DataSourceType(req.Type)
+		}
+		sessionInit, err := sessionInitColumn(dsType, *req.SessionInitStatements)
+		if err != nil {
+			return nil, err
+		}
+		updates["session_init_statements"] = sessionInit
+	}
 
 	if err := s.db.Model(&dataSource).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("failed to update data source: %w", err)
 	}
 
+	// A provided replica list replaces the current one; an empty list removes all replicas
+	if req.Replicas != nil {
+		if err := s.setReplicas(dataSource.ID, *req.Replicas); err != nil {
+			return nil, fmt.Errorf("failed to update data source: %w", err)
+		}
+	}
+
+	// Drop the cached pools so the next query connects with the new settings
+	s.connections.Invalidate(dataSource.ID)
+	var replicas []models.DataSourceReplica
+	s.db.Where("data_source_id = ?", dataSource.ID).Find(&replicas)
+	for _, replica := range replicas {
+		s.connections.Invalidate(replica.ID)
+	}
+
 	// Reload to get updated data
-	if err := s.db.First(&dataSource, "id = ?", dataSourceID).Error; err != nil {
+	if err := s.db.Preload("Replicas").First(&dataSource, "id = ?", dataSourceID).Error; err != nil {
 		return nil, err
 	}
 
@@ -165,11 +366,25 @@ func (s *DataSourceService) DeleteDataSource(ctx context.Context, dataSourceID s
 		return fmt.Errorf("failed to delete permissions: %w", err)
 	}
 
+	// Delete replicas, closing their pools
+	var replicas []models.DataSourceReplica
+	s.db.Where("data_source_id = ?", dataSourceID).Find(&replicas)
+	if err := s.db.Where("data_source_id = ?", dataSourceID).Delete(&models.DataSourceReplica{}).Error; err != nil {
+		return fmt.Errorf("failed to delete replicas: %w", err)
+	}
+	for _, replica := range replicas {
+		s.connections.Invalidate(replica.ID)
+	}
+
 	// Delete data source
 	if err := s.db.Delete(&models.DataSource{}, "id = ?", dataSourceID).Error; err != nil {
 		return fmt.Errorf("failed to delete data source: %w", err)
 	}
 
+	if id, err := uuid.Parse(dataSourceID); err == nil {
+		s.connections.Invalidate(id)
+	}
+
 	return nil
 }
 
@@ -180,42 +395,82 @@ func (s *DataSourceService) TestConnection(ctx context.Context, dataSourceID str
 		return fmt.Errorf("data source not found: %w", err)
 	}
 
-	// Decrypt password
-	password, err := s.decryptPassword(dataSource.EncryptedPassword)
+	// Decrypt the password and TLS material
+	credentials, err := resolveCredentials(ctx, s.decryptPassword, s.connections.secrets, dataSource)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt password: %w", err)
+		return err
 	}
 
-	// Test connection based on type
-	switch dataSource.Type {
-	case models.DataSourceTypePostgreSQL:
-		return s.testPostgreSQLConnection(dataSource, password)
-	case models.DataSourceTypeMySQL:
-		return s.testMySQLConnection(dataSource, password)
-	default:
-		return fmt.Errorf("unsupported data source type: %s", dataSource.Type)
-	}
+	// Test connection through the shared pool
+	return s.connections.Ping(ctx, dataSource, credentials)
 }
 
 // TestConnectionWithParams tests connection with raw parameters
 func (s *DataSourceService) TestConnectionWithParams(ctx context.Context, input *TestConnectionInput) error {
 	dataSource := &models.DataSource{
-		Type:         models.DataSourceType(input.Type),
-		Host:         input.Host,
-		Port:         input.Port,
-		DatabaseName: input.DatabaseName,
-		Username:     input.Username,
-	}
-
-	// Test connection based on type
-	switch dataSource.Type {
-	case models.DataSourceTypePostgreSQL:
-		return s.testPostgreSQLConnection(dataSource, input.Password)
-	case models.DataSourceTypeMySQL:
-		return s.testMySQLConnection(dataSource, input.Password)
-	default:
-		return fmt.Errorf("unsupported data source type: %s", dataSource.Type)
+		Type:          models.DataSourceType(input.Type),
+		Host:          input.Host,
+		Port:          input.Port,
+		DatabaseName:  input.DatabaseName,
+		FilePath:      input.FilePath,
+		Username:      input.Username,
+		TLSMode:       models.DataSourceTLSMode(input.TLSMode),
+		TLSServerName: input.TLSServerName,
+		SSHHost:       input.SSHHost,
+		SSHPort:       input.SSHPort,
+		SSHUser:       input.SSHUser,
+		SSHKnownHosts: input.SSHKnownHosts,
+	}
+	if dataSource.SSHPort == 0 {
+		dataSource.SSHPort = 22
+	}
+	credentials := &ConnectionCredentials{
+		Password:      input.Password,
+		TLSCACert:     input.TLSCACert,
+		TLSClientCert: input.TLSClientCert,
+		TLSClientKey:  input.TLSClientKey,
+		SSHPrivateKey: input.SSHPrivateKey,
+		SSHPassword:   input.SSHPassword,
+	}
+
+	// A password read from a secret provider is resolved like it will be for queries
+	source, ref, err := s.credentialSource(dataSource.Type, input.CredentialSource, input.CredentialRef)
+	if err != nil {
+		return err
+	}
+	if source != models.CredentialSourceEncrypted {
+		if input.Password != "" {
+			return fmt.Errorf("%w: a password can't be set when it is read from %s", ErrInvalidCredentialSource, source)
+		}
+		if credentials.Password, err = s.connections.secrets.Resolve(ctx, source, ref); err != nil {
+			return err
+		}
 	}
+
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return err
+	}
+	if err := ValidateTLSSettings(dataSource, credentials); err != nil {
+		return err
+	}
+	if err := ValidateSSHSettings(dataSource, credentials); err != nil {
+		return err
+	}
+
+	// Test on a connection of its own, as the settings may not be saved yet
+	db, err := driver.Open(dataSource, credentials, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	return sqlDB.PingContext(ctx)
 }
 
 // SetPermissions sets permissions for a group on a data source
@@ -263,124 +518,44 @@ func (s *DataSourceService) GetPermissions(ctx context.Context, dataSourceID str
 	return permissions, err
 }
 
-// encryptPassword encrypts a password using AES-256-GCM
-func (s *DataSourceService) encryptPassword(password string) (string, error) {
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return "", err
+// encryptSecret encrypts TLS material or an SSH credential like a password; an empty secret stays empty
+func (s *DataSourceService) encryptSecret(secret string) (string, error) {
+	if secret == "" {
+		return "", nil
 	}
-
-	// Create GCM mode
-	aesgcm, err := cipher.NewGCM(block)
+	encrypted, err := s.encryptPassword(secret)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
 	}
+	return encrypted, nil
+}
 
-	// Generate nonce
-	nonce := make([]byte, aesgcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	// Encrypt
-	ciphertext := aesgcm.Seal(nonce, nonce, []byte(password), nil)
-
-	// Encode to base64
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+// encryptPassword encrypts a password with the active key
+func (s *DataSourceService) encryptPassword(password string) (string, error) {
+	return s.keyring.Encrypt(password)
 }
 
 // decryptPassword decrypts an encrypted password
 func (s *DataSourceService) decryptPassword(encryptedPassword string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(encryptedPassword)
-	if err != nil {
-		return "", err
-	}
-
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return "", err
-	}
-
-	// Create GCM mode
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// Extract nonce
-	nonceSize := aesgcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("encrypted data too short")
-	}
-
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-
-	// Decrypt
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", err
-	}
-
-	return string(plaintext), nil
-}
-
-// testPostgreSQLConnection tests a PostgreSQL connection
-func (s *DataSourceService) testPostgreSQLConnection(dataSource *models.DataSource, password string) error {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		dataSource.Host,
-		dataSource.Port,
-		dataSource.Username,
-		password,
-		dataSource.DatabaseName,
-	)
-
-	db, err := gorm.Open(gormpostgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
-	}
-
-	sqlDB, err := db.DB()
-	if err != nil {
-		return err
-	}
-	defer sqlDB.Close()
-
-	return sqlDB.Ping()
-}
-
-// testMySQLConnection tests a MySQL connection
-func (s *DataSourceService) testMySQLConnection(dataSource *models.DataSource, password string) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		dataSource.Username,
-		password,
-		dataSource.Host,
-		dataSource.Port,
-		dataSource.DatabaseName,
-	)
-
-	db, err := gorm.Open(gormmysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
-	}
-
-	sqlDB, err := db.DB()
-	if err != nil {
-		return err
-	}
-	defer sqlDB.Close()
-
-	return sqlDB.Ping()
+	return s.keyring.Decrypt(encryptedPassword)
 }
 
 // HealthCheckResult represents the result of a health check
 type HealthCheckResult struct {
 	Status    dto.HealthStatus
 	LatencyMs int64
-	Error     string
-	Message   string
+	// ConnectLatencyMs and PingLatencyMs split LatencyMs; nil when the step was not reached
+	ConnectLatencyMs *int64
+	PingLatencyMs    *int64
+	ServerVersion    string
+	Error            string
+	Message          string
+	Replicas         []dto.ReplicaHealth
+	// TLSVersion is the TLS version the connection negotiated, empty when it is not encrypted
+	TLSVersion string
 }
 
-// CheckHealth performs a health check on a data source
+// CheckHealth performs a health check on a data source and records it in its health history
 func (s *DataSourceService) CheckHealth(ctx context.Context, dataSourceID string) (*HealthCheckResult, error) {
 	// Get data source
 	var dataSource models.DataSource
@@ -388,58 +563,7 @@ func (s *DataSourceService) CheckHealth(ctx context.Context, dataSourceID string
 		return nil, fmt.Errorf("data source not found: %w", err)
 	}
 
-	// Check if data source is active
-	if !dataSource.IsActive {
-		return &HealthCheckResult{
-			Status:  dto.HealthStatusUnhealthy,
-			Message: "Data source is inactive",
-		}, nil
-	}
-
-	// Decrypt password
-	password, err := s.decryptPassword(dataSource.EncryptedPassword)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt password: %w", err)
-	}
-
-	// Measure connection latency
-	start := time.Now()
-
-	var connectionErr error
-	switch dataSource.Type {
-	case models.DataSourceTypePostgreSQL:
-		connectionErr = s.testPostgreSQLConnection(&dataSource, password)
-	case models.DataSourceTypeMySQL:
-		connectionErr = s.testMySQLConnection(&dataSource, password)
-	default:
-		return nil, fmt.Errorf("unsupported data source type: %s", dataSource.Type)
-	}
-
-	latency := time.Since(start).Milliseconds()
-
-	// Determine health status based on connection result
-	if connectionErr != nil {
-		return &HealthCheckResult{
-			Status:    dto.HealthStatusUnhealthy,
-			LatencyMs: latency,
-			Error:     connectionErr.Error(),
-			Message:   "Failed to connect to data source",
-		}, nil
-	}
-
-	// Determine health based on latency
-	status := dto.HealthStatusHealthy
-	message := "Data source is healthy"
-	if latency > 1000 {
-		status = dto.HealthStatusDegraded
-		message = "Data source is responding slowly"
-	}
-
-	return &HealthCheckResult{
-		Status:    status,
-		LatencyMs: latency,
-		Message:   message,
-	}, nil
+	return s.ProbeHealth(ctx, &dataSource, models.HealthProbeCheck)
 }
 
 // CreateDataSourceInput represents input for creating a data source
@@ -451,18 +575,115 @@ type CreateDataSourceInput struct {
 	DatabaseName string
 	Username     string
 	Password     string
+	// Environment is dev, staging, prod (default) or a custom name; it selects the approval policy
+	Environment string
+	// CredentialSource is encrypted (default), env, file or http. Other sources read the password
+	// at connect time from the variable, file or secret CredentialRef names, so Password is empty.
+	CredentialSource string
+	CredentialRef    string
+	// FilePath is the absolute path of the database file of a SQLite data source
+	FilePath string
+	// StatementTimeoutSeconds overrides the default timeout; 0 disables it
+	StatementTimeoutSeconds *int
+	MaxResultRows           *int
+	MaxResultBytes          *int64
+	// Retention overrides; nil uses the global setting and 0 disables the rule
+	ResultMaxAgeHours     *int
+	ResultMaxTotalBytes   *int64
+	ResultKeepLastPerUser *int
+	// ResultCacheTTLSeconds caches SELECT results in Redis; 0 disables the cache
+	ResultCacheTTLSeconds int
+	// Cost guard thresholds on the EXPLAIN estimate of SELECTs; 0 disables a rule.
+	// CostGuardAction is block (default), warn or approval.
+	CostGuardMaxCost float64
+	CostGuardMaxRows int64
+	CostGuardAction  string
+	// Replicas serve SELECT and EXPLAIN traffic while their lag is within MaxReplicaLagSeconds
+	Replicas             []ReplicaInput
+	MaxReplicaLagSeconds *int
+	// SessionInitStatements are SET statements run on every new connection
+	SessionInitStatements []string
+	// TLSMode is disable (default), require, verify-ca or verify-full. The PEM-encoded
+	// certificates and key are stored encrypted; empty ones are not configured.
+	TLSMode       string
+	TLSServerName string
+	TLSCACert     string
+	TLSClientCert string
+	TLSClientKey  string
+	// SSH tunnel through a bastion, used when SSHHost is set. SSHPort defaults to 22.
+	// SSHKnownHosts pins the host key of the bastion.
+	SSHHost       string
+	SSHPort       int
+	SSHUser       string
+	SSHPrivateKey string
+	SSHPassword   string
+	SSHKnownHosts string
 }
 
 // UpdateDataSourceInput represents input for updating a data source
 type UpdateDataSourceInput struct {
-	Name         string
-	Type         string
-	Host         string
-	Port         int
-	DatabaseName string
-	Username     string
-	Password     string
-	IsActive     *bool
+	Name                    string
+	Type                    string
+	Host                    string
+	Port                    int
+	DatabaseName            string
+	Username                string
+	Password                string
+	FilePath                string
+	Environment             string
+	IsActive                *bool
+	StatementTimeoutSeconds *int
+	MaxResultRows           *int
+	MaxResultBytes          *int64
+	// Retention overrides; a negative value clears the override
+	ResultMaxAgeHours     *int
+	ResultMaxTotalBytes   *int64
+	ResultKeepLastPerUser *int
+	ResultCacheTTLSeconds *int
+	CostGuardMaxCost      *float64
+	CostGuardMaxRows      *int64
+	CostGuardAction       string
+	// Replicas replaces the replica endpoints when not nil
+	Replicas             *[]ReplicaInput
+	MaxReplicaLagSeconds *int
+	// SessionInitStatements replaces the session init statements when not nil; an empty list clears them
+	SessionInitStatements *[]string
+	// TLS settings; a provided empty server name, certificate or key clears it
+	TLSMode       string
+	TLSServerName *string
+	TLSCACert     *string
+	TLSClientCert *string
+	TLSClientKey  *string
+	// SSH tunnel settings; a provided empty SSHHost connects directly again
+	SSHHost       *string
+	SSHPort       *int
+	SSHUser       *string
+	SSHPrivateKey *string
+	SSHPassword   *string
+	SSHKnownHosts *string
+	// Credential source of the password; see CreateDataSourceInput
+	CredentialSource string
+	CredentialRef    *string
+}
+
+// sessionInitColumn validates session init statements and returns their column value
+func sessionInitColumn(dsType models.DataSourceType, statements []string) (*string, error) {
+	normalized, err := NormalizeSessionInitStatements(statements)
+	if err != nil {
+		return nil, err
+	}
+	if len(normalized) > 0 && dsType == models.DataSourceTypeSQLite {
+		return nil, fmt.Errorf("%w: SQLite has no SET statements", ErrInvalidSessionInit)
+	}
+	return EncodeSessionInitStatements(normalized)
+}
+
+// retentionOverride returns the column value for a retention override, NULL when it is cleared
+func retentionOverride(value int64) interface{} {
+	if value < 0 {
+		return nil
+	}
+	return value
 }
 
 // PermissionInput represents permission settings
@@ -474,10 +695,27 @@ type PermissionInput struct {
 
 // TestConnectionInput represents input for testing a connection
 type TestConnectionInput struct {
-	Type         string `json:"type" binding:"required,oneof=postgresql mysql"`
-	Host         string `json:"host" binding:"required"`
-	Port         int    `json:"port" binding:"required,min=1,max=65535"`
-	DatabaseName string `json:"database_name" binding:"required"`
-	Username     string `json:"username" binding:"required"`
-	Password     string `json:"password" binding:"required"`
+	Type         string `json:"type" binding:"required"`
+	Host         string `json:"host" binding:"required_unless=Type sqlite"`
+	Port         int    `json:"port" binding:"required_unless=Type sqlite,min=0,max=65535"`
+	DatabaseName string `json:"database_name" binding:"required_unless=Type sqlite"`
+	Username     string `json:"username" binding:"required_unless=Type sqlite"`
+	Password     string `json:"password"`
+	FilePath     string `json:"file_path" binding:"required_if=Type sqlite"`
+	// Credential source of the password; see CreateDataSourceInput
+	CredentialSource string `json:"credential_source" binding:"omitempty,oneof=encrypted env file http"`
+	CredentialRef    string `json:"credential_ref"`
+	// TLS settings of the connection; see CreateDataSourceInput
+	TLSMode       string `json:"tls_mode" binding:"omitempty,oneof=disable require verify-ca verify-full"`
+	TLSServerName string `json:"tls_server_name"`
+	TLSCACert     string `json:"tls_ca_cert"`
+	TLSClientCert string `json:"tls_client_cert"`
+	TLSClientKey  string `json:"tls_client_key"`
+	// SSH tunnel of the connection; see CreateDataSourceInput
+	SSHHost       string `json:"ssh_host"`
+	SSHPort       int    `json:"ssh_port" binding:"omitempty,min=1,max=65535"`
+	SSHUser       string `json:"ssh_user"`
+	SSHPrivateKey string `json:"ssh_private_key"`
+	SSHPassword   string `json:"ssh_password"`
+	SSHKnownHosts string `json:"ssh_known_hosts"`
 }
@@ -0,0 +1,437 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/querybase/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrInvalidSSHConfig is returned when the SSH tunnel settings of a data source are unusable
+	ErrInvalidSSHConfig = errors.New("invalid SSH tunnel configuration")
+
+	// ErrSSHTunnel is returned when a data source can't be reached because the hop to its bastion failed
+	ErrSSHTunnel = errors.New("SSH tunnel failed")
+)
+
+const (
+	// sshDialTimeout bounds connecting and authenticating to a bastion, and each keepalive probe
+	sshDialTimeout = 10 * time.Second
+
+	// sshKeepAliveInterval is how often an idle tunnel checks that its bastion is still there
+	sshKeepAliveInterval = 30 * time.Second
+)
+
+// sshTunnel is a connection to a bastion, shared by every pool that reaches a data source through it.
+// It connects on first use and reconnects when the connection to the bastion is lost.
+type sshTunnel struct {
+	key    string
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+
+	// refs counts the pools using the tunnel, guarded by sshTunnels.mu
+	refs int
+}
+
+// sshTunnels holds the open tunnels by their settings
+var sshTunnels = struct {
+	mu    sync.Mutex
+	byKey map[string]*sshTunnel
+}{byKey: make(map[string]*sshTunnel)}
+
+// acquireSSHTunnel returns the shared tunnel to the bastion of a data source, nil when the data source
+// is reached directly. The caller releases it when its pool is closed.
+func acquireSSHTunnel(dataSource *models.DataSource, credentials *ConnectionCredentials) (*sshTunnel, error) {
+	if !dataSource.UsesSSHTunnel() {
+		return nil, nil
+	}
+	config, err := sshClientConfig(dataSource, credentials)
+	if err != nil {
+		return nil, err
+	}
+	key := sshTunnelKey(dataSource, credentials)
+
+	sshTunnels.mu.Lock()
+	defer sshTunnels.mu.Unlock()
+
+	tunnel, ok := sshTunnels.byKey[key]
+	if !ok {
+		tunnel = &sshTunnel{
+			key:    key,
+			addr:   net.JoinHostPort(dataSource.SSHHost, strconv.Itoa(dataSource.SSHPort)),
+			config: config,
+		}
+		sshTunnels.byKey[key] = tunnel
+	}
+	tunnel.refs++
+	return tunnel, nil
+}
+
+// release gives up a reference to the tunnel, closing it when no pool uses it anymore
+func (t *sshTunnel) release() {
+	if t == nil {
+		return
+	}
+
+	sshTunnels.mu.Lock()
+	t.refs--
+	last := t.refs == 0
+	if last {
+		delete(sshTunnels.byKey, t.key)
+	}
+	sshTunnels.mu.Unlock()
+
+	if last {
+		t.mu.Lock()
+		client := t.client
+		t.client = nil
+		t.mu.Unlock()
+		if client != nil {
+			client.Close()
+		}
+	}
+}
+
+// DialContext opens a connection to addr from the bastion. When the connection to the bastion turns
+// out to be lost, the tunnel reconnects and tries once more.
+func (t *sshTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := t.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		channel, err := client.DialContext(ctx, network, addr)
+		if err == nil {
+			return withDeadlines(channel), nil
+		}
+
+		// The bastion is up but can't reach the database, which is not a failure of the tunnel
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			return nil, fmt.Errorf("bastion %s failed to connect to %s: %s", t.addr, addr, openErr.Message)
+		}
+
+		t.drop(client)
+		if attempt > 0 || ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrSSHTunnel, t.addr, err)
+		}
+	}
+}
+
+// connect returns the client connected to the bastion, connecting when there is none
+func (t *sshTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to bastion %s: %v", ErrSSHTunnel, t.addr, err)
+	}
+
+	// The SSH handshake has no context, so it is bounded by a deadline on the connection
+	deadline := time.Now().Add(sshDialTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, t.addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: bastion %s: %v", ErrSSHTunnel, t.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	t.client = ssh.NewClient(sshConn, channels, requests)
+	go t.keepAlive(t.client)
+	return t.client, nil
+}
+
+// drop discards a client whose connection is broken, so the next dial reconnects
+func (t *sshTunnel) drop(client *ssh.Client) {
+	t.mu.Lock()
+	if t.client == client {
+		t.client = nil
+	}
+	t.mu.Unlock()
+	client.Close()
+}
+
+// keepAlive probes the bastion until its connection is lost, then drops the client. Probes find
+// connections that died without being closed, e.g. behind a NAT that forgot them.
+func (t *sshTunnel) keepAlive(client *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			t.drop(client)
+			return
+		case <-ticker.C:
+			if err := probeSSHClient(client); err != nil {
+				log.Printf("[SSHTunnel] Lost the connection to bastion %s: %v", t.addr, err)
+				client.Close()
+			}
+		}
+	}
+}
+
+// probeSSHClient sends a keepalive request and waits for the reply
+func probeSSHClient(client *ssh.Client) error {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(sshDialTimeout):
+		return errors.New("keepalive timed out")
+	}
+}
+
+// withDeadlines bridges a channel through an in-memory pipe. SSH channels don't support deadlines,
+// which the database drivers set on their connections.
+func withDeadlines(channel net.Conn) net.Conn {
+	local, bridge := net.Pipe()
+	go func() {
+		io.Copy(channel, bridge)
+		channel.Close()
+	}()
+	go func() {
+		io.Copy(bridge, channel)
+		bridge.Close()
+	}()
+	return local
+}
+
+// tunnelConnector releases its tunnel when the pool it serves is closed
+type tunnelConnector struct {
+	driver.Connector
+	tunnel *sshTunnel
+}
+
+// Close releases the tunnel. database/sql calls it when the pool is closed.
+func (c *tunnelConnector) Close() error {
+	c.tunnel.release()
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// withSSHTunnel ties a tunnel to the connector of a pool; a nil tunnel leaves the connector as it is
+func withSSHTunnel(connector driver.Connector, tunnel *sshTunnel) driver.Connector {
+	if tunnel == nil {
+		return connector
+	}
+	return &tunnelConnector{Connector: connector, tunnel: tunnel}
+}
+
+// sshTunnelKey identifies the bastion and credentials of a tunnel
+func sshTunnelKey(dataSource *models.DataSource, credentials *ConnectionCredentials) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00%s\x00%s",
+		dataSource.SSHHost,
+		dataSource.SSHPort,
+		dataSource.SSHUser,
+		credentials.SSHPrivateKey,
+		credentials.SSHPassword,
+		dataSource.SSHKnownHosts,
+	)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sshClientConfig returns the client configuration of the tunnel to the bastion of a data source
+func sshClientConfig(dataSource *models.DataSource, credentials *ConnectionCredentials) (*ssh.ClientConfig, error) {
+	if dataSource.SSHUser == "" {
+		return nil, fmt.Errorf("%w: an SSH user is required", ErrInvalidSSHConfig)
+	}
+	if dataSource.SSHPort < 1 || dataSource.SSHPort > 65535 {
+		return nil, fmt.Errorf("%w: invalid SSH port %d", ErrInvalidSSHConfig, dataSource.SSHPort)
+	}
+
+	var auth []ssh.AuthMethod
+	if credentials.SSHPrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(credentials.SSHPrivateKey))
+		if err != nil {
+			var passphraseErr *ssh.PassphraseMissingError
+			if errors.As(err, &passphraseErr) {
+				return nil, fmt.Errorf("%w: the private key must not be protected by a passphrase", ErrInvalidSSHConfig)
+			}
+			return nil, fmt.Errorf("%w: invalid private key: %v", ErrInvalidSSHConfig, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if credentials.SSHPassword != "" {
+		auth = append(auth, ssh.Password(credentials.SSHPassword))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("%w: a private key or a password is required", ErrInvalidSSHConfig)
+	}
+
+	hostKeyCallback, err := pinnedHostKeys(dataSource.SSHKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            dataSource.SSHUser,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}, nil
+}
+
+// pinnedHostKeys returns a host key callback that accepts only the keys of known_hosts lines.
+// Tunnels only ever connect to their bastion, so the host patterns of the lines are not matched.
+func pinnedHostKeys(knownHosts string) (ssh.HostKeyCallback, error) {
+	var pinned []ssh.PublicKey
+	rest := []byte(knownHosts)
+	for {
+		marker, _, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid known_hosts: %v", ErrInvalidSSHConfig, err)
+		}
+		if marker != "" {
+			return nil, fmt.Errorf("%w: known_hosts markers like %s are not supported", ErrInvalidSSHConfig, marker)
+		}
+		pinned = append(pinned, key)
+		rest = next
+	}
+	if len(pinned) == 0 {
+		return nil, fmt.Errorf("%w: known_hosts must pin the host key of the bastion", ErrInvalidSSHConfig)
+	}
+
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		for _, pinnedKey := range pinned {
+			if bytes.Equal(pinnedKey.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key %s of %s is not pinned in known_hosts", ssh.FingerprintSHA256(key), hostname)
+	}, nil
+}
+
+// ValidateSSHSettings checks that the SSH tunnel settings of a data source can be used to connect
+func ValidateSSHSettings(dataSource *models.DataSource, credentials *ConnectionCredentials) error {
+	if !dataSource.UsesSSHTunnel() {
+		return nil
+	}
+	if dataSource.Type == models.DataSourceTypeSQLite {
+		return fmt.Errorf("%w: SQLite data sources are local files", ErrInvalidSSHConfig)
+	}
+	_, err := sshClientConfig(dataSource, credentials)
+	return err
+}
+
+// setSSHSettings validates the SSH tunnel settings of a new data source and sets them, encrypting the secrets
+func (s *DataSourceService) setSSHSettings(dataSource *models.DataSource, req *CreateDataSourceInput) error {
+	dataSource.SSHHost = strings.TrimSpace(req.SSHHost)
+	dataSource.SSHPort = req.SSHPort
+	if dataSource.SSHPort == 0 {
+		dataSource.SSHPort = 22
+	}
+	dataSource.SSHUser = req.SSHUser
+	dataSource.SSHKnownHosts = strings.TrimSpace(req.SSHKnownHosts)
+
+	credentials := &ConnectionCredentials{SSHPrivateKey: req.SSHPrivateKey, SSHPassword: req.SSHPassword}
+	if err := ValidateSSHSettings(dataSource, credentials); err != nil {
+		return err
+	}
+
+	var err error
+	if dataSource.EncryptedSSHPrivateKey, err = s.encryptSecret(req.SSHPrivateKey); err != nil {
+		return err
+	}
+	dataSource.EncryptedSSHPassword, err = s.encryptSecret(req.SSHPassword)
+	return err
+}
+
+// sshUpdates validates the SSH tunnel settings a data source will have after an update and returns the columns to change
+func (s *DataSourceService) sshUpdates(dataSource *models.DataSource, req *UpdateDataSourceInput) (map[string]interface{}, error) {
+	credentials, err := decryptCredentials(s.decryptPassword, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *dataSource
+	if req.Type != "" {
+		updated.Type = models.DataSourceType(req.Type)
+	}
+
+	updates := make(map[string]interface{})
+	if req.SSHHost != nil {
+		updated.SSHHost = strings.TrimSpace(*req.SSHHost)
+		updates["ssh_host"] = updated.SSHHost
+	}
+	if req.SSHPort != nil {
+		updated.SSHPort = *req.SSHPort
+		updates["ssh_port"] = updated.SSHPort
+	}
+	if req.SSHUser != nil {
+		updated.SSHUser = *req.SSHUser
+		updates["ssh_user"] = updated.SSHUser
+	}
+	if req.SSHKnownHosts != nil {
+		updated.SSHKnownHosts = strings.TrimSpace(*req.SSHKnownHosts)
+		updates["ssh_known_hosts"] = updated.SSHKnownHosts
+	}
+	for _, field := range []struct {
+		column string
+		value  *string
+		plain  *string
+	}{
+		{"encrypted_ssh_private_key", req.SSHPrivateKey, &credentials.SSHPrivateKey},
+		{"encrypted_ssh_password", req.SSHPassword, &credentials.SSHPassword},
+	} {
+		if field.value == nil {
+			continue
+		}
+		*field.plain = *field.value
+		encrypted, err := s.encryptSecret(*field.value)
+		if err != nil {
+			return nil, err
+		}
+		updates[field.column] = encrypted
+	}
+
+	if err := ValidateSSHSettings(&updated, credentials); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
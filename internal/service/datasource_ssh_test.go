@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// testBastion is an SSH server that forwards direct-tcpip channels like a bastion host
+type testBastion struct {
+	listener    net.Listener
+	knownHosts  string
+	privateKey  string
+	connections atomic.Int32
+	conns       chan ssh.Conn
+}
+
+func newTestBastion(t *testing.T) *testBastion {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientPEM, err := ssh.MarshalPrivateKey(clientKey, "")
+	require.NoError(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(clientKey)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "tunnel" && string(key.Marshal()) == string(clientSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "tunnel" && string(password) == "hunter2" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	bastion := &testBastion{
+		listener:   listener,
+		knownHosts: "bastion.internal " + string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey())),
+		privateKey: string(pem.EncodeToMemory(clientPEM)),
+		conns:      make(chan ssh.Conn, 16),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go bastion.serve(conn, config)
+		}
+	}()
+	return bastion
+}
+
+// serve forwards the direct-tcpip channels of a client connection
+func (b *testBastion) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	b.connections.Add(1)
+	b.conns <- sshConn
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		// RFC 4254 7.2: host to connect, port to connect, originator address, originator port
+		payload := newChannel.ExtraData()
+		hostLen := binary.BigEndian.Uint32(payload)
+		host := string(payload[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(payload[4+hostLen:])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			io.Copy(channel, target)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(target, channel)
+			target.Close()
+		}()
+	}
+}
+
+// dataSource returns a data source reached through the bastion
+func (b *testBastion) dataSource(target string) *models.DataSource {
+	host, portText, _ := net.SplitHostPort(target)
+	port, _ := strconv.Atoi(portText)
+	bastionHost, bastionPortText, _ := net.SplitHostPort(b.listener.Addr().String())
+	bastionPort, _ := strconv.Atoi(bastionPortText)
+	return &models.DataSource{
+		Type:          models.DataSourceTypePostgreSQL,
+		Host:          host,
+		Port:          port,
+		SSHHost:       bastionHost,
+		SSHPort:       bastionPort,
+		SSHUser:       "tunnel",
+		SSHKnownHosts: b.knownHosts,
+	}
+}
+
+// newEchoServer returns the address of a TCP server that echoes what it receives
+func newEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// closedAddress returns an address nothing listens on
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+// echo sends a line through a connection and reads it back
+func echo(t *testing.T, conn net.Conn, line string) {
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err := fmt.Fprint(conn, line)
+	require.NoError(t, err)
+	reply := make([]byte, len(line))
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	assert.Equal(t, line, string(reply))
+}
+
+func TestSSHTunnel_SharedAndReconnects(t *testing.T) {
+	bastion := newTestBastion(t)
+	target := newEchoServer(t)
+	dataSource := bastion.dataSource(target)
+	credentials := &ConnectionCredentials{SSHPrivateKey: bastion.privateKey}
+
+	tunnel, err := acquireSSHTunnel(dataSource, credentials)
+	require.NoError(t, err)
+	defer tunnel.release()
+
+	// Pools with the same bastion settings share one tunnel, and one SSH connection
+	other, err := acquireSSHTunnel(dataSource, credentials)
+	require.NoError(t, err)
+	assert.Same(t, tunnel, other)
+	other.release()
+
+	for i := 0; i < 2; i++ {
+		conn, err := tunnel.DialContext(context.Background(), "tcp", target)
+		require.NoError(t, err)
+		echo(t, conn, "ping\n")
+		conn.Close()
+	}
+	assert.EqualValues(t, 1, bastion.connections.Load())
+
+	// The bastion drops the connection; the next dial reconnects
+	(<-bastion.conns).Close()
+	conn, err := tunnel.DialContext(context.Background(), "tcp", target)
+	require.NoError(t, err)
+	echo(t, conn, "pong\n")
+	conn.Close()
+	assert.EqualValues(t, 2, bastion.connections.Load())
+
+	// A database the bastion can't reach is not a tunnel failure
+	_, err = tunnel.DialContext(context.Background(), "tcp", closedAddress(t))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrSSHTunnel)
+}
+
+func TestSSHTunnel_HostKeyPinningAndAuth(t *testing.T) {
+	bastion := newTestBastion(t)
+	target := newEchoServer(t)
+
+	// Password authentication works too
+	dataSource := bastion.dataSource(target)
+	tunnel, err := acquireSSHTunnel(dataSource, &ConnectionCredentials{SSHPassword: "hunter2"})
+	require.NoError(t, err)
+	conn, err := tunnel.DialContext(context.Background(), "tcp", target)
+	require.NoError(t, err)
+	conn.Close()
+	tunnel.release()
+
+	// The host key of another server is not accepted
+	dataSource.SSHKnownHosts = newTestBastion(t).knownHosts
+	tunnel, err = acquireSSHTunnel(dataSource, &ConnectionCredentials{SSHPassword: "hunter2"})
+	require.NoError(t, err)
+	_, err = tunnel.DialContext(context.Background(), "tcp", target)
+	assert.ErrorIs(t, err, ErrSSHTunnel)
+	assert.Contains(t, err.Error(), "not pinned")
+	tunnel.release()
+
+	// So is a bastion that is down
+	dataSource = bastion.dataSource(target)
+	dataSource.SSHHost, dataSource.SSHPort = "127.0.0.1", 1
+	tunnel, err = acquireSSHTunnel(dataSource, &ConnectionCredentials{SSHPassword: "hunter2"})
+	require.NoError(t, err)
+	_, err = tunnel.DialContext(context.Background(), "tcp", target)
+	assert.ErrorIs(t, err, ErrSSHTunnel)
+	tunnel.release()
+}
+
+func TestValidateSSHSettings(t *testing.T) {
+	bastion := newTestBastion(t)
+	dataSource := bastion.dataSource("db.internal:5432")
+
+	assert.NoError(t, ValidateSSHSettings(dataSource, &ConnectionCredentials{SSHPrivateKey: bastion.privateKey}))
+	assert.ErrorIs(t, ValidateSSHSettings(dataSource, &ConnectionCredentials{}), ErrInvalidSSHConfig)
+	assert.ErrorIs(t, ValidateSSHSettings(dataSource, &ConnectionCredentials{SSHPrivateKey: "not a key"}), ErrInvalidSSHConfig)
+
+	unpinned := *dataSource
+	unpinned.SSHKnownHosts = ""
+	assert.ErrorIs(t, ValidateSSHSettings(&unpinned, &ConnectionCredentials{SSHPassword: "hunter2"}), ErrInvalidSSHConfig)
+
+	sqliteSource := *dataSource
+	sqliteSource.Type = models.DataSourceTypeSQLite
+	assert.ErrorIs(t, ValidateSSHSettings(&sqliteSource, &ConnectionCredentials{SSHPassword: "hunter2"}), ErrInvalidSSHConfig)
+
+	// Without a bastion there is nothing to check
+	assert.NoError(t, ValidateSSHSettings(&models.DataSource{Type: models.DataSourceTypeSQLite}, &ConnectionCredentials{}))
+}
+
+func TestDataSourceService_TestConnectionThroughSSH(t *testing.T) {
+	bastion := newTestBastion(t)
+	service := NewDataSourceService(setupTestDB(t), NewLegacyKeyring(sqliteTestEncryptionKey))
+
+	for _, dsType := range []models.DataSourceType{models.DataSourceTypePostgreSQL, models.DataSourceTypeMySQL} {
+		input := func(bastionAddr, target string) *TestConnectionInput {
+			host, portText, _ := net.SplitHostPort(target)
+			port, _ := strconv.Atoi(portText)
+			sshHost, sshPortText, _ := net.SplitHostPort(bastionAddr)
+			sshPort, _ := strconv.Atoi(sshPortText)
+			return &TestConnectionInput{
+				Type: string(dsType), Host: host, Port: port, DatabaseName: "app", Username: "querybase", Password: "secret",
+				SSHHost: sshHost, SSHPort: sshPort, SSHUser: "tunnel", SSHPassword: "hunter2", SSHKnownHosts: bastion.knownHosts,
+			}
+		}
+
+		// The failure is on the tunnel hop when the bastion is down
+		err := service.TestConnectionWithParams(context.Background(), input(closedAddress(t), "127.0.0.1:5432"))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrSSHTunnel, dsType)
+
+		// and at the database when the bastion can't reach it
+		err = service.TestConnectionWithParams(context.Background(), input(bastion.listener.Addr().String(), closedAddress(t)))
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSSHTunnel, dsType)
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTLSConfig is returned when the TLS settings of a data source are unusable
+var ErrInvalidTLSConfig = errors.New("invalid TLS configuration")
+
+// NormalizeTLSMode checks a TLS mode; an empty mode disables TLS
+func NormalizeTLSMode(mode string) (models.DataSourceTLSMode, error) {
+	switch tlsMode := models.DataSourceTLSMode(strings.ToLower(strings.TrimSpace(mode))); tlsMode {
+	case "":
+		return models.TLSModeDisable, nil
+	case models.TLSModeDisable, models.TLSModeRequire, models.TLSModeVerifyCA, models.TLSModeVerifyFull:
+		return tlsMode, nil
+	default:
+		return "", fmt.Errorf("%w: unknown TLS mode %q", ErrInvalidTLSConfig, mode)
+	}
+}
+
+// ValidateTLSSettings checks that the TLS settings of a data source can be used to connect:
+// the PEM blocks must parse, and a client certificate needs its key
+func ValidateTLSSettings(dataSource *models.DataSource, credentials *ConnectionCredentials) error {
+	mode, err := NormalizeTLSMode(string(dataSource.TLSMode))
+	if err != nil {
+		return err
+	}
+	if mode != models.TLSModeDisable && dataSource.Type == models.DataSourceTypeSQLite {
+		return fmt.Errorf("%w: SQLite data sources are local files", ErrInvalidTLSConfig)
+	}
+	if mode == models.TLSModeDisable {
+		return nil
+	}
+	_, err = buildTLSConfig(dataSource, credentials)
+	return err
+}
+
+// setTLSSettings validates the TLS settings of a new data source and sets them, encrypting the PEM blocks
+func (s *DataSourceService) setTLSSettings(dataSource *models.DataSource, req *CreateDataSourceInput) error {
+	mode, err := NormalizeTLSMode(req.TLSMode)
+	if err != nil {
+		return err
+	}
+	dataSource.TLSMode = mode
+	dataSource.TLSServerName = strings.TrimSpace(req.TLSServerName)
+
+	credentials := &ConnectionCredentials{
+		TLSCACert:     req.TLSCACert,
+		TLSClientCert: req.TLSClientCert,
+		TLSClientKey:  req.TLSClientKey,
+	}
+	if err := ValidateTLSSettings(dataSource, credentials); err != nil {
+		return err
+	}
+
+	if dataSource.EncryptedTLSCACert, err = s.encryptSecret(req.TLSCACert); err != nil {
+		return err
+	}
+	if dataSource.EncryptedTLSClientCert, err = s.encryptSecret(req.TLSClientCert); err != nil {
+		return err
+	}
+	dataSource.EncryptedTLSClientKey, err = s.encryptSecret(req.TLSClientKey)
+	return err
+}
+
+// tlsUpdates validates the TLS settings a data source will have after an update and returns the columns to change
+func (s *DataSourceService) tlsUpdates(dataSource *models.DataSource, req *UpdateDataSourceInput) (map[string]interface{}, error) {
+	credentials, err := decryptCredentials(s.decryptPassword, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *dataSource
+	if req.Type != "" {
+		updated.Type = models.DataSourceType(req.Type)
+	}
+
+	updates := make(map[string]interface{})
+	if req.TLSMode != "" {
+		if updated.TLSMode, err = NormalizeTLSMode(req.TLSMode); err != nil {
+			return nil, err
+		}
+		updates["tls_mode"] = updated.TLSMode
+	}
+	if req.TLSServerName != nil {
+		updated.TLSServerName = strings.TrimSpace(*req.TLSServerName)
+		updates["tls_server_name"] = updated.TLSServerName
+	}
+	for _, field := range []struct {
+		column string
+		value  *string
+		plain  *string
+	}{
+		{"encrypted_tls_ca_cert", req.TLSCACert, &credentials.TLSCACert},
+		{"encrypted_tls_client_cert", req.TLSClientCert, &credentials.TLSClientCert},
+		{"encrypted_tls_client_key", req.TLSClientKey, &credentials.TLSClientKey},
+	} {
+		if field.value == nil {
+			continue
+		}
+		*field.plain = *field.value
+		encrypted, err := s.encryptSecret(*field.value)
+		if err != nil {
+			return nil, err
+		}
+		updates[field.column] = encrypted
+	}
+
+	if err := ValidateTLSSettings(&updated, credentials); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// tlsVersion returns the TLS version a pooled connection to a data source negotiated, empty when it
+// is unknown or the connection is not encrypted
+func (s *DataSourceService) tlsVersion(dataSource *models.DataSource, db *gorm.DB, driver DataSourceDriver) string {
+	reporter, ok := driver.(TLSVersionReporter)
+	if !ok {
+		return ""
+	}
+	version, err := reporter.TLSVersion(db)
+	if err != nil {
+		log.Printf("[HealthCheck] Failed to read the TLS version of %s: %v", dataSource.Name, err)
+		return ""
+	}
+	return version
+}
+
+// buildTLSConfig returns the TLS configuration of a connection to a data source, nil when TLS is disabled
+func buildTLSConfig(dataSource *models.DataSource, credentials *ConnectionCredentials) (*tls.Config, error) {
+	mode, err := NormalizeTLSMode(string(dataSource.TLSMode))
+	if err != nil {
+		return nil, err
+	}
+	if mode == models.TLSModeDisable {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if credentials.TLSClientCert != "" || credentials.TLSClientKey != "" {
+		if credentials.TLSClientCert == "" || credentials.TLSClientKey == "" {
+			return nil, fmt.Errorf("%w: a client certificate and its key must be set together", ErrInvalidTLSConfig)
+		}
+		cert, err := tls.X509KeyPair([]byte(credentials.TLSClientCert), []byte(credentials.TLSClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid client certificate: %v", ErrInvalidTLSConfig, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if credentials.TLSCACert != "" {
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(credentials.TLSCACert)) {
+			return nil, fmt.Errorf("%w: the CA bundle has no PEM certificates", ErrInvalidTLSConfig)
+		}
+	}
+
+	switch mode {
+	case models.TLSModeRequire:
+		// Like sslmode=require, the connection is encrypted but anyone can be on the other end
+		config.InsecureSkipVerify = true
+	case models.TLSModeVerifyCA:
+		// The chain is verified by hand, as crypto/tls always checks the name when it verifies
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, roots)
+		}
+	case models.TLSModeVerifyFull:
+		config.RootCAs = roots
+		config.ServerName = dataSource.TLSServerName
+		if config.ServerName == "" {
+			config.ServerName = dataSource.Host
+		}
+	}
+	return config, nil
+}
+
+// verifyCertificateChain verifies a server certificate chain against the roots without checking its name.
+// Nil roots use the system roots.
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server sent no certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid server certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// testPKI is a CA with a server certificate it issued for db.internal
+type testPKI struct {
+	caPEM  string
+	server tls.Certificate
+	// A client certificate and key, PEM-encoded
+	clientCertPEM string
+	clientKeyPEM  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (*ecdsa.PrivateKey, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		return key, der
+	}
+
+	serverKey, serverDER := issue(2, "db.internal", x509.ExtKeyUsageServerAuth)
+	clientKey, clientDER := issue(3, "querybase", x509.ExtKeyUsageClientAuth)
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+
+	return &testPKI{
+		caPEM:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		server:        tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey},
+		clientCertPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER})),
+		clientKeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyDER})),
+	}
+}
+
+// handshake runs a TLS handshake against a server presenting the certificate of the PKI
+func (p *testPKI) handshake(t *testing.T, config *tls.Config) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{p.server}})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", listener.Addr().String(), config)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestBuildTLSConfig_Modes(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestPKI(t)
+
+	// The server is reached by an address that is not on its certificate
+	dataSource := &models.DataSource{Type: models.DataSourceTypePostgreSQL, Host: "10.0.0.5"}
+	credentials := &ConnectionCredentials{TLSCACert: pki.caPEM}
+
+	config, err := buildTLSConfig(dataSource, credentials)
+	require.NoError(t, err)
+	assert.Nil(t, config, "TLS is disabled by default")
+
+	dataSource.TLSMode = models.TLSModeRequire
+	config, err = buildTLSConfig(dataSource, &ConnectionCredentials{TLSCACert: other.caPEM})
+	require.NoError(t, err)
+	assert.NoError(t, pki.handshake(t, config), "require doesn't verify the server")
+
+	dataSource.TLSMode = models.TLSModeVerifyCA
+	config, err = buildTLSConfig(dataSource, credentials)
+	require.NoError(t, err)
+	assert.NoError(t, pki.handshake(t, config), "verify-ca doesn't check the name")
+
+	config, err = buildTLSConfig(dataSource, &ConnectionCredentials{TLSCACert: other.caPEM})
+	require.NoError(t, err)
+	assert.Error(t, pki.handshake(t, config), "verify-ca rejects an unknown CA")
+
+	dataSource.TLSMode = models.TLSModeVerifyFull
+	config, err = buildTLSConfig(dataSource, credentials)
+	require.NoError(t, err)
+	assert.Error(t, pki.handshake(t, config), "verify-full checks the host name")
+
+	dataSource.TLSServerName = "db.internal"
+	config, err = buildTLSConfig(dataSource, credentials)
+	require.NoError(t, err)
+	assert.NoError(t, pki.handshake(t, config))
+}
+
+func TestValidateTLSSettings(t *testing.T) {
+	pki := newTestPKI(t)
+	dataSource := &models.DataSource{Type: models.DataSourceTypeMySQL, Host: "db.internal", TLSMode: models.TLSModeVerifyFull}
+
+	assert.NoError(t, ValidateTLSSettings(dataSource, &ConnectionCredentials{
+		TLSCACert: pki.caPEM, TLSClientCert: pki.clientCertPEM, TLSClientKey: pki.clientKeyPEM,
+	}))
+
+	for name, credentials := range map[string]*ConnectionCredentials{
+		"certificate without key": {TLSClientCert: pki.clientCertPEM},
+		"key without certificate": {TLSClientKey: pki.clientKeyPEM},
+		"key of another pair":     {TLSClientCert: pki.clientCertPEM, TLSClientKey: newTestPKI(t).clientKeyPEM},
+		"CA bundle without PEM":   {TLSCACert: "not a certificate"},
+	} {
+		assert.ErrorIs(t, ValidateTLSSettings(dataSource, credentials), ErrInvalidTLSConfig, name)
+	}
+
+	dataSource.TLSMode = "prefer"
+	assert.ErrorIs(t, ValidateTLSSettings(dataSource, &ConnectionCredentials{}), ErrInvalidTLSConfig)
+
+	sqliteSource := &models.DataSource{Type: models.DataSourceTypeSQLite, TLSMode: models.TLSModeRequire}
+	assert.ErrorIs(t, ValidateTLSSettings(sqliteSource, &ConnectionCredentials{}), ErrInvalidTLSConfig)
+}
+
+func TestDataSourceService_TLSSettings(t *testing.T) {
+	db := setupTestDB(t)
+	pki := newTestPKI(t)
+	service := NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey))
+
+	dataSource, err := service.CreateDataSource(context.Background(), &CreateDataSourceInput{
+		Name:          "tls",
+		Type:          string(models.DataSourceTypePostgreSQL),
+		Host:          "db.internal",
+		Port:          5432,
+		DatabaseName:  "app",
+		Username:      "querybase",
+		Password:      "secret",
+		TLSMode:       "verify-full",
+		TLSCACert:     pki.caPEM,
+		TLSClientCert: pki.clientCertPEM,
+		TLSClientKey:  pki.clientKeyPEM,
+	})
+	require.NoError(t, err)
+
+	// The certificates and key are stored encrypted, like the password
+	var stored models.DataSource
+	require.NoError(t, db.First(&stored, "id = ?", dataSource.ID).Error)
+	assert.Equal(t, models.TLSModeVerifyFull, stored.TLSMode)
+	assert.NotEmpty(t, stored.EncryptedTLSClientKey)
+	assert.NotContains(t, stored.EncryptedTLSClientKey, "PRIVATE KEY")
+
+	credentials, err := resolveCredentials(context.Background(), service.decryptPassword, service.connections.secrets, &stored)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", credentials.Password)
+	assert.Equal(t, pki.caPEM, credentials.TLSCACert)
+	assert.Equal(t, pki.clientKeyPEM, credentials.TLSClientKey)
+
+	// Removing only the key would leave an unusable certificate
+	empty := ""
+	_, err = service.UpdateDataSource(context.Background(), dataSource.ID.String(), &UpdateDataSourceInput{TLSClientKey: &empty})
+	assert.ErrorIs(t, err, ErrInvalidTLSConfig)
+
+	updated, err := service.UpdateDataSource(context.Background(), dataSource.ID.String(), &UpdateDataSourceInput{
+		TLSMode: "verify-ca", TLSClientCert: &empty, TLSClientKey: &empty,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.TLSModeVerifyCA, updated.TLSMode)
+	assert.Empty(t, updated.EncryptedTLSClientCert)
+	assert.Empty(t, updated.EncryptedTLSClientKey)
+	assert.NotEmpty(t, updated.EncryptedTLSCACert)
+
+	// A local SQLite file has no TLS
+	_, err = service.CreateDataSource(context.Background(), &CreateDataSourceInput{
+		Name: "edge", Type: string(models.DataSourceTypeSQLite), FilePath: "/tmp/edge.db", TLSMode: "require",
+	})
+	assert.ErrorIs(t, err, ErrInvalidTLSConfig)
+}
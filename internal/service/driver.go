@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUnsupportedDataSourceType is returned for a data source type that has no registered driver
+	ErrUnsupportedDataSourceType = errors.New("unsupported data source type")
+
+	// ErrAuditUnavailable is returned by a driver, before the query ran, when it can't capture the rows a write changes
+	ErrAuditUnavailable = errors.New("audit capture unavailable")
+)
+
+// DataSourceDriver implements everything that differs between database engines. The query, schema,
+// audit and data source services reach data sources only through the driver of their type, so an
+// engine is supported by registering a driver for it.
+type DataSourceDriver interface {
+	// Type returns the data source type the driver handles
+	Type() models.DataSourceType
+
+	// Open opens a connection pool to a data source. Every connection runs the session init statements.
+	Open(dataSource *models.DataSource, credentials *ConnectionCredentials, sessionInit []string) (*gorm.DB, error)
+
+	// ParseSQL parses and validates a query in the dialect of the engine
+	ParseSQL(sqlText string) (*SQLParseResult, error)
+
+	// QuoteIdentifier quotes a single identifier
+	QuoteIdentifier(name string) string
+
+	// QuoteString renders a string as a SQL literal
+	QuoteString(value string) string
+
+	// Placeholder returns the bind placeholder of the argument at a 1-based position. A numbered
+	// placeholder, such as $1, can be referenced again to reuse its argument.
+	Placeholder(position int) (placeholder string, numbered bool)
+
+	// ListTables returns the tables with their columns, and the schema names where the engine has them
+	ListTables(db *sql.DB) ([]TableInfo, []string, error)
+
+	// DescribeTable returns a table with its columns
+	DescribeTable(db *sql.DB, tableName string) (*TableInfo, error)
+
+	// SearchTables returns the names of the tables whose lowercased name matches a LIKE pattern
+	SearchTables(db *sql.DB, pattern string) ([]string, error)
+
+	// TableExists reports whether a table exists
+	TableExists(db *gorm.DB, tableName string) bool
+
+	// ExplainStatement returns the statement prefix that explains a query, e.g. "EXPLAIN ANALYZE"
+	ExplainStatement(analyze bool) (string, error)
+
+	// CountQuery converts a write query into a SELECT COUNT(*) of the rows it would affect
+	CountQuery(queryText string) (string, error)
+
+	// TestAuditCapability reports whether a connection can create what trigger-based audit needs
+	TestAuditCapability(db *gorm.DB) models.AuditCapability
+
+	// CaptureAudit runs a write query in a transaction and captures the rows it changed, at most
+	// sampleLimit when it is positive. ErrAuditUnavailable means the query did not run.
+	CaptureAudit(tx *gorm.DB, queryText, tableName string, sampleLimit int) (*AuditResult, error)
+
+	// SessionID returns the server-side ID of the session of a pinned connection
+	SessionID(conn *gorm.DB) (int64, error)
+
+	// StatementTimeout returns the statements that set and reset a session's statement timeout;
+	// both are empty when the engine has none
+	StatementTimeout(timeout time.Duration) (set, reset string)
+
+	// CancelStatement cancels the statement running in a session from another connection
+	CancelStatement(ctx context.Context, db *gorm.DB, sessionID int64) error
+}
+
+// CostEstimator is implemented by drivers whose planner estimates the cost of a query
+type CostEstimator interface {
+	// ParseCostEstimate reads the estimate from the rows of a plain EXPLAIN
+	ParseCostEstimate(plan []map[string]interface{}) (*CostEstimate, error)
+}
+
+// TLSVersionReporter is implemented by drivers that can tell which TLS version a connection negotiated
+type TLSVersionReporter interface {
+	// TLSVersion returns the TLS version of the connection, e.g. "TLSv1.3", or "" when it is not encrypted
+	TLSVersion(db *gorm.DB) (string, error)
+}
+
+// ServerVersionReporter is implemented by drivers that can tell the version of the server
+type ServerVersionReporter interface {
+	// ServerVersion returns the version of the connected server, e.g. "16.2"
+	ServerVersion(db *gorm.DB) (string, error)
+}
+
+// ReplicaLagReporter is implemented by drivers that can measure how far a replica is behind its primary
+type ReplicaLagReporter interface {
+	// ReplicaLag returns how many seconds the connected server is behind its primary
+	ReplicaLag(db *gorm.DB) (float64, error)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[models.DataSourceType]DataSourceDriver)
+)
+
+// RegisterDataSourceDriver makes a driver available for its data source type.
+// Like sql.Register, it panics when the type already has a driver.
+func RegisterDataSourceDriver(driver DataSourceDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		panic("service: RegisterDataSourceDriver driver is nil")
+	}
+	if _, dup := drivers[driver.Type()]; dup {
+		panic("service: RegisterDataSourceDriver called twice for type " + string(driver.Type()))
+	}
+	drivers[driver.Type()] = driver
+}
+
+// LookupDataSourceDriver returns the driver registered for a data source type
+func LookupDataSourceDriver(dsType models.DataSourceType) (DataSourceDriver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[dsType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDataSourceType, dsType)
+	}
+	return driver, nil
+}
+
+// DataSourceTypes returns the data source types that have a registered driver, sorted by name
+func DataSourceTypes() []models.DataSourceType {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	types := make([]models.DataSourceType, 0, len(drivers))
+	for dsType := range drivers {
+		types = append(types, dsType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// standardSQL implements the parts of a driver that follow the SQL standard. Drivers embed it and
+// override what their engine does differently.
+type standardSQL struct{}
+
+// QuoteIdentifier quotes an identifier in double quotes
+func (standardSQL) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteString quotes a string literal in single quotes
+func (standardSQL) QuoteString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Placeholder returns the positional ? placeholder
+func (standardSQL) Placeholder(position int) (string, bool) {
+	return "?", false
+}
+
+// CountQuery converts a DELETE, UPDATE or INSERT ... SELECT into a SELECT COUNT(*)
+func (standardSQL) CountQuery(queryText string) (string, error) {
+	return buildCountQuery(queryText)
+}
@@ -0,0 +1,643 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterDataSourceDriver(mysqlDriver{})
+}
+
+// mysqlDriver is the driver of MySQL data sources
+type mysqlDriver struct {
+	standardSQL
+}
+
+// Type returns the MySQL data source type
+func (mysqlDriver) Type() models.DataSourceType {
+	return models.DataSourceTypeMySQL
+}
+
+// Open connects through go-sql-driver/mysql, directly or through the SSH tunnel of the data source
+func (mysqlDriver) Open(dataSource *models.DataSource, credentials *ConnectionCredentials, sessionInit []string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local&timeout=5s&readTimeout=15s&writeTimeout=15s",
+		dataSource.Username,
+		credentials.Password,
+		dataSource.Host,
+		dataSource.Port,
+		dataSource.GetDatabase(),
+	)
+	config, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	if config.TLS, err = buildTLSConfig(dataSource, credentials); err != nil {
+		return nil, err
+	}
+
+	tunnel, err := acquireSSHTunnel(dataSource, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if tunnel != nil {
+		// The driver only takes custom dialers by network name, so each tunnel registers its own
+		config.Net = "querybase-ssh-" + tunnel.key
+		gomysql.RegisterDialContext(config.Net, func(ctx context.Context, addr string) (net.Conn, error) {
+			return tunnel.DialContext(ctx, "tcp", addr)
+		})
+	}
+
+	connector, err := gomysql.NewConnector(config)
+	if err != nil {
+		tunnel.release()
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	sqlDB := openConnectorDB(withSSHTunnel(connector, tunnel), sessionInit)
+	return openGorm(mysql.New(mysql.Config{Conn: sqlDB}), sqlDB)
+}
+
+// TLSVersion reads the Ssl_version session status, which is empty on an unencrypted connection
+func (mysqlDriver) TLSVersion(db *gorm.DB) (string, error) {
+	var name, version string
+	if err := db.Raw("SHOW SESSION STATUS LIKE 'Ssl_version'").Row().Scan(&name, &version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// ServerVersion reads the version of the server, which names MariaDB servers as such
+func (mysqlDriver) ServerVersion(db *gorm.DB) (string, error) {
+	var version string
+	if err := db.Raw("SELECT VERSION()").Row().Scan(&version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// ParseSQL parses a query with the TiDB parser
+func (mysqlDriver) ParseSQL(sqlText string) (*SQLParseResult, error) {
+	return parseMySQL(sqlText)
+}
+
+// QuoteIdentifier quotes an identifier in backticks
+func (mysqlDriver) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// QuoteString quotes a string literal. MySQL treats backslash as an escape character
+// inside string literals by default, so backslashes are escaped too.
+func (d mysqlDriver) QuoteString(value string) string {
+	return d.standardSQL.QuoteString(strings.ReplaceAll(value, `\`, `\\`))
+}
+
+// ListTables fetches the tables of the connected database; MySQL has no schemas within a database
+func (d mysqlDriver) ListTables(db *sql.DB) ([]TableInfo, []string, error) {
+	tables, err := d.listTables(db)
+	return tables, nil, err
+}
+
+// SearchTables searches the tables of the connected database
+func (mysqlDriver) SearchTables(db *sql.DB, pattern string) ([]string, error) {
+	query := `
+		SELECT DISTINCT TABLE_NAME
+		FROM information_schema.tables
+		WHERE TABLE_SCHEMA = DATABASE()
+			AND TABLE_TYPE = 'BASE TABLE'
+			AND LOWER(TABLE_NAME) LIKE ?
+		ORDER BY TABLE_NAME
+		LIMIT 50
+	`
+
+	rows, err := db.Query(query, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// TableExists looks a table up in the connected database
+func (mysqlDriver) TableExists(db *gorm.DB, tableName string) bool {
+	var count int64
+	err := db.Raw(`
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		AND LOWER(table_name) = ?
+	`, strings.ToLower(tableName)).Scan(&count).Error
+	return err == nil && count > 0
+}
+
+// ExplainStatement returns EXPLAIN, or EXPLAIN ANALYZE which runs the query
+func (mysqlDriver) ExplainStatement(analyze bool) (string, error) {
+	if analyze {
+		return "EXPLAIN ANALYZE", nil
+	}
+	return "EXPLAIN", nil
+}
+
+// ParseCostEstimate multiplies the row estimates of the tables joined in each SELECT
+func (mysqlDriver) ParseCostEstimate(plan []map[string]interface{}) (*CostEstimate, error) {
+	return parseMySQLCostEstimate(plan)
+}
+
+// SessionID returns the connection ID
+func (mysqlDriver) SessionID(conn *gorm.DB) (int64, error) {
+	var connectionID int64
+	if err := conn.Raw("SELECT CONNECTION_ID()").Scan(&connectionID).Error; err != nil {
+		return 0, fmt.Errorf("failed to get connection id: %w", err)
+	}
+	return connectionID, nil
+}
+
+// StatementTimeout sets MAX_EXECUTION_TIME in milliseconds, which limits SELECTs
+func (mysqlDriver) StatementTimeout(timeout time.Duration) (string, string) {
+	if timeout <= 0 {
+		return "", ""
+	}
+	return fmt.Sprintf("SET SESSION MAX_EXECUTION_TIME = %d", timeout.Milliseconds()), "SET SESSION MAX_EXECUTION_TIME = 0"
+}
+
+// CancelStatement kills the statement of a connection, leaving the connection open
+func (mysqlDriver) CancelStatement(ctx context.Context, db *gorm.DB, sessionID int64) error {
+	return db.WithContext(ctx).Exec(fmt.Sprintf("KILL QUERY %d", sessionID)).Error
+}
+
+// ReplicaLag reads Seconds_Behind_Source from the replica status
+func (mysqlDriver) ReplicaLag(db *gorm.DB) (float64, error) {
+	// SHOW REPLICA STATUS replaced SHOW SLAVE STATUS in MySQL 8.0.22
+	status, err := showReplicaStatus(db, "SHOW REPLICA STATUS")
+	if err != nil {
+		if status, err = showReplicaStatus(db, "SHOW SLAVE STATUS"); err != nil {
+			return 0, fmt.Errorf("failed to read replica status: %w", err)
+		}
+	}
+	if status == nil {
+		// Not configured as a replica
+		return 0, nil
+	}
+
+	for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		value, ok := status[column]
+		if !ok {
+			continue
+		}
+		if !value.Valid {
+			return 0, fmt.Errorf("replication is not running")
+		}
+		lag, ok := planNumber(value.String)
+		if !ok {
+			return 0, fmt.Errorf("invalid replication lag %q", value.String)
+		}
+		return lag, nil
+	}
+	return 0, fmt.Errorf("replica status has no lag column")
+}
+
+// showReplicaStatus returns the columns of MySQL's replica status, or nil when the server is not a replica
+func showReplicaStatus(db *gorm.DB, statement string) (map[string]sql.NullString, error) {
+	rows, err := db.Raw(statement).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	values := make([]sql.NullString, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]sql.NullString, len(columns))
+	for i, column := range columns {
+		status[column] = values[i]
+	}
+	return status, nil
+}
+
+// listTables fetches the tables of the connected MySQL database
+func (d mysqlDriver) listTables(db *sql.DB) ([]TableInfo, error) {
+	// Get the current database name
+	var dbName string
+	err := db.QueryRow("SELECT DATABASE()").Scan(&dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	// First get list of base tables
+	tableQuery := `
+		SELECT TABLE_NAME
+		FROM information_schema.tables
+		WHERE TABLE_SCHEMA = DATABASE()
+			AND TABLE_TYPE = 'BASE TABLE'
+	`
+
+	// Get the tables
+	tableRows, err := db.Query(tableQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer tableRows.Close()
+
+	var tablesList []string
+	for tableRows.Next() {
+		var tableName string
+		if err := tableRows.Scan(&tableName); err != nil {
+			return nil, err
+		}
+		tablesList = append(tablesList, tableName)
+	}
+
+	if len(tablesList) == 0 {
+		return []TableInfo{}, nil
+	}
+
+	// Build IN clause placeholders
+	inClause := ""
+	for i := 0; i < len(tablesList); i++ {
+		if i > 0 {
+			inClause += ","
+		}
+		inClause += "?"
+	}
+
+	// Now get columns for these tables
+	query := `
+		SELECT
+			TABLE_NAME,
+			COLUMN_NAME,
+			DATA_TYPE,
+			IS_NULLABLE,
+			COLUMN_DEFAULT,
+			COLUMN_KEY = 'PRI' as is_primary_key
+		FROM information_schema.columns
+		WHERE TABLE_SCHEMA = DATABASE()
+			AND TABLE_NAME IN (` + inClause + `)
+		ORDER BY TABLE_NAME, ORDINAL_POSITION
+	`
+
+	// Convert tablesList to interface{} for query args
+	args := make([]interface{}, len(tablesList))
+	for i, t := range tablesList {
+		args[i] = t
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tableMap := make(map[string]*TableInfo)
+
+	for rows.Next() {
+		var tableName, columnName, dataType, isNullable string
+		var columnDefault, isPrimaryKey sql.NullString
+
+		if err := rows.Scan(&tableName, &columnName, &dataType, &isNullable, &columnDefault, &isPrimaryKey); err != nil {
+			return nil, err
+		}
+
+		if _, exists := tableMap[tableName]; !exists {
+			tableMap[tableName] = &TableInfo{
+				TableName: tableName,
+				Schema:    dbName, // Use the actual database name
+				Columns:   []ColumnInfo{},
+			}
+		}
+
+		column := ColumnInfo{
+			ColumnName:   columnName,
+			DataType:     dataType,
+			IsNullable:   isNullable == "YES",
+			IsPrimaryKey: isPrimaryKey.String == "PRI",
+		}
+
+		if columnDefault.Valid {
+			column.ColumnDefault = &columnDefault.String
+		}
+
+		tableMap[tableName].Columns = append(tableMap[tableName].Columns, column)
+	}
+
+	tables := make([]TableInfo, 0, len(tableMap))
+	for _, table := range tableMap {
+		tables = append(tables, *table)
+	}
+
+	return tables, nil
+}
+
+// DescribeTable fetches detailed information for a specific table in MySQL
+func (d mysqlDriver) DescribeTable(db *sql.DB, tableName string) (*TableInfo, error) {
+	query := `
+		SELECT
+			COLUMN_NAME,
+			DATA_TYPE,
+			IS_NULLABLE,
+			COLUMN_DEFAULT,
+			COLUMN_KEY = 'PRI' as is_primary_key
+		FROM information_schema.columns
+		WHERE TABLE_NAME = ? AND TABLE_SCHEMA = DATABASE()
+		ORDER BY ORDINAL_POSITION
+	`
+
+	rows, err := db.Query(query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tableInfo := &TableInfo{
+		TableName: tableName,
+		Schema:    "", // MySQL doesn't use schemas the same way
+		Columns:   []ColumnInfo{},
+	}
+
+	for rows.Next() {
+		var name, dataType, isNullable string
+		var columnDefault, isPrimaryKey sql.NullString
+
+		if err := rows.Scan(&name, &dataType, &isNullable, &columnDefault, &isPrimaryKey); err != nil {
+			return nil, err
+		}
+
+		column := ColumnInfo{
+			ColumnName:   name,
+			DataType:     dataType,
+			IsNullable:   isNullable == "YES",
+			IsPrimaryKey: isPrimaryKey.String == "PRI",
+		}
+
+		if columnDefault.Valid {
+			column.ColumnDefault = &columnDefault.String
+		}
+
+		tableInfo.Columns = append(tableInfo.Columns, column)
+	}
+
+	return tableInfo, nil
+}
+
+// TestAuditCapability tests DDL permissions on MySQL
+func (d mysqlDriver) TestAuditCapability(db *gorm.DB) models.AuditCapability {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return models.AuditCapabilityCountOnly
+	}
+	defer tx.Rollback()
+
+	// Test creating a temporary table
+	err := tx.Exec(`CREATE TEMPORARY TABLE _qb_audit_test (id INT AUTO_INCREMENT PRIMARY KEY, data TEXT)`).Error
+	if err != nil {
+		return models.AuditCapabilityCountOnly
+	}
+
+	// Drop the temp table
+	tx.Exec(`DROP TEMPORARY TABLE IF EXISTS _qb_audit_test`)
+
+	// MySQL trigger creation requires TRIGGER privilege which we test separately
+	// For now, temp table support is a prerequisite
+	return models.AuditCapabilityFull
+}
+
+// CaptureAudit uses MySQL triggers to capture audit data
+func (d mysqlDriver) CaptureAudit(tx *gorm.DB, queryText, tableName string, sampleLimit int) (*AuditResult, error) {
+	// Step 1: Create temp audit tables for before and after events to avoid MySQL Can't reopen table error
+	err := tx.Exec(`
+		CREATE TEMPORARY TABLE IF NOT EXISTS _qb_audit_before (
+			_qb_seq INT AUTO_INCREMENT PRIMARY KEY,
+			_qb_action VARCHAR(10),
+			_qb_data JSON
+		)
+	`).Error
+	if err != nil {
+		return nil, ErrAuditUnavailable
+	}
+	// Clear any stale rows from a prior run in this MySQL session.
+	tx.Exec(`DELETE FROM _qb_audit_before`)
+
+	err = tx.Exec(`
+		CREATE TEMPORARY TABLE IF NOT EXISTS _qb_audit_after (
+			_qb_seq INT AUTO_INCREMENT PRIMARY KEY,
+			_qb_action VARCHAR(10),
+			_qb_data JSON
+		)
+	`).Error
+	if err != nil {
+		return nil, ErrAuditUnavailable
+	}
+	tx.Exec(`DELETE FROM _qb_audit_after`)
+
+	// Step 2: Get columns for the target table to build JSON_OBJECT
+	columnListSQL, err := d.columnList(tx, tableName)
+	if err != nil {
+		return nil, ErrAuditUnavailable
+	}
+
+	// Step 3: Create triggers
+	safeName := strings.ReplaceAll(tableName, ".", "_")
+	triggerBeforeDelete := fmt.Sprintf("_qb_trg_before_del_%s", safeName)
+	triggerBeforeUpdate := fmt.Sprintf("_qb_trg_before_upd_%s", safeName)
+	triggerAfterUpdate := fmt.Sprintf("_qb_trg_after_upd_%s", safeName)
+	triggerAfterInsert := fmt.Sprintf("_qb_trg_after_ins_%s", safeName)
+
+	// BEFORE DELETE trigger
+	tx.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS %s`, triggerBeforeDelete))
+	err = tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER %s BEFORE DELETE ON %s
+		FOR EACH ROW
+		INSERT INTO _qb_audit_before (_qb_action, _qb_data) VALUES ('DELETE', %s)
+	`, triggerBeforeDelete, tableName, d.jsonObject("OLD", columnListSQL))).Error
+	if err != nil {
+		return nil, ErrAuditUnavailable
+	}
+
+	// BEFORE UPDATE trigger
+	tx.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS %s`, triggerBeforeUpdate))
+	tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER %s BEFORE UPDATE ON %s
+		FOR EACH ROW
+		INSERT INTO _qb_audit_before (_qb_action, _qb_data) VALUES ('BEFORE_UPD', %s)
+	`, triggerBeforeUpdate, tableName, d.jsonObject("OLD", columnListSQL)))
+
+	// AFTER UPDATE trigger
+	tx.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS %s`, triggerAfterUpdate))
+	tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER %s AFTER UPDATE ON %s
+		FOR EACH ROW
+		INSERT INTO _qb_audit_after (_qb_action, _qb_data) VALUES ('AFTER_UPD', %s)
+	`, triggerAfterUpdate, tableName, d.jsonObject("NEW", columnListSQL)))
+
+	// AFTER INSERT trigger
+	tx.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS %s`, triggerAfterInsert))
+	tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER %s AFTER INSERT ON %s
+		FOR EACH ROW
+		INSERT INTO _qb_audit_after (_qb_action, _qb_data) VALUES ('INSERT', %s)
+	`, triggerAfterInsert, tableName, d.jsonObject("NEW", columnListSQL)))
+
+	// Step 4: Execute the user's query
+	execResult := tx.Exec(queryText)
+	if execResult.Error != nil {
+		d.cleanupTriggers(tx, triggerBeforeDelete, triggerBeforeUpdate, triggerAfterUpdate, triggerAfterInsert)
+		return nil, fmt.Errorf("query execution failed: %w", execResult.Error)
+	}
+
+	// Step 5: Read audit log
+	beforeData, afterData, err := d.readAuditLog(tx, sampleLimit)
+
+	// Step 6: Cleanup
+	d.cleanupTriggers(tx, triggerBeforeDelete, triggerBeforeUpdate, triggerAfterUpdate, triggerAfterInsert)
+
+	if err != nil {
+		return &AuditResult{
+			AffectedRows: int(execResult.RowsAffected),
+			AuditMode:    models.AuditModeCountOnly,
+		}, nil
+	}
+
+	mode := models.AuditModeFull
+	if sampleLimit > 0 {
+		mode = models.AuditModeSample
+	}
+
+	return &AuditResult{
+		AffectedRows: int(execResult.RowsAffected),
+		BeforeData:   beforeData,
+		AfterData:    afterData,
+		AuditMode:    mode,
+	}, nil
+}
+
+// columnList retrieves column names for building JSON_OBJECT
+func (d mysqlDriver) columnList(tx *gorm.DB, tableName string) ([]string, error) {
+	var columns []string
+	rows, err := tx.Raw(`
+		SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`, tableName).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			continue
+		}
+		columns = append(columns, col)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns found for table %s", tableName)
+	}
+
+	return columns, nil
+}
+
+// jsonObject builds a JSON_OBJECT expression for MySQL triggers
+func (d mysqlDriver) jsonObject(prefix string, columns []string) string {
+	var parts []string
+	for _, col := range columns {
+		parts = append(parts, fmt.Sprintf("'%s', %s.`%s`", col, prefix, col))
+	}
+	return fmt.Sprintf("JSON_OBJECT(%s)", strings.Join(parts, ", "))
+}
+
+// readAuditLog reads captured data from the MySQL audit temp tables
+func (d mysqlDriver) readAuditLog(tx *gorm.DB, sampleLimit int) ([]map[string]interface{}, []map[string]interface{}, error) {
+	var beforeData, afterData []map[string]interface{}
+
+	// Read before data
+	queryBefore := `SELECT _qb_action, _qb_data FROM _qb_audit_before ORDER BY _qb_seq`
+	if sampleLimit > 0 {
+		queryBefore = fmt.Sprintf("%s LIMIT %d", queryBefore, sampleLimit)
+	}
+
+	rowsBefore, err := tx.Raw(queryBefore).Rows()
+	if err == nil {
+		defer rowsBefore.Close()
+		for rowsBefore.Next() {
+			var action string
+			var dataJSON []byte
+			if err := rowsBefore.Scan(&action, &dataJSON); err != nil {
+				continue
+			}
+
+			var rowData map[string]interface{}
+			if err := json.Unmarshal(dataJSON, &rowData); err != nil {
+				continue
+			}
+			beforeData = append(beforeData, rowData)
+		}
+	}
+
+	// Read after data
+	queryAfter := `SELECT _qb_action, _qb_data FROM _qb_audit_after ORDER BY _qb_seq`
+	if sampleLimit > 0 {
+		queryAfter = fmt.Sprintf("%s LIMIT %d", queryAfter, sampleLimit)
+	}
+
+	rowsAfter, err := tx.Raw(queryAfter).Rows()
+	if err == nil {
+		defer rowsAfter.Close()
+		for rowsAfter.Next() {
+			var action string
+			var dataJSON []byte
+			if err := rowsAfter.Scan(&action, &dataJSON); err != nil {
+				continue
+			}
+
+			var rowData map[string]interface{}
+			if err := json.Unmarshal(dataJSON, &rowData); err != nil {
+				continue
+			}
+			afterData = append(afterData, rowData)
+		}
+	}
+
+	return beforeData, afterData, nil
+}
+
+// cleanupTriggers removes audit triggers
+func (d mysqlDriver) cleanupTriggers(tx *gorm.DB, triggers ...string) {
+	for _, trigger := range triggers {
+		tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s", trigger))
+	}
+	tx.Exec("DROP TEMPORARY TABLE IF EXISTS _qb_audit_before")
+	tx.Exec("DROP TEMPORARY TABLE IF EXISTS _qb_audit_after")
+}
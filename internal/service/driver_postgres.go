@@ -0,0 +1,541 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterDataSourceDriver(postgresDriver{})
+}
+
+// postgresReplicaLagQuery returns the replay lag of a PostgreSQL standby in seconds. A standby that has
+// replayed everything it received is not lagging, however old its last transaction is, and a server
+// that is not in recovery has no lag.
+const postgresReplicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+// postgresDriver is the driver of PostgreSQL data sources
+type postgresDriver struct {
+	standardSQL
+}
+
+// Type returns the PostgreSQL data source type
+func (postgresDriver) Type() models.DataSourceType {
+	return models.DataSourceTypePostgreSQL
+}
+
+// Open connects through pgx, directly or through the SSH tunnel of the data source. TLS is configured
+// on the connection itself, so a server without TLS is never fallen back to in plaintext.
+func (postgresDriver) Open(dataSource *models.DataSource, credentials *ConnectionCredentials, sessionInit []string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable connect_timeout=5",
+		dataSource.Host,
+		dataSource.Port,
+		dataSource.Username,
+		credentials.Password,
+		dataSource.GetDatabase(),
+	)
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	if config.TLSConfig, err = buildTLSConfig(dataSource, credentials); err != nil {
+		return nil, err
+	}
+
+	tunnel, err := acquireSSHTunnel(dataSource, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if tunnel != nil {
+		config.DialFunc = tunnel.DialContext
+		// The host is resolved by the bastion, as it is often only known on its network
+		config.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+			return []string{host}, nil
+		}
+	}
+
+	sqlDB := openConnectorDB(withSSHTunnel(stdlib.GetConnector(*config), tunnel), sessionInit)
+	return openGorm(postgres.New(postgres.Config{Conn: sqlDB}), sqlDB)
+}
+
+// TLSVersion reads the TLS version of the session from pg_stat_ssl
+func (postgresDriver) TLSVersion(db *gorm.DB) (string, error) {
+	var version sql.NullString
+	if err := db.Raw("SELECT version FROM pg_stat_ssl WHERE pid = pg_backend_pid()").Row().Scan(&version); err != nil {
+		return "", err
+	}
+	return version.String, nil
+}
+
+// ServerVersion reads the server_version setting
+func (postgresDriver) ServerVersion(db *gorm.DB) (string, error) {
+	var version string
+	if err := db.Raw("SHOW server_version").Row().Scan(&version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// ParseSQL parses a query with the PostgreSQL parser
+func (postgresDriver) ParseSQL(sqlText string) (*SQLParseResult, error) {
+	return parsePostgreSQL(sqlText)
+}
+
+// SearchTables searches the tables of every non-system schema
+func (postgresDriver) SearchTables(db *sql.DB, pattern string) ([]string, error) {
+	query := `
+		SELECT DISTINCT
+			t.table_name,
+			t.table_schema
+		FROM information_schema.tables t
+		WHERE t.table_schema NOT IN ('pg_catalog', 'information_schema')
+			AND t.table_type = 'BASE TABLE'
+			AND LOWER(t.table_name) LIKE $1
+		ORDER BY t.table_name
+		LIMIT 50
+	`
+
+	rows, err := db.Query(query, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name, schema string
+		if err := rows.Scan(&name, &schema); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// TableExists looks a table up in the public schema
+func (postgresDriver) TableExists(db *gorm.DB, tableName string) bool {
+	var count int64
+	err := db.Raw(`
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = 'public'
+		AND LOWER(table_name) = ?
+	`, strings.ToLower(tableName)).Scan(&count).Error
+	return err == nil && count > 0
+}
+
+// ExplainStatement returns EXPLAIN, or EXPLAIN ANALYZE which runs the query
+func (postgresDriver) ExplainStatement(analyze bool) (string, error) {
+	if analyze {
+		return "EXPLAIN ANALYZE", nil
+	}
+	return "EXPLAIN", nil
+}
+
+// ParseCostEstimate reads the total cost of the top plan node and the largest row estimate of any node
+func (postgresDriver) ParseCostEstimate(plan []map[string]interface{}) (*CostEstimate, error) {
+	return parsePostgresCostEstimate(plan)
+}
+
+// SessionID returns the backend pid of the connection
+func (postgresDriver) SessionID(conn *gorm.DB) (int64, error) {
+	var backendID int64
+	if err := conn.Raw("SELECT pg_backend_pid()").Scan(&backendID).Error; err != nil {
+		return 0, fmt.Errorf("failed to get backend pid: %w", err)
+	}
+	return backendID, nil
+}
+
+// Placeholder returns the numbered $n placeholder
+func (postgresDriver) Placeholder(position int) (string, bool) {
+	return "$" + strconv.Itoa(position), true
+}
+
+// StatementTimeout sets statement_timeout in milliseconds
+func (postgresDriver) StatementTimeout(timeout time.Duration) (string, string) {
+	if timeout <= 0 {
+		return "", ""
+	}
+	return fmt.Sprintf("SET statement_timeout = %d", timeout.Milliseconds()), "RESET statement_timeout"
+}
+
+// CancelStatement cancels the statement of a backend with pg_cancel_backend
+func (postgresDriver) CancelStatement(ctx context.Context, db *gorm.DB, sessionID int64) error {
+	return db.WithContext(ctx).Exec("SELECT pg_cancel_backend(?)", sessionID).Error
+}
+
+// ReplicaLag measures the replay lag of a standby
+func (postgresDriver) ReplicaLag(db *gorm.DB) (float64, error) {
+	var lag float64
+	if err := db.Raw(postgresReplicaLagQuery).Scan(&lag).Error; err != nil {
+		return 0, fmt.Errorf("failed to measure replication lag: %w", err)
+	}
+	return lag, nil
+}
+
+// ListTables fetches the tables of every non-system schema
+func (d postgresDriver) ListTables(db *sql.DB) ([]TableInfo, []string, error) {
+	// Get all schemas
+	schemas, err := d.listSchemas(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Get all tables with columns
+	query := `
+		SELECT
+			t.table_schema,
+			t.table_name,
+			c.column_name,
+			c.data_type,
+			c.is_nullable,
+			c.column_default,
+			COALESCE(pk.constraint_type, '') as is_primary_key
+		FROM information_schema.tables t
+		LEFT JOIN information_schema.columns c ON t.table_name = c.table_name AND t.table_schema = c.table_schema
+		LEFT JOIN (
+			SELECT ku.table_name, ku.column_name, tc.constraint_type
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage ku ON tc.constraint_name = ku.constraint_name
+			WHERE tc.constraint_type = 'PRIMARY KEY'
+		) pk ON c.table_name = pk.table_name AND c.column_name = pk.column_name
+		WHERE t.table_schema NOT IN ('pg_catalog', 'information_schema')
+			AND t.table_type = 'BASE TABLE'
+		ORDER BY t.table_schema, t.table_name, c.ordinal_position
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	tableMap := make(map[string]*TableInfo)
+
+	for rows.Next() {
+		var schemaName, tableName, columnName, dataType, isNullable, isPrimaryKey string
+		var columnDefault sql.NullString
+		if err := rows.Scan(&schemaName, &tableName, &columnName, &dataType, &isNullable, &columnDefault, &isPrimaryKey); err != nil {
+			return nil, nil, err
+		}
+
+		key := schemaName + "." + tableName
+		if _, exists := tableMap[key]; !exists {
+			tableMap[key] = &TableInfo{
+				TableName: tableName,
+				Schema:    schemaName,
+				Columns:   []ColumnInfo{},
+			}
+		}
+
+		column := ColumnInfo{
+			ColumnName:   columnName,
+			DataType:     dataType,
+			IsNullable:   isNullable == "YES",
+			IsPrimaryKey: isPrimaryKey == "PRIMARY KEY",
+		}
+
+		if columnDefault.Valid {
+			column.ColumnDefault = &columnDefault.String
+		}
+
+		tableMap[key].Columns = append(tableMap[key].Columns, column)
+	}
+
+	// Convert map to slice
+	tables := make([]TableInfo, 0, len(tableMap))
+	for _, table := range tableMap {
+		tables = append(tables, *table)
+	}
+
+	return tables, schemas, nil
+}
+
+// DescribeTable fetches detailed information for a specific table
+func (d postgresDriver) DescribeTable(db *sql.DB, tableName string) (*TableInfo, error) {
+	query := `
+		SELECT
+			c.table_name,
+			c.column_name,
+			c.data_type,
+			c.is_nullable,
+			c.column_default,
+			COALESCE(pk.constraint_type, '') as is_primary_key
+		FROM information_schema.columns c
+		LEFT JOIN (
+			SELECT ku.table_name, ku.column_name, tc.constraint_type
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage ku ON tc.constraint_name = ku.constraint_name
+			WHERE tc.constraint_type = 'PRIMARY KEY'
+		) pk ON c.table_name = pk.table_name AND c.column_name = pk.column_name
+		WHERE c.table_name = $1
+			AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY c.ordinal_position
+	`
+
+	rows, err := db.Query(query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tableInfo := &TableInfo{
+		TableName: tableName,
+		Schema:    "public",
+		Columns:   []ColumnInfo{},
+	}
+
+	for rows.Next() {
+		var name, dataType, isNullable, isPrimaryKey string
+		var columnDefault sql.NullString
+		if err := rows.Scan(&name, &dataType, &isNullable, &columnDefault, &isPrimaryKey); err != nil {
+			return nil, err
+		}
+
+		column := ColumnInfo{
+			ColumnName:   name,
+			DataType:     dataType,
+			IsNullable:   isNullable == "YES",
+			IsPrimaryKey: isPrimaryKey == "PRIMARY KEY",
+		}
+
+		if columnDefault.Valid {
+			column.ColumnDefault = &columnDefault.String
+		}
+
+		tableInfo.Columns = append(tableInfo.Columns, column)
+	}
+
+	return tableInfo, nil
+}
+
+// listSchemas returns all non-system schemas
+func (d postgresDriver) listSchemas(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT schema_name
+		FROM information_schema.schemata
+		WHERE schema_name NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+		ORDER BY schema_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+// TestAuditCapability tests DDL permissions on PostgreSQL
+func (d postgresDriver) TestAuditCapability(db *gorm.DB) models.AuditCapability {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return models.AuditCapabilityCountOnly
+	}
+	defer tx.Rollback()
+
+	// Test creating a temp table
+	err := tx.Exec(`CREATE TEMP TABLE _qb_audit_test (id SERIAL, data TEXT)`).Error
+	if err != nil {
+		return models.AuditCapabilityCountOnly
+	}
+
+	// Test creating a function (needed for triggers in PostgreSQL)
+	err = tx.Exec(`
+		CREATE OR REPLACE FUNCTION _qb_audit_test_fn() RETURNS TRIGGER AS $$
+		BEGIN
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql
+	`).Error
+	if err != nil {
+		return models.AuditCapabilityCountOnly
+	}
+
+	// Clean up the function
+	tx.Exec(`DROP FUNCTION IF EXISTS _qb_audit_test_fn()`)
+
+	return models.AuditCapabilityFull
+}
+
+// CaptureAudit uses PostgreSQL triggers to capture audit data
+func (d postgresDriver) CaptureAudit(tx *gorm.DB, queryText, tableName string, sampleLimit int) (*AuditResult, error) {
+	// Step 1: Create temp audit table and clear any stale data from prior runs
+	// in the same session (IF NOT EXISTS means it may already exist and hold old rows).
+	err := tx.Exec(`
+		CREATE TEMP TABLE IF NOT EXISTS _qb_audit_log (
+			_qb_seq SERIAL,
+			_qb_action VARCHAR(10),
+			_qb_data JSONB
+		)
+	`).Error
+	if err != nil {
+		// Fallback to count-only
+		return nil, ErrAuditUnavailable
+	}
+	// Always truncate to clear any rows from a prior run in this session.
+	tx.Exec(`DELETE FROM _qb_audit_log`)
+
+	// Step 2: Create the audit trigger function
+	fnName := "_qb_audit_fn_" + strings.ReplaceAll(tableName, ".", "_")
+	triggerBefore := "_qb_trg_before_" + strings.ReplaceAll(tableName, ".", "_")
+	triggerAfter := "_qb_trg_after_" + strings.ReplaceAll(tableName, ".", "_")
+
+	createFnSQL := fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION %s() RETURNS TRIGGER AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				INSERT INTO _qb_audit_log (_qb_action, _qb_data)
+				VALUES ('DELETE', to_jsonb(OLD));
+				RETURN OLD;
+			ELSIF TG_OP = 'UPDATE' THEN
+				IF TG_WHEN = 'BEFORE' THEN
+					INSERT INTO _qb_audit_log (_qb_action, _qb_data)
+					VALUES ('BEFORE_UPD', to_jsonb(OLD));
+				ELSE
+					INSERT INTO _qb_audit_log (_qb_action, _qb_data)
+					VALUES ('AFTER_UPD', to_jsonb(NEW));
+				END IF;
+				RETURN NEW;
+			ELSIF TG_OP = 'INSERT' THEN
+				INSERT INTO _qb_audit_log (_qb_action, _qb_data)
+				VALUES ('INSERT', to_jsonb(NEW));
+				RETURN NEW;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql
+	`, fnName)
+
+	err = tx.Exec(createFnSQL).Error
+	if err != nil {
+		return nil, ErrAuditUnavailable
+	}
+
+	// Step 3: Create triggers on the target table
+	// BEFORE trigger for UPDATE (captures OLD state) and DELETE
+	err = tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER %s
+		BEFORE UPDATE OR DELETE ON %s
+		FOR EACH ROW EXECUTE FUNCTION %s()
+	`, triggerBefore, tableName, fnName)).Error
+	if err != nil {
+		tx.Exec(fmt.Sprintf("DROP FUNCTION IF EXISTS %s()", fnName))
+		return nil, ErrAuditUnavailable
+	}
+
+	// AFTER trigger for UPDATE (captures NEW state) and INSERT
+	err = tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER %s
+		AFTER UPDATE OR INSERT ON %s
+		FOR EACH ROW EXECUTE FUNCTION %s()
+	`, triggerAfter, tableName, fnName)).Error
+	if err != nil {
+		tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", triggerBefore, tableName))
+		tx.Exec(fmt.Sprintf("DROP FUNCTION IF EXISTS %s()", fnName))
+		return nil, ErrAuditUnavailable
+	}
+
+	// Step 4: Execute the user's query
+	execResult := tx.Exec(queryText)
+	if execResult.Error != nil {
+		// Cleanup triggers before returning error
+		d.cleanupTriggers(tx, tableName, triggerBefore, triggerAfter, fnName)
+		return nil, fmt.Errorf("query execution failed: %w", execResult.Error)
+	}
+
+	// Step 5: Read audit log
+	beforeData, afterData, err := readPostgreSQLAuditLog(tx, sampleLimit)
+
+	// Step 6: Cleanup triggers
+	d.cleanupTriggers(tx, tableName, triggerBefore, triggerAfter, fnName)
+
+	if err != nil {
+		return &AuditResult{
+			AffectedRows: int(execResult.RowsAffected),
+			AuditMode:    models.AuditModeCountOnly,
+		}, nil
+	}
+
+	mode := models.AuditModeFull
+	if sampleLimit > 0 {
+		mode = models.AuditModeSample
+	}
+
+	return &AuditResult{
+		AffectedRows: int(execResult.RowsAffected),
+		BeforeData:   beforeData,
+		AfterData:    afterData,
+		AuditMode:    mode,
+	}, nil
+}
+
+// readPostgreSQLAuditLog reads captured data from the audit temp table
+func readPostgreSQLAuditLog(tx *gorm.DB, sampleLimit int) ([]map[string]interface{}, []map[string]interface{}, error) {
+	var beforeData, afterData []map[string]interface{}
+
+	// Build the query with optional limit
+	query := `SELECT _qb_action, _qb_data FROM _qb_audit_log ORDER BY _qb_seq`
+	if sampleLimit > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, sampleLimit*2) // *2 to account for before+after pairs
+	}
+
+	rows, err := tx.Raw(query).Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action string
+		var dataJSON []byte
+		if err := rows.Scan(&action, &dataJSON); err != nil {
+			continue
+		}
+
+		var rowData map[string]interface{}
+		if err := json.Unmarshal(dataJSON, &rowData); err != nil {
+			continue
+		}
+
+		switch action {
+		case "DELETE", "BEFORE_UPD":
+			beforeData = append(beforeData, rowData)
+		case "INSERT", "AFTER_UPD":
+			afterData = append(afterData, rowData)
+		}
+	}
+
+	return beforeData, afterData, nil
+}
+
+// cleanupTriggers removes audit triggers and function
+func (d postgresDriver) cleanupTriggers(tx *gorm.DB, tableName, triggerBefore, triggerAfter, fnName string) {
+	tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", triggerAfter, tableName))
+	tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", triggerBefore, tableName))
+	tx.Exec(fmt.Sprintf("DROP FUNCTION IF EXISTS %s()", fnName))
+	tx.Exec("DROP TABLE IF EXISTS _qb_audit_log")
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterDataSourceDriver(sqliteDriver{})
+}
+
+// sqliteDriver is the driver of SQLite data sources, which are database files on the server
+type sqliteDriver struct {
+	standardSQL
+}
+
+// Type returns the SQLite data source type
+func (sqliteDriver) Type() models.DataSourceType {
+	return models.DataSourceTypeSQLite
+}
+
+// Open opens the database file through mattn/go-sqlite3; SQLite has no credentials
+func (sqliteDriver) Open(dataSource *models.DataSource, _ *ConnectionCredentials, sessionInit []string) (*gorm.DB, error) {
+	filePath, err := NormalizeSQLitePath(dataSource.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := openSessionDB(&sqlite3.SQLiteDriver{}, sqliteDSN(filePath), sessionInit)
+	if err != nil {
+		return nil, err
+	}
+	return openGorm(sqlite.New(sqlite.Config{Conn: sqlDB}), sqlDB)
+}
+
+// ServerVersion returns the version of the SQLite library, as there is no server
+func (sqliteDriver) ServerVersion(db *gorm.DB) (string, error) {
+	var version string
+	if err := db.Raw("SELECT sqlite_version()").Row().Scan(&version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// ParseSQL validates a query with the generic parser, as there is no SQLite parser
+func (sqliteDriver) ParseSQL(sqlText string) (*SQLParseResult, error) {
+	return parseGeneric(sqlText)
+}
+
+// ListTables fetches the tables of the database file, which has no schemas besides "main"
+func (d sqliteDriver) ListTables(db *sql.DB) ([]TableInfo, []string, error) {
+	tables, err := d.listTables(db)
+	return tables, nil, err
+}
+
+// SearchTables searches the user tables of the database file
+func (d sqliteDriver) SearchTables(db *sql.DB, pattern string) ([]string, error) {
+	return d.tableNames(db, pattern)
+}
+
+// TableExists looks a table or view up in sqlite_master
+func (sqliteDriver) TableExists(db *gorm.DB, tableName string) bool {
+	var count int64
+	err := db.Raw(`
+		SELECT COUNT(*)
+		FROM sqlite_master
+		WHERE type IN ('table', 'view')
+		AND LOWER(name) = ?
+	`, strings.ToLower(tableName)).Scan(&count).Error
+	return err == nil && count > 0
+}
+
+// ExplainStatement returns EXPLAIN QUERY PLAN. Plain EXPLAIN lists SQLite's bytecode, and
+// the query plan is what users want to read.
+func (sqliteDriver) ExplainStatement(analyze bool) (string, error) {
+	if analyze {
+		return "", fmt.Errorf("EXPLAIN ANALYZE is not supported on SQLite")
+	}
+	return "EXPLAIN QUERY PLAN", nil
+}
+
+// SessionID returns 0: SQLite runs in process, so there is no server session to cancel
+func (sqliteDriver) SessionID(conn *gorm.DB) (int64, error) {
+	return 0, nil
+}
+
+// StatementTimeout returns no statements; SQLite has no statement timeout
+func (sqliteDriver) StatementTimeout(timeout time.Duration) (string, string) {
+	return "", ""
+}
+
+// CancelStatement does nothing: a SQLite statement is interrupted when its context is cancelled
+func (sqliteDriver) CancelStatement(ctx context.Context, db *gorm.DB, sessionID int64) error {
+	return nil
+}
+
+// listTables fetches the tables of a SQLite database
+func (d sqliteDriver) listTables(db *sql.DB) ([]TableInfo, error) {
+	names, err := d.tableNames(db, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]TableInfo, 0, len(names))
+	for _, name := range names {
+		tableInfo, err := d.DescribeTable(db, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, *tableInfo)
+	}
+
+	return tables, nil
+}
+
+// tableNames lists the user tables of a SQLite database, optionally filtered by a LIKE pattern.
+// Internal sqlite_* tables are left out.
+func (d sqliteDriver) tableNames(db *sql.DB, pattern string) ([]string, error) {
+	query := `
+		SELECT name
+		FROM sqlite_master
+		WHERE type = 'table'
+			AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+			AND (? = '' OR LOWER(name) LIKE ?)
+		ORDER BY name
+	`
+
+	rows, err := db.Query(query, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// DescribeTable fetches detailed information for a specific table in SQLite
+func (d sqliteDriver) DescribeTable(db *sql.DB, tableName string) (*TableInfo, error) {
+	rows, err := db.Query(`SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tableInfo := &TableInfo{
+		TableName: tableName,
+		Schema:    "main",
+		Columns:   []ColumnInfo{},
+	}
+
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, dataType string
+		var columnDefault sql.NullString
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &columnDefault, &primaryKey); err != nil {
+			return nil, err
+		}
+
+		column := ColumnInfo{
+			ColumnName:   name,
+			DataType:     dataType,
+			IsNullable:   notNull == 0,
+			IsPrimaryKey: primaryKey > 0, // position in the primary key, 0 for other columns
+		}
+
+		if columnDefault.Valid {
+			column.ColumnDefault = &columnDefault.String
+		}
+
+		tableInfo.Columns = append(tableInfo.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// pragma_table_info returns no rows for a table that doesn't exist
+	if len(tableInfo.Columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", tableName)
+	}
+
+	return tableInfo, nil
+}
+
+// TestAuditCapability tests trigger support on SQLite. Audit uses TEMP triggers, which any
+// connection may create, and json_object, which needs SQLite's JSON functions.
+func (d sqliteDriver) TestAuditCapability(db *gorm.DB) models.AuditCapability {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return models.AuditCapabilityCountOnly
+	}
+	defer tx.Rollback()
+
+	err := tx.Exec(`CREATE TEMP TABLE _qb_audit_test (id INTEGER PRIMARY KEY, data TEXT)`).Error
+	if err != nil {
+		return models.AuditCapabilityCountOnly
+	}
+
+	err = tx.Exec(`
+		CREATE TEMP TRIGGER _qb_audit_test_trg AFTER INSERT ON _qb_audit_test
+		FOR EACH ROW BEGIN
+			UPDATE _qb_audit_test SET data = json_object('id', NEW.id) WHERE id = NEW.id;
+		END
+	`).Error
+	if err != nil {
+		return models.AuditCapabilityCountOnly
+	}
+
+	if err := tx.Exec(`INSERT INTO _qb_audit_test (id) VALUES (1)`).Error; err != nil {
+		return models.AuditCapabilityCountOnly
+	}
+
+	return models.AuditCapabilityFull
+}
+
+// CaptureAudit uses SQLite TEMP triggers to capture audit data. TEMP triggers only exist
+// on the current connection, so the schema of the database file is never changed.
+func (d sqliteDriver) CaptureAudit(tx *gorm.DB, queryText, tableName string, sampleLimit int) (*AuditResult, error) {
+	// Step 1: Create the temp audit table, which has the layout of the PostgreSQL one
+	err := tx.Exec(`
+		CREATE TEMP TABLE IF NOT EXISTS _qb_audit_log (
+			_qb_seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			_qb_action TEXT,
+			_qb_data TEXT
+		)
+	`).Error
+	if err != nil {
+		return nil, ErrAuditUnavailable
+	}
+	tx.Exec(`DELETE FROM _qb_audit_log`)
+
+	// Step 2: Get columns for the target table to build json_object
+	columnList, err := d.columnList(tx, tableName)
+	if err != nil {
+		tx.Exec("DROP TABLE IF EXISTS temp._qb_audit_log")
+		return nil, ErrAuditUnavailable
+	}
+
+	// Step 3: Create triggers
+	safeName := strings.ReplaceAll(tableName, ".", "_")
+	triggers := []struct {
+		name, timing, action, row string
+	}{
+		{"_qb_trg_before_del_" + safeName, "BEFORE DELETE", "DELETE", "OLD"},
+		{"_qb_trg_before_upd_" + safeName, "BEFORE UPDATE", "BEFORE_UPD", "OLD"},
+		{"_qb_trg_after_upd_" + safeName, "AFTER UPDATE", "AFTER_UPD", "NEW"},
+		{"_qb_trg_after_ins_" + safeName, "AFTER INSERT", "INSERT", "NEW"},
+	}
+	triggerNames := make([]string, 0, len(triggers))
+	for _, trigger := range triggers {
+		triggerNames = append(triggerNames, trigger.name)
+		tx.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS temp.%s`, trigger.name))
+		err = tx.Exec(fmt.Sprintf(`
+			CREATE TEMP TRIGGER %s %s ON %s
+			FOR EACH ROW BEGIN
+				INSERT INTO _qb_audit_log (_qb_action, _qb_data) VALUES ('%s', %s);
+			END
+		`, trigger.name, trigger.timing, tableName, trigger.action, d.jsonObject(trigger.row, columnList))).Error
+		if err != nil {
+			d.cleanupTriggers(tx, triggerNames...)
+			return nil, ErrAuditUnavailable
+		}
+	}
+
+	// Step 4: Execute the user's query
+	execResult := tx.Exec(queryText)
+	if execResult.Error != nil {
+		d.cleanupTriggers(tx, triggerNames...)
+		return nil, fmt.Errorf("query execution failed: %w", execResult.Error)
+	}
+
+	// Step 5: Read audit log
+	beforeData, afterData, err := readPostgreSQLAuditLog(tx, sampleLimit)
+
+	// Step 6: Cleanup
+	d.cleanupTriggers(tx, triggerNames...)
+
+	if err != nil {
+		return &AuditResult{
+			AffectedRows: int(execResult.RowsAffected),
+			AuditMode:    models.AuditModeCountOnly,
+		}, nil
+	}
+
+	mode := models.AuditModeFull
+	if sampleLimit > 0 {
+		mode = models.AuditModeSample
+	}
+
+	return &AuditResult{
+		AffectedRows: int(execResult.RowsAffected),
+		BeforeData:   beforeData,
+		AfterData:    afterData,
+		AuditMode:    mode,
+	}, nil
+}
+
+// columnList retrieves column names for building json_object
+func (d sqliteDriver) columnList(tx *gorm.DB, tableName string) ([]string, error) {
+	schemaName := "main"
+	name := strings.ReplaceAll(tableName, `"`, "")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		schemaName, name = name[:i], name[i+1:]
+	}
+
+	var columns []string
+	rows, err := tx.Raw(`SELECT name FROM pragma_table_info(?, ?) ORDER BY cid`, name, schemaName).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			continue
+		}
+		columns = append(columns, col)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns found for table %s", tableName)
+	}
+
+	return columns, nil
+}
+
+// jsonObject builds a json_object expression for SQLite triggers. Any SQLite column
+// can hold a BLOB, which JSON can't, so BLOB values are captured as hex strings.
+func (d sqliteDriver) jsonObject(prefix string, columns []string) string {
+	var parts []string
+	for _, col := range columns {
+		value := prefix + "." + d.QuoteIdentifier(col)
+		parts = append(parts, fmt.Sprintf("'%s', CASE WHEN typeof(%s) = 'blob' THEN hex(%s) ELSE %s END",
+			strings.ReplaceAll(col, "'", "''"), value, value, value))
+	}
+	return fmt.Sprintf("json_object(%s)", strings.Join(parts, ", "))
+}
+
+// cleanupTriggers removes the audit triggers and the temp audit table
+func (d sqliteDriver) cleanupTriggers(tx *gorm.DB, triggers ...string) {
+	for _, trigger := range triggers {
+		tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS temp.%s", trigger))
+	}
+	tx.Exec("DROP TABLE IF EXISTS temp._qb_audit_log")
+}
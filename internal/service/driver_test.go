@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestLookupDataSourceDriver(t *testing.T) {
+	for _, dsType := range []models.DataSourceType{models.DataSourceTypePostgreSQL, models.DataSourceTypeMySQL, models.DataSourceTypeSQLite} {
+		driver, err := LookupDataSourceDriver(dsType)
+		require.NoError(t, err)
+		assert.Equal(t, dsType, driver.Type())
+	}
+	assert.Equal(t, []models.DataSourceType{models.DataSourceTypeMySQL, models.DataSourceTypePostgreSQL, models.DataSourceTypeSQLite}, DataSourceTypes())
+
+	_, err := LookupDataSourceDriver("oracle")
+	assert.ErrorIs(t, err, ErrUnsupportedDataSourceType)
+	assert.EqualError(t, err, "unsupported data source type: oracle")
+
+	// A type can only have one driver
+	assert.Panics(t, func() { RegisterDataSourceDriver(postgresDriver{}) })
+}
+
+func TestDataSourceDrivers_Dialects(t *testing.T) {
+	postgres, _ := LookupDataSourceDriver(models.DataSourceTypePostgreSQL)
+	mysql, _ := LookupDataSourceDriver(models.DataSourceTypeMySQL)
+	sqlite, _ := LookupDataSourceDriver(models.DataSourceTypeSQLite)
+
+	assert.Equal(t, `"order ""items"""`, postgres.QuoteIdentifier(`order "items"`))
+	assert.Equal(t, "`order ``items```", mysql.QuoteIdentifier("order `items`"))
+	assert.Equal(t, `'C:\temp''s'`, sqlite.QuoteString(`C:\temp's`))
+	assert.Equal(t, `'C:\\temp''s'`, mysql.QuoteString(`C:\temp's`))
+
+	placeholder, numbered := postgres.Placeholder(2)
+	assert.Equal(t, "$2", placeholder)
+	assert.True(t, numbered)
+	placeholder, numbered = mysql.Placeholder(2)
+	assert.Equal(t, "?", placeholder)
+	assert.False(t, numbered)
+
+	set, reset := postgres.StatementTimeout(1500 * time.Millisecond)
+	assert.Equal(t, "SET statement_timeout = 1500", set)
+	assert.Equal(t, "RESET statement_timeout", reset)
+	set, reset = mysql.StatementTimeout(0)
+	assert.Empty(t, set)
+	assert.Empty(t, reset)
+
+	// SQLite's plan has no ANALYZE form and no cost estimates
+	explain, err := sqlite.ExplainStatement(false)
+	require.NoError(t, err)
+	assert.Equal(t, "EXPLAIN QUERY PLAN", explain)
+	_, err = sqlite.ExplainStatement(true)
+	assert.Error(t, err)
+	_, ok := sqlite.(CostEstimator)
+	assert.False(t, ok)
+	_, ok = mysql.(CostEstimator)
+	assert.True(t, ok)
+
+	count, err := postgres.CountQuery("DELETE FROM orders WHERE id = 1")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM orders WHERE id = 1", count)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+var (
+	// ErrInvalidEnvironment is returned for an environment name that can't be used
+	ErrInvalidEnvironment = errors.New("invalid environment")
+
+	// ErrApprovalRequired is returned when a query would run without the approval the environment
+	// policy of its data source requires
+	ErrApprovalRequired = errors.New("the environment policy of this data source requires approval")
+)
+
+// environmentName matches the names of data source environments
+var environmentName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// EnvironmentPolicy holds the rules queries on the data sources of an environment follow
+type EnvironmentPolicy struct {
+	// RequiredApprovals is how many approvals a request needs; 0 runs writes without approval
+	RequiredApprovals int
+	// SelectRequiresApproval sends SELECTs to approval like writes
+	SelectRequiresApproval bool
+	// MaxRows caps SELECT results on top of the data source and role limits (0 = unlimited)
+	MaxRows int
+	// AllowAdminDirectExecution lets admins run any query without approval
+	AllowAdminDirectExecution bool
+}
+
+// fallbackEnvironmentPolicy applies when neither the environment of a data source nor prod
+// has a policy: every write needs one approval, as before environments existed
+var fallbackEnvironmentPolicy = EnvironmentPolicy{RequiredApprovals: 1}
+
+// RequiresApproval reports whether a user with the role must get an operation approved
+func (p EnvironmentPolicy) RequiresApproval(operationType models.OperationType, role models.UserRole) bool {
+	if role == models.RoleAdmin && p.AllowAdminDirectExecution {
+		return false
+	}
+	if operationType == models.OperationSelect {
+		return p.SelectRequiresApproval
+	}
+	return RequiresApproval(operationType) && p.RequiredApprovals > 0
+}
+
+// ApprovalsNeeded returns how many approvals a request needs before it is approved
+func (p EnvironmentPolicy) ApprovalsNeeded() int {
+	// A request only exists when something required approval, so it takes at least one
+	if p.RequiredApprovals < 1 {
+		return 1
+	}
+	return p.RequiredApprovals
+}
+
+// NormalizeEnvironment checks an environment name; an empty name is prod
+func NormalizeEnvironment(environment string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(environment))
+	if name == "" {
+		return models.EnvironmentProd, nil
+	}
+	if !environmentName.MatchString(name) {
+		return "", fmt.Errorf("%w: %q must be up to 32 lowercase letters, digits, '_' and '-'", ErrInvalidEnvironment, environment)
+	}
+	return name, nil
+}
+
+// SetEnvironmentPolicies configures the policy of each data source environment
+func (s *QueryService) SetEnvironmentPolicies(environments map[string]config.EnvironmentPolicyConfig) {
+	policies := make(map[string]EnvironmentPolicy, len(environments))
+	for name, policy := range environments {
+		policies[strings.ToLower(name)] = EnvironmentPolicy{
+			RequiredApprovals:         policy.RequiredApprovals,
+			SelectRequiresApproval:    policy.SelectRequiresApproval,
+			MaxRows:                   policy.MaxRows,
+			AllowAdminDirectExecution: policy.AllowAdminDirectExecution,
+		}
+	}
+	s.environmentPolicies = policies
+}
+
+// EnvironmentPolicy returns the policy of an environment. Custom environments without a
+// policy of their own follow the prod policy.
+func (s *QueryService) EnvironmentPolicy(environment string) EnvironmentPolicy {
+	if policy, ok := s.environmentPolicies[environment]; ok {
+		return policy
+	}
+	if policy, ok := s.environmentPolicies[models.EnvironmentProd]; ok {
+		return policy
+	}
+	return fallbackEnvironmentPolicy
+}
+
+// ApprovalRequired reports whether the environment policy of a data source sends an operation
+// of a user to approval
+func (s *QueryService) ApprovalRequired(userID uuid.UUID, dataSource *models.DataSource, operationType models.OperationType) bool {
+	// A user whose role can't be read gets no admin exemption
+	var user models.User
+	s.db.Select("role").First(&user, "id = ?", userID)
+
+	return s.EnvironmentPolicy(dataSource.Environment).RequiresApproval(operationType, user.Role)
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// testEnvironments are environment policies with a stricter prod than the defaults
+var testEnvironments = map[string]config.EnvironmentPolicyConfig{
+	"dev":     {RequiredApprovals: 0, AllowAdminDirectExecution: true},
+	"staging": {RequiredApprovals: 1, AllowAdminDirectExecution: true},
+	"prod":    {RequiredApprovals: 2, SelectRequiresApproval: true, MaxRows: 500},
+}
+
+func TestNormalizeEnvironment(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":          models.EnvironmentProd,
+		" Staging ": models.EnvironmentStaging,
+		"qa-eu_1":   "qa-eu_1",
+	} {
+		environment, err := NormalizeEnvironment(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, environment)
+	}
+
+	for _, input := range []string{"-dev", "pre prod", "prod!", "an-environment-name-over-32-chars"} {
+		_, err := NormalizeEnvironment(input)
+		assert.ErrorIs(t, err, ErrInvalidEnvironment, input)
+	}
+}
+
+func TestEnvironmentPolicy_RequiresApproval(t *testing.T) {
+	service := NewQueryService(setupTestDB(t), NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+
+	// Without policies every write needs one approval, as before environments
+	policy := service.EnvironmentPolicy(models.EnvironmentDev)
+	assert.True(t, policy.RequiresApproval(models.OperationUpdate, models.RoleAdmin))
+	assert.False(t, policy.RequiresApproval(models.OperationSelect, models.RoleUser))
+	assert.Equal(t, 1, policy.ApprovalsNeeded())
+
+	service.SetEnvironmentPolicies(testEnvironments)
+
+	dev := service.EnvironmentPolicy(models.EnvironmentDev)
+	assert.False(t, dev.RequiresApproval(models.OperationDelete, models.RoleUser))
+	assert.Equal(t, 1, dev.ApprovalsNeeded())
+
+	staging := service.EnvironmentPolicy(models.EnvironmentStaging)
+	assert.True(t, staging.RequiresApproval(models.OperationInsert, models.RoleUser))
+	assert.False(t, staging.RequiresApproval(models.OperationInsert, models.RoleAdmin))
+	assert.False(t, staging.RequiresApproval(models.OperationSet, models.RoleUser))
+
+	prod := service.EnvironmentPolicy(models.EnvironmentProd)
+	assert.True(t, prod.RequiresApproval(models.OperationSelect, models.RoleUser))
+	assert.True(t, prod.RequiresApproval(models.OperationUpdate, models.RoleAdmin))
+	assert.Equal(t, 2, prod.ApprovalsNeeded())
+
+	// Custom environments without a policy follow prod
+	assert.Equal(t, prod, service.EnvironmentPolicy("qa"))
+}
+
+func TestQueryService_ApprovalRequiredAndLimits(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	service.SetEnvironmentPolicies(testEnvironments)
+	admin := createTestUser(t, db, models.RoleAdmin)
+	user := createTestUser(t, db, models.RoleUser)
+
+	dataSource := createTestDataSource(t, db)
+	assert.Equal(t, models.EnvironmentProd, dataSource.Environment, "data sources are prod by default")
+	assert.True(t, service.ApprovalRequired(admin.ID, dataSource, models.OperationUpdate))
+	assert.True(t, service.ApprovalRequired(user.ID, dataSource, models.OperationSelect))
+	assert.Equal(t, 500, service.resultLimitsFor(user.ID, dataSource).MaxRows)
+
+	dataSource.Environment = models.EnvironmentStaging
+	assert.False(t, service.ApprovalRequired(admin.ID, dataSource, models.OperationUpdate))
+	assert.True(t, service.ApprovalRequired(user.ID, dataSource, models.OperationUpdate))
+	assert.False(t, service.ApprovalRequired(uuid.New(), dataSource, models.OperationSelect))
+	assert.Equal(t, dataSource.MaxResultRows, service.resultLimitsFor(user.ID, dataSource).MaxRows)
+}
+
+func TestQueryService_EnvironmentPolicyAppliesToReRuns(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	service.SetEnvironmentPolicies(testEnvironments)
+	admin := createTestUser(t, db, models.RoleAdmin)
+	dataSource := createSQLiteDataSource(t, db)
+	ctx := context.Background()
+
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  dataSource.ID,
+		UserID:        admin.ID,
+		QueryText:     "SELECT id, status FROM orders",
+		OperationType: models.OperationSelect,
+		Status:        models.StatusCompleted,
+	}
+	require.NoError(t, db.Create(query).Error)
+
+	// prod sends SELECTs to approval, so they can't run, stream or page directly
+	_, err := service.ExecuteQuery(ctx, query, dataSource)
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	_, err = service.StreamExportQuery(ctx, admin.ID, query, dataSource, "csv", io.Discard)
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	_, _, err = service.GetPaginatedResultsFromDataSource(ctx, admin.ID, query, dataSource, 1, 10, "", "asc")
+	assert.ErrorIs(t, err, ErrCannotPaginateOnDataSource)
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+
+	// Pages stop at the row limit of the environment
+	service.SetEnvironmentPolicies(map[string]config.EnvironmentPolicyConfig{"prod": {MaxRows: 1}})
+	set, meta, err := service.GetPaginatedResultsFromDataSource(ctx, admin.ID, query, dataSource, 2, 10, "", "asc")
+	require.NoError(t, err)
+	assert.Equal(t, 1, meta.TotalRows)
+	assert.Equal(t, 1, meta.Page)
+	assert.Len(t, set.Rows, 1)
+}
+
+func TestApprovalService_RequiredApprovalsOfEnvironment(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	queryService.SetEnvironmentPolicies(testEnvironments)
+	approvalService := NewApprovalService(db, queryService, nil)
+
+	requester := createTestUser(t, db, models.RoleUser)
+	firstReviewer := createTestUser(t, db, models.RoleAdmin)
+	secondReviewer := createTestUser(t, db, models.RoleAdmin)
+	dataSource := createTestDataSource(t, db)
+
+	request := func() *models.ApprovalRequest {
+		approval := &models.ApprovalRequest{
+			ID:            uuid.New(),
+			DataSourceID:  dataSource.ID,
+			QueryText:     "DELETE FROM sessions WHERE expired",
+			RequestedBy:   requester.ID,
+			Status:        models.ApprovalStatusPending,
+			OperationType: models.OperationDelete,
+		}
+		require.NoError(t, db.Create(approval).Error)
+		return approval
+	}
+	review := func(approval *models.ApprovalRequest, reviewer *models.User) models.ApprovalStatus {
+		_, err := approvalService.ReviewApproval(context.Background(), &ReviewInput{
+			ApprovalID: approval.ID,
+			ReviewerID: reviewer.ID.String(),
+			Decision:   models.ApprovalDecisionApproved,
+		})
+		require.NoError(t, err)
+		var stored models.ApprovalRequest
+		require.NoError(t, db.First(&stored, "id = ?", approval.ID).Error)
+		return stored.Status
+	}
+
+	// prod takes two approvals
+	approval := request()
+	assert.Equal(t, models.ApprovalStatusPending, review(approval, firstReviewer))
+	assert.Equal(t, models.ApprovalStatusApproved, review(approval, secondReviewer))
+
+	// staging takes one
+	require.NoError(t, db.Model(dataSource).Update("environment", models.EnvironmentStaging).Error)
+	assert.Equal(t, models.ApprovalStatusApproved, review(request(), firstReviewer))
+}
+
+func TestApprovalService_ApprovedSelectRunsWithEnvironmentLimits(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	queryService.SetEnvironmentPolicies(map[string]config.EnvironmentPolicyConfig{
+		"prod": {RequiredApprovals: 1, SelectRequiresApproval: true, MaxRows: 1},
+	})
+	approvalService := NewApprovalService(db, queryService, nil)
+	requester := createTestUser(t, db, models.RoleAdmin)
+	reviewer := createTestUser(t, db, models.RoleAdmin)
+	dataSource := createSQLiteDataSource(t, db)
+	ctx := context.Background()
+
+	// A SELECT the policy sends to approval is the requester's pending query until it's approved
+	query := &models.Query{
+		ID:               uuid.New(),
+		DataSourceID:     dataSource.ID,
+		UserID:           requester.ID,
+		QueryText:        "SELECT id, status FROM orders ORDER BY id",
+		OperationType:    models.OperationSelect,
+		Status:           models.StatusPending,
+		RequiresApproval: true,
+	}
+	require.NoError(t, db.Create(query).Error)
+	approval := &models.ApprovalRequest{
+		ID:            uuid.New(),
+		QueryID:       &query.ID,
+		DataSourceID:  dataSource.ID,
+		QueryText:     query.QueryText,
+		RequestedBy:   requester.ID,
+		OperationType: models.OperationSelect,
+		Status:        models.ApprovalStatusPending,
+	}
+	require.NoError(t, db.Create(approval).Error)
+
+	_, err := approvalService.ReviewApproval(ctx, &ReviewInput{
+		ApprovalID: approval.ID,
+		ReviewerID: reviewer.ID.String(),
+		Decision:   models.ApprovalDecisionApproved,
+	})
+	require.NoError(t, err)
+
+	// The approval lets it past the policy, but not past the row limit of the environment
+	var executed models.Query
+	require.NoError(t, db.First(&executed, "id = ?", query.ID).Error)
+	assert.Equal(t, models.StatusCompleted, executed.Status, executed.ErrorMessage)
+	var result models.QueryResult
+	require.NoError(t, db.First(&result, "query_id = ?", query.ID).Error)
+	assert.Equal(t, 1, result.RowCount)
+	assert.Equal(t, ResultLimitMaxRows, result.TruncatedBy)
+
+	// Approving doesn't let the same SELECT run directly
+	_, err = queryService.ExecuteQuery(ctx, &models.Query{ID: uuid.New(), DataSourceID: dataSource.ID, UserID: requester.ID, QueryText: query.QueryText}, dataSource)
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+}
+
+func TestDataSourceService_Environment(t *testing.T) {
+	service := NewDataSourceService(setupTestDB(t), NewLegacyKeyring(sqliteTestEncryptionKey))
+	ctx := context.Background()
+	input := func(environment string) *CreateDataSourceInput {
+		return &CreateDataSourceInput{
+			Name: "warehouse", Type: string(models.DataSourceTypePostgreSQL), Host: "db.internal", Port: 5432,
+			DatabaseName: "app", Username: "querybase", Password: "secret", Environment: environment,
+		}
+	}
+
+	dataSource, err := service.CreateDataSource(ctx, input(""))
+	require.NoError(t, err)
+	assert.Equal(t, models.EnvironmentProd, dataSource.Environment)
+
+	_, err = service.CreateDataSource(ctx, input("pre prod"))
+	assert.ErrorIs(t, err, ErrInvalidEnvironment)
+
+	updated, err := service.UpdateDataSource(ctx, dataSource.ID.String(), &UpdateDataSourceInput{Environment: "Staging"})
+	require.NoError(t, err)
+	assert.Equal(t, models.EnvironmentStaging, updated.Environment)
+}
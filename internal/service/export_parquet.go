@@ -0,0 +1,420 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// parquetPageRows is the number of rows written per data page
+const parquetPageRows = 10000
+
+// Parquet physical types
+const (
+	parquetBoolean   int32 = 0
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Parquet converted types, -1 when a column has none
+const (
+	parquetConvertedNone            int32 = -1
+	parquetConvertedUTF8            int32 = 0
+	parquetConvertedDate            int32 = 6
+	parquetConvertedTimestampMillis int32 = 9
+)
+
+// Parquet enum values used by the writer
+const (
+	parquetRepetitionOptional int32 = 1
+	parquetEncodingPlain      int32 = 0
+	parquetEncodingRLE        int32 = 3
+	parquetCodecUncompressed  int32 = 0
+	parquetPageTypeData       int32 = 0
+)
+
+// parquetColumn is the schema and encoded values of one exported column
+type parquetColumn struct {
+	name          string
+	physicalType  int32
+	convertedType int32
+	values        []interface{} // nil for NULL, otherwise bool, int32, int64, float64 or string
+}
+
+// parquetExporter writes a Parquet file with one row group. Column types follow the source
+// column types: integers become INT64, floats DOUBLE, booleans BOOLEAN, dates DATE and
+// timestamps TIMESTAMP_MILLIS. Decimals and everything else are written as UTF-8 strings so
+// no precision is lost. A column falls back to strings when one of its values does not fit
+// its source type.
+type parquetExporter struct{}
+
+func (parquetExporter) ContentType() string   { return "application/vnd.apache.parquet" }
+func (parquetExporter) FileExtension() string { return "parquet" }
+
+func (parquetExporter) Export(w io.Writer, table *ExportTable) error {
+	columns := buildParquetColumns(table)
+
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+
+	// Write one column chunk per column, each split into pages
+	chunks := make([]*thriftCompactWriter, len(columns))
+	var totalBytes int64
+	for i, col := range columns {
+		chunkOffset := int64(file.Len())
+		for start := 0; start < len(col.values); start += parquetPageRows {
+			end := start + parquetPageRows
+			if end > len(col.values) {
+				end = len(col.values)
+			}
+			page, err := encodeParquetPage(col, col.values[start:end])
+			if err != nil {
+				return fmt.Errorf("failed to encode column %s: %w", col.name, err)
+			}
+
+			header := &thriftCompactWriter{}
+			header.structBegin()
+			header.i32Field(1, parquetPageTypeData)
+			header.i32Field(2, int32(len(page)))
+			header.i32Field(3, int32(len(page)))
+			header.fieldHeader(5, thriftTypeStruct)
+			header.structBegin()
+			header.i32Field(1, int32(end-start))
+			header.i32Field(2, parquetEncodingPlain)
+			header.i32Field(3, parquetEncodingRLE)
+			header.i32Field(4, parquetEncodingRLE)
+			header.structEnd()
+			header.structEnd()
+
+			file.Write(header.buf.Bytes())
+			file.Write(page)
+		}
+		chunkSize := int64(file.Len()) - chunkOffset
+		totalBytes += chunkSize
+
+		chunk := &thriftCompactWriter{}
+		chunk.structBegin()
+		chunk.i64Field(2, chunkOffset)
+		chunk.fieldHeader(3, thriftTypeStruct)
+		chunk.structBegin()
+		chunk.i32Field(1, col.physicalType)
+		chunk.listHeader(2, thriftTypeI32, 2)
+		chunk.i32(parquetEncodingPlain)
+		chunk.i32(parquetEncodingRLE)
+		chunk.listHeader(3, thriftTypeBinary, 1)
+		chunk.binary(col.name)
+		chunk.i32Field(4, parquetCodecUncompressed)
+		chunk.i64Field(5, int64(len(col.values)))
+		chunk.i64Field(6, chunkSize)
+		chunk.i64Field(7, chunkSize)
+		chunk.i64Field(9, chunkOffset)
+		chunk.structEnd()
+		chunk.structEnd()
+		chunks[i] = chunk
+	}
+
+	// File metadata
+	meta := &thriftCompactWriter{}
+	meta.structBegin()
+	meta.i32Field(1, 1)
+	meta.listHeader(2, thriftTypeStruct, len(columns)+1)
+	meta.structBegin()
+	meta.binaryField(4, "schema")
+	meta.i32Field(5, int32(len(columns)))
+	meta.structEnd()
+	for _, col := range columns {
+		meta.structBegin()
+		meta.i32Field(1, col.physicalType)
+		meta.i32Field(3, parquetRepetitionOptional)
+		meta.binaryField(4, col.name)
+		if col.convertedType != parquetConvertedNone {
+			meta.i32Field(6, col.convertedType)
+		}
+		meta.structEnd()
+	}
+	meta.i64Field(3, int64(len(table.Rows)))
+	if len(table.Rows) == 0 {
+		meta.listHeader(4, thriftTypeStruct, 0)
+	} else {
+		meta.listHeader(4, thriftTypeStruct, 1)
+		meta.structBegin()
+		meta.listHeader(1, thriftTypeStruct, len(chunks))
+		for _, chunk := range chunks {
+			meta.buf.Write(chunk.buf.Bytes())
+		}
+		meta.i64Field(2, totalBytes)
+		meta.i64Field(3, int64(len(table.Rows)))
+		meta.structEnd()
+	}
+	meta.binaryField(6, "querybase")
+	meta.structEnd()
+
+	file.Write(meta.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// buildParquetColumns maps the source column types to Parquet types and converts every value
+func buildParquetColumns(table *ExportTable) []*parquetColumn {
+	columns := make([]*parquetColumn, len(table.Columns))
+	seen := make(map[string]int, len(table.Columns))
+
+	for i, name := range table.Columns {
+		// Parquet column names must be unique, SELECT a.id, b.id is not
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+
+		col := &parquetColumn{name: name}
+		col.physicalType, col.convertedType = parquetTypeFor(table.columnType(i))
+		col.values = make([]interface{}, len(table.Rows))
+
+		for r, row := range table.Rows {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			val, ok := parquetValue(col, row[i])
+			if !ok {
+				col.physicalType, col.convertedType = parquetByteArray, parquetConvertedUTF8
+				break
+			}
+			col.values[r] = val
+		}
+
+		// Re-convert as strings when a value didn't fit the source type
+		if col.physicalType == parquetByteArray {
+			for r, row := range table.Rows {
+				col.values[r] = nil
+				if i < len(row) && row[i] != nil {
+					col.values[r] = exportCellString(row[i])
+				}
+			}
+		}
+
+		columns[i] = col
+	}
+
+	return columns
+}
+
+// parquetTypeFor returns the physical and converted Parquet types for a database type name
+func parquetTypeFor(columnType string) (int32, int32) {
+	switch {
+	case isIntegerColumnType(columnType):
+		return parquetInt64, parquetConvertedNone
+	case isFloatColumnType(columnType):
+		return parquetDouble, parquetConvertedNone
+	case isBoolColumnType(columnType):
+		return parquetBoolean, parquetConvertedNone
+	case isDateColumnType(columnType):
+		return parquetInt32, parquetConvertedDate
+	case isTimestampColumnType(columnType):
+		return parquetInt64, parquetConvertedTimestampMillis
+	default:
+		return parquetByteArray, parquetConvertedUTF8
+	}
+}
+
+// parquetValue converts a value to the Go type written for the column
+func parquetValue(col *parquetColumn, val interface{}) (interface{}, bool) {
+	switch col.physicalType {
+	case parquetBoolean:
+		return exportBool(val)
+
+	case parquetInt32:
+		t, ok := exportTime(val)
+		if !ok {
+			return nil, false
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return int32(day.Unix() / 86400), true
+
+	case parquetInt64:
+		if col.convertedType == parquetConvertedTimestampMillis {
+			t, ok := exportTime(val)
+			if !ok {
+				return nil, false
+			}
+			return t.UnixMilli(), true
+		}
+		num, ok := exportNumber(val)
+		if !ok {
+			return nil, false
+		}
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		return n, true
+
+	case parquetDouble:
+		num, ok := exportNumber(val)
+		if !ok {
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+
+	default:
+		return exportCellString(val), true
+	}
+}
+
+// encodeParquetPage encodes the definition levels and PLAIN values of a data page
+func encodeParquetPage(col *parquetColumn, values []interface{}) ([]byte, error) {
+	var page bytes.Buffer
+
+	// Definition levels: 1 for a value, 0 for NULL, bit-packed with a bit width of 1
+	levels := encodeParquetDefinitionLevels(values)
+	binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+	page.Write(levels)
+
+	var bits []bool
+	for _, val := range values {
+		if val == nil {
+			continue
+		}
+		switch v := val.(type) {
+		case bool:
+			bits = append(bits, v)
+		case int32:
+			binary.Write(&page, binary.LittleEndian, v)
+		case int64:
+			binary.Write(&page, binary.LittleEndian, v)
+		case float64:
+			binary.Write(&page, binary.LittleEndian, math.Float64bits(v))
+		case string:
+			binary.Write(&page, binary.LittleEndian, uint32(len(v)))
+			page.WriteString(v)
+		default:
+			return nil, fmt.Errorf("unexpected value type %T", val)
+		}
+	}
+	if col.physicalType == parquetBoolean {
+		page.Write(packParquetBits(bits))
+	}
+
+	return page.Bytes(), nil
+}
+
+// encodeParquetDefinitionLevels writes levels as a single bit-packed run of the RLE/bit-packing hybrid encoding
+func encodeParquetDefinitionLevels(values []interface{}) []byte {
+	defined := make([]bool, len(values))
+	for i, val := range values {
+		defined[i] = val != nil
+	}
+	packed := packParquetBits(defined)
+
+	var buf bytes.Buffer
+	header := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(len(packed))<<1|1)
+	buf.Write(header[:n])
+	buf.Write(packed)
+	return buf.Bytes()
+}
+
+// packParquetBits packs booleans eight to a byte, least significant bit first
+func packParquetBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	return packed
+}
+
+// Thrift compact protocol type ids
+const (
+	thriftTypeI32    byte = 5
+	thriftTypeI64    byte = 6
+	thriftTypeBinary byte = 8
+	thriftTypeStruct byte = 12
+)
+
+// thriftCompactWriter encodes the Thrift compact protocol structures used by Parquet metadata
+type thriftCompactWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+}
+
+func (t *thriftCompactWriter) structBegin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftCompactWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftCompactWriter) fieldHeader(id int16, fieldType byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftCompactWriter) listHeader(id int16, elemType byte, size int) {
+	t.fieldHeader(id, 9)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	t.buf.WriteByte(0xF0 | elemType)
+	t.uvarint(uint64(size))
+}
+
+func (t *thriftCompactWriter) i32Field(id int16, v int32) {
+	t.fieldHeader(id, thriftTypeI32)
+	t.i32(v)
+}
+
+func (t *thriftCompactWriter) i64Field(id int16, v int64) {
+	t.fieldHeader(id, thriftTypeI64)
+	t.varint(v)
+}
+
+func (t *thriftCompactWriter) binaryField(id int16, v string) {
+	t.fieldHeader(id, thriftTypeBinary)
+	t.binary(v)
+}
+
+func (t *thriftCompactWriter) i32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftCompactWriter) binary(v string) {
+	t.uvarint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+// varint writes a zigzag-encoded signed integer
+func (t *thriftCompactWriter) varint(v int64) {
+	t.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (t *thriftCompactWriter) uvarint(v uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	t.buf.Write(tmp[:n])
+}
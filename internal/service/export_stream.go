@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// exportFlushEvery controls how many rows are buffered before a chunk is flushed to the client
+const exportFlushEvery = 1000
+
+// StreamRowWriter writes exported rows to an output stream one at a time
+type StreamRowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	Flush() error
+}
+
+// NewStreamRowWriter creates a row writer for a streaming export format and returns its content type
+func NewStreamRowWriter(format string, w io.Writer) (StreamRowWriter, string, error) {
+	switch format {
+	case "csv":
+		return &csvStreamWriter{w: csv.NewWriter(w)}, "text/csv", nil
+	case "ndjson":
+		return &ndjsonStreamWriter{w: bufio.NewWriter(w)}, "application/x-ndjson", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported streaming export format: %s", format)
+	}
+}
+
+// csvStreamWriter writes rows as RFC 4180 CSV
+type csvStreamWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvStreamWriter) WriteHeader(columns []string) error {
+	return cw.w.Write(columns)
+}
+
+func (cw *csvStreamWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, val := range values {
+		record[i] = exportCellString(val)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvStreamWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ndjsonStreamWriter writes one JSON object per line, keeping the column order of the result set
+type ndjsonStreamWriter struct {
+	w       *bufio.Writer
+	columns [][]byte
+}
+
+func (nw *ndjsonStreamWriter) WriteHeader(columns []string) error {
+	// Duplicate column names would collapse into one key when the object is parsed
+	keys := ResultColumnKeys(columns)
+	nw.columns = make([][]byte, len(keys))
+	for i, col := range keys {
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		nw.columns[i] = key
+	}
+	return nil
+}
+
+func (nw *ndjsonStreamWriter) WriteRow(values []interface{}) error {
+	nw.w.WriteByte('{')
+	for i, val := range values {
+		if i > 0 {
+			nw.w.WriteByte(',')
+		}
+		nw.w.Write(nw.columns[i])
+		nw.w.WriteByte(':')
+
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("failed to encode column %s: %w", nw.columns[i], err)
+		}
+		nw.w.Write(encoded)
+	}
+	nw.w.WriteByte('}')
+	return nw.w.WriteByte('\n')
+}
+
+func (nw *ndjsonStreamWriter) Flush() error {
+	return nw.w.Flush()
+}
+
+// exportCellString formats a scanned value for text-based exports
+func exportCellString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// StreamExportQuery re-runs a SELECT query on its data source with the permissions of userID and
+// writes every row to w as it is read from the cursor. Nothing is written before the query has
+// started returning rows, so callers can still report earlier errors as a normal response.
+func (s *QueryService) StreamExportQuery(ctx context.Context, userID uuid.UUID, query *models.Query, dataSource *models.DataSource, format string, w io.Writer) (int, error) {
+	queryText := normalizeSQLForExecution(query.QueryText)
+	if DetectOperationType(queryText) != models.OperationSelect {
+		return 0, fmt.Errorf("only SELECT queries can be exported from the data source")
+	}
+
+	perms, err := s.GetEffectivePermissions(ctx, userID, dataSource.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if !perms.CanSelect {
+		return 0, fmt.Errorf("permission denied: group policies do not allow SELECT on this datasource")
+	}
+
+	// A re-run is a new execution, which the environment policy may require approval for
+	if s.ApprovalRequired(userID, dataSource, models.OperationSelect) {
+		return 0, ErrApprovalRequired
+	}
+
+	sqlText, args, err := bindQuery(query, queryText, dataSource.Type)
+	if err != nil {
+		return 0, err
+	}
+
+	// The whole result is read again, so the cost guard applies as when the query first ran
+	if err := s.checkRerunCost(ctx, query, dataSource, sqlText, args); err != nil {
+		return 0, err
+	}
+
+	writer, _, err := NewStreamRowWriter(format, w)
+	if err != nil {
+		return 0, err
+	}
+
+	// Re-runs are read-only, so they go to a healthy replica when the data source has one
+	dataSourceDB, endpoint, err := s.connectForRead(dataSource)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to data source: %w", err)
+	}
+
+	// Exports are cancellable and bounded by the statement timeout like any other execution
+	exportID := uuid.New()
+	runCtx, finish := s.startRunningQuery(ctx, exportID, endpoint)
+	defer finish()
+
+	flusher, _ := w.(interface{ Flush() })
+	startTime := time.Now()
+	rowCount := 0
+	flushed := false
+
+	execErr := dataSourceDB.WithContext(runCtx).Connection(func(conn *gorm.DB) error {
+		if err := s.prepareSession(conn, exportID, dataSource); err != nil {
+			return err
+		}
+		defer s.resetSession(conn, dataSource)
+
+		tx, err := beginReadOnly(conn)
+		if err != nil {
+			return err
+		}
+		defer endReadOnly(tx)
+
+		rows, err := queryRows(tx, sqlText, args)
+		if err != nil {
+			return s.classifyExecutionError(runCtx, exportID, dataSource, err)
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf("failed to get columns: %w", err)
+		}
+		if err := writer.WriteHeader(columns); err != nil {
+			return fmt.Errorf("failed to write export header: %w", err)
+		}
+
+		// Reuse the scan buffers for every row so memory stays flat
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+
+		for rows.Next() {
+			if err := rows.Scan(valuePtrs...); err != nil {
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			for i, val := range values {
+				if b, ok := val.([]byte); ok {
+					values[i] = string(b)
+				}
+			}
+
+			if err := writer.WriteRow(values); err != nil {
+				return fmt.Errorf("failed to write export row: %w", err)
+			}
+			rowCount++
+
+			if rowCount%exportFlushEvery == 0 {
+				if err := writer.Flush(); err != nil {
+					return fmt.Errorf("failed to write export chunk: %w", err)
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+				flushed = true
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			return s.classifyExecutionError(runCtx, exportID, dataSource, err)
+		}
+		return nil
+	})
+
+	// When the query fails before the first chunk went out, drop the buffered
+	// rows so the caller can still answer with an error response
+	if execErr == nil || flushed {
+		if err := writer.Flush(); err != nil && execErr == nil {
+			execErr = fmt.Errorf("failed to write export chunk: %w", err)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// Record the export run in history
+	executionTime := int(time.Since(startTime).Milliseconds())
+	history := &models.QueryHistory{
+		ID:              uuid.New(),
+		QueryID:         &query.ID,
+		UserID:          userID,
+		DataSourceID:    dataSource.ID,
+		QueryText:       queryText,
+		OperationType:   models.OperationSelect,
+		Status:          models.StatusCompleted,
+		RowCount:        &rowCount,
+		ExecutionTimeMs: &executionTime,
+		ExecutedAt:      startTime,
+	}
+	if execErr != nil {
+		history.Status = models.StatusFailed
+		if errors.Is(execErr, ErrQueryCancelled) {
+			history.Status = models.StatusCancelled
+		}
+		history.ErrorMessage = execErr.Error()
+	}
+	if err := s.db.Create(history).Error; err != nil {
+		log.Printf("[StreamExportQuery] Failed to record history for query %s: %v", query.ID, err)
+	}
+
+	return rowCount, execErr
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, contentType, err := NewStreamRowWriter("csv", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", contentType)
+
+	require.NoError(t, writer.WriteHeader([]string{"id", "name", "created_at"}))
+	require.NoError(t, writer.WriteRow([]interface{}{int64(1), `Jane "JJ" Doe`, time.Date(2026, 1, 29, 12, 0, 0, 0, time.UTC)}))
+	require.NoError(t, writer.WriteRow([]interface{}{int64(2), nil, nil}))
+	require.NoError(t, writer.Flush())
+
+	expected := "id,name,created_at\n" +
+		"1,\"Jane \"\"JJ\"\" Doe\",2026-01-29T12:00:00Z\n" +
+		"2,,\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestNDJSONStreamWriter_PreservesColumnOrder(t *testing.T) {
+	var buf bytes.Buffer
+	writer, contentType, err := NewStreamRowWriter("ndjson", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-ndjson", contentType)
+
+	require.NoError(t, writer.WriteHeader([]string{"zeta", "alpha"}))
+	require.NoError(t, writer.WriteRow([]interface{}{"z", int64(1)}))
+	require.NoError(t, writer.WriteRow([]interface{}{nil, int64(2)}))
+	require.NoError(t, writer.Flush())
+
+	assert.Equal(t, "{\"zeta\":\"z\",\"alpha\":1}\n{\"zeta\":null,\"alpha\":2}\n", buf.String())
+}
+
+func TestNewStreamRowWriter_UnsupportedFormat(t *testing.T) {
+	_, _, err := NewStreamRowWriter("xml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Excel worksheet limits
+const (
+	xlsxMaxRows       = 1048576
+	xlsxMaxCellLength = 32767
+	// xlsxMaxExactDigits is the number of significant digits Excel keeps for numbers
+	xlsxMaxExactDigits = 15
+)
+
+// Cell style indexes defined in xlsxStyles
+const (
+	xlsxStyleDefault   = 0
+	xlsxStyleHeader    = 1
+	xlsxStyleDate      = 2
+	xlsxStyleTimestamp = 3
+)
+
+// xlsxEpoch is day zero of the Excel 1900 date system
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Results" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`
+
+// xlsxExporter writes an Office Open XML workbook with a single sheet. Cells are typed
+// from the source column types: numbers, booleans and dates stay numbers, booleans and
+// dates in Excel instead of text.
+type xlsxExporter struct{}
+
+func (xlsxExporter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+func (xlsxExporter) FileExtension() string { return "xlsx" }
+
+func (xlsxExporter) Export(w io.Writer, table *ExportTable) error {
+	if len(table.Rows)+1 > xlsxMaxRows {
+		return fmt.Errorf("result has %d rows, more than the %d rows an Excel worksheet can hold", len(table.Rows), xlsxMaxRows-1)
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeXLSXSheet(sheet, table); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeXLSXSheet writes the worksheet XML with a frozen, bold header row
+func writeXLSXSheet(w io.Writer, table *ExportTable) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	bw.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	bw.WriteString(`<sheetData>`)
+
+	columnRefs := make([]string, len(table.Columns))
+	for i := range table.Columns {
+		columnRefs[i] = xlsxColumnName(i)
+	}
+
+	bw.WriteString(`<row r="1">`)
+	for i, col := range table.Columns {
+		writeXLSXInlineString(bw, columnRefs[i]+"1", xlsxStyleHeader, col)
+	}
+	bw.WriteString(`</row>`)
+
+	for r, row := range table.Rows {
+		rowNum := strconv.Itoa(r + 2)
+		bw.WriteString(`<row r="` + rowNum + `">`)
+		for i := range table.Columns {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			writeXLSXCell(bw, columnRefs[i]+rowNum, table.columnType(i), row[i])
+		}
+		bw.WriteString(`</row>`)
+	}
+
+	bw.WriteString(`</sheetData></worksheet>`)
+	return bw.Flush()
+}
+
+// writeXLSXCell writes a value typed by its column, falling back to text when it doesn't parse
+func writeXLSXCell(bw *bufio.Writer, ref, columnType string, val interface{}) {
+	switch {
+	case isBoolColumnType(columnType):
+		if b, ok := exportBool(val); ok {
+			v := "0"
+			if b {
+				v = "1"
+			}
+			bw.WriteString(`<c r="` + ref + `" t="b"><v>` + v + `</v></c>`)
+			return
+		}
+
+	case isNumericColumnType(columnType):
+		if num, ok := exportNumber(val); ok && xlsxExactNumber(num) {
+			bw.WriteString(`<c r="` + ref + `"><v>` + num + `</v></c>`)
+			return
+		}
+
+	case isDateColumnType(columnType), isTimestampColumnType(columnType):
+		if t, ok := exportTime(val); ok && t.Year() >= 1900 && t.Year() <= 9999 {
+			style := xlsxStyleTimestamp
+			if isDateColumnType(columnType) {
+				style = xlsxStyleDate
+			}
+			serial := strconv.FormatFloat(xlsxSerialDate(t), 'f', -1, 64)
+			bw.WriteString(fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, ref, style, serial))
+			return
+		}
+
+	case columnType == "":
+		// Without a source type, keep JSON booleans and numbers typed but leave strings as text
+		if _, isBool := val.(bool); isBool {
+			writeXLSXCell(bw, ref, "BOOLEAN", val)
+			return
+		}
+		if _, isText := val.(string); !isText {
+			if num, ok := exportNumber(val); ok && xlsxExactNumber(num) {
+				bw.WriteString(`<c r="` + ref + `"><v>` + num + `</v></c>`)
+				return
+			}
+		}
+	}
+
+	writeXLSXInlineString(bw, ref, xlsxStyleDefault, exportCellString(val))
+}
+
+// writeXLSXInlineString writes a text cell without a shared string table
+func writeXLSXInlineString(bw *bufio.Writer, ref string, style int, text string) {
+	if len(text) > xlsxMaxCellLength {
+		text = text[:xlsxMaxCellLength]
+		// Don't leave half of a multi-byte character behind
+		text = strings.ToValidUTF8(text, "")
+	}
+
+	bw.WriteString(`<c r="` + ref + `" t="inlineStr"`)
+	if style != xlsxStyleDefault {
+		bw.WriteString(` s="` + strconv.Itoa(style) + `"`)
+	}
+	bw.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(bw, []byte(text))
+	bw.WriteString(`</t></is></c>`)
+}
+
+// xlsxExactNumber reports whether Excel can hold a number without losing digits.
+// Longer values such as 64-bit IDs are written as text instead.
+func xlsxExactNumber(num string) bool {
+	digits := 0
+	for _, c := range strings.TrimLeft(num, "-+0") {
+		if c >= '0' && c <= '9' {
+			digits++
+		} else if c == 'e' || c == 'E' {
+			break
+		}
+	}
+	return digits <= xlsxMaxExactDigits
+}
+
+// xlsxSerialDate converts a time to an Excel serial date, keeping its wall clock time
+func xlsxSerialDate(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	seconds := wall.Unix() - xlsxEpoch.Unix()
+	return (float64(seconds) + float64(wall.Nanosecond())/1e9) / 86400
+}
+
+// xlsxColumnName converts a zero-based column index to its letter name (0 = A, 26 = AA)
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// ExportTable is a stored query result prepared for an exporter
+type ExportTable struct {
+	Columns     []string
+	ColumnTypes []string // database type names as reported by the driver, may be shorter than Columns
+	Rows        [][]interface{}
+	TableName   string                // target table for SQL INSERT exports
+	Dialect     models.DataSourceType // SQL dialect of the data source the result came from
+}
+
+// columnType returns the upper-cased database type name of a column, or "" when unknown
+func (t *ExportTable) columnType(i int) string {
+	if i < len(t.ColumnTypes) {
+		return strings.ToUpper(t.ColumnTypes[i])
+	}
+	return ""
+}
+
+// rowMaps returns the rows keyed by column name, with duplicate names made unique
+func (t *ExportTable) rowMaps() []map[string]interface{} {
+	return rowsToMaps(t.Columns, t.Rows)
+}
+
+// Exporter renders a query result in one file format
+type Exporter interface {
+	ContentType() string
+	FileExtension() string
+	Export(w io.Writer, table *ExportTable) error
+}
+
+var (
+	exporters      = make(map[string]Exporter)
+	exportersMutex sync.RWMutex
+)
+
+func init() {
+	RegisterExporter("csv", csvExporter{})
+	RegisterExporter("json", jsonExporter{})
+	RegisterExporter("ndjson", ndjsonExporter{})
+	RegisterExporter("markdown", markdownExporter{})
+	RegisterExporter("sql", sqlInsertExporter{})
+	RegisterExporter("xlsx", xlsxExporter{})
+	RegisterExporter("parquet", parquetExporter{})
+}
+
+// RegisterExporter makes an export format available, replacing any exporter registered under the same name
+func RegisterExporter(format string, exporter Exporter) {
+	exportersMutex.Lock()
+	defer exportersMutex.Unlock()
+	exporters[strings.ToLower(format)] = exporter
+}
+
+// GetExporter returns the exporter registered for a format
+func GetExporter(format string) (Exporter, bool) {
+	exportersMutex.RLock()
+	defer exportersMutex.RUnlock()
+	exporter, ok := exporters[strings.ToLower(format)]
+	return exporter, ok
+}
+
+// ExportFormats lists the registered export formats in alphabetical order
+func ExportFormats() []string {
+	exportersMutex.RLock()
+	defer exportersMutex.RUnlock()
+
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// csvExporter writes every value quoted, matching the original stored-result CSV export
+type csvExporter struct{}
+
+func (csvExporter) ContentType() string   { return "text/csv" }
+func (csvExporter) FileExtension() string { return "csv" }
+
+func (csvExporter) Export(w io.Writer, table *ExportTable) error {
+	bw := bufio.NewWriter(w)
+	writeRecord := func(values []string) {
+		for i, val := range values {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			bw.WriteByte('"')
+			bw.WriteString(strings.ReplaceAll(val, "\"", "\"\""))
+			bw.WriteByte('"')
+		}
+		bw.WriteByte('\n')
+	}
+
+	writeRecord(table.Columns)
+	record := make([]string, len(table.Columns))
+	for _, row := range table.Rows {
+		for i := range table.Columns {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = exportCellString(row[i])
+			}
+		}
+		writeRecord(record)
+	}
+	return bw.Flush()
+}
+
+// jsonExporter writes a single document with the columns, row count and rows.
+// The columns are the object keys of the rows, so duplicate names carry a suffix.
+type jsonExporter struct{}
+
+func (jsonExporter) ContentType() string   { return "application/json" }
+func (jsonExporter) FileExtension() string { return "json" }
+
+func (jsonExporter) Export(w io.Writer, table *ExportTable) error {
+	output := map[string]interface{}{
+		"columns":   ResultColumnKeys(table.Columns),
+		"row_count": len(table.Rows),
+		"data":      table.rowMaps(),
+	}
+
+	encoded, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// ndjsonExporter writes one JSON object per row using the streaming row writer
+type ndjsonExporter struct{}
+
+func (ndjsonExporter) ContentType() string   { return "application/x-ndjson" }
+func (ndjsonExporter) FileExtension() string { return "ndjson" }
+
+func (ndjsonExporter) Export(w io.Writer, table *ExportTable) error {
+	writer, _, err := NewStreamRowWriter("ndjson", w)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteHeader(table.Columns); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		if err := writer.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// markdownExporter writes a GitHub-flavored Markdown table
+type markdownExporter struct{}
+
+func (markdownExporter) ContentType() string   { return "text/markdown" }
+func (markdownExporter) FileExtension() string { return "md" }
+
+func (markdownExporter) Export(w io.Writer, table *ExportTable) error {
+	bw := bufio.NewWriter(w)
+	writeLine := func(cells []string) {
+		bw.WriteString("|")
+		for _, cell := range cells {
+			bw.WriteString(" ")
+			bw.WriteString(markdownCell(cell))
+			bw.WriteString(" |")
+		}
+		bw.WriteString("\n")
+	}
+
+	writeLine(table.Columns)
+	bw.WriteString("|")
+	for i := range table.Columns {
+		if isNumericColumnType(table.columnType(i)) {
+			bw.WriteString(" ---: |")
+		} else {
+			bw.WriteString(" --- |")
+		}
+	}
+	bw.WriteString("\n")
+
+	cells := make([]string, len(table.Columns))
+	for _, row := range table.Rows {
+		for i := range table.Columns {
+			cells[i] = ""
+			if i < len(row) {
+				cells[i] = exportCellString(row[i])
+			}
+		}
+		writeLine(cells)
+	}
+	return bw.Flush()
+}
+
+// markdownCell escapes characters that would break a Markdown table cell
+func markdownCell(val string) string {
+	val = strings.ReplaceAll(val, "\\", "\\\\")
+	val = strings.ReplaceAll(val, "|", "\\|")
+	val = strings.ReplaceAll(val, "\r\n", "<br>")
+	return strings.ReplaceAll(val, "\n", "<br>")
+}
+
+// sqlInsertBatchSize is the number of rows per INSERT statement in SQL exports
+const sqlInsertBatchSize = 100
+
+// sqlInsertExporter writes a script of multi-row INSERT statements for the source dialect
+type sqlInsertExporter struct{}
+
+func (sqlInsertExporter) ContentType() string   { return "application/sql" }
+func (sqlInsertExporter) FileExtension() string { return "sql" }
+
+func (sqlInsertExporter) Export(w io.Writer, table *ExportTable) error {
+	tableName := table.TableName
+	if tableName == "" {
+		tableName = "query_results"
+	}
+
+	quotedColumns := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		quotedColumns[i] = quoteIdentifier(table.Dialect, col)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteQualifiedIdentifier(table.Dialect, tableName), strings.Join(quotedColumns, ", "))
+
+	bw := bufio.NewWriter(w)
+	for start := 0; start < len(table.Rows); start += sqlInsertBatchSize {
+		end := start + sqlInsertBatchSize
+		if end > len(table.Rows) {
+			end = len(table.Rows)
+		}
+
+		bw.WriteString(prefix)
+		for r, row := range table.Rows[start:end] {
+			bw.WriteString("  (")
+			for i := range table.Columns {
+				if i > 0 {
+					bw.WriteString(", ")
+				}
+				var val interface{}
+				if i < len(row) {
+					val = row[i]
+				}
+				bw.WriteString(sqlLiteral(table.Dialect, table.columnType(i), val))
+			}
+			bw.WriteString(")")
+			if start+r < end-1 {
+				bw.WriteString(",\n")
+			} else {
+				bw.WriteString(";\n")
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// quoteIdentifier quotes a single identifier for a SQL dialect
+func quoteIdentifier(dialect models.DataSourceType, name string) string {
+	return dialectQuoter(dialect).QuoteIdentifier(name)
+}
+
+// dialectQuoter returns the driver of a dialect for quoting; exports without a known
+// dialect are quoted as standard SQL
+func dialectQuoter(dialect models.DataSourceType) interface {
+	QuoteIdentifier(name string) string
+	QuoteString(value string) string
+} {
+	if driver, err := LookupDataSourceDriver(dialect); err == nil {
+		return driver
+	}
+	return standardSQL{}
+}
+
+// quoteQualifiedIdentifier quotes each part of a schema-qualified name
+func quoteQualifiedIdentifier(dialect models.DataSourceType, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(dialect, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// sqlLiteral renders a value as a SQL literal. Numeric and boolean values are written
+// unquoted when the column type allows it; everything else becomes a quoted string.
+func sqlLiteral(dialect models.DataSourceType, columnType string, val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case json.Number, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		if columnType == "" || isNumericColumnType(columnType) {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+
+	return dialectQuoter(dialect).QuoteString(exportCellString(val))
+}
+
+// isIntegerColumnType reports whether a database type name holds whole numbers
+func isIntegerColumnType(columnType string) bool {
+	switch strings.ToUpper(columnType) {
+	case "INT", "INT2", "INT4", "INT8", "INTEGER", "SMALLINT", "BIGINT", "TINYINT", "MEDIUMINT",
+		"SERIAL", "BIGSERIAL", "SMALLSERIAL",
+		"UNSIGNED INT", "UNSIGNED BIGINT", "UNSIGNED SMALLINT", "UNSIGNED TINYINT", "UNSIGNED MEDIUMINT", "YEAR":
+		return true
+	}
+	return false
+}
+
+// isFloatColumnType reports whether a database type name holds floating point numbers
+func isFloatColumnType(columnType string) bool {
+	switch strings.ToUpper(columnType) {
+	case "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL", "DOUBLE PRECISION":
+		return true
+	}
+	return false
+}
+
+// isDecimalColumnType reports whether a database type name holds exact decimal numbers
+func isDecimalColumnType(columnType string) bool {
+	switch strings.ToUpper(columnType) {
+	case "NUMERIC", "DECIMAL", "MONEY":
+		return true
+	}
+	return false
+}
+
+// isNumericColumnType reports whether a database type name holds any kind of number
+func isNumericColumnType(columnType string) bool {
+	return isIntegerColumnType(columnType) || isFloatColumnType(columnType) || isDecimalColumnType(columnType)
+}
+
+// isBoolColumnType reports whether a database type name holds booleans
+func isBoolColumnType(columnType string) bool {
+	switch strings.ToUpper(columnType) {
+	case "BOOL", "BOOLEAN":
+		return true
+	}
+	return false
+}
+
+// isDateColumnType reports whether a database type name holds calendar dates without a time
+func isDateColumnType(columnType string) bool {
+	return strings.ToUpper(columnType) == "DATE"
+}
+
+// isTimestampColumnType reports whether a database type name holds points in time
+func isTimestampColumnType(columnType string) bool {
+	switch strings.ToUpper(columnType) {
+	case "TIMESTAMP", "TIMESTAMPTZ", "DATETIME":
+		return true
+	}
+	return false
+}
+
+// exportTimeLayouts are the formats timestamps are stored in after a result is serialized to JSON
+var exportTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// exportNumber returns the numeric text of a value, if it is a finite number
+func exportNumber(val interface{}) (string, bool) {
+	var text string
+	switch v := val.(type) {
+	case json.Number:
+		text = v.String()
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		text = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v), true
+	case string:
+		text = strings.TrimSpace(v)
+	default:
+		return "", false
+	}
+
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	return text, true
+}
+
+// exportTime returns the time held by a value, if it is a time or a timestamp string
+func exportTime(val interface{}) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range exportTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// exportBool returns the boolean held by a value, accepting the spellings databases use
+func exportBool(val interface{}) (bool, bool) {
+	switch v := val.(type) {
+	case bool:
+		return v, true
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "t", "true", "1", "y", "yes":
+			return true, true
+		case "f", "false", "0", "n", "no":
+			return false, true
+		}
+	case json.Number:
+		switch v.String() {
+		case "1":
+			return true, true
+		case "0":
+			return false, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// exportRowMaps runs a registered exporter over rows keyed by column name
+func exportRowMaps(format string, rowMaps []map[string]interface{}, columns []string) ([]byte, error) {
+	rows := make([][]interface{}, len(rowMaps))
+	for i, rowMap := range rowMaps {
+		rows[i] = make([]interface{}, len(columns))
+		for j, col := range columns {
+			rows[i][j] = rowMap[col]
+		}
+	}
+
+	exporter, _ := GetExporter(format)
+	var buf bytes.Buffer
+	err := exporter.Export(&buf, &ExportTable{Columns: columns, Rows: rows})
+	return buf.Bytes(), err
+}
+
+func TestExportFormats_Registered(t *testing.T) {
+	assert.Equal(t, []string{"csv", "json", "markdown", "ndjson", "parquet", "sql", "xlsx"}, ExportFormats())
+
+	exporter, ok := GetExporter("XLSX")
+	require.True(t, ok)
+	assert.Equal(t, "xlsx", exporter.FileExtension())
+
+	_, ok = GetExporter("pdf")
+	assert.False(t, ok)
+}
+
+func TestMarkdownExporter(t *testing.T) {
+	var buf bytes.Buffer
+	err := markdownExporter{}.Export(&buf, &ExportTable{
+		Columns:     []string{"id", "note"},
+		ColumnTypes: []string{"INT4", "TEXT"},
+		Rows: [][]interface{}{
+			{json.Number("1"), "a|b"},
+			{json.Number("2"), "line1\nline2"},
+			{json.Number("3"), nil},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "| id | note |\n"+
+		"| ---: | --- |\n"+
+		"| 1 | a\\|b |\n"+
+		"| 2 | line1<br>line2 |\n"+
+		"| 3 |  |\n", buf.String())
+}
+
+func TestSQLInsertExporter_PostgreSQL(t *testing.T) {
+	var buf bytes.Buffer
+	err := sqlInsertExporter{}.Export(&buf, &ExportTable{
+		Columns:     []string{"id", "name", "active", "code"},
+		ColumnTypes: []string{"INT8", "TEXT", "BOOL", "VARCHAR"},
+		Rows: [][]interface{}{
+			{json.Number("1"), "O'Brien", true, json.Number("007")},
+			{json.Number("2"), nil, false, "x"},
+		},
+		TableName: "public.users",
+		Dialect:   models.DataSourceTypePostgreSQL,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "INSERT INTO \"public\".\"users\" (\"id\", \"name\", \"active\", \"code\") VALUES\n"+
+		"  (1, 'O''Brien', TRUE, '007'),\n"+
+		"  (2, NULL, FALSE, 'x');\n", buf.String())
+}
+
+func TestSQLInsertExporter_MySQLBatches(t *testing.T) {
+	rows := make([][]interface{}, sqlInsertBatchSize+1)
+	for i := range rows {
+		rows[i] = []interface{}{`C:\temp`}
+	}
+
+	var buf bytes.Buffer
+	err := sqlInsertExporter{}.Export(&buf, &ExportTable{
+		Columns: []string{"path"},
+		Rows:    rows,
+		Dialect: models.DataSourceTypeMySQL,
+	})
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Equal(t, 2, strings.Count(out, "INSERT INTO `query_results` (`path`) VALUES"))
+	assert.Contains(t, out, `('C:\\temp')`)
+	assert.Equal(t, 2, strings.Count(out, ";\n"))
+}
+
+func TestXLSXExporter_TypedCells(t *testing.T) {
+	var buf bytes.Buffer
+	err := xlsxExporter{}.Export(&buf, &ExportTable{
+		Columns:     []string{"id", "name", "active", "created_at", "big_id", "price"},
+		ColumnTypes: []string{"INT4", "TEXT", "BOOL", "TIMESTAMP", "INT8", "NUMERIC"},
+		Rows: [][]interface{}{
+			{json.Number("1"), "<Alice & Bob>", true, "2024-01-02T12:00:00Z", json.Number("9223372036854775807"), "12.50"},
+			{json.Number("2"), nil, "f", "not a date", json.Number("5"), nil},
+		},
+	})
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+
+	require.Contains(t, files, "[Content_Types].xml")
+	require.Contains(t, files, "xl/workbook.xml")
+	require.Contains(t, files, "xl/styles.xml")
+	sheet := files["xl/worksheets/sheet1.xml"]
+
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">id</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="A2"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">&lt;Alice &amp; Bob&gt;</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="C2" t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" s="3"><v>45293.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="F2"><v>12.50</v></c>`)
+	assert.Contains(t, sheet, `<c r="C3" t="b"><v>0</v></c>`)
+	assert.Contains(t, sheet, `<c r="E3"><v>5</v></c>`)
+
+	// Values Excel can't hold exactly or that don't match the column type stay text
+	assert.Contains(t, sheet, `<c r="E2" t="inlineStr"><is><t xml:space="preserve">9223372036854775807</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="D3" t="inlineStr"><is><t xml:space="preserve">not a date</t></is></c>`)
+	assert.NotContains(t, sheet, `r="B3"`)
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumnName(0))
+	assert.Equal(t, "Z", xlsxColumnName(25))
+	assert.Equal(t, "AA", xlsxColumnName(26))
+	assert.Equal(t, "AZ", xlsxColumnName(51))
+	assert.Equal(t, "BA", xlsxColumnName(52))
+}
+
+func TestParquetExporter_FileLayout(t *testing.T) {
+	var buf bytes.Buffer
+	err := parquetExporter{}.Export(&buf, &ExportTable{
+		Columns:     []string{"id", "name", "id"},
+		ColumnTypes: []string{"INT8", "TEXT", "INT4"},
+		Rows: [][]interface{}{
+			{json.Number("1"), "Alice", json.Number("10")},
+			{json.Number("2"), nil, json.Number("20")},
+		},
+	})
+	require.NoError(t, err)
+
+	data := buf.Bytes()
+	require.Greater(t, len(data), 12)
+	assert.Equal(t, parquetMagic, string(data[:4]))
+	assert.Equal(t, parquetMagic, string(data[len(data)-4:]))
+
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	assert.Contains(t, string(footer), "schema")
+	assert.Contains(t, string(footer), "name")
+	assert.Contains(t, string(footer), "id_2")
+	assert.Contains(t, string(footer), "querybase")
+}
+
+func TestBuildParquetColumns_Types(t *testing.T) {
+	columns := buildParquetColumns(&ExportTable{
+		Columns:     []string{"n", "f", "b", "d", "ts", "amount", "mixed"},
+		ColumnTypes: []string{"BIGINT", "DOUBLE", "BOOLEAN", "DATE", "DATETIME", "DECIMAL", "INT4"},
+		Rows: [][]interface{}{
+			{"42", json.Number("1.5"), "1", "1970-01-03", "1970-01-01 00:00:01", "10.10", json.Number("1")},
+			{nil, nil, nil, nil, nil, nil, "n/a"},
+		},
+	})
+
+	assert.Equal(t, parquetInt64, columns[0].physicalType)
+	assert.Equal(t, []interface{}{int64(42), nil}, columns[0].values)
+	assert.Equal(t, parquetDouble, columns[1].physicalType)
+	assert.Equal(t, 1.5, columns[1].values[0])
+	assert.Equal(t, parquetBoolean, columns[2].physicalType)
+	assert.Equal(t, true, columns[2].values[0])
+	assert.Equal(t, parquetConvertedDate, columns[3].convertedType)
+	assert.Equal(t, int32(2), columns[3].values[0])
+	assert.Equal(t, parquetConvertedTimestampMillis, columns[4].convertedType)
+	assert.Equal(t, int64(1000), columns[4].values[0])
+	assert.Equal(t, parquetByteArray, columns[5].physicalType)
+	assert.Equal(t, "10.10", columns[5].values[0])
+
+	// A value that doesn't fit the source type turns the column into strings
+	assert.Equal(t, parquetByteArray, columns[6].physicalType)
+	assert.Equal(t, []interface{}{"1", "n/a"}, columns[6].values)
+}
+
+func TestEncodeParquetDefinitionLevels(t *testing.T) {
+	levels := encodeParquetDefinitionLevels([]interface{}{int64(1), nil, int64(3)})
+	// One bit-packed group: header (1 << 1 | 1), then bits 1,0,1 least significant first
+	assert.Equal(t, []byte{0x03, 0x05}, levels)
+}
+
+func TestThriftCompactWriter(t *testing.T) {
+	w := &thriftCompactWriter{}
+	w.structBegin()
+	w.i32Field(1, -1)
+	w.i64Field(20, 300)
+	w.binaryField(21, "ab")
+	w.structEnd()
+
+	assert.Equal(t, []byte{
+		0x15, 0x01, // field 1, i32, zigzag(-1)
+		0x06, 0x28, 0xd8, 0x04, // long form field 20, i64, zigzag(300)
+		0x18, 0x02, 'a', 'b', // field 21, binary
+		0x00,
+	}, w.buf.Bytes())
+}
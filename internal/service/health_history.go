@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// defaultHealthRetention is how long health probes are kept when no retention is configured
+const defaultHealthRetention = 30 * 24 * time.Hour
+
+// Bounds of a health history report
+const (
+	maxHealthIncidents = 20
+	recentHealthProbes = 50
+)
+
+// healthWindows are the periods uptime and latency are reported for
+var healthWindows = []struct {
+	name   string
+	period time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// HealthWindow summarizes the probes of a data source over a period
+type HealthWindow struct {
+	Window string `json:"window"`
+	Probes int    `json:"probes"`
+	// UptimePercent is the share of healthy and degraded probes; nil without probes
+	UptimePercent        *float64 `json:"uptime_percent"`
+	AvgConnectLatencyMs  *float64 `json:"avg_connect_latency_ms"`
+	AvgPingLatencyMs     *float64 `json:"avg_ping_latency_ms"`
+	MaxReplicaLagSeconds *float64 `json:"max_replica_lag_seconds"`
+}
+
+// HealthIncident is a run of consecutive unhealthy probes
+type HealthIncident struct {
+	StartedAt time.Time `json:"started_at"`
+	// EndedAt is the first healthy probe after the incident, nil while it is ongoing
+	EndedAt         *time.Time              `json:"ended_at"`
+	DurationSeconds int64                   `json:"duration_seconds"`
+	Probes          int                     `json:"probes"`
+	ErrorClass      models.HealthErrorClass `json:"error_class"`
+	Error           string                  `json:"error"`
+}
+
+// HealthHistory is the health of a data source over time. It tells a flaky database (many short
+// incidents) from a dead one (one ongoing incident).
+type HealthHistory struct {
+	DataSourceID uuid.UUID        `json:"data_source_id"`
+	Windows      []HealthWindow   `json:"windows"`
+	Incidents    []HealthIncident `json:"incidents"` // newest first
+	// RecentProbes are the latest probes, newest first
+	RecentProbes []models.DataSourceHealthCheck `json:"recent_probes"`
+}
+
+// SetHealthHistory configures how long health probes are kept
+func (s *DataSourceService) SetHealthHistory(healthHistory config.HealthHistoryConfig) {
+	if healthHistory.Retention > 0 {
+		s.healthRetention = healthHistory.Retention
+	}
+}
+
+// ProbeHealth probes a data source on a connection of its own and records the probe: connect
+// and ping latency, server version, replica lag and why it failed. The health columns of the
+// data source are updated with the outcome. Inactive data sources are not probed.
+func (s *DataSourceService) ProbeHealth(ctx context.Context, dataSource *models.DataSource, source models.HealthProbeSource) (*HealthCheckResult, error) {
+	if !dataSource.IsActive {
+		return &HealthCheckResult{
+			Status:  dto.HealthStatusUnhealthy,
+			Message: "Data source is inactive",
+		}, nil
+	}
+
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := &models.DataSourceHealthCheck{
+		ID:           uuid.New(),
+		DataSourceID: dataSource.ID,
+		Source:       source,
+	}
+	result := s.probe(ctx, dataSource, driver, probe)
+
+	// Replica lag is measured on every probe and decides where reads are routed
+	replicas, err := s.CheckReplicas(ctx, dataSource)
+	if err != nil {
+		log.Printf("[HealthCheck] Failed to check replicas of %s: %v", dataSource.Name, err)
+	}
+	result.Replicas = replicas
+	for _, replica := range replicas {
+		if replica.LagSeconds != nil && (probe.ReplicaLagSeconds == nil || *replica.LagSeconds > *probe.ReplicaLagSeconds) {
+			probe.ReplicaLagSeconds = replica.LagSeconds
+		}
+	}
+
+	probe.Status = string(result.Status)
+	probe.CheckedAt = time.Now()
+	s.recordHealthProbe(probe)
+	return result, nil
+}
+
+// probe connects to a data source and fills in the measurements of the probe
+func (s *DataSourceService) probe(ctx context.Context, dataSource *models.DataSource, driver DataSourceDriver, probe *models.DataSourceHealthCheck) *HealthCheckResult {
+	failed := func(err error, message string) *HealthCheckResult {
+		probe.ErrorClass = classifyHealthError(err)
+		probe.Error = err.Error()
+		return &HealthCheckResult{
+			Status:           dto.HealthStatusUnhealthy,
+			LatencyMs:        derefLatency(probe.ConnectLatencyMs),
+			ConnectLatencyMs: probe.ConnectLatencyMs,
+			Error:            err.Error(),
+			Message:          message,
+		}
+	}
+
+	// Decrypt the password and TLS material
+	credentials, err := resolveCredentials(ctx, s.decryptPassword, s.connections.secrets, dataSource)
+	if err != nil {
+		return failed(err, "Failed to read the credentials of the data source")
+	}
+
+	// The shared pool would hide the connect time, so the probe opens a connection of its own
+	start := time.Now()
+	db, err := openDataSource(dataSource, credentials)
+	connectLatency := time.Since(start).Milliseconds()
+	if err != nil {
+		return failed(err, "Failed to connect to data source")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return failed(err, "Failed to connect to data source")
+	}
+	defer sqlDB.Close()
+	probe.ConnectLatencyMs = &connectLatency
+
+	start = time.Now()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return failed(err, "Failed to connect to data source")
+	}
+	pingLatency := time.Since(start).Milliseconds()
+	probe.PingLatencyMs = &pingLatency
+
+	if reporter, ok := driver.(ServerVersionReporter); ok {
+		if probe.ServerVersion, err = reporter.ServerVersion(db.WithContext(ctx)); err != nil {
+			log.Printf("[HealthCheck] Failed to read the server version of %s: %v", dataSource.Name, err)
+		}
+	}
+
+	// Determine health based on latency
+	latency := connectLatency + pingLatency
+	status := dto.HealthStatusHealthy
+	message := "Data source is healthy"
+	if latency > 1000 {
+		status = dto.HealthStatusDegraded
+		message = "Data source is responding slowly"
+	}
+
+	return &HealthCheckResult{
+		Status:           status,
+		LatencyMs:        latency,
+		ConnectLatencyMs: &connectLatency,
+		PingLatencyMs:    &pingLatency,
+		ServerVersion:    probe.ServerVersion,
+		Message:          message,
+		TLSVersion:       s.tlsVersion(dataSource, db.WithContext(ctx), driver),
+	}
+}
+
+// recordHealthProbe stores a probe, updates the health columns of its data source and deletes
+// the probes that are past the retention
+func (s *DataSourceService) recordHealthProbe(probe *models.DataSourceHealthCheck) {
+	if err := s.db.Create(probe).Error; err != nil {
+		log.Printf("[HealthCheck] Failed to record health probe of data source %s: %v", probe.DataSourceID, err)
+	}
+
+	// UpdateColumns leaves updated_at alone, as the settings of the data source are unchanged
+	if err := s.db.Model(&models.DataSource{}).Where("id = ?", probe.DataSourceID).UpdateColumns(map[string]interface{}{
+		"is_healthy":        probe.Status != string(dto.HealthStatusUnhealthy),
+		"last_health_check": probe.CheckedAt,
+	}).Error; err != nil {
+		log.Printf("[HealthCheck] Failed to update health of data source %s: %v", probe.DataSourceID, err)
+	}
+
+	if err := s.db.Where("data_source_id = ? AND checked_at < ?", probe.DataSourceID, probe.CheckedAt.Add(-s.healthRetention)).
+		Delete(&models.DataSourceHealthCheck{}).Error; err != nil {
+		log.Printf("[HealthCheck] Failed to delete old health probes of data source %s: %v", probe.DataSourceID, err)
+	}
+}
+
+// GetHealthHistory reports the uptime, latency and incidents of a data source from its probes
+func (s *DataSourceService) GetHealthHistory(ctx context.Context, dataSourceID uuid.UUID, now time.Time) (*HealthHistory, error) {
+	longest := healthWindows[len(healthWindows)-1].period
+
+	var probes []models.DataSourceHealthCheck
+	if err := s.db.WithContext(ctx).
+		Where("data_source_id = ? AND checked_at >= ?", dataSourceID, now.Add(-longest)).
+		Order("checked_at ASC").
+		Find(&probes).Error; err != nil {
+		return nil, err
+	}
+
+	history := &HealthHistory{
+		DataSourceID: dataSourceID,
+		Windows:      make([]HealthWindow, 0, len(healthWindows)),
+		Incidents:    healthIncidents(probes, now),
+		RecentProbes: make([]models.DataSourceHealthCheck, 0, recentHealthProbes),
+	}
+	for _, window := range healthWindows {
+		history.Windows = append(history.Windows, summarizeHealthWindow(window.name, probes, now.Add(-window.period)))
+	}
+	for i := len(probes) - 1; i >= 0 && len(history.RecentProbes) < recentHealthProbes; i-- {
+		history.RecentProbes = append(history.RecentProbes, probes[i])
+	}
+	return history, nil
+}
+
+// summarizeHealthWindow summarizes the probes checked since a time; probes are in check order
+func summarizeHealthWindow(name string, probes []models.DataSourceHealthCheck, since time.Time) HealthWindow {
+	first := sort.Search(len(probes), func(i int) bool {
+		return !probes[i].CheckedAt.Before(since)
+	})
+	window := HealthWindow{Window: name, Probes: len(probes) - first}
+	if window.Probes == 0 {
+		return window
+	}
+
+	var up, connects, pings int
+	var connectTotal, pingTotal int64
+	for _, probe := range probes[first:] {
+		if probe.Status != string(dto.HealthStatusUnhealthy) {
+			up++
+		}
+		if probe.ConnectLatencyMs != nil {
+			connects++
+			connectTotal += *probe.ConnectLatencyMs
+		}
+		if probe.PingLatencyMs != nil {
+			pings++
+			pingTotal += *probe.PingLatencyMs
+		}
+		if probe.ReplicaLagSeconds != nil && (window.MaxReplicaLagSeconds == nil || *probe.ReplicaLagSeconds > *window.MaxReplicaLagSeconds) {
+			window.MaxReplicaLagSeconds = probe.ReplicaLagSeconds
+		}
+	}
+
+	uptime := float64(up) * 100 / float64(window.Probes)
+	window.UptimePercent = &uptime
+	window.AvgConnectLatencyMs = average(connectTotal, connects)
+	window.AvgPingLatencyMs = average(pingTotal, pings)
+	return window
+}
+
+// healthIncidents groups consecutive unhealthy probes into incidents, newest first
+func healthIncidents(probes []models.DataSourceHealthCheck, now time.Time) []HealthIncident {
+	incidents := []HealthIncident{}
+	var current *HealthIncident
+	for _, probe := range probes {
+		if probe.Status != string(dto.HealthStatusUnhealthy) {
+			if current != nil {
+				endedAt := probe.CheckedAt
+				current.EndedAt = &endedAt
+				current.DurationSeconds = int64(endedAt.Sub(current.StartedAt).Seconds())
+				incidents = append(incidents, *current)
+				current = nil
+			}
+			continue
+		}
+		if current == nil {
+			current = &HealthIncident{
+				StartedAt:  probe.CheckedAt,
+				ErrorClass: probe.ErrorClass,
+				Error:      probe.Error,
+			}
+		}
+		current.Probes++
+	}
+	if current != nil {
+		current.DurationSeconds = int64(now.Sub(current.StartedAt).Seconds())
+		incidents = append(incidents, *current)
+	}
+
+	// Newest first
+	for i, j := 0, len(incidents)-1; i < j; i, j = i+1, j-1 {
+		incidents[i], incidents[j] = incidents[j], incidents[i]
+	}
+	if len(incidents) > maxHealthIncidents {
+		incidents = incidents[:maxHealthIncidents]
+	}
+	return incidents
+}
+
+// classifyHealthError tells why a data source could not be reached
+func classifyHealthError(err error) models.HealthErrorClass {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrSSHTunnel) || errors.Is(err, ErrInvalidSSHConfig):
+		return models.HealthErrorSSHTunnel
+	case errors.Is(err, ErrSecretUnavailable) || errors.Is(err, ErrInvalidCredentialSource) || errors.Is(err, ErrUnknownEncryptionKey):
+		return models.HealthErrorCredentials
+	case errors.Is(err, ErrInvalidTLSConfig):
+		return models.HealthErrorTLS
+	case errors.As(err, &dnsErr):
+		return models.HealthErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return models.HealthErrorRefused
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return models.HealthErrorTimeout
+	}
+
+	// Drivers don't always wrap the network error, so fall back to the message
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "authentication failed") || strings.Contains(message, "access denied"):
+		return models.HealthErrorAuth
+	case strings.Contains(message, "tls") || strings.Contains(message, "certificate") || strings.Contains(message, "x509"):
+		return models.HealthErrorTLS
+	case strings.Contains(message, "no such host"):
+		return models.HealthErrorDNS
+	case strings.Contains(message, "connection refused"):
+		return models.HealthErrorRefused
+	case strings.Contains(message, "timeout") || strings.Contains(message, "deadline exceeded"):
+		return models.HealthErrorTimeout
+	default:
+		return models.HealthErrorOther
+	}
+}
+
+// average returns the mean of count values, nil without values
+func average(total int64, count int) *float64 {
+	if count == 0 {
+		return nil
+	}
+	mean := float64(total) / float64(count)
+	return &mean
+}
+
+// derefLatency returns a latency, 0 when it was not measured
+func derefLatency(latency *int64) int64 {
+	if latency == nil {
+		return 0
+	}
+	return *latency
+}
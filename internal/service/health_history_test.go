@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestClassifyHealthError(t *testing.T) {
+	for expected, err := range map[models.HealthErrorClass]error{
+		models.HealthErrorSSHTunnel:   fmt.Errorf("%w: dial bastion: connection refused", ErrSSHTunnel),
+		models.HealthErrorCredentials: fmt.Errorf("%w: DB_PASSWORD is not set", ErrSecretUnavailable),
+		models.HealthErrorTLS:         errors.New("x509: certificate signed by unknown authority"),
+		models.HealthErrorAuth:        errors.New(`pq: password authentication failed for user "querybase"`),
+		models.HealthErrorDNS:         &net.OpError{Op: "dial", Err: &net.DNSError{Name: "db.internal", Err: "no such host"}},
+		models.HealthErrorRefused:     &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+		models.HealthErrorTimeout:     fmt.Errorf("ping: %w", context.DeadlineExceeded),
+		models.HealthErrorOther:       errors.New("database is locked"),
+	} {
+		assert.Equal(t, expected, classifyHealthError(err), err.Error())
+	}
+}
+
+func TestDataSourceService_ProbeHealth(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey))
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "edge.db")
+	file, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = file.Exec("CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+	file.Close()
+
+	dataSource := &models.DataSource{
+		ID: uuid.New(), Name: "edge", Type: models.DataSourceTypeSQLite, FilePath: path, IsActive: true,
+	}
+	require.NoError(t, db.Create(dataSource).Error)
+
+	result, err := service.ProbeHealth(ctx, dataSource, models.HealthProbeCheck)
+	require.NoError(t, err)
+	assert.NotEqual(t, dto.HealthStatusUnhealthy, result.Status)
+	require.NotNil(t, result.ConnectLatencyMs)
+	require.NotNil(t, result.PingLatencyMs)
+	assert.NotEmpty(t, result.ServerVersion)
+
+	// A file that is gone makes the probe fail, and the failure is recorded
+	dataSource.FilePath = filepath.Join(t.TempDir(), "missing.db")
+	result, err = service.ProbeHealth(ctx, dataSource, models.HealthProbeSchemaSync)
+	require.NoError(t, err)
+	assert.Equal(t, dto.HealthStatusUnhealthy, result.Status)
+	assert.Nil(t, result.ConnectLatencyMs)
+
+	var probes []models.DataSourceHealthCheck
+	require.NoError(t, db.Where("data_source_id = ?", dataSource.ID).Order("checked_at").Find(&probes).Error)
+	require.Len(t, probes, 2)
+	assert.Equal(t, models.HealthProbeCheck, probes[0].Source)
+	assert.NotEmpty(t, probes[0].ServerVersion)
+	assert.Empty(t, probes[0].ErrorClass)
+	assert.Equal(t, models.HealthProbeSchemaSync, probes[1].Source)
+	assert.Equal(t, string(dto.HealthStatusUnhealthy), probes[1].Status)
+	assert.Equal(t, models.HealthErrorOther, probes[1].ErrorClass)
+	assert.NotEmpty(t, probes[1].Error)
+
+	var stored models.DataSource
+	require.NoError(t, db.First(&stored, "id = ?", dataSource.ID).Error)
+	assert.False(t, stored.IsHealthy)
+	assert.NotNil(t, stored.LastHealthCheck)
+
+	// Probes past the retention are deleted with the next probe
+	service.SetHealthHistory(config.HealthHistoryConfig{Retention: time.Hour})
+	require.NoError(t, db.Model(&models.DataSourceHealthCheck{}).Where("id = ?", probes[0].ID).
+		Update("checked_at", time.Now().Add(-2*time.Hour)).Error)
+	_, err = service.ProbeHealth(ctx, dataSource, models.HealthProbeCheck)
+	require.NoError(t, err)
+	var count int64
+	db.Model(&models.DataSourceHealthCheck{}).Where("data_source_id = ?", dataSource.ID).Count(&count)
+	assert.EqualValues(t, 2, count)
+}
+
+func TestDataSourceService_GetHealthHistory(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey))
+	dataSource := createTestDataSource(t, db)
+	now := time.Now()
+
+	record := func(age time.Duration, status dto.HealthStatus, connectMs int64) {
+		probe := &models.DataSourceHealthCheck{
+			ID: uuid.New(), DataSourceID: dataSource.ID, CheckedAt: now.Add(-age),
+			Source: models.HealthProbeSchemaSync, Status: string(status),
+		}
+		if status == dto.HealthStatusUnhealthy {
+			probe.ErrorClass, probe.Error = models.HealthErrorRefused, "connection refused"
+		} else {
+			probe.ConnectLatencyMs = &connectMs
+		}
+		require.NoError(t, db.Create(probe).Error)
+	}
+
+	// Down for two probes three days ago, then a flap that is still going on
+	record(4*24*time.Hour, dto.HealthStatusHealthy, 10)
+	record(3*24*time.Hour, dto.HealthStatusUnhealthy, 0)
+	record(3*24*time.Hour-30*time.Minute, dto.HealthStatusUnhealthy, 0)
+	record(3*24*time.Hour-time.Hour, dto.HealthStatusHealthy, 20)
+	record(2*time.Hour, dto.HealthStatusDegraded, 30)
+	record(time.Hour, dto.HealthStatusUnhealthy, 0)
+
+	history, err := service.GetHealthHistory(context.Background(), dataSource.ID, now)
+	require.NoError(t, err)
+
+	require.Len(t, history.Windows, 3)
+	day, week := history.Windows[0], history.Windows[1]
+	assert.Equal(t, "24h", day.Window)
+	assert.Equal(t, 2, day.Probes)
+	assert.InDelta(t, 50, *day.UptimePercent, 0.01)
+	assert.InDelta(t, 30, *day.AvgConnectLatencyMs, 0.01)
+	assert.Nil(t, day.MaxReplicaLagSeconds)
+	assert.Equal(t, 6, week.Probes)
+	assert.InDelta(t, 50, *week.UptimePercent, 0.01)
+	assert.InDelta(t, 20, *week.AvgConnectLatencyMs, 0.01)
+
+	require.Len(t, history.Incidents, 2)
+	ongoing, past := history.Incidents[0], history.Incidents[1]
+	assert.Nil(t, ongoing.EndedAt)
+	assert.Equal(t, 1, ongoing.Probes)
+	assert.EqualValues(t, 3600, ongoing.DurationSeconds)
+	require.NotNil(t, past.EndedAt)
+	assert.Equal(t, 2, past.Probes)
+	assert.EqualValues(t, 3600, past.DurationSeconds)
+	assert.Equal(t, models.HealthErrorRefused, past.ErrorClass)
+
+	require.Len(t, history.RecentProbes, 6)
+	assert.Equal(t, string(dto.HealthStatusUnhealthy), history.RecentProbes[0].Status)
+
+	// A data source without probes has no uptime yet
+	empty, err := service.GetHealthHistory(context.Background(), uuid.New(), now)
+	require.NoError(t, err)
+	assert.Nil(t, empty.Windows[0].UptimePercent)
+	assert.Empty(t, empty.Incidents)
+}
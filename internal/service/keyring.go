@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidEncryptionKeys is returned for encryption settings that can't be used
+	ErrInvalidEncryptionKeys = errors.New("invalid encryption keys")
+
+	// ErrUnknownEncryptionKey is returned for a secret encrypted with a key that is not configured
+	ErrUnknownEncryptionKey = errors.New("unknown encryption key")
+)
+
+// encryptionKeyID matches the IDs of encryption keys. Base64 has no colon, so the ID and the
+// ciphertext it prefixes can always be told apart.
+var encryptionKeyID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Keyring encrypts data source secrets. New secrets are encrypted with the active key and stored as
+// "{key ID}:{base64 ciphertext}", so every configured key can decrypt what it encrypted and keys can
+// be rotated without downtime. Secrets stored without a key ID were encrypted with the legacy key.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+	legacy   []byte
+}
+
+// NewKeyring creates the keyring of the encryption settings
+func NewKeyring(encryptionConfig config.EncryptionConfig) (*Keyring, error) {
+	keyring := &Keyring{
+		activeID: strings.TrimSpace(encryptionConfig.ActiveKey),
+		keys:     make(map[string][]byte),
+		legacy:   []byte(encryptionConfig.LegacyKey),
+	}
+
+	for _, entry := range strings.Split(encryptionConfig.Keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(entry, ":")
+		if !ok || !encryptionKeyID.MatchString(id) {
+			return nil, fmt.Errorf("%w: keys are id:key pairs, with IDs of letters, digits, '.', '_' and '-'", ErrInvalidEncryptionKeys)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%w: key %s must be exactly 32 characters for AES-256", ErrInvalidEncryptionKeys, id)
+		}
+		if _, dup := keyring.keys[id]; dup {
+			return nil, fmt.Errorf("%w: key %s is configured twice", ErrInvalidEncryptionKeys, id)
+		}
+		keyring.keys[id] = []byte(key)
+	}
+
+	switch {
+	case keyring.activeID == "" && len(keyring.keys) > 0:
+		return nil, fmt.Errorf("%w: active_key must name the key new secrets are encrypted with", ErrInvalidEncryptionKeys)
+	case keyring.activeID != "" && keyring.keys[keyring.activeID] == nil:
+		return nil, fmt.Errorf("%w: active key %s is not configured", ErrInvalidEncryptionKeys, keyring.activeID)
+	case keyring.activeID == "" && len(keyring.legacy) == 0:
+		return nil, fmt.Errorf("%w: no key is configured", ErrInvalidEncryptionKeys)
+	}
+	return keyring, nil
+}
+
+// NewLegacyKeyring returns a keyring that encrypts with a single key and no key ID, like secrets
+// were stored before key IDs
+func NewLegacyKeyring(key string) *Keyring {
+	return &Keyring{keys: make(map[string][]byte), legacy: []byte(key)}
+}
+
+// ActiveKeyID returns the ID of the key new secrets are encrypted with, empty for the legacy key
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Encrypt encrypts a secret with the active key using AES-256-GCM
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k.activeID == "" {
+		return seal(k.legacy, plaintext, nil)
+	}
+	// The key ID is authenticated, so a ciphertext can't be relabelled with another key
+	ciphertext, err := seal(k.keys[k.activeID], plaintext, []byte(k.activeID))
+	if err != nil {
+		return "", err
+	}
+	return k.activeID + ":" + ciphertext, nil
+}
+
+// Decrypt decrypts a secret with the key it was encrypted with. An empty secret stays empty.
+func (k *Keyring) Decrypt(encrypted string) (string, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	id, ciphertext, ok := strings.Cut(encrypted, ":")
+	if !ok {
+		if len(k.legacy) == 0 {
+			return "", fmt.Errorf("%w: the secret has no key ID and no legacy key is configured", ErrUnknownEncryptionKey)
+		}
+		return open(k.legacy, encrypted, nil)
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, id)
+	}
+	return open(key, ciphertext, []byte(id))
+}
+
+// KeyID returns the ID of the key a secret was encrypted with, empty for the legacy key
+func (k *Keyring) KeyID(encrypted string) string {
+	id, _, ok := strings.Cut(encrypted, ":")
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// NeedsRotation reports whether a secret is encrypted with another key than the active one
+func (k *Keyring) NeedsRotation(encrypted string) bool {
+	return encrypted != "" && k.KeyID(encrypted) != k.activeID
+}
+
+// seal encrypts a secret and returns base64(nonce + ciphertext)
+func seal(key []byte, plaintext string, additionalData []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	// Create GCM mode
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate nonce
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := aesgcm.Seal(nonce, nonce, []byte(plaintext), additionalData)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// open decrypts base64(nonce + ciphertext)
+func open(key []byte, encoded string, additionalData []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	// Create GCM mode
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	// Extract nonce
+	nonceSize := aesgcm.NonceSize()
+	if len(data) < nonceSize {
+		return "", fmt.Errorf("encrypted data too short")
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// ReencryptResult counts what a key rotation re-encrypted
+type ReencryptResult struct {
+	DataSources int
+	Secrets     int
+}
+
+// ReencryptSecrets re-encrypts every data source secret that is not encrypted with the active key:
+// passwords, TLS material and SSH credentials. It runs in one transaction, so a secret that can't be
+// decrypted leaves everything as it was. Running it again only re-encrypts what is left.
+func ReencryptSecrets(ctx context.Context, db *gorm.DB, keyring *Keyring) (*ReencryptResult, error) {
+	result := &ReencryptResult{}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var dataSources []models.DataSource
+		if err := tx.Order("name").Find(&dataSources).Error; err != nil {
+			return fmt.Errorf("failed to list data sources: %w", err)
+		}
+
+		for _, dataSource := range dataSources {
+			updates := make(map[string]interface{})
+			for column, encrypted := range map[string]string{
+				"encrypted_password":        dataSource.EncryptedPassword,
+				"encrypted_tls_ca_cert":     dataSource.EncryptedTLSCACert,
+				"encrypted_tls_client_cert": dataSource.EncryptedTLSClientCert,
+				"encrypted_tls_client_key":  dataSource.EncryptedTLSClientKey,
+				"encrypted_ssh_private_key": dataSource.EncryptedSSHPrivateKey,
+				"encrypted_ssh_password":    dataSource.EncryptedSSHPassword,
+			} {
+				if !keyring.NeedsRotation(encrypted) {
+					continue
+				}
+				plaintext, err := keyring.Decrypt(encrypted)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt %s of data source %s: %w", column, dataSource.Name, err)
+				}
+				if updates[column], err = keyring.Encrypt(plaintext); err != nil {
+					return fmt.Errorf("failed to encrypt %s of data source %s: %w", column, dataSource.Name, err)
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+
+			// UpdateColumns leaves updated_at alone, as the settings of the data source are unchanged
+			if err := tx.Model(&dataSource).UpdateColumns(updates).Error; err != nil {
+				return fmt.Errorf("failed to update data source %s: %w", dataSource.Name, err)
+			}
+			result.DataSources++
+			result.Secrets += len(updates)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+const (
+	testKey2025 = "2025aaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testKey2026 = "2026bbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestNewKeyring_Validation(t *testing.T) {
+	for name, encryptionConfig := range map[string]config.EncryptionConfig{
+		"no key":              {},
+		"short key":           {ActiveKey: "k1", Keys: "k1:too-short"},
+		"missing active key":  {ActiveKey: "k2", Keys: "k1:" + testKey2025},
+		"no active key":       {Keys: "k1:" + testKey2025},
+		"duplicate key":       {ActiveKey: "k1", Keys: "k1:" + testKey2025 + ",k1:" + testKey2026},
+		"key without an ID":   {ActiveKey: "k1", Keys: testKey2025},
+		"ID with a separator": {ActiveKey: "k 1", Keys: "k 1:" + testKey2025},
+	} {
+		_, err := NewKeyring(encryptionConfig)
+		assert.ErrorIs(t, err, ErrInvalidEncryptionKeys, name)
+	}
+
+	keyring, err := NewKeyring(config.EncryptionConfig{ActiveKey: "2026", Keys: " 2025:" + testKey2025 + ", 2026:" + testKey2026})
+	require.NoError(t, err)
+	assert.Equal(t, "2026", keyring.ActiveKeyID())
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	legacy := NewLegacyKeyring(sqliteTestEncryptionKey)
+	legacySecret, err := legacy.Encrypt("secret")
+	require.NoError(t, err)
+	assert.Empty(t, legacy.KeyID(legacySecret))
+
+	old, err := NewKeyring(config.EncryptionConfig{ActiveKey: "2025", Keys: "2025:" + testKey2025})
+	require.NoError(t, err)
+	oldSecret, err := old.Encrypt("secret")
+	require.NoError(t, err)
+	assert.Equal(t, "2025", old.KeyID(oldSecret))
+
+	// During a rotation, secrets of the old key, and of the JWT secret before it, still decrypt
+	keyring, err := NewKeyring(config.EncryptionConfig{
+		ActiveKey: "2026",
+		Keys:      "2025:" + testKey2025 + ",2026:" + testKey2026,
+		LegacyKey: sqliteTestEncryptionKey,
+	})
+	require.NoError(t, err)
+	for _, encrypted := range []string{legacySecret, oldSecret} {
+		plaintext, err := keyring.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", plaintext)
+		assert.True(t, keyring.NeedsRotation(encrypted))
+	}
+
+	newSecret, err := keyring.Encrypt("secret")
+	require.NoError(t, err)
+	assert.Equal(t, "2026", keyring.KeyID(newSecret))
+	assert.False(t, keyring.NeedsRotation(newSecret))
+
+	// A retired key can no longer decrypt, and the key ID can't be swapped
+	_, err = NewLegacyKeyring(sqliteTestEncryptionKey).Decrypt(newSecret)
+	assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+	_, err = keyring.Decrypt("2025" + newSecret[len("2026"):])
+	assert.Error(t, err)
+
+	empty, err := keyring.Decrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func TestReencryptSecrets(t *testing.T) {
+	db := setupTestDB(t)
+	pki := newTestPKI(t)
+
+	// Data sources created before keys were configured are encrypted with the JWT secret
+	legacy := NewLegacyKeyring(sqliteTestEncryptionKey)
+	dataSource, err := NewDataSourceService(db, legacy).CreateDataSource(context.Background(), &CreateDataSourceInput{
+		Name: "warehouse", Type: string(models.DataSourceTypePostgreSQL), Host: "db.internal", Port: 5432,
+		DatabaseName: "dw", Username: "querybase", Password: "secret",
+		TLSMode: "verify-ca", TLSCACert: pki.caPEM,
+	})
+	require.NoError(t, err)
+
+	keyring, err := NewKeyring(config.EncryptionConfig{ActiveKey: "2026", Keys: "2026:" + testKey2026, LegacyKey: sqliteTestEncryptionKey})
+	require.NoError(t, err)
+
+	// The password and the CA certificate are re-encrypted; the unset TLS client key stays empty
+	result, err := ReencryptSecrets(context.Background(), db, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, &ReencryptResult{DataSources: 1, Secrets: 2}, result)
+
+	var stored models.DataSource
+	require.NoError(t, db.First(&stored, "id = ?", dataSource.ID).Error)
+	assert.Equal(t, "2026", keyring.KeyID(stored.EncryptedPassword))
+	assert.Equal(t, "2026", keyring.KeyID(stored.EncryptedTLSCACert))
+	assert.Empty(t, stored.EncryptedTLSClientKey)
+
+	// The legacy key is no longer needed
+	rotated, err := NewKeyring(config.EncryptionConfig{ActiveKey: "2026", Keys: "2026:" + testKey2026})
+	require.NoError(t, err)
+	credentials, err := resolveCredentials(context.Background(), rotated.Decrypt, NewSecretResolver(config.SecretsConfig{}), &stored)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", credentials.Password)
+	assert.Equal(t, pki.caPEM, credentials.TLSCACert)
+
+	// Nothing is left to rotate
+	result, err = ReencryptSecrets(context.Background(), db, rotated)
+	require.NoError(t, err)
+	assert.Zero(t, result.Secrets)
+
+	// A secret no configured key can decrypt leaves everything as it was
+	other, err := NewKeyring(config.EncryptionConfig{ActiveKey: "2027", Keys: "2027:" + testKey2025})
+	require.NoError(t, err)
+	_, err = ReencryptSecrets(context.Background(), db, other)
+	assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+	var unchanged models.DataSource
+	require.NoError(t, db.First(&unchanged, "id = ?", dataSource.ID).Error)
+	assert.Equal(t, stored.EncryptedPassword, unchanged.EncryptedPassword)
+}
@@ -118,7 +118,7 @@ func TestRequiresApproval_OperationCoverage(t *testing.T) {
 
 func TestCreateMultiQueryTransaction_CreatesStatements(t *testing.T) {
 	db := setupWorkflowDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	svc := NewMultiQueryService(db, queryService, nil, nil)
 
 	user := createTestUser(t, db, models.RoleAdmin)
@@ -155,7 +155,7 @@ func TestCreateMultiQueryTransaction_CreatesStatements(t *testing.T) {
 
 func TestCreateMultiQueryTransaction_SingleStatement(t *testing.T) {
 	db := setupWorkflowDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	svc := NewMultiQueryService(db, queryService, nil, nil)
 
 	user := createTestUser(t, db, models.RoleAdmin)
@@ -176,7 +176,7 @@ func TestCreateMultiQueryTransaction_SingleStatement(t *testing.T) {
 
 func TestRollbackMultiQuery_ActiveTransaction(t *testing.T) {
 	db := setupWorkflowDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	svc := NewMultiQueryService(db, queryService, nil, nil)
 
 	user := createTestUser(t, db, models.RoleAdmin)
@@ -196,7 +196,7 @@ func TestRollbackMultiQuery_ActiveTransaction(t *testing.T) {
 
 func TestRollbackMultiQuery_NonActiveTransaction(t *testing.T) {
 	db := setupWorkflowDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	svc := NewMultiQueryService(db, queryService, nil, nil)
 
 	user := createTestUser(t, db, models.RoleAdmin)
@@ -215,7 +215,7 @@ func TestRollbackMultiQuery_NonActiveTransaction(t *testing.T) {
 
 func TestRollbackMultiQuery_NonExistentTransaction(t *testing.T) {
 	db := setupWorkflowDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	svc := NewMultiQueryService(db, queryService, nil, nil)
 
 	err := svc.RollbackMultiQuery(nil, uuid.New())
@@ -229,7 +229,7 @@ func TestRollbackMultiQuery_NonExistentTransaction(t *testing.T) {
 
 func TestGetMultiQueryStatements_OrderedBySequence(t *testing.T) {
 	db := setupWorkflowDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	svc := NewMultiQueryService(db, queryService, nil, nil)
 
 	user := createTestUser(t, db, models.RoleAdmin)
@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"time"
 
@@ -105,6 +107,152 @@ func (s *NotificationService) sendGoogleChatNotification(config *models.Notifica
 	return nil
 }
 
+// ScheduledResult is the outcome of a scheduled query run sent to a notification channel
+type ScheduledResult struct {
+	ScheduleName   string
+	QueryName      string
+	DataSourceName string
+	Status         models.ScheduleRunStatus
+	RowCount       int
+	Truncated      bool
+	ErrorMessage   string
+	ResultURL      string
+	FileName       string
+	Attachment     []byte // CSV of the result; nil sends the link only
+}
+
+// scheduledResultPayload is the JSON body posted to generic webhooks
+type scheduledResultPayload struct {
+	Event      string `json:"event"`
+	Schedule   string `json:"schedule"`
+	Query      string `json:"query"`
+	DataSource string `json:"data_source"`
+	Status     string `json:"status"`
+	RowCount   int    `json:"row_count"`
+	Truncated  bool   `json:"truncated"`
+	Error      string `json:"error,omitempty"`
+	ResultURL  string `json:"result_url"`
+	FileName   string `json:"file_name,omitempty"`
+}
+
+// SendScheduledResult delivers the result of a scheduled run and returns how it was delivered.
+// Google Chat can't receive files, so attachments are replaced by the link there.
+func (s *NotificationService) SendScheduledResult(ctx context.Context, config *models.NotificationConfig, result *ScheduledResult) (models.ScheduleDelivery, error) {
+	if config.Channel != models.NotificationChannelWebhook {
+		return models.ScheduleDeliveryLink, s.sendGoogleChatNotification(config, s.formatScheduledResultMessage(result))
+	}
+
+	payload := scheduledResultPayload{
+		Event:      "scheduled_query_result",
+		Schedule:   result.ScheduleName,
+		Query:      result.QueryName,
+		DataSource: result.DataSourceName,
+		Status:     string(result.Status),
+		RowCount:   result.RowCount,
+		Truncated:  result.Truncated,
+		Error:      result.ErrorMessage,
+		ResultURL:  result.ResultURL,
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if result.Attachment == nil {
+		return models.ScheduleDeliveryLink, s.postWebhook(ctx, config.WebhookURL, "application/json", bytes.NewReader(payloadJSON))
+	}
+
+	// The payload goes in a form field next to the CSV file
+	payload.FileName = result.FileName
+	if payloadJSON, err = json.Marshal(payload); err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("payload", string(payloadJSON)); err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+	file, err := form.CreateFormFile("file", result.FileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+	if _, err := file.Write(result.Attachment); err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+
+	return models.ScheduleDeliveryAttachment, s.postWebhook(ctx, config.WebhookURL, form.FormDataContentType(), &body)
+}
+
+// postWebhook posts a body to a webhook and checks the response status
+func (s *NotificationService) postWebhook(ctx context.Context, url, contentType string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// formatScheduledResultMessage formats the result of a scheduled run for Google Chat
+func (s *NotificationService) formatScheduledResultMessage(result *ScheduledResult) *GoogleChatMessage {
+	var text string
+	switch {
+	case result.Status != models.ScheduleRunSucceeded:
+		text = fmt.Sprintf("**Status:** failed\n\n**Error:** %s", result.ErrorMessage)
+	case result.Truncated:
+		text = fmt.Sprintf("**Rows:** %d (truncated by the result limit)", result.RowCount)
+	default:
+		text = fmt.Sprintf("**Rows:** %d", result.RowCount)
+	}
+
+	return &GoogleChatMessage{
+		Text: fmt.Sprintf("⏰ Scheduled query %s: %s", result.ScheduleName, result.Status),
+		Cards: []Card{
+			{
+				Header: &CardHeader{
+					Title:    result.ScheduleName,
+					Subtitle: fmt.Sprintf("Data Source: %s", result.DataSourceName),
+				},
+				Sections: []CardSection{
+					{
+						Widgets: []Widget{
+							{TextParagraph: &TextWidget{Text: text}},
+						},
+					},
+					{
+						Widgets: []Widget{
+							{
+								Buttons: []ButtonWidget{
+									{
+										TextButton: &TextButton{
+											Text:    "Open Result",
+											OnClick: &OnClick{OpenLink: &OpenLink{URL: result.ResultURL}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 // formatApprovalMessage formats an approval request message for Google Chat
 func (s *NotificationService) formatApprovalMessage(approval *models.ApprovalRequest) *GoogleChatMessage {
 	// Get approval URL (this should be configured in the app)
@@ -19,7 +19,7 @@ func TestAdminRole_BypassesAllPermissionChecks(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := &models.User{
 		ID:           uuid.New(),
@@ -65,7 +65,7 @@ func TestAdminRole_CanExecuteAnyQueryType(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := createTestUser(t, db, models.RoleAdmin)
 	dataSource := createTestDataSource(t, db)
@@ -85,7 +85,7 @@ func TestAdminRole_CanApproveAnyRequest(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := createTestUser(t, db, models.RoleAdmin)
 	dataSource := createTestDataSource(t, db)
@@ -102,7 +102,7 @@ func TestAdminRole_CanAccessAnyDataSource(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := createTestUser(t, db, models.RoleAdmin)
 
@@ -129,7 +129,7 @@ func TestAdminRole_CanViewAllQueryHistory(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := createTestUser(t, db, models.RoleAdmin)
 	otherUser := createTestUser(t, db, models.RoleUser)
@@ -251,7 +251,7 @@ func TestAdminRole_CanDeleteAnyQuery(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := createTestUser(t, db, models.RoleAdmin)
 	otherUser := createTestUser(t, db, models.RoleUser)
@@ -287,7 +287,7 @@ func TestAdminRole_HasFullPermissionsComparedToViewer(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	adminUser := createTestUser(t, db, models.RoleAdmin)
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -324,7 +324,7 @@ func TestAdminRole_NormalUserNeedsPermissions(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	regularUser := createTestUser(t, db, models.RoleUser)
 	dataSource := createTestDataSource(t, db)
@@ -439,7 +439,7 @@ func TestReadOnlyUser_CanExecuteSelectQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
 
@@ -464,7 +464,7 @@ func TestReadOnlyUser_CannotExecuteInsertQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
 
@@ -492,7 +492,7 @@ func TestReadOnlyUser_CannotExecuteUpdateQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
 
@@ -520,7 +520,7 @@ func TestReadOnlyUser_CannotExecuteDeleteQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
 
@@ -548,7 +548,7 @@ func TestReadOnlyUser_CanViewOwnQueryHistory(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
 	otherUser := createTestUser(t, db, models.RoleUser)
@@ -601,7 +601,7 @@ func TestReadOnlyUser_CannotApproveWriteRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
@@ -634,7 +634,7 @@ func TestReadOnlyUser_CanPreviewQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
 
@@ -720,7 +720,7 @@ func TestWriteUser_HasWritePermissions(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
 
@@ -741,7 +741,7 @@ func TestWriteUser_CanExecuteInsertWithApproval(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
 
@@ -762,7 +762,7 @@ func TestWriteUser_CanExecuteUpdateWithApproval(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
 
@@ -783,7 +783,7 @@ func TestWriteUser_CanExecuteDeleteWithApproval(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
 
@@ -804,7 +804,7 @@ func TestWriteUser_CanCreateApprovalRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
@@ -836,7 +836,7 @@ func TestWriteUser_CannotApproveOwnRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
@@ -871,7 +871,7 @@ func TestWriteUser_CanViewOwnRequestsAndHistory(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
@@ -942,7 +942,7 @@ func TestWriteUser_CanPreviewWriteQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	writeUser, _, dataSource := createWriteUserWithPermission(t, db)
 
@@ -971,7 +971,7 @@ func TestUserWithoutPermissions_CannotExecuteAnyQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	userWithoutPerms := createUserWithoutPermissions(t, db)
 	dataSource := createTestDataSource(t, db)
@@ -1013,7 +1013,7 @@ func TestApproverUser_CanApproveWriteRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create requester (regular user)
@@ -1086,7 +1086,7 @@ func TestApproverUser_CannotApproveOwnRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create approver user with can_approve permission
@@ -1160,7 +1160,7 @@ func TestApproverUser_CanRejectRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create requester (regular user)
@@ -1231,7 +1231,7 @@ func TestApproverUser_ApprovalAppearsInList(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create requester (regular user)
@@ -1303,7 +1303,7 @@ func TestApproverUser_HasCanApprovePermission(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create approver user with can_approve permission
 	approver := createTestUser(t, db, models.RoleUser)
@@ -1351,7 +1351,7 @@ func TestApproverUser_CanViewAllPendingApprovals(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create multiple requesters
@@ -1425,7 +1425,7 @@ func TestApproverUser_CannotApproveAlreadyApproved(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create requester
@@ -1517,7 +1517,7 @@ func TestViewerRole_CannotExecuteWriteQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1559,7 +1559,7 @@ func TestViewerRole_CanOnlyViewQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1621,7 +1621,7 @@ func TestViewerRole_CannotCreateApprovalRequests(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1648,7 +1648,7 @@ func TestViewerRole_CannotApproveAnything(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1713,7 +1713,7 @@ func TestViewerRole_LimitedQueryHistoryAccess(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1766,7 +1766,7 @@ func TestViewerRole_CanPreviewQueries(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1839,7 +1839,7 @@ func TestViewerRole_HasReadOnlyPermissions(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -1911,7 +1911,7 @@ func TestApproverUser_CannotApproveAlreadyRejected(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create requester
@@ -2003,7 +2003,7 @@ func TestGroupInheritance_MultipleGroups_UnionPermissions(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2085,7 +2085,7 @@ func TestGroupInheritance_GroupAReadGroupBWrite_UserGetsBoth(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2155,7 +2155,7 @@ func TestGroupInheritance_OverlappingGroups_UnionNotOverride(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2227,7 +2227,7 @@ func TestGroupInheritance_CanApproveInherited(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create a regular user
@@ -2294,7 +2294,7 @@ func TestGroupInheritance_AllPermissionsGroup_FullAccess(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2349,7 +2349,7 @@ func TestGroupInheritance_RemovedFromGroup_LosesPermissions(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2424,7 +2424,7 @@ func TestGroupInheritance_AddedToGroup_GainsPermissions(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2497,7 +2497,7 @@ func TestGroupInheritance_MultipleGroupsSamePermission_NoDuplication(t *testing.
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a regular user
 	user := createTestUser(t, db, models.RoleUser)
@@ -2586,7 +2586,7 @@ func TestPermissionDenial_Returns403WhenLacksPermission(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a user without any permissions
 	userWithoutPerms := createTestUser(t, db, models.RoleUser)
@@ -2623,7 +2623,7 @@ func TestPermissionDenial_ErrorMessageContainsDetails(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create a user with only read permission
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
@@ -2665,7 +2665,7 @@ func TestPermissionDenial_AccessWithoutMembership_Returns403(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create user without any group membership
 	userWithoutMembership := createTestUser(t, db, models.RoleUser)
@@ -2719,7 +2719,7 @@ func TestPermissionDenial_ExecuteWriteAsViewer_Returns403(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create viewer user
 	viewerUser := createTestUser(t, db, models.RoleViewer)
@@ -2795,7 +2795,7 @@ func TestPermissionDenial_ApproveWithoutPermission_Returns403(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 	approvalService := NewApprovalService(db, queryService, nil)
 
 	// Create users
@@ -2902,7 +2902,7 @@ func TestPermissionDenial_ExecuteQueryWithoutRead_Returns403(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create user without any group membership (no permissions)
 	userWithoutRead := createTestUser(t, db, models.RoleUser)
@@ -2938,7 +2938,7 @@ func TestPermissionDenial_PreviewWriteWithoutWrite_Returns403(t *testing.T) {
 	}
 
 	db := setupTestDB(t)
-	queryService := NewQueryService(db, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	// Create user with only read permission
 	readOnlyUser, _, dataSource := createReadOnlyUserWithPermission(t, db)
@@ -1,11 +1,10 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
@@ -16,9 +15,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/config"
 	"github.com/yourorg/querybase/internal/models"
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -35,25 +33,38 @@ type ActiveTransaction struct {
 
 // QueryService handles query execution logic
 type QueryService struct {
-	db                 *gorm.DB
-	encryptionKey      []byte
-	activeTransactions map[uuid.UUID]*ActiveTransaction
-	txMutex            sync.RWMutex
-	statsService       *StatsService
-	auditService       *AuditService
+	db                  *gorm.DB
+	keyring             *Keyring
+	activeTransactions  map[uuid.UUID]*ActiveTransaction
+	txMutex             sync.RWMutex
+	runningQueries      map[uuid.UUID]*runningQuery
+	runningMutex        sync.Mutex
+	connections         *ConnectionManager
+	roleLimits          map[models.UserRole]ResultLimits
+	environmentPolicies map[string]EnvironmentPolicy
+	statsService        *StatsService
+	auditService        *AuditService
+	resultCache         *ResultCache
 }
 
 // NewQueryService creates a new query service
-func NewQueryService(db *gorm.DB, encryptionKey string, statsService *StatsService, auditService *AuditService) *QueryService {
+func NewQueryService(db *gorm.DB, keyring *Keyring, statsService *StatsService, auditService *AuditService) *QueryService {
 	return &QueryService{
 		db:                 db,
-		encryptionKey:      []byte(encryptionKey),
+		keyring:            keyring,
 		activeTransactions: make(map[uuid.UUID]*ActiveTransaction),
+		runningQueries:     make(map[uuid.UUID]*runningQuery),
+		connections:        NewConnectionManager(config.DataSourcePoolConfig{}),
 		statsService:       statsService,
 		auditService:       auditService,
 	}
 }
 
+// SetConnectionManager shares a connection manager with other services
+func (s *QueryService) SetConnectionManager(connections *ConnectionManager) {
+	s.connections = connections
+}
+
 // ConnectToDataSourcePublic is a public wrapper around connectToDataSource
 // used by external handlers for audit capability testing
 func (s *QueryService) ConnectToDataSourcePublic(dataSource *models.DataSource) (*gorm.DB, error) {
@@ -127,6 +138,15 @@ func (s *QueryService) GetEffectivePermissions(ctx context.Context, userID, dsID
 
 // ExecuteQuery executes a SQL query on a data source
 func (s *QueryService) ExecuteQuery(ctx context.Context, query *models.Query, dataSource *models.DataSource) (*models.QueryResult, error) {
+	return s.ExecuteQueryWithOptions(ctx, query, dataSource, ExecuteOptions{})
+}
+
+// ExecuteQueryWithOptions executes a SQL query on a data source. SELECT results may be served from
+// the result cache, after the same permission checks, unless options.Refresh is set. SELECTs that run
+// on the data source are checked by its cost guard first and fail with a *CostGuardError when stopped.
+func (s *QueryService) ExecuteQueryWithOptions(ctx context.Context, query *models.Query, dataSource *models.DataSource, options ExecuteOptions) (*models.QueryResult, error) {
+	startTime := time.Now()
+
 	// Normalize the query text before execution (fixes common syntax mistakes)
 	query.QueryText = normalizeSQLForExecution(query.QueryText)
 
@@ -160,108 +180,203 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, query *models.Query, da
 		}
 	}
 
+	// Anything the environment policy sends to approval is refused here, including queued and
+	// scheduled runs; approved SELECTs run through RunApprovedQuery and approved writes through
+	// ExecuteQueryInTransaction
+	if !options.Approved && s.ApprovalRequired(query.UserID, dataSource, operationType) {
+		return nil, ErrApprovalRequired
+	}
+
 	// For write operations, we should not execute directly (should go through approval) unless explicitly bypassed by a transaction runner
 	if operationType != models.OperationSelect {
 		// NOTE: if query execution reaches here for write, it means it was approved and run by admin,
 		// or is running in a transaction. The API handler usually blocks direct execution.
 	}
 
-	// Get database connection
-	dataSourceDB, err := s.connectToDataSource(dataSource)
+	// Named parameters are bound as driver arguments, never interpolated into the text
+	sqlText, args, err := bindQuery(query, query.QueryText, dataSource.Type)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to data source: %w", err)
+		return nil, err
 	}
 
-	// Execute the query — write ops use Exec(), reads use Raw().Rows()
-	if operationType != models.OperationSelect {
-		// Write query: use Exec to get affected row count
-		execResult := dataSourceDB.Exec(query.QueryText)
-		if execResult.Error != nil {
-			s.db.Model(query).Updates(map[string]interface{}{
-				"status":        models.StatusFailed,
-				"error_message": execResult.Error.Error(),
-			})
-			return nil, fmt.Errorf("query execution failed: %w", execResult.Error)
+	// Row and byte budgets are enforced while scanning so large results never reach memory
+	limits := s.resultLimitsFor(query.UserID, dataSource)
+
+	// Cached SELECT results are keyed by the bound statement, so each parameter set has its own entry
+	var cacheKey string
+	if operationType == models.OperationSelect {
+		cacheKey = s.resultCacheKey(dataSource, sqlText, args, limits)
+	}
+	if cacheKey != "" && !options.Refresh {
+		cached, err := s.resultCache.Get(ctx, cacheKey)
+		if err != nil {
+			log.Printf("[ExecuteQuery] Result cache lookup failed, running on the data source: %v", err)
+		} else if cached != nil {
+			return s.cachedQueryResult(query, cached, startTime)
 		}
-		// Build a minimal result
-		return &models.QueryResult{
-			RowCount:    int(execResult.RowsAffected),
-			ColumnNames: `["rows_affected"]`,
-			ColumnTypes: `["int"]`,
-			Data:        fmt.Sprintf(`[{"rows_affected":%d}]`, execResult.RowsAffected),
-		}, nil
 	}
 
-	log.Printf("[ExecuteQuery] Executing on DB: %s", query.QueryText)
-
-	rows, err := dataSourceDB.Raw(query.QueryText).Rows()
-	if err != nil {
-		// Update query status to failed
-		s.db.Model(query).Updates(map[string]interface{}{
-			"status":        models.StatusFailed,
-			"error_message": err.Error(),
-		})
-
-		return nil, fmt.Errorf("query execution failed: %w", err)
+	// SELECTs the planner expects to be expensive are blocked, flagged or sent for approval
+	if operationType == models.OperationSelect && costGuardEnabled(dataSource) {
+		if err := s.checkQueryCost(ctx, query, dataSource, sqlText, args, options.Approved); err != nil {
+			// A query sent for approval stays pending until the approval runs it
+			if !errors.Is(err, ErrCostGuardApprovalRequired) {
+				s.failQuery(query, err)
+			}
+			return nil, err
+		}
 	}
-	defer rows.Close()
 
-	// Parse results
-	columns, err := rows.Columns()
+	// SELECTs are routed to a healthy replica when the data source has one; writes stay on the primary
+	var dataSourceDB *gorm.DB
+	endpoint := dataSource
+	if operationType == models.OperationSelect {
+		dataSourceDB, endpoint, err = s.connectForRead(dataSource)
+	} else {
+		dataSourceDB, err = s.connectToDataSource(dataSource)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return nil, fmt.Errorf("failed to connect to data source: %w", err)
 	}
 
-	log.Printf("[ExecuteQuery] Got %d columns from DB", len(columns))
+	// Register the query so it can be cancelled on the server it runs on,
+	// and bound it by the data source statement timeout
+	runCtx, finish := s.startRunningQuery(ctx, query.ID, endpoint)
+	defer finish()
+
+	var (
+		rowsAffected int64
+		columns      []string
+		typeNames    []string
+		rowCount     int
+		dataJSON     bytes.Buffer
+		truncatedBy  string
+	)
+
+	// Pin a single connection so the session timeout and backend ID apply to the statement we run
+	execErr := dataSourceDB.WithContext(runCtx).Connection(func(conn *gorm.DB) error {
+		if err := s.prepareSession(conn, query.ID, dataSource); err != nil {
+			return err
+		}
+		defer s.resetSession(conn, dataSource)
 
-	// Get column types from the result set
-	columnTypes, err := rows.ColumnTypes()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get column types: %w", err)
-	}
+		// Execute the query — write ops use Exec(), reads use Raw().Rows()
+		if operationType != models.OperationSelect {
+			// Write query: use Exec to get affected row count
+			affected, err := execStatement(conn, sqlText, args)
+			if err != nil {
+				return s.classifyExecutionError(runCtx, query.ID, dataSource, err)
+			}
+			rowsAffected = affected
+			return nil
+		}
 
-	// Extract database type names from column types
-	typeNames := make([]string, len(columns))
-	for i, ct := range columnTypes {
-		typeNames[i] = ct.DatabaseTypeName()
-	}
+		log.Printf("[ExecuteQuery] Executing on %s: %s", endpoint.Name, query.QueryText)
 
-	results := make([]map[string]interface{}, 0) // non-nil so JSON marshals to [] not null
-	for rows.Next() {
-		// Create a slice of interface{} to hold each column value
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
+		// Reads run in a read-only transaction, so a SELECT calling a function that writes fails
+		tx, err := beginReadOnly(conn)
+		if err != nil {
+			return err
+		}
+		defer endReadOnly(tx)
 
-		for i := range columns {
-			valuePtrs[i] = &values[i]
+		rows, err := queryRows(tx, sqlText, args)
+		if err != nil {
+			return s.classifyExecutionError(runCtx, query.ID, dataSource, err)
 		}
+		defer rows.Close()
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+		// Parse results
+		columns, err = rows.Columns()
+		if err != nil {
+			return fmt.Errorf("failed to get columns: %w", err)
 		}
 
-		// Create a map for this row
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			b, ok := val.([]byte)
-			if ok {
-				v = string(b)
-			} else {
-				v = val
+		log.Printf("[ExecuteQuery] Got %d columns from DB", len(columns))
+
+		// Get column types from the result set
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return fmt.Errorf("failed to get column types: %w", err)
+		}
+
+		// Extract database type names from column types
+		typeNames = make([]string, len(columns))
+		for i, ct := range columnTypes {
+			typeNames[i] = ct.DatabaseTypeName()
+		}
+
+		for rows.Next() {
+			if limits.MaxRows > 0 && rowCount >= limits.MaxRows {
+				truncatedBy = ResultLimitMaxRows
+				break
 			}
-			row[col] = v
+
+			// Create a slice of interface{} to hold each column value
+			values := make([]interface{}, len(columns))
+			valuePtrs := make([]interface{}, len(columns))
+
+			for i := range columns {
+				valuePtrs[i] = &values[i]
+			}
+
+			if err := rows.Scan(valuePtrs...); err != nil {
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+
+			// Keep the values in column order so duplicate column names are not lost
+			row := make([]interface{}, len(columns))
+			for i, val := range values {
+				if b, ok := val.([]byte); ok {
+					row[i] = string(b)
+				} else {
+					row[i] = val
+				}
+			}
+
+			rowJSON, err := json.Marshal(row)
+			if err != nil {
+				return fmt.Errorf("failed to serialize row: %w", err)
+			}
+
+			// Account for the separating comma and the enclosing brackets
+			if limits.MaxBytes > 0 && int64(dataJSON.Len()+len(rowJSON)+2) > limits.MaxBytes {
+				truncatedBy = ResultLimitMaxBytes
+				break
+			}
+			if rowCount > 0 {
+				dataJSON.WriteByte(',')
+			}
+			dataJSON.Write(rowJSON)
+			rowCount++
+		}
+
+		// Iteration stops early when the context is cancelled mid-stream
+		if err := rows.Err(); err != nil {
+			return s.classifyExecutionError(runCtx, query.ID, dataSource, err)
 		}
-		results = append(results, row)
+		return nil
+	})
+	if execErr != nil {
+		// Update query status to failed or cancelled
+		s.failQuery(query, execErr)
+		return nil, execErr
 	}
 
-	// Serialize results to JSON
-	resultsJSON, err := json.Marshal(results)
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize results: %w", err)
+	if operationType != models.OperationSelect {
+		// Build a minimal result
+		return &models.QueryResult{
+			RowCount:    int(rowsAffected),
+			ColumnNames: `["rows_affected"]`,
+			ColumnTypes: `["int"]`,
+			Data:        fmt.Sprintf(`[[%d]]`, rowsAffected),
+			DataFormat:  models.ResultFormatRows,
+		}, nil
 	}
 
+	// Rows were serialized while scanning; wrap them into a JSON array
+	resultsJSON := "[" + dataJSON.String() + "]"
+
 	// Serialize column names and types to JSON strings for storage
 	columnNamesJSON, err := json.Marshal(columns)
 	if err != nil {
@@ -274,17 +389,26 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, query *models.Query, da
 		return nil, fmt.Errorf("failed to serialize column types: %w", err)
 	}
 
-	log.Printf("[ExecuteQuery] Scanned %d rows from DB", len(results))
+	log.Printf("[ExecuteQuery] Scanned %d rows from DB", rowCount)
 
 	// Create query result
 	queryResult := &models.QueryResult{
 		ID:          uuid.New(), // Generate proper UUID
 		QueryID:     query.ID,
-		RowCount:    len(results),
+		RowCount:    rowCount,
 		ColumnNames: string(columnNamesJSON), // Store as JSON string
 		ColumnTypes: string(columnTypesJSON), // Store as JSON string
-		Data:        string(resultsJSON),
+		Data:        resultsJSON,
+		DataFormat:  models.ResultFormatRows,
 		StoredAt:    time.Now(),
+		SizeBytes:   len(resultsJSON),
+	}
+
+	if truncatedBy != "" {
+		queryResult.Truncated = true
+		queryResult.TruncatedBy = truncatedBy
+		queryResult.ResultLimit = limits.valueOf(truncatedBy)
+		log.Printf("[ExecuteQuery] Result truncated by %s=%d", truncatedBy, queryResult.ResultLimit)
 	}
 
 	log.Printf("[ExecuteQuery] Returning result: RowCount=%d, DataLength=%d", queryResult.RowCount, len(queryResult.Data))
@@ -294,22 +418,39 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, query *models.Query, da
 		return nil, fmt.Errorf("failed to save query result: %w", err)
 	}
 
+	if cacheKey != "" {
+		ttl := time.Duration(dataSource.ResultCacheTTLSeconds) * time.Second
+		if err := s.resultCache.Set(ctx, cacheKey, queryResult, ttl); err != nil {
+			log.Printf("[ExecuteQuery] Failed to cache result of query %s: %v", query.ID, err)
+		}
+	}
+
+	s.completeQuery(query, rowCount, false, startTime)
+	return queryResult, nil
+}
+
+// completeQuery marks a SELECT as completed and records it in the query history
+// with the time taken since startTime
+func (s *QueryService) completeQuery(query *models.Query, rowCount int, cacheHit bool, startTime time.Time) {
+	executionTime := int(time.Since(startTime).Milliseconds())
+
 	// Update query status
 	s.db.Model(query).Updates(map[string]interface{}{
 		"status": models.StatusCompleted,
 	})
 
 	// Create query history entry
-	rowCount := len(results)
 	queryHistory := &models.QueryHistory{
-		QueryID:       &query.ID,
-		UserID:        query.UserID,
-		DataSourceID:  query.DataSourceID,
-		QueryText:     query.QueryText,
-		OperationType: query.OperationType,
-		Status:        models.StatusCompleted,
-		RowCount:      &rowCount,
-		ExecutedAt:    time.Now(),
+		QueryID:         &query.ID,
+		UserID:          query.UserID,
+		DataSourceID:    query.DataSourceID,
+		QueryText:       query.QueryText,
+		OperationType:   query.OperationType,
+		Status:          models.StatusCompleted,
+		RowCount:        &rowCount,
+		ExecutionTimeMs: &executionTime,
+		CacheHit:        cacheHit,
+		ExecutedAt:      startTime,
 	}
 	s.db.Create(queryHistory)
 
@@ -317,72 +458,46 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, query *models.Query, da
 	if s.statsService != nil {
 		s.statsService.TriggerStatsChanged(query.UserID.String())
 	}
-
-	return queryResult, nil
 }
 
-// GetPaginatedResults retrieves paginated results for a query
-func (s *QueryService) GetPaginatedResults(ctx context.Context, queryID uuid.UUID, page, perPage int, sortColumn, sortDirection string) ([]map[string]interface{}, []string, *PaginationMeta, error) {
+// GetPaginatedResults retrieves paginated results for a query.
+// Rows hold the values in the order of the returned column names.
+func (s *QueryService) GetPaginatedResults(ctx context.Context, queryID uuid.UUID, page, perPage int, sortColumn, sortDirection string) ([][]interface{}, []string, *PaginationMeta, error) {
 	// Get the query result from database
 	var result models.QueryResult
 	err := s.db.Where("query_id = ?", queryID).Order("stored_at DESC").First(&result).Error
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("query result not found: %w", err)
 	}
-
-	// Parse the data from JSONB
-	var allRows []map[string]interface{}
-	if err := json.Unmarshal([]byte(result.Data), &allRows); err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to parse result data: %w", err)
+	if result.PurgedAt != nil {
+		return nil, nil, nil, ErrResultPurged
 	}
 
-	// Parse column names
-	var columnNames []string
-	if err := json.Unmarshal([]byte(result.ColumnNames), &columnNames); err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to parse column names: %w", err)
+	set, err := DecodeQueryResult(&result)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	allRows := set.Rows
 
-	// Sort if requested
+	// Sort if requested; with duplicate names the first matching column wins
 	if sortColumn != "" {
-		allRows = s.sortRows(allRows, sortColumn, sortDirection)
+		if index := set.ColumnIndex(sortColumn); index >= 0 {
+			allRows = s.sortRows(allRows, index, sortDirection)
+		}
 	}
 
 	// Calculate pagination
-	totalRows := len(allRows)
-	totalPages := (totalRows + perPage - 1) / perPage
-	if totalPages == 0 {
-		totalPages = 1
-	}
-
-	// Ensure page is within bounds
-	if page < 1 {
-		page = 1
-	}
-	if page > totalPages {
-		page = totalPages
-	}
-
-	// Calculate offset and limit
-	offset := (page - 1) * perPage
+	metadata := newPaginationMeta(len(allRows), page, perPage)
+	offset := (metadata.Page - 1) * perPage
 	end := offset + perPage
-	if end > totalRows {
-		end = totalRows
+	if end > len(allRows) {
+		end = len(allRows)
 	}
 
 	// Get paginated slice
 	paginatedRows := allRows[offset:end]
 
-	// Build pagination metadata
-	metadata := &PaginationMeta{
-		Page:       page,
-		PerPage:    perPage,
-		TotalPages: totalPages,
-		TotalRows:  totalRows,
-		HasNext:    page < totalPages,
-		HasPrev:    page > 1,
-	}
-
-	return paginatedRows, columnNames, metadata, nil
+	return paginatedRows, set.Columns, metadata, nil
 }
 
 // PaginationMeta represents pagination metadata
@@ -395,26 +510,23 @@ type PaginationMeta struct {
 	HasPrev    bool `json:"has_prev"`
 }
 
-// sortRows sorts rows by the specified column
-func (s *QueryService) sortRows(rows []map[string]interface{}, column, direction string) []map[string]interface{} {
+// sortRows sorts rows by the column at the given index
+func (s *QueryService) sortRows(rows [][]interface{}, column int, direction string) [][]interface{} {
 	// Create a copy to avoid mutating the original
-	sorted := make([]map[string]interface{}, len(rows))
+	sorted := make([][]interface{}, len(rows))
 	copy(sorted, rows)
 
 	// Simple bubble sort for small datasets (can be optimized with quicksort for larger datasets)
 	n := len(sorted)
 	for i := 0; i < n-1; i++ {
 		for j := 0; j < n-i-1; j++ {
-			val1, ok1 := sorted[j][column]
-			val2, ok2 := sorted[j+1][column]
-
 			// If column doesn't exist in either row, skip comparison
-			if !ok1 || !ok2 {
+			if column >= len(sorted[j]) || column >= len(sorted[j+1]) {
 				continue
 			}
 
 			// Compare values
-			cmp := s.compareValues(val1, val2)
+			cmp := s.compareValues(sorted[j][column], sorted[j+1][column])
 			if (direction == "desc" && cmp < 0) || (direction != "desc" && cmp > 0) {
 				sorted[j], sorted[j+1] = sorted[j+1], sorted[j]
 			}
@@ -473,6 +585,9 @@ func (s *QueryService) toFloat64(v interface{}) (float64, bool) {
 		return float64(val), true
 	case float64:
 		return val, true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
 	case string:
 		// Try to parse string as float
 		var f float64
@@ -484,99 +599,71 @@ func (s *QueryService) toFloat64(v interface{}) (float64, bool) {
 	return 0, false
 }
 
-// ExportQuery exports query results in the specified format (CSV or JSON)
+// ExportOptions customizes a stored-result export
+type ExportOptions struct {
+	// TableName is the target table of SQL INSERT exports. Defaults to the first table the query reads from.
+	TableName string
+}
+
+// ExportQuery exports the stored results of a query in one of the registered formats
 func (s *QueryService) ExportQuery(ctx context.Context, queryID uuid.UUID, format string) ([]byte, string, error) {
+	return s.ExportQueryWithOptions(ctx, queryID, format, ExportOptions{})
+}
+
+// ExportQueryWithOptions exports the stored results of a query using the exporter registered for format
+func (s *QueryService) ExportQueryWithOptions(ctx context.Context, queryID uuid.UUID, format string, options ExportOptions) ([]byte, string, error) {
+	exporter, ok := GetExporter(format)
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported export format: %s", format)
+	}
+
 	// Get the query result from database
 	var result models.QueryResult
 	err := s.db.Where("query_id = ?", queryID).Order("stored_at DESC").First(&result).Error
 	if err != nil {
 		return nil, "", fmt.Errorf("query result not found: %w", err)
 	}
-
-	// Parse the data from JSONB
-	var rows []map[string]interface{}
-	if err := json.Unmarshal([]byte(result.Data), &rows); err != nil {
-		return nil, "", fmt.Errorf("failed to parse result data: %w", err)
-	}
-
-	// Parse column names
-	var columnNames []string
-	if err := json.Unmarshal([]byte(result.ColumnNames), &columnNames); err != nil {
-		return nil, "", fmt.Errorf("failed to parse column names: %w", err)
+	if result.PurgedAt != nil {
+		return nil, "", ErrResultPurged
 	}
 
-	// Export based on format
-	switch format {
-	case "csv":
-		csvData, err := s.exportToCSV(rows, columnNames)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to export to CSV: %w", err)
-		}
-		return csvData, "text/csv", nil
-	case "json":
-		jsonData, err := s.exportToJSON(rows, columnNames)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to export to JSON: %w", err)
-		}
-		return jsonData, "application/json", nil
-	default:
-		return nil, "", fmt.Errorf("unsupported export format: %s", format)
+	table, err := s.loadExportTable(&result)
+	if err != nil {
+		return nil, "", err
 	}
-}
-
-// exportToCSV converts query results to CSV format
-func (s *QueryService) exportToCSV(rows []map[string]interface{}, columns []string) ([]byte, error) {
-	var csv strings.Builder
+	table.TableName = options.TableName
 
-	// Write header row
-	for i, col := range columns {
-		if i > 0 {
-			csv.WriteString(",")
+	// The SQL dialect and default table name come from the query and its data source
+	var query models.Query
+	if err := s.db.Preload("DataSource").First(&query, "id = ?", queryID).Error; err == nil {
+		table.Dialect = query.DataSource.Type
+		if table.TableName == "" {
+			if tables, err := s.extractTableNames(query.QueryText); err == nil && len(tables) > 0 {
+				table.TableName = tables[0]
+			}
 		}
-		// Escape quotes and wrap in quotes
-		escapedCol := strings.ReplaceAll(col, "\"", "\"\"")
-		csv.WriteString("\"")
-		csv.WriteString(escapedCol)
-		csv.WriteString("\"")
 	}
-	csv.WriteString("\n")
 
-	// Write data rows
-	for _, row := range rows {
-		for i, col := range columns {
-			if i > 0 {
-				csv.WriteString(",")
-			}
-			// Get value for this column
-			val := row[col]
-			var strVal string
-			if val == nil {
-				strVal = ""
-			} else {
-				strVal = fmt.Sprintf("%v", val)
-			}
-			// Escape quotes and wrap in quotes
-			escapedVal := strings.ReplaceAll(strVal, "\"", "\"\"")
-			csv.WriteString("\"")
-			csv.WriteString(escapedVal)
-			csv.WriteString("\"")
-		}
-		csv.WriteString("\n")
+	var buf bytes.Buffer
+	if err := exporter.Export(&buf, table); err != nil {
+		return nil, "", fmt.Errorf("failed to export to %s: %w", format, err)
 	}
 
-	return []byte(csv.String()), nil
+	return buf.Bytes(), exporter.ContentType(), nil
 }
 
-// exportToJSON converts query results to JSON format
-func (s *QueryService) exportToJSON(rows []map[string]interface{}, columns []string) ([]byte, error) {
-	// Create a structured JSON output
-	output := map[string]interface{}{
-		"columns":   columns,
-		"row_count": len(rows),
-		"data":      rows,
+// loadExportTable decodes a stored result into an export table
+func (s *QueryService) loadExportTable(result *models.QueryResult) (*ExportTable, error) {
+	set, err := DecodeQueryResult(result)
+	if err != nil {
+		return nil, err
 	}
 
-	return json.MarshalIndent(output, "", "  ")
+	return &ExportTable{
+		Columns:     set.Columns,
+		ColumnTypes: set.ColumnTypes,
+		Rows:        set.Rows,
+	}, nil
 }
 
 // SaveQuery saves a new query
@@ -637,21 +724,38 @@ type DryRunResult struct {
 
 // ExplainQuery executes an EXPLAIN or EXPLAIN ANALYZE query
 func (s *QueryService) ExplainQuery(ctx context.Context, queryText string, dataSource *models.DataSource, analyze bool) (*ExplainQueryResult, error) {
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build EXPLAIN query
+	explainQuery, err := driver.ExplainStatement(analyze)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.explain(ctx, dataSource, explainQuery+" "+queryText, nil)
+}
+
+// explain runs an EXPLAIN statement with bound arguments and returns the plan rows.
+// Like SELECTs, it runs on a replica when the data source has a healthy one.
+func (s *QueryService) explain(ctx context.Context, dataSource *models.DataSource, explainQuery string, args []interface{}) (*ExplainQueryResult, error) {
 	// Get database connection
-	dataSourceDB, err := s.connectToDataSource(dataSource)
+	dataSourceDB, _, err := s.connectForRead(dataSource)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to data source: %w", err)
 	}
 
-	// Build EXPLAIN query
-	explainQuery := "EXPLAIN"
-	if analyze {
-		explainQuery += " ANALYZE"
+	// EXPLAIN ANALYZE executes the statement, so it runs in a read-only transaction like other reads
+	tx, err := beginReadOnly(dataSourceDB.WithContext(ctx))
+	if err != nil {
+		return nil, err
 	}
-	explainQuery += " " + queryText
+	defer endReadOnly(tx)
 
 	// Execute EXPLAIN query
-	rows, err := dataSourceDB.Raw(explainQuery).Rows()
+	rows, err := queryRows(tx, explainQuery, args)
 	if err != nil {
 		return nil, fmt.Errorf("EXPLAIN query failed: %w", err)
 	}
@@ -1528,112 +1632,20 @@ func (s *QueryService) PreviewAndValidateWriteQuery(ctx context.Context, queryTe
 	}, nil
 }
 
-// ListQueryHistory retrieves query history with pagination
-func (s *QueryService) ListQueryHistory(ctx context.Context, userID string, limit, offset int, search string) ([]models.QueryHistory, int64, error) {
-	var history []models.QueryHistory
-	var total int64
-
-	query := s.db.Model(&models.QueryHistory{})
-
-	// If not admin, only show user's own history
-	var user models.User
-	if err := s.db.First(&user, "id = ?", userID).Error; err == nil {
-		if user.Role != models.RoleAdmin {
-			query = query.Where("user_id = ?", userID)
-		}
-	}
-
-	if search != "" {
-		searchParam := "%" + search + "%"
-		query = query.Where("LOWER(query_text) LIKE LOWER(?) OR LOWER(name) LIKE LOWER(?)", searchParam, searchParam)
-	}
-
-	// Get total count
-	query.Count(&total)
-
-	// Get paginated results with DataSource preloaded
-	err := query.Preload("DataSource").
-		Order("executed_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&history).Error
-
-	return history, total, err
-}
-
-// connectToDataSource establishes a connection to a data source
+// connectToDataSource returns the shared connection pool of a data source
 func (s *QueryService) connectToDataSource(dataSource *models.DataSource) (*gorm.DB, error) {
-	// Decrypt password
-	password, err := s.decryptPassword(dataSource.GetPassword())
+	// Decrypt the password and TLS material
+	credentials, err := resolveCredentials(context.Background(), s.decryptPassword, s.connections.secrets, dataSource)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt password: %w", err)
-	}
-
-	switch dataSource.Type {
-	case models.DataSourceTypePostgreSQL:
-		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable connect_timeout=5",
-			dataSource.Host,
-			dataSource.Port,
-			dataSource.Username,
-			password,
-			dataSource.GetDatabase(),
-		)
-		return gorm.Open(postgres.Open(dsn), &gorm.Config{})
-
-	case models.DataSourceTypeMySQL:
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local&timeout=5s&readTimeout=15s&writeTimeout=15s",
-			dataSource.Username,
-			password,
-			dataSource.Host,
-			dataSource.Port,
-			dataSource.GetDatabase(),
-		)
-		return gorm.Open(mysql.Open(dsn), &gorm.Config{})
-
-	default:
-		return nil, fmt.Errorf("unsupported data source type: %s", dataSource.Type)
+		return nil, err
 	}
+
+	return s.connections.Get(dataSource, credentials)
 }
 
-// decryptPassword decrypts an encrypted password using AES-256-GCM
+// decryptPassword decrypts an encrypted password
 func (s *QueryService) decryptPassword(encryptedPassword string) (string, error) {
-	if encryptedPassword == "" {
-		return "", nil
-	}
-
-	// The encrypted password should be in format: base64(nonce + ciphertext)
-	data, err := base64.StdEncoding.DecodeString(encryptedPassword)
-	if err != nil {
-		return "", err
-	}
-
-	// Create cipher block
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return "", err
-	}
-
-	// Extract nonce (first 12 bytes for GCM)
-	nonceSize := 12
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("encrypted data too short")
-	}
-
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-
-	// Create GCM mode
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// Decrypt
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", err
-	}
-
-	return string(plaintext), nil
+	return s.keyring.Decrypt(encryptedPassword)
 }
 
 // ValidateQuerySchema validates that tables and columns referenced in the query exist in the data source
@@ -1816,35 +1828,12 @@ func (s *QueryService) extractTableNames(queryText string) ([]string, error) {
 
 // tableExists checks if a table exists in the database
 func (s *QueryService) tableExists(db *gorm.DB, dataSource *models.DataSource, tableName string) bool {
-	tableName = strings.ToLower(tableName)
-
-	switch dataSource.Type {
-	case models.DataSourceTypePostgreSQL:
-		// Query PostgreSQL's information_schema
-		var count int64
-		err := db.Raw(`
-			SELECT COUNT(*)
-			FROM information_schema.tables
-			WHERE table_schema = 'public'
-			AND LOWER(table_name) = ?
-		`, tableName).Scan(&count).Error
-		return err == nil && count > 0
-
-	case models.DataSourceTypeMySQL:
-		// Query MySQL's information_schema
-		var count int64
-		err := db.Raw(`
-			SELECT COUNT(*)
-			FROM information_schema.tables
-			WHERE table_schema = DATABASE()
-			AND LOWER(table_name) = ?
-		`, tableName).Scan(&count).Error
-		return err == nil && count > 0
-
-	default:
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
 		// For unknown database types, assume table exists (don't block)
 		return true
 	}
+	return driver.TableExists(db, tableName)
 }
 
 // ExecuteQueryInTransaction executes a query in a transaction and keeps it open for preview.
@@ -2036,6 +2025,7 @@ func (s *QueryService) ExecuteQueryInTransaction(ctx context.Context, approval *
 		ColumnNames: string(columnNamesJSON),
 		ColumnTypes: string(columnTypesJSON),
 		Data:        string(resultsJSON),
+		DataFormat:  models.ResultFormatObjects,
 		StoredAt:    time.Now(),
 	}
 
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// ErrQueryNotPending is returned when a queued query was cancelled or already picked up before it could run
+var ErrQueryNotPending = errors.New("query is no longer pending")
+
+// RunQueuedQuery executes a query that was submitted for asynchronous execution and returns its final state.
+// The query is claimed by moving it from pending to running, so a query that was cancelled while
+// queued, or a task that is delivered twice, is not executed again.
+func (s *QueryService) RunQueuedQuery(ctx context.Context, queryID uuid.UUID) (*models.Query, error) {
+	return s.RunQueuedQueryWithOptions(ctx, queryID, ExecuteOptions{})
+}
+
+// RunQueuedQueryWithOptions runs a queued query like RunQueuedQuery with execution options.
+// Queries the cost guard sent for approval are left to RunApprovedQuery.
+func (s *QueryService) RunQueuedQueryWithOptions(ctx context.Context, queryID uuid.UUID, options ExecuteOptions) (*models.Query, error) {
+	return s.claimAndRunQuery(ctx, queryID, false, options)
+}
+
+// RunApprovedQuery runs a pending query whose approval request was approved, as the requester and with
+// the result limits, read-only transaction and replica routing of any other run. The result is stored
+// under the query and its final state is returned.
+func (s *QueryService) RunApprovedQuery(ctx context.Context, queryID uuid.UUID) (*models.Query, error) {
+	return s.claimAndRunQuery(ctx, queryID, true, ExecuteOptions{Approved: true})
+}
+
+// claimAndRunQuery moves a pending query to running and executes it. approved selects the queries
+// waiting for approval instead of the queued ones.
+func (s *QueryService) claimAndRunQuery(ctx context.Context, queryID uuid.UUID, approved bool, options ExecuteOptions) (*models.Query, error) {
+	var query models.Query
+	if err := s.db.First(&query, "id = ?", queryID).Error; err != nil {
+		return nil, fmt.Errorf("query not found: %w", err)
+	}
+
+	claim := s.db.Model(&models.Query{}).Where("id = ? AND status = ?", queryID, models.StatusPending)
+	if approved {
+		claim = claim.Where("requires_approval = ?", true)
+	} else {
+		claim = claim.Where("is_async = ? AND requires_approval = ?", true, false)
+	}
+	claim = claim.Update("status", models.StatusRunning)
+	if claim.Error != nil {
+		return nil, fmt.Errorf("failed to claim query: %w", claim.Error)
+	}
+	if claim.RowsAffected == 0 {
+		return &query, ErrQueryNotPending
+	}
+	query.Status = models.StatusRunning
+
+	var dataSource models.DataSource
+	if err := s.db.First(&dataSource, "id = ?", query.DataSourceID).Error; err != nil {
+		err = fmt.Errorf("data source not found: %w", err)
+		s.failQuery(&query, err)
+		return s.reloadQuery(&query), err
+	}
+
+	startTime := time.Now()
+	result, err := s.ExecuteQueryWithOptions(ctx, &query, &dataSource, options)
+	executionTime := int(time.Since(startTime).Milliseconds())
+
+	if err != nil {
+		// Execution errors have already updated the query; permission and connection errors have not
+		var current models.Query
+		if s.db.Select("status").First(&current, "id = ?", query.ID).Error == nil && current.Status == models.StatusRunning {
+			s.failQuery(&query, err)
+		}
+		s.db.Model(&query).Update("execution_time_ms", executionTime)
+		return s.reloadQuery(&query), err
+	}
+
+	s.db.Model(&query).Updates(map[string]interface{}{
+		"row_count":         result.RowCount,
+		"execution_time_ms": executionTime,
+	})
+
+	log.Printf("[RunQueuedQuery] Query %s completed with %d rows in %dms", query.ID, result.RowCount, executionTime)
+	return s.reloadQuery(&query), nil
+}
+
+// CancelPendingQuery cancels an async query that is still waiting in the queue.
+// It returns false when the query has already started or finished.
+func (s *QueryService) CancelPendingQuery(ctx context.Context, queryID uuid.UUID) (bool, error) {
+	update := s.db.Model(&models.Query{}).
+		Where("id = ? AND is_async = ? AND status = ?", queryID, true, models.StatusPending).
+		Updates(map[string]interface{}{
+			"status":        models.StatusCancelled,
+			"error_message": ErrQueryCancelled.Error(),
+		})
+	if update.Error != nil {
+		return false, fmt.Errorf("failed to cancel query: %w", update.Error)
+	}
+	return update.RowsAffected > 0, nil
+}
+
+// reloadQuery returns the stored state of a query, falling back to the in-memory copy
+func (s *QueryService) reloadQuery(query *models.Query) *models.Query {
+	var current models.Query
+	if err := s.db.First(&current, "id = ?", query.ID).Error; err != nil {
+		return query
+	}
+	return &current
+}
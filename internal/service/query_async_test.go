@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+func createAsyncTestQuery(t *testing.T, db *gorm.DB, status models.QueryStatus, isAsync bool) *models.Query {
+	user := createTestUser(t, db, models.RoleUser)
+	dataSource := &models.DataSource{
+		ID:           uuid.New(),
+		Name:         "async-ds-" + uuid.New().String(),
+		Type:         models.DataSourceTypePostgreSQL,
+		Host:         "localhost",
+		Port:         5432,
+		DatabaseName: "test",
+		Username:     "test",
+		IsActive:     true,
+	}
+	require.NoError(t, db.Create(dataSource).Error)
+
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  dataSource.ID,
+		UserID:        user.ID,
+		QueryText:     "SELECT 1",
+		OperationType: models.OperationSelect,
+		Status:        status,
+		IsAsync:       isAsync,
+	}
+	require.NoError(t, db.Create(query).Error)
+	return query
+}
+
+func TestRunQueuedQuery_SkipsQueriesThatAreNotPending(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	cancelled := createAsyncTestQuery(t, db, models.StatusCancelled, true)
+	query, err := queryService.RunQueuedQuery(context.Background(), cancelled.ID)
+	assert.ErrorIs(t, err, ErrQueryNotPending)
+	assert.Equal(t, models.StatusCancelled, query.Status)
+
+	// Saved queries are pending too, but were never queued
+	saved := createAsyncTestQuery(t, db, models.StatusPending, false)
+	_, err = queryService.RunQueuedQuery(context.Background(), saved.ID)
+	assert.ErrorIs(t, err, ErrQueryNotPending)
+}
+
+func TestRunQueuedQuery_RecordsFailure(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	// The user belongs to no group, so the permission check fails before connecting
+	pending := createAsyncTestQuery(t, db, models.StatusPending, true)
+	query, err := queryService.RunQueuedQuery(context.Background(), pending.ID)
+	require.Error(t, err)
+	require.NotNil(t, query)
+
+	assert.Equal(t, models.StatusFailed, query.Status)
+	assert.Contains(t, query.ErrorMessage, "permission denied")
+
+	// A second delivery of the same task must not run it again
+	_, err = queryService.RunQueuedQuery(context.Background(), pending.ID)
+	assert.ErrorIs(t, err, ErrQueryNotPending)
+}
+
+func TestCancelPendingQuery(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	pending := createAsyncTestQuery(t, db, models.StatusPending, true)
+	cancelled, err := queryService.CancelPendingQuery(context.Background(), pending.ID)
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	var stored models.Query
+	require.NoError(t, db.First(&stored, "id = ?", pending.ID).Error)
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+
+	running := createAsyncTestQuery(t, db, models.StatusRunning, true)
+	cancelled, err = queryService.CancelPendingQuery(context.Background(), running.ID)
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+}
+
+func TestQueryEventBus_DisabledWithoutRedis(t *testing.T) {
+	bus := NewQueryEventBus(nil)
+	assert.False(t, bus.Enabled())
+	assert.NoError(t, bus.PublishQueryEvent(context.Background(), QueryEvent{QueryID: uuid.New()}))
+	assert.Error(t, bus.RequestCancel(context.Background(), uuid.New()))
+
+	var nilBus *QueryEventBus
+	assert.False(t, nilBus.Enabled())
+	assert.NoError(t, nilBus.PublishQueryEvent(context.Background(), QueryEvent{}))
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrQueryCancelled is returned when a running query was cancelled by a user or the client went away
+	ErrQueryCancelled = errors.New("query cancelled")
+
+	// ErrQueryTimeout is returned when a query exceeds the statement timeout of its data source
+	ErrQueryTimeout = errors.New("query exceeded statement timeout")
+
+	// ErrQueryNotRunning is returned when cancelling a query that is not executing on this server
+	ErrQueryNotRunning = errors.New("query is not running")
+)
+
+// runningQuery tracks an in-flight query so it can be cancelled from another request
+type runningQuery struct {
+	cancel     context.CancelFunc
+	dataSource *models.DataSource
+	backendID  int64
+	cancelled  bool
+}
+
+// statementTimeout returns the statement timeout configured on a data source (0 means none)
+func statementTimeout(dataSource *models.DataSource) time.Duration {
+	if dataSource.StatementTimeoutSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(dataSource.StatementTimeoutSeconds) * time.Second
+}
+
+// startRunningQuery registers a query as running and returns the context it must execute under.
+// The returned function must be called once execution has finished.
+func (s *QueryService) startRunningQuery(ctx context.Context, queryID uuid.UUID, dataSource *models.DataSource) (context.Context, func()) {
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if timeout := statementTimeout(dataSource); timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+
+	s.runningMutex.Lock()
+	s.runningQueries[queryID] = &runningQuery{
+		cancel:     cancel,
+		dataSource: dataSource,
+	}
+	s.runningMutex.Unlock()
+
+	return runCtx, func() {
+		s.runningMutex.Lock()
+		delete(s.runningQueries, queryID)
+		s.runningMutex.Unlock()
+		cancel()
+	}
+}
+
+// prepareSession records the server-side session ID of a pinned connection and
+// applies the data source statement timeout to it
+func (s *QueryService) prepareSession(conn *gorm.DB, queryID uuid.UUID, dataSource *models.DataSource) error {
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return err
+	}
+
+	backendID, err := driver.SessionID(conn)
+	if err != nil {
+		return err
+	}
+	timeoutStmt, _ := driver.StatementTimeout(statementTimeout(dataSource))
+
+	s.runningMutex.Lock()
+	if rq, ok := s.runningQueries[queryID]; ok {
+		rq.backendID = backendID
+	}
+	s.runningMutex.Unlock()
+
+	if timeoutStmt != "" {
+		if err := conn.Exec(timeoutStmt).Error; err != nil {
+			return fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// resetSession clears the statement timeout so the connection can be reused safely
+func (s *QueryService) resetSession(conn *gorm.DB, dataSource *models.DataSource) {
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return
+	}
+
+	_, resetStmt := driver.StatementTimeout(statementTimeout(dataSource))
+	if resetStmt == "" {
+		return
+	}
+
+	// The query context may already be cancelled, so reset on a fresh one
+	conn.WithContext(context.Background()).Exec(resetStmt)
+}
+
+// wasCancelled reports whether a running query was cancelled through CancelQuery
+func (s *QueryService) wasCancelled(queryID uuid.UUID) bool {
+	s.runningMutex.Lock()
+	defer s.runningMutex.Unlock()
+
+	rq, ok := s.runningQueries[queryID]
+	return ok && rq.cancelled
+}
+
+// classifyExecutionError maps driver and context errors to ErrQueryCancelled, ErrQueryTimeout or ErrReadOnlyViolation
+func (s *QueryService) classifyExecutionError(runCtx context.Context, queryID uuid.UUID, dataSource *models.DataSource, err error) error {
+	if s.wasCancelled(queryID) || errors.Is(runCtx.Err(), context.Canceled) {
+		return fmt.Errorf("%w: %v", ErrQueryCancelled, err)
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) || isStatementTimeoutError(err) {
+		return fmt.Errorf("%w of %ds: %v", ErrQueryTimeout, dataSource.StatementTimeoutSeconds, err)
+	}
+	if isReadOnlyViolation(err) {
+		return fmt.Errorf("%w: %v", ErrReadOnlyViolation, err)
+	}
+	return fmt.Errorf("query execution failed: %w", err)
+}
+
+// isStatementTimeoutError detects server-side statement timeout errors
+func isStatementTimeoutError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "statement timeout") || // PostgreSQL SQLSTATE 57014
+		strings.Contains(msg, "maximum statement execution time exceeded") // MySQL error 3024
+}
+
+// failQuery records a failed, cancelled or timed-out execution on the query and its history
+func (s *QueryService) failQuery(query *models.Query, execErr error) {
+	status := models.StatusFailed
+	if errors.Is(execErr, ErrQueryCancelled) {
+		status = models.StatusCancelled
+	}
+
+	s.db.Model(query).Updates(map[string]interface{}{
+		"status":        status,
+		"error_message": execErr.Error(),
+	})
+
+	// Cancellations and timeouts are recorded in history so runaway queries stay visible
+	if status == models.StatusCancelled || errors.Is(execErr, ErrQueryTimeout) {
+		s.db.Create(&models.QueryHistory{
+			ID:            uuid.New(),
+			QueryID:       &query.ID,
+			UserID:        query.UserID,
+			DataSourceID:  query.DataSourceID,
+			QueryText:     query.QueryText,
+			OperationType: query.OperationType,
+			Status:        status,
+			ErrorMessage:  execErr.Error(),
+			ExecutedAt:    time.Now(),
+		})
+	}
+}
+
+// CancelQuery stops a running query on the server and cancels its execution context
+func (s *QueryService) CancelQuery(ctx context.Context, queryID uuid.UUID) error {
+	// prepareSession sets the backend ID under the mutex, so it is copied while the lock is held
+	var (
+		backendID  int64
+		dataSource *models.DataSource
+	)
+	s.runningMutex.Lock()
+	rq, ok := s.runningQueries[queryID]
+	if ok {
+		rq.cancelled = true
+		backendID = rq.backendID
+		dataSource = rq.dataSource
+	}
+	s.runningMutex.Unlock()
+
+	if !ok {
+		return ErrQueryNotRunning
+	}
+
+	// Ask the server to stop the statement first so the backend is freed
+	// even when the driver does not propagate context cancellation
+	if backendID != 0 {
+		if err := s.cancelBackend(ctx, dataSource, backendID); err != nil {
+			log.Printf("[CancelQuery] Server-side cancel failed for query %s: %v", queryID, err)
+		}
+	}
+
+	rq.cancel()
+	return nil
+}
+
+// cancelBackend cancels the statement currently running in a server session
+func (s *QueryService) cancelBackend(ctx context.Context, dataSource *models.DataSource, backendID int64) error {
+	driver, err := LookupDataSourceDriver(dataSource.Type)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := resolveCredentials(ctx, s.decryptPassword, s.connections.secrets, dataSource)
+	if err != nil {
+		return err
+	}
+
+	// Use a dedicated connection so cancelling still works when the shared pool is exhausted
+	dataSourceDB, err := openDataSource(dataSource, credentials)
+	if err != nil {
+		return fmt.Errorf("failed to connect to data source: %w", err)
+	}
+	if sqlDB, err := dataSourceDB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	return driver.CancelStatement(ctx, dataSourceDB, backendID)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestStatementTimeout(t *testing.T) {
+	assert.Equal(t, 300*time.Second, statementTimeout(&models.DataSource{StatementTimeoutSeconds: 300}))
+	assert.Equal(t, time.Duration(0), statementTimeout(&models.DataSource{StatementTimeoutSeconds: 0}))
+	assert.Equal(t, time.Duration(0), statementTimeout(&models.DataSource{StatementTimeoutSeconds: -1}))
+}
+
+func TestIsStatementTimeoutError(t *testing.T) {
+	assert.True(t, isStatementTimeoutError(errors.New("ERROR: canceling statement due to statement timeout (SQLSTATE 57014)")))
+	assert.True(t, isStatementTimeoutError(errors.New("Error 3024 (HY000): Query execution was interrupted, maximum statement execution time exceeded")))
+	assert.False(t, isStatementTimeoutError(errors.New("ERROR: relation \"users\" does not exist")))
+}
+
+func TestCancelQuery_NotRunning(t *testing.T) {
+	queryService := NewQueryService(nil, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	err := queryService.CancelQuery(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrQueryNotRunning)
+}
+
+func TestCancelQuery_CancelsRunningContext(t *testing.T) {
+	queryService := NewQueryService(nil, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	queryID := uuid.New()
+	dataSource := &models.DataSource{Type: models.DataSourceTypePostgreSQL, StatementTimeoutSeconds: 300}
+
+	runCtx, finish := queryService.startRunningQuery(context.Background(), queryID, dataSource)
+	defer finish()
+
+	// No backend ID has been recorded yet, so only the context is cancelled
+	require.NoError(t, queryService.CancelQuery(context.Background(), queryID))
+
+	select {
+	case <-runCtx.Done():
+	default:
+		t.Fatal("expected running query context to be cancelled")
+	}
+
+	err := queryService.classifyExecutionError(runCtx, queryID, dataSource, errors.New("context canceled"))
+	assert.ErrorIs(t, err, ErrQueryCancelled)
+}
+
+func TestClassifyExecutionError_Timeout(t *testing.T) {
+	queryService := NewQueryService(nil, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	queryID := uuid.New()
+	dataSource := &models.DataSource{Type: models.DataSourceTypePostgreSQL, StatementTimeoutSeconds: 5}
+
+	runCtx, finish := queryService.startRunningQuery(context.Background(), queryID, dataSource)
+	defer finish()
+
+	err := queryService.classifyExecutionError(runCtx, queryID, dataSource, errors.New("ERROR: canceling statement due to statement timeout"))
+	assert.ErrorIs(t, err, ErrQueryTimeout)
+	assert.Contains(t, err.Error(), "5s")
+
+	err = queryService.classifyExecutionError(runCtx, queryID, dataSource, errors.New("syntax error"))
+	assert.False(t, errors.Is(err, ErrQueryTimeout) || errors.Is(err, ErrQueryCancelled))
+}
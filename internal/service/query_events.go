@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// Redis pub/sub channels shared by the API server and workers
+const (
+	QueryEventsChannel = "querybase:query_events"
+	QueryCancelChannel = "querybase:query_cancel"
+)
+
+// QueryEvent reports that an asynchronous query reached a final status
+type QueryEvent struct {
+	QueryID         uuid.UUID          `json:"query_id"`
+	UserID          uuid.UUID          `json:"user_id"`
+	Status          models.QueryStatus `json:"status"`
+	RowCount        *int               `json:"row_count,omitempty"`
+	ExecutionTimeMs *int               `json:"execution_time_ms,omitempty"`
+	ErrorMessage    string             `json:"error_message,omitempty"`
+	FinishedAt      time.Time          `json:"finished_at"`
+}
+
+// NewQueryEvent builds the completion event for a query from its stored state
+func NewQueryEvent(query *models.Query) QueryEvent {
+	return QueryEvent{
+		QueryID:         query.ID,
+		UserID:          query.UserID,
+		Status:          query.Status,
+		RowCount:        query.RowCount,
+		ExecutionTimeMs: query.ExecutionTimeMs,
+		ErrorMessage:    query.ErrorMessage,
+		FinishedAt:      time.Now(),
+	}
+}
+
+// QueryEventBus carries query completion events from workers to the API server,
+// and cancel requests from the API server to workers. Without Redis it does nothing.
+type QueryEventBus struct {
+	redis *redis.Client
+}
+
+// NewQueryEventBus creates a new query event bus
+func NewQueryEventBus(redisClient *redis.Client) *QueryEventBus {
+	return &QueryEventBus{redis: redisClient}
+}
+
+// Enabled reports whether events can be delivered to other processes
+func (b *QueryEventBus) Enabled() bool {
+	return b != nil && b.redis != nil
+}
+
+// PublishQueryEvent announces that a query has finished
+func (b *QueryEventBus) PublishQueryEvent(ctx context.Context, event QueryEvent) error {
+	if !b.Enabled() {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query event: %w", err)
+	}
+	return b.redis.Publish(ctx, QueryEventsChannel, payload).Err()
+}
+
+// RequestCancel asks the process running a query to cancel it
+func (b *QueryEventBus) RequestCancel(ctx context.Context, queryID uuid.UUID) error {
+	if !b.Enabled() {
+		return fmt.Errorf("query event bus is not available")
+	}
+	return b.redis.Publish(ctx, QueryCancelChannel, queryID.String()).Err()
+}
+
+// SubscribeQueryEvents calls handler for every query event until ctx is done
+func (b *QueryEventBus) SubscribeQueryEvents(ctx context.Context, handler func(QueryEvent)) {
+	b.subscribe(ctx, QueryEventsChannel, func(payload string) {
+		var event QueryEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Printf("[QueryEventBus] Ignoring malformed query event: %v", err)
+			return
+		}
+		handler(event)
+	})
+}
+
+// SubscribeCancelRequests calls handler for every cancel request until ctx is done
+func (b *QueryEventBus) SubscribeCancelRequests(ctx context.Context, handler func(uuid.UUID)) {
+	b.subscribe(ctx, QueryCancelChannel, func(payload string) {
+		queryID, err := uuid.Parse(payload)
+		if err != nil {
+			log.Printf("[QueryEventBus] Ignoring malformed cancel request: %v", err)
+			return
+		}
+		handler(queryID)
+	})
+}
+
+// subscribe delivers the messages of a channel to handler until ctx is done
+func (b *QueryEventBus) subscribe(ctx context.Context, channel string, handler func(string)) {
+	if !b.Enabled() {
+		return
+	}
+
+	pubsub := b.redis.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			handler(msg.Payload)
+		}
+	}
+}
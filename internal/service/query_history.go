@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// ErrInvalidHistoryFilter is returned when a history search has an unknown sort or filter value
+var ErrInvalidHistoryFilter = errors.New("invalid history filter")
+
+// History sort keys and the columns they order by
+var historySortColumns = map[string]string{
+	"executed_at":       "query_history.executed_at",
+	"execution_time_ms": "query_history.execution_time_ms",
+	"row_count":         "query_history.row_count",
+}
+
+// HistoryFilter narrows a query history search; zero values don't filter
+type HistoryFilter struct {
+	// UserID selects the history of one user. Only admins can view other users' history.
+	UserID        *uuid.UUID
+	DataSourceID  *uuid.UUID
+	OperationType models.OperationType
+	Status        models.QueryStatus
+	// Search matches the query text or the name of the saved query, case-insensitively
+	Search string
+	// From and To bound the execution time, both inclusive
+	From *time.Time
+	To   *time.Time
+	// MinExecutionTimeMs keeps executions that took at least this long
+	MinExecutionTimeMs int
+	// SortBy is executed_at (default), execution_time_ms or row_count
+	SortBy string
+	// SortOrder is asc or desc (default)
+	SortOrder string
+}
+
+// ListQueryHistory retrieves query history with pagination.
+// Admins see the history of all users, other users only their own.
+func (s *QueryService) ListQueryHistory(ctx context.Context, userID string, limit, offset int, search string) ([]models.QueryHistory, int64, error) {
+	return s.SearchQueryHistory(ctx, userID, HistoryFilter{Search: search}, limit, offset)
+}
+
+// SearchQueryHistory retrieves the query history visible to userID that matches the filter.
+// Admins see all users unless the filter selects one; other users only see their own history.
+func (s *QueryService) SearchQueryHistory(ctx context.Context, userID string, filter HistoryFilter, limit, offset int) ([]models.QueryHistory, int64, error) {
+	var history []models.QueryHistory
+	var total int64
+
+	orderBy, err := historyOrder(filter.SortBy, filter.SortOrder)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.QueryHistory{})
+
+	// Unknown users are treated like regular users and only see their own entries
+	var user models.User
+	isAdmin := s.db.First(&user, "id = ?", userID).Error == nil && user.Role == models.RoleAdmin
+	switch {
+	case filter.UserID != nil && (isAdmin || filter.UserID.String() == userID):
+		query = query.Where("query_history.user_id = ?", *filter.UserID)
+	case filter.UserID != nil:
+		return nil, 0, fmt.Errorf("permission denied: only admins can view the history of other users")
+	case !isAdmin:
+		query = query.Where("query_history.user_id = ?", userID)
+	}
+
+	if filter.DataSourceID != nil {
+		query = query.Where("query_history.data_source_id = ?", *filter.DataSourceID)
+	}
+	if filter.OperationType != "" {
+		query = query.Where("query_history.operation_type = ?", filter.OperationType)
+	}
+	if filter.Status != "" {
+		query = query.Where("query_history.status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("query_history.executed_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("query_history.executed_at <= ?", *filter.To)
+	}
+	if filter.MinExecutionTimeMs > 0 {
+		query = query.Where("query_history.execution_time_ms >= ?", filter.MinExecutionTimeMs)
+	}
+
+	// History has no name of its own; the name comes from the saved query it ran
+	if filter.Search != "" {
+		searchParam := "%" + strings.ToLower(filter.Search) + "%"
+		query = query.Where(
+			"LOWER(query_history.query_text) LIKE ? OR query_history.query_id IN (SELECT id FROM queries WHERE LOWER(name) LIKE ?)",
+			searchParam, searchParam,
+		)
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get paginated results with DataSource and User preloaded
+	err = query.Preload("DataSource").
+		Preload("User").
+		Order(orderBy).
+		Limit(limit).
+		Offset(offset).
+		Find(&history).Error
+
+	return history, total, err
+}
+
+// historyOrder builds the ORDER BY clause of a history search. Entries without a value sort last,
+// and ties keep the newest first.
+func historyOrder(sortBy, sortOrder string) (string, error) {
+	if sortBy == "" {
+		sortBy = "executed_at"
+	}
+	column, ok := historySortColumns[sortBy]
+	if !ok {
+		return "", fmt.Errorf("%w: sort_by must be one of executed_at, execution_time_ms, row_count", ErrInvalidHistoryFilter)
+	}
+
+	direction := strings.ToUpper(sortOrder)
+	switch direction {
+	case "":
+		direction = "DESC"
+	case "ASC", "DESC":
+	default:
+		return "", fmt.Errorf("%w: sort_order must be asc or desc", ErrInvalidHistoryFilter)
+	}
+
+	order := fmt.Sprintf("%s IS NULL, %s %s", column, column, direction)
+	if sortBy != "executed_at" {
+		order += ", query_history.executed_at DESC"
+	}
+	return order, nil
+}
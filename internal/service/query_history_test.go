@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// createTestHistory records an execution of query at executedAt taking durationMs (nil when unknown)
+func createTestHistory(t *testing.T, db *gorm.DB, query *models.Query, status models.QueryStatus, executedAt time.Time, durationMs *int, rowCount int) *models.QueryHistory {
+	entry := &models.QueryHistory{
+		ID:              uuid.New(),
+		QueryID:         &query.ID,
+		UserID:          query.UserID,
+		DataSourceID:    query.DataSourceID,
+		QueryText:       query.QueryText,
+		OperationType:   query.OperationType,
+		Status:          status,
+		RowCount:        &rowCount,
+		ExecutionTimeMs: durationMs,
+		ExecutedAt:      executedAt,
+	}
+	require.NoError(t, db.Create(entry).Error)
+	return entry
+}
+
+func TestSearchQueryHistory_Filters(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	require.NoError(t, db.Model(query).Update("name", "Monthly Revenue").Error)
+	other := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	slow, fast := 5000, 20
+	slowRun := createTestHistory(t, db, query, models.StatusCompleted, day.Add(9*time.Hour), &slow, 10)
+	createTestHistory(t, db, query, models.StatusFailed, day.Add(-24*time.Hour), &fast, 0)
+	createTestHistory(t, db, other, models.StatusCompleted, day.Add(10*time.Hour), &fast, 3)
+
+	search := func(filter HistoryFilter) []models.QueryHistory {
+		history, total, err := queryService.SearchQueryHistory(context.Background(), query.UserID.String(), filter, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(history)), total)
+		return history
+	}
+
+	// Other users' runs are never visible to a regular user
+	assert.Len(t, search(HistoryFilter{}), 2)
+
+	// The saved query name is searched along with the SQL text
+	history := search(HistoryFilter{Search: "monthly"})
+	assert.Len(t, history, 2)
+	assert.Equal(t, query.DataSourceID, history[0].DataSourceID)
+
+	history = search(HistoryFilter{Status: models.StatusCompleted, MinExecutionTimeMs: 1000})
+	require.Len(t, history, 1)
+	assert.Equal(t, slowRun.ID, history[0].ID)
+
+	from, to := day, day.Add(24*time.Hour-time.Nanosecond)
+	history = search(HistoryFilter{From: &from, To: &to})
+	require.Len(t, history, 1)
+	assert.Equal(t, slowRun.ID, history[0].ID)
+
+	otherDataSource := other.DataSourceID
+	assert.Empty(t, search(HistoryFilter{DataSourceID: &otherDataSource}))
+
+	_, _, err := queryService.SearchQueryHistory(context.Background(), query.UserID.String(), HistoryFilter{UserID: &other.UserID}, 10, 0)
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestSearchQueryHistory_AdminSortsAllUsersByDuration(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	admin := createTestUser(t, db, models.RoleAdmin)
+
+	first := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	second := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	now := time.Now()
+
+	slow, medium := 900, 300
+	unknown := createTestHistory(t, db, first, models.StatusCancelled, now, nil, 0)
+	slowRun := createTestHistory(t, db, second, models.StatusCompleted, now.Add(-time.Hour), &slow, 5)
+	mediumRun := createTestHistory(t, db, first, models.StatusCompleted, now.Add(-2*time.Hour), &medium, 50)
+
+	history, total, err := queryService.SearchQueryHistory(context.Background(), admin.ID.String(),
+		HistoryFilter{SortBy: "execution_time_ms", SortOrder: "desc"}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, history, 3)
+
+	// Entries without a duration sort last
+	assert.Equal(t, []uuid.UUID{slowRun.ID, mediumRun.ID, unknown.ID}, []uuid.UUID{history[0].ID, history[1].ID, history[2].ID})
+	assert.Equal(t, second.UserID, history[0].User.ID)
+
+	history, _, err = queryService.SearchQueryHistory(context.Background(), admin.ID.String(),
+		HistoryFilter{UserID: &first.UserID, SortBy: "row_count", SortOrder: "asc"}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, unknown.ID, history[0].ID)
+	assert.Equal(t, mediumRun.ID, history[1].ID)
+
+	_, _, err = queryService.SearchQueryHistory(context.Background(), admin.ID.String(), HistoryFilter{SortBy: "name"}, 10, 0)
+	assert.ErrorIs(t, err, ErrInvalidHistoryFilter)
+}
@@ -0,0 +1,515 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// ParameterError reports a problem with one named query parameter
+type ParameterError struct {
+	Name    string
+	Message string
+}
+
+func (e *ParameterError) Error() string {
+	return fmt.Sprintf("parameter :%s %s", e.Name, e.Message)
+}
+
+// parameterNamePattern is the syntax of a :name placeholder after the colon
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parameterDateLayout is the accepted format of date parameters
+const parameterDateLayout = "2006-01-02"
+
+// parameterTimestampLayouts are the accepted formats of timestamp parameters
+var parameterTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	parameterDateLayout,
+}
+
+// parameterPlaceholder is one :name occurrence in a query text
+type parameterPlaceholder struct {
+	name       string
+	start, end int
+}
+
+// findParameterPlaceholders returns the :name placeholders of a query, skipping string literals,
+// quoted identifiers, comments, PostgreSQL :: casts and dollar-quoted bodies, MySQL := assignments,
+// and array slices such as arr[lo:hi].
+func findParameterPlaceholders(queryText string) []parameterPlaceholder {
+	var placeholders []parameterPlaceholder
+	n := len(queryText)
+
+	for i := 0; i < n; i++ {
+		c := queryText[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Quoted text ends at the matching quote; doubled quotes and backslashes escape it
+			for i++; i < n; i++ {
+				if queryText[i] == '\\' && c == '\'' {
+					i++
+					continue
+				}
+				if queryText[i] == c {
+					if i+1 < n && queryText[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '-' && i+1 < n && queryText[i+1] == '-':
+			for i < n && queryText[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < n && queryText[i+1] == '*':
+			end := strings.Index(queryText[i+2:], "*/")
+			if end < 0 {
+				return placeholders
+			}
+			i += end + 3
+		case c == '$':
+			// Dollar-quoted bodies: $$...$$ or $tag$...$tag$
+			tagEnd := strings.IndexByte(queryText[i+1:], '$')
+			if tagEnd < 0 {
+				continue
+			}
+			tag := queryText[i : i+tagEnd+2]
+			if tagEnd > 0 && !parameterNamePattern.MatchString(tag[1:len(tag)-1]) {
+				continue
+			}
+			end := strings.Index(queryText[i+len(tag):], tag)
+			if end < 0 {
+				return placeholders
+			}
+			i += len(tag) + end + len(tag) - 1
+		case c == ':':
+			if i+1 < n && (queryText[i+1] == ':' || queryText[i+1] == '=') {
+				i++
+				continue
+			}
+			if i > 0 && isParameterNameByte(queryText[i-1]) || i > 0 && queryText[i-1] == ']' {
+				continue
+			}
+			j := i + 1
+			for j < n && isParameterNameByte(queryText[j]) {
+				j++
+			}
+			if name := queryText[i+1 : j]; parameterNamePattern.MatchString(name) {
+				placeholders = append(placeholders, parameterPlaceholder{name: name, start: i, end: j})
+				i = j - 1
+			}
+		}
+	}
+
+	return placeholders
+}
+
+func isParameterNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// ParseQueryParameters returns the names of the :name placeholders of a query in order of first use
+func ParseQueryParameters(queryText string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range findParameterPlaceholders(queryText) {
+		if !seen[p.name] {
+			seen[p.name] = true
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// ValidateParameterDefinitions checks the declared parameters of a saved query against its text.
+// Every placeholder must be declared, every declaration used, and defaults must be valid values.
+func ValidateParameterDefinitions(queryText string, definitions []models.QueryParameter) error {
+	if len(definitions) == 0 {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	for _, name := range ParseQueryParameters(queryText) {
+		used[name] = true
+	}
+
+	declared := make(map[string]bool, len(definitions))
+	for _, def := range definitions {
+		if !parameterNamePattern.MatchString(def.Name) {
+			return &ParameterError{Name: def.Name, Message: "has an invalid name; use letters, digits and underscores"}
+		}
+		if declared[def.Name] {
+			return &ParameterError{Name: def.Name, Message: "is declared more than once"}
+		}
+		declared[def.Name] = true
+
+		if !used[def.Name] {
+			return &ParameterError{Name: def.Name, Message: "is declared but not used in the query"}
+		}
+		if !isKnownParameterType(def.Type) {
+			return &ParameterError{Name: def.Name, Message: fmt.Sprintf("has unknown type %q", def.Type)}
+		}
+
+		for _, allowed := range def.AllowedValues {
+			if _, err := coerceParameterValue(def.Type, allowed); err != nil {
+				return &ParameterError{Name: def.Name, Message: fmt.Sprintf("has an invalid allowed value %v: %v", allowed, err)}
+			}
+		}
+		if def.Default != nil {
+			if _, err := resolveParameterValue(def, def.Default); err != nil {
+				return &ParameterError{Name: def.Name, Message: "has an invalid default: " + err.(*ParameterError).Message}
+			}
+		}
+	}
+
+	for name := range used {
+		if !declared[name] {
+			return &ParameterError{Name: name, Message: "is used in the query but not declared"}
+		}
+	}
+	return nil
+}
+
+// BindQueryParameters replaces the :name placeholders of a query with the bind placeholders of the
+// dialect's driver ($1 for PostgreSQL, ? otherwise) and returns the values to bind, in order.
+// Values are never interpolated into the SQL text. With definitions, values are converted to the
+// declared types and checked against the allowed values; defaults fill in missing values.
+func BindQueryParameters(queryText string, definitions []models.QueryParameter, values map[string]interface{}, dialect models.DataSourceType) (string, []interface{}, error) {
+	placeholders := findParameterPlaceholders(queryText)
+
+	used := make(map[string]bool, len(placeholders))
+	for _, p := range placeholders {
+		used[p.name] = true
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !used[name] {
+			return "", nil, &ParameterError{Name: name, Message: "is not used in the query"}
+		}
+	}
+
+	byName := make(map[string]models.QueryParameter, len(definitions))
+	for _, def := range definitions {
+		byName[def.Name] = def
+	}
+
+	// Resolve each parameter once, even when it appears several times
+	resolved := make(map[string]interface{}, len(used))
+	for _, p := range placeholders {
+		if _, ok := resolved[p.name]; ok {
+			continue
+		}
+
+		def, declared := byName[p.name]
+		if !declared {
+			if len(definitions) > 0 {
+				return "", nil, &ParameterError{Name: p.name, Message: "is used in the query but not declared"}
+			}
+			def = models.QueryParameter{Name: p.name, Type: inferParameterType(values[p.name])}
+		}
+
+		value, ok := values[p.name]
+		if !ok || value == nil {
+			value = def.Default
+		}
+		if value == nil {
+			return "", nil, &ParameterError{Name: p.name, Message: "requires a value"}
+		}
+
+		converted, err := resolveParameterValue(def, value)
+		if err != nil {
+			return "", nil, err
+		}
+		resolved[p.name] = converted
+	}
+
+	driver, err := LookupDataSourceDriver(dialect)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var bound strings.Builder
+	var args []interface{}
+	positions := make(map[string]int)
+	last := 0
+	for _, p := range placeholders {
+		bound.WriteString(queryText[last:p.start])
+		last = p.end
+
+		// Numbered placeholders are reused for a name referenced more than once
+		if pos, ok := positions[p.name]; ok {
+			placeholder, _ := driver.Placeholder(pos)
+			bound.WriteString(placeholder)
+			continue
+		}
+
+		args = append(args, resolved[p.name])
+		placeholder, numbered := driver.Placeholder(len(args))
+		if numbered {
+			positions[p.name] = len(args)
+		}
+		bound.WriteString(placeholder)
+	}
+	bound.WriteString(queryText[last:])
+
+	return bound.String(), args, nil
+}
+
+// resolveParameterValue converts a value to the declared type and checks the allowed values
+func resolveParameterValue(def models.QueryParameter, value interface{}) (interface{}, error) {
+	converted, err := coerceParameterValue(def.Type, value)
+	if err != nil {
+		return nil, &ParameterError{Name: def.Name, Message: err.Error()}
+	}
+
+	if len(def.AllowedValues) > 0 {
+		key := parameterValueKey(converted)
+		allowedKeys := make([]string, 0, len(def.AllowedValues))
+		for _, allowed := range def.AllowedValues {
+			allowedValue, err := coerceParameterValue(def.Type, allowed)
+			if err != nil {
+				continue
+			}
+			if parameterValueKey(allowedValue) == key {
+				return converted, nil
+			}
+			allowedKeys = append(allowedKeys, fmt.Sprint(allowed))
+		}
+		return nil, &ParameterError{Name: def.Name, Message: fmt.Sprintf("must be one of: %s", strings.Join(allowedKeys, ", "))}
+	}
+
+	return converted, nil
+}
+
+// coerceParameterValue converts a JSON value to the Go value bound for a parameter type
+func coerceParameterValue(paramType models.QueryParameterType, value interface{}) (interface{}, error) {
+	switch paramType {
+	case models.ParameterTypeString, "":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64, json.Number, int, int64, bool:
+			return fmt.Sprint(v), nil
+		}
+
+	case models.ParameterTypeInteger:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), nil
+			}
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				return i, nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("must be an integer, got %v", value)
+
+	case models.ParameterTypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f, nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a number, got %v", value)
+
+	case models.ParameterTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("must be true or false, got %v", value)
+
+	case models.ParameterTypeDate:
+		// Dates are bound as text so no time zone conversion can shift the day
+		if v, ok := value.(string); ok {
+			if t, err := time.Parse(parameterDateLayout, strings.TrimSpace(v)); err == nil {
+				return t.Format(parameterDateLayout), nil
+			}
+		}
+		return nil, fmt.Errorf("must be a date in YYYY-MM-DD format, got %v", value)
+
+	case models.ParameterTypeTimestamp:
+		if v, ok := value.(string); ok {
+			for _, layout := range parameterTimestampLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+					return t, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be an RFC 3339 timestamp, got %v", value)
+
+	default:
+		return nil, fmt.Errorf("has unknown type %q", paramType)
+	}
+
+	return nil, fmt.Errorf("must be a string, got %v", value)
+}
+
+// inferParameterType picks the type of an undeclared parameter from its JSON value
+func inferParameterType(value interface{}) models.QueryParameterType {
+	switch v := value.(type) {
+	case bool:
+		return models.ParameterTypeBoolean
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return models.ParameterTypeInteger
+		}
+		return models.ParameterTypeNumber
+	case json.Number, int, int64:
+		if _, err := coerceParameterValue(models.ParameterTypeInteger, v); err == nil {
+			return models.ParameterTypeInteger
+		}
+		return models.ParameterTypeNumber
+	}
+	return models.ParameterTypeString
+}
+
+func isKnownParameterType(paramType models.QueryParameterType) bool {
+	switch paramType {
+	case models.ParameterTypeString, models.ParameterTypeInteger, models.ParameterTypeNumber,
+		models.ParameterTypeBoolean, models.ParameterTypeDate, models.ParameterTypeTimestamp:
+		return true
+	}
+	return false
+}
+
+// parameterValueKey gives equal converted values the same comparable form
+func parameterValueKey(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// EncodeQueryParameters serializes parameter definitions for storage; no definitions store NULL
+func EncodeQueryParameters(definitions []models.QueryParameter) (*string, error) {
+	if len(definitions) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(definitions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize query parameters: %w", err)
+	}
+	s := string(encoded)
+	return &s, nil
+}
+
+// DecodeQueryParameters reads the stored parameter definitions of a query
+func DecodeQueryParameters(query *models.Query) ([]models.QueryParameter, error) {
+	if query.Parameters == nil || *query.Parameters == "" {
+		return nil, nil
+	}
+	var definitions []models.QueryParameter
+	if err := json.Unmarshal([]byte(*query.Parameters), &definitions); err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+	return definitions, nil
+}
+
+// EncodeParameterValues serializes the values given for an execution; no values store NULL
+func EncodeParameterValues(values map[string]interface{}) (*string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize parameter values: %w", err)
+	}
+	s := string(encoded)
+	return &s, nil
+}
+
+// DecodeParameterValues reads the values stored for an execution
+func DecodeParameterValues(query *models.Query) (map[string]interface{}, error) {
+	if query.ParameterValues == nil || *query.ParameterValues == "" {
+		return nil, nil
+	}
+	var values map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(*query.ParameterValues))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("failed to parse parameter values: %w", err)
+	}
+	return values, nil
+}
+
+// bindQuery returns the SQL and arguments to run for a query. Queries without declared
+// parameters or values run their text unchanged, so colons in plain SQL are left alone.
+func bindQuery(query *models.Query, queryText string, dialect models.DataSourceType) (string, []interface{}, error) {
+	if query.Parameters == nil && query.ParameterValues == nil {
+		return queryText, nil, nil
+	}
+
+	definitions, err := DecodeQueryParameters(query)
+	if err != nil {
+		return "", nil, err
+	}
+	values, err := DecodeParameterValues(query)
+	if err != nil {
+		return "", nil, err
+	}
+	return BindQueryParameters(queryText, definitions, values, dialect)
+}
+
+// queryRows runs a statement on a pinned connection. Arguments are handed to the driver as bind
+// parameters, bypassing gorm's own ? substitution which would also rewrite question marks in literals.
+func queryRows(conn *gorm.DB, sqlText string, args []interface{}) (*sql.Rows, error) {
+	if len(args) == 0 {
+		return conn.Raw(sqlText).Rows()
+	}
+	return conn.Statement.ConnPool.QueryContext(conn.Statement.Context, sqlText, args...)
+}
+
+// execStatement runs a write statement on a pinned connection and returns the affected row count
+func execStatement(conn *gorm.DB, sqlText string, args []interface{}) (int64, error) {
+	if len(args) == 0 {
+		result := conn.Exec(sqlText)
+		return result.RowsAffected, result.Error
+	}
+	result, err := conn.Statement.ConnPool.ExecContext(conn.Statement.Context, sqlText, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
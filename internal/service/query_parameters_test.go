@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestParseQueryParameters(t *testing.T) {
+	query := `SELECT id::text, ':skipped', "col:x", arr[lo:hi] -- :comment
+		FROM orders /* :block */ WHERE customer_id = :customer_id AND status = :status
+		AND created_at > :since AND customer_id <> :customer_id AND body = $$ :dollar $$`
+
+	assert.Equal(t, []string{"customer_id", "status", "since"}, ParseQueryParameters(query))
+	assert.Empty(t, ParseQueryParameters("SELECT @x := 1"))
+}
+
+func TestBindQueryParameters_PostgreSQL(t *testing.T) {
+	sql, args, err := BindQueryParameters(
+		"SELECT * FROM orders WHERE customer_id = :id OR parent_id = :id AND note = ':id'",
+		nil,
+		map[string]interface{}{"id": float64(42)},
+		models.DataSourceTypePostgreSQL,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT * FROM orders WHERE customer_id = $1 OR parent_id = $1 AND note = ':id'", sql)
+	assert.Equal(t, []interface{}{int64(42)}, args)
+}
+
+func TestBindQueryParameters_MySQL(t *testing.T) {
+	sql, args, err := BindQueryParameters(
+		"SELECT * FROM orders WHERE a = :a AND b = :b AND c = :a",
+		nil,
+		map[string]interface{}{"a": "x", "b": true},
+		models.DataSourceTypeMySQL,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT * FROM orders WHERE a = ? AND b = ? AND c = ?", sql)
+	assert.Equal(t, []interface{}{"x", true, "x"}, args)
+}
+
+func TestBindQueryParameters_DeclaredTypes(t *testing.T) {
+	definitions := []models.QueryParameter{
+		{Name: "customer_id", Type: models.ParameterTypeInteger},
+		{Name: "status", Type: models.ParameterTypeString, Default: "open", AllowedValues: []interface{}{"open", "closed"}},
+		{Name: "since", Type: models.ParameterTypeTimestamp},
+		{Name: "day", Type: models.ParameterTypeDate, Default: "2024-01-31"},
+	}
+	query := "SELECT * FROM orders WHERE customer_id = :customer_id AND status = :status AND created_at > :since AND day = :day"
+
+	_, args, err := BindQueryParameters(query, definitions, map[string]interface{}{
+		"customer_id": "17",
+		"since":       "2024-01-02T03:04:05Z",
+	}, models.DataSourceTypePostgreSQL)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(17), "open", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-31"}, args)
+
+	tests := []struct {
+		name      string
+		values    map[string]interface{}
+		parameter string
+		message   string
+	}{
+		{"missing value", map[string]interface{}{"since": "2024-01-02"}, "customer_id", "requires a value"},
+		{"wrong type", map[string]interface{}{"customer_id": "abc", "since": "2024-01-02"}, "customer_id", "must be an integer"},
+		{"not allowed", map[string]interface{}{"customer_id": 1.0, "status": "deleted", "since": "2024-01-02"}, "status", "must be one of: open, closed"},
+		{"unknown", map[string]interface{}{"customer_id": 1.0, "since": "2024-01-02", "limit": 5.0}, "limit", "is not used"},
+		{"bad timestamp", map[string]interface{}{"customer_id": 1.0, "since": "yesterday"}, "since", "RFC 3339"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := BindQueryParameters(query, definitions, tt.values, models.DataSourceTypePostgreSQL)
+			require.Error(t, err)
+
+			var paramErr *ParameterError
+			require.ErrorAs(t, err, &paramErr)
+			assert.Equal(t, tt.parameter, paramErr.Name)
+			assert.Contains(t, err.Error(), ":"+tt.parameter)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+func TestValidateParameterDefinitions(t *testing.T) {
+	query := "SELECT * FROM orders WHERE id = :id AND status = :status"
+
+	assert.NoError(t, ValidateParameterDefinitions(query, nil))
+	assert.NoError(t, ValidateParameterDefinitions(query, []models.QueryParameter{
+		{Name: "id", Type: models.ParameterTypeInteger},
+		{Name: "status", Type: models.ParameterTypeString, Default: "open", AllowedValues: []interface{}{"open", "closed"}},
+	}))
+
+	err := ValidateParameterDefinitions(query, []models.QueryParameter{{Name: "id", Type: models.ParameterTypeInteger}})
+	assert.EqualError(t, err, "parameter :status is used in the query but not declared")
+
+	err = ValidateParameterDefinitions(query, []models.QueryParameter{
+		{Name: "id", Type: models.ParameterTypeInteger, Default: "x"},
+		{Name: "status", Type: models.ParameterTypeString},
+	})
+	assert.EqualError(t, err, "parameter :id has an invalid default: must be an integer, got x")
+
+	err = ValidateParameterDefinitions(query, []models.QueryParameter{
+		{Name: "id", Type: "uuid"},
+		{Name: "status", Type: models.ParameterTypeString},
+	})
+	assert.EqualError(t, err, `parameter :id has unknown type "uuid"`)
+
+	err = ValidateParameterDefinitions(query, []models.QueryParameter{
+		{Name: "id", Type: models.ParameterTypeInteger},
+		{Name: "status", Type: models.ParameterTypeString},
+		{Name: "limit", Type: models.ParameterTypeInteger},
+	})
+	assert.EqualError(t, err, "parameter :limit is declared but not used in the query")
+}
+
+func TestBindQuery_PlainQueriesAreUnchanged(t *testing.T) {
+	// Without parameters the text runs as written, even if it looks like it has placeholders
+	query := &models.Query{QueryText: "SELECT arr[1:2], :not_a_param"}
+	sql, args, err := bindQuery(query, query.QueryText, models.DataSourceTypePostgreSQL)
+	require.NoError(t, err)
+	assert.Equal(t, query.QueryText, sql)
+	assert.Empty(t, args)
+
+	values, err := EncodeParameterValues(map[string]interface{}{"id": 9007199254740993})
+	require.NoError(t, err)
+	query = &models.Query{QueryText: "SELECT * FROM t WHERE id = :id", ParameterValues: values}
+	sql, args, err = bindQuery(query, query.QueryText, models.DataSourceTypeMySQL)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE id = ?", sql)
+	assert.Equal(t, []interface{}{int64(9007199254740993)}, args)
+}
+
+func TestExecuteQuery_ReportsParameterErrors(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	// An admin passes the permission check, so the bind step is reached before connecting
+	query := createAsyncTestQuery(t, db, models.StatusRunning, false)
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", query.UserID).Update("role", models.RoleAdmin).Error)
+
+	definitions, err := EncodeQueryParameters([]models.QueryParameter{{Name: "id", Type: models.ParameterTypeInteger}})
+	require.NoError(t, err)
+	query.QueryText = "SELECT * FROM users WHERE id = :id"
+	query.Parameters = definitions
+
+	var dataSource models.DataSource
+	require.NoError(t, db.First(&dataSource, "id = ?", query.DataSourceID).Error)
+
+	_, err = queryService.ExecuteQuery(context.Background(), query, &dataSource)
+	var paramErr *ParameterError
+	require.ErrorAs(t, err, &paramErr)
+	assert.Equal(t, "id", paramErr.Name)
+}
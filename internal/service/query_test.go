@@ -15,7 +15,7 @@ import (
 func TestExtractTableNames(t *testing.T) {
 	// For extractTableNames, we don't need a real database connection,
 	// so we can pass nil for the database and logger.
-	queryService := NewQueryService(nil, "test-encryption-key-32-chars-long!", nil, nil)
+	queryService := NewQueryService(nil, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
 
 	tests := []struct {
 		name           string
@@ -847,80 +847,80 @@ func TestSortRows(t *testing.T) {
 
 	tests := []struct {
 		name          string
-		rows          []map[string]interface{}
-		sortColumn    string
+		rows          [][]interface{}
+		sortColumn    int
 		sortDirection string
 		expectedFirst interface{}
 		expectedLast  interface{}
 	}{
 		{
 			name: "Sort by int column ascending",
-			rows: []map[string]interface{}{
-				{"id": 3, "name": "Charlie"},
-				{"id": 1, "name": "Alice"},
-				{"id": 2, "name": "Bob"},
+			rows: [][]interface{}{
+				{3, "Charlie"},
+				{1, "Alice"},
+				{2, "Bob"},
 			},
-			sortColumn:    "id",
+			sortColumn:    0,
 			sortDirection: "asc",
 			expectedFirst: 1,
 			expectedLast:  3,
 		},
 		{
 			name: "Sort by int column descending",
-			rows: []map[string]interface{}{
-				{"id": 1, "name": "Alice"},
-				{"id": 3, "name": "Charlie"},
-				{"id": 2, "name": "Bob"},
+			rows: [][]interface{}{
+				{1, "Alice"},
+				{3, "Charlie"},
+				{2, "Bob"},
 			},
-			sortColumn:    "id",
+			sortColumn:    0,
 			sortDirection: "desc",
 			expectedFirst: 3,
 			expectedLast:  1,
 		},
 		{
 			name: "Sort by string column ascending",
-			rows: []map[string]interface{}{
-				{"name": "Charlie", "id": 3},
-				{"name": "Alice", "id": 1},
-				{"name": "Bob", "id": 2},
+			rows: [][]interface{}{
+				{"Charlie", 3},
+				{"Alice", 1},
+				{"Bob", 2},
 			},
-			sortColumn:    "name",
+			sortColumn:    0,
 			sortDirection: "asc",
 			expectedFirst: "Alice",
 			expectedLast:  "Charlie",
 		},
 		{
 			name: "Sort by string column descending",
-			rows: []map[string]interface{}{
-				{"name": "Alice", "id": 1},
-				{"name": "Charlie", "id": 3},
-				{"name": "Bob", "id": 2},
+			rows: [][]interface{}{
+				{"Alice", 1},
+				{"Charlie", 3},
+				{"Bob", 2},
 			},
-			sortColumn:    "name",
+			sortColumn:    0,
 			sortDirection: "desc",
 			expectedFirst: "Charlie",
 			expectedLast:  "Alice",
 		},
 		{
 			name: "Sort with nil values",
-			rows: []map[string]interface{}{
-				{"id": nil, "name": "Unknown"},
-				{"id": 2, "name": "Bob"},
-				{"id": 1, "name": "Alice"},
+			rows: [][]interface{}{
+				{nil, "Unknown"},
+				{2, "Bob"},
+				{1, "Alice"},
 			},
-			sortColumn:    "id",
+			sortColumn:    0,
 			sortDirection: "asc",
 			expectedFirst: nil,
 			expectedLast:  2,
 		},
 		{
 			name: "Sort by float column",
-			rows: []map[string]interface{}{
-				{"price": 19.99, "name": "Item A"},
-				{"price": 9.99, "name": "Item B"},
-				{"price": 29.99, "name": "Item C"},
+			rows: [][]interface{}{
+				{19.99, "Item A"},
+				{9.99, "Item B"},
+				{29.99, "Item C"},
 			},
-			sortColumn:    "price",
+			sortColumn:    0,
 			sortDirection: "asc",
 			expectedFirst: 9.99,
 			expectedLast:  29.99,
@@ -1035,8 +1035,6 @@ func TestToFloat64(t *testing.T) {
 
 // TestExportToCSV tests the CSV export functionality
 func TestExportToCSV(t *testing.T) {
-	queryService := &QueryService{}
-
 	tests := []struct {
 		name     string
 		rows     []map[string]interface{}
@@ -1078,7 +1076,7 @@ func TestExportToCSV(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := queryService.exportToCSV(tt.rows, tt.columns)
+			result, err := exportRowMaps("csv", tt.rows, tt.columns)
 			if err != nil {
 				t.Errorf("exportToCSV() unexpected error: %v", err)
 				return
@@ -1097,8 +1095,6 @@ func TestExportToCSV(t *testing.T) {
 
 // TestExportToJSON tests the JSON export functionality
 func TestExportToJSON(t *testing.T) {
-	queryService := &QueryService{}
-
 	tests := []struct {
 		name     string
 		rows     []map[string]interface{}
@@ -1132,7 +1128,7 @@ func TestExportToJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := queryService.exportToJSON(tt.rows, tt.columns)
+			result, err := exportRowMaps("json", tt.rows, tt.columns)
 			if err != nil {
 				t.Errorf("exportToJSON() unexpected error: %v", err)
 				return
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// ReplicaInput is a read replica endpoint of a data source
+type ReplicaInput struct {
+	Host string
+	Port int
+}
+
+// replicaEndpoint returns a copy of the data source that connects to one of its replicas.
+// The copy has the replica's ID, so it gets a connection pool of its own.
+func replicaEndpoint(dataSource *models.DataSource, replica *models.DataSourceReplica) *models.DataSource {
+	endpoint := *dataSource
+	endpoint.ID = replica.ID
+	endpoint.Name = fmt.Sprintf("%s (replica %s:%d)", dataSource.Name, replica.Host, replica.Port)
+	endpoint.Host = replica.Host
+	endpoint.Port = replica.Port
+	endpoint.Replicas = nil
+	return &endpoint
+}
+
+// routableReplicas returns the replicas of a data source that may serve reads: healthy at the last
+// health check and within the lag limit of the data source, least lagging first
+func routableReplicas(db *gorm.DB, dataSource *models.DataSource) ([]models.DataSourceReplica, error) {
+	var replicas []models.DataSourceReplica
+	err := db.Where("data_source_id = ? AND is_healthy = ? AND lag_seconds <= ?", dataSource.ID, true, dataSource.MaxReplicaLagSeconds).
+		Order("lag_seconds ASC").
+		Find(&replicas).Error
+	return replicas, err
+}
+
+// connectForRead returns a pool for read-only traffic and the endpoint it connects to. Reads go to
+// the least lagging routable replica; when there is none, or none can be reached, they use the primary.
+func (s *QueryService) connectForRead(dataSource *models.DataSource) (*gorm.DB, *models.DataSource, error) {
+	replicas, err := routableReplicas(s.db, dataSource)
+	if err != nil {
+		log.Printf("[ReplicaRouting] Failed to load replicas of %s, using the primary: %v", dataSource.Name, err)
+	}
+
+	for i := range replicas {
+		endpoint := replicaEndpoint(dataSource, &replicas[i])
+		db, err := s.connectToDataSource(endpoint)
+		if err == nil {
+			return db, endpoint, nil
+		}
+		log.Printf("[ReplicaRouting] %s is unavailable: %v", endpoint.Name, err)
+	}
+
+	db, err := s.connectToDataSource(dataSource)
+	return db, dataSource, err
+}
+
+// setReplicas replaces the replica endpoints of a data source. Replicas that stay keep their
+// health state; the pools of removed replicas are closed.
+func (s *DataSourceService) setReplicas(dataSourceID uuid.UUID, inputs []ReplicaInput) error {
+	var existing []models.DataSourceReplica
+	if err := s.db.Where("data_source_id = ?", dataSourceID).Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load replicas: %w", err)
+	}
+
+	endpoint := func(host string, port int) string {
+		return fmt.Sprintf("%s:%d", host, port)
+	}
+
+	wanted := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		wanted[endpoint(input.Host, input.Port)] = true
+	}
+
+	kept := make(map[string]bool, len(existing))
+	for _, replica := range existing {
+		key := endpoint(replica.Host, replica.Port)
+		if wanted[key] && !kept[key] {
+			kept[key] = true
+			continue
+		}
+		if err := s.db.Delete(&replica).Error; err != nil {
+			return fmt.Errorf("failed to remove replica %s: %w", key, err)
+		}
+		s.connections.Invalidate(replica.ID)
+	}
+
+	for _, input := range inputs {
+		key := endpoint(input.Host, input.Port)
+		if kept[key] {
+			continue
+		}
+		kept[key] = true
+
+		replica := &models.DataSourceReplica{
+			ID:           uuid.New(),
+			DataSourceID: dataSourceID,
+			Host:         input.Host,
+			Port:         input.Port,
+		}
+		if err := s.db.Create(replica).Error; err != nil {
+			return fmt.Errorf("failed to add replica %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckReplicas connects to each replica of a data source, measures its replication lag and records
+// the result, which decides where reads are routed until the next check
+func (s *DataSourceService) CheckReplicas(ctx context.Context, dataSource *models.DataSource) ([]dto.ReplicaHealth, error) {
+	var replicas []models.DataSourceReplica
+	if err := s.db.Where("data_source_id = ?", dataSource.ID).Order("host, port").Find(&replicas).Error; err != nil {
+		return nil, fmt.Errorf("failed to load replicas: %w", err)
+	}
+	if len(replicas) == 0 {
+		return nil, nil
+	}
+
+	credentials, err := resolveCredentials(ctx, s.decryptPassword, s.connections.secrets, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]dto.ReplicaHealth, 0, len(replicas))
+	for i := range replicas {
+		replica := &replicas[i]
+		start := time.Now()
+		lag, checkErr := s.measureReplicaLag(ctx, replicaEndpoint(dataSource, replica), credentials)
+		now := time.Now()
+
+		health := dto.ReplicaHealth{
+			ID:        replica.ID.String(),
+			Host:      replica.Host,
+			Port:      replica.Port,
+			LatencyMs: now.Sub(start).Milliseconds(),
+		}
+		updates := map[string]interface{}{
+			"last_checked_at": now,
+		}
+
+		if checkErr != nil {
+			health.Status = dto.HealthStatusUnhealthy
+			health.Error = checkErr.Error()
+			updates["is_healthy"] = false
+			updates["lag_seconds"] = nil
+			updates["last_error"] = checkErr.Error()
+		} else {
+			health.LagSeconds = &lag
+			health.Routable = lag <= float64(dataSource.MaxReplicaLagSeconds)
+			health.Status = dto.HealthStatusHealthy
+			if !health.Routable {
+				health.Status = dto.HealthStatusDegraded
+			}
+			updates["is_healthy"] = true
+			updates["lag_seconds"] = lag
+			updates["last_error"] = ""
+		}
+
+		if err := s.db.Model(replica).Updates(updates).Error; err != nil {
+			log.Printf("[ReplicaHealth] Failed to record health of replica %s:%d: %v", replica.Host, replica.Port, err)
+		}
+		results = append(results, health)
+	}
+
+	return results, nil
+}
+
+// measureReplicaLag returns how many seconds a replica is behind its primary
+func (s *DataSourceService) measureReplicaLag(ctx context.Context, endpoint *models.DataSource, credentials *ConnectionCredentials) (float64, error) {
+	db, err := s.connections.Get(endpoint, credentials)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	db = db.WithContext(ctx)
+
+	driver, err := LookupDataSourceDriver(endpoint.Type)
+	if err != nil {
+		return 0, err
+	}
+	reporter, ok := driver.(ReplicaLagReporter)
+	if !ok {
+		return 0, fmt.Errorf("%s data sources can't measure replication lag", endpoint.Type)
+	}
+	return reporter.ReplicaLag(db)
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/api/dto"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestRoutableReplicas_HealthyWithinLagLimit(t *testing.T) {
+	db := setupTestDB(t)
+	dataSource := &models.DataSource{ID: uuid.New(), Name: "analytics", MaxReplicaLagSeconds: 30}
+
+	addReplica := func(host string, healthy bool, lag *float64) *models.DataSourceReplica {
+		replica := &models.DataSourceReplica{ID: uuid.New(), DataSourceID: dataSource.ID, Host: host, Port: 5432}
+		require.NoError(t, db.Create(replica).Error)
+		require.NoError(t, db.Model(replica).Updates(map[string]interface{}{"is_healthy": healthy, "lag_seconds": lag}).Error)
+		return replica
+	}
+	lag := func(seconds float64) *float64 { return &seconds }
+
+	slower := addReplica("replica-b", true, lag(12))
+	faster := addReplica("replica-a", true, lag(0.5))
+	addReplica("lagging", true, lag(120))
+	addReplica("down", false, lag(1))
+	addReplica("unchecked", false, nil)
+
+	replicas, err := routableReplicas(db, dataSource)
+	require.NoError(t, err)
+	require.Len(t, replicas, 2)
+	assert.Equal(t, faster.ID, replicas[0].ID)
+	assert.Equal(t, slower.ID, replicas[1].ID)
+
+	// Replicas connect with the data source settings at their own endpoint and pool
+	endpoint := replicaEndpoint(dataSource, &replicas[0])
+	assert.Equal(t, faster.ID, endpoint.ID)
+	assert.Equal(t, "replica-a", endpoint.Host)
+	assert.Equal(t, "analytics (replica replica-a:5432)", endpoint.Name)
+	assert.Equal(t, "analytics", dataSource.Name)
+}
+
+func TestDataSourceReplicas_UpdateAndHealthCheck(t *testing.T) {
+	db := setupTestDB(t)
+	dataSourceService := NewDataSourceService(db, NewLegacyKeyring("0123456789abcdef0123456789abcdef"))
+
+	dataSource, err := dataSourceService.CreateDataSource(context.Background(), &CreateDataSourceInput{
+		Name:         "warehouse",
+		Type:         "oracle",
+		Host:         "primary",
+		Port:         1521,
+		DatabaseName: "dw",
+		Username:     "querybase",
+		Password:     "secret",
+		Replicas:     []ReplicaInput{{Host: "replica-1", Port: 1521}, {Host: "replica-2", Port: 1521}},
+	})
+	require.NoError(t, err)
+	require.Len(t, dataSource.Replicas, 2)
+	assert.Equal(t, 30, dataSource.MaxReplicaLagSeconds)
+
+	// A failed check marks replicas unhealthy so reads stay on the primary
+	health, err := dataSourceService.CheckReplicas(context.Background(), dataSource)
+	require.NoError(t, err)
+	require.Len(t, health, 2)
+	assert.Equal(t, dto.HealthStatusUnhealthy, health[0].Status)
+	assert.False(t, health[0].Routable)
+	assert.Contains(t, health[0].Error, "unsupported data source type")
+
+	var kept models.DataSourceReplica
+	require.NoError(t, db.First(&kept, "host = ?", "replica-1").Error)
+	require.NotNil(t, kept.LastCheckedAt)
+	assert.NotEmpty(t, kept.LastError)
+
+	// Replicas that stay keep their state; others are replaced
+	replicas := []ReplicaInput{{Host: "replica-1", Port: 1521}, {Host: "replica-3", Port: 1521}}
+	updated, err := dataSourceService.UpdateDataSource(context.Background(), dataSource.ID.String(), &UpdateDataSourceInput{Replicas: &replicas})
+	require.NoError(t, err)
+	require.Len(t, updated.Replicas, 2)
+
+	hosts := map[string]uuid.UUID{}
+	for _, replica := range updated.Replicas {
+		hosts[replica.Host] = replica.ID
+	}
+	assert.Equal(t, kept.ID, hosts["replica-1"])
+	assert.Contains(t, hosts, "replica-3")
+	assert.NotContains(t, hosts, "replica-2")
+
+	// An empty list removes all replicas
+	replicas = []ReplicaInput{}
+	updated, err = dataSourceService.UpdateDataSource(context.Background(), dataSource.ID.String(), &UpdateDataSourceInput{Replicas: &replicas})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Replicas)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// resultCacheKeyPrefix namespaces result cache entries in Redis
+const resultCacheKeyPrefix = "querybase:result_cache:"
+
+// ExecuteOptions changes how a query is executed
+type ExecuteOptions struct {
+	// Refresh runs the query on the data source even when a cached result exists
+	Refresh bool
+	// Approved runs a query whose approval request was approved, so neither the environment policy nor the cost guard
+	// sends it for approval again
+	Approved bool
+}
+
+// CachedResult is a SELECT result stored in the result cache
+type CachedResult struct {
+	QueryID     uuid.UUID `json:"query_id"` // the query whose execution produced the rows
+	ColumnNames string    `json:"column_names"`
+	ColumnTypes string    `json:"column_types"`
+	Data        string    `json:"data"`
+	DataFormat  string    `json:"data_format"`
+	RowCount    int       `json:"row_count"`
+	Truncated   bool      `json:"truncated"`
+	TruncatedBy string    `json:"truncated_by,omitempty"`
+	ResultLimit int64     `json:"result_limit,omitempty"`
+	CachedAt    time.Time `json:"cached_at"`
+}
+
+// ResultCache caches SELECT results in Redis so repeated queries skip the data source.
+// Without Redis it does nothing.
+type ResultCache struct {
+	redis         *redis.Client
+	maxEntryBytes int64
+}
+
+// NewResultCache creates a new result cache
+func NewResultCache(redisClient *redis.Client, cacheConfig config.ResultCacheConfig) *ResultCache {
+	return &ResultCache{
+		redis:         redisClient,
+		maxEntryBytes: cacheConfig.MaxEntryBytes,
+	}
+}
+
+// Enabled reports whether results can be cached
+func (c *ResultCache) Enabled() bool {
+	return c != nil && c.redis != nil
+}
+
+// ResultCacheKey fingerprints a SELECT on a data source. The SQL must already be normalized with
+// normalizeSQLForExecution and bound; the bound arguments and the result limits of the caller are part
+// of the key, so users with different limits never share a truncated result. The data source update
+// time is included so changing its settings starts a new cache generation.
+func ResultCacheKey(dataSource *models.DataSource, sqlText string, args []interface{}, limits ResultLimits) (string, error) {
+	fingerprint, err := json.Marshal(struct {
+		SQL      string        `json:"sql"`
+		Args     []interface{} `json:"args"`
+		MaxRows  int           `json:"max_rows"`
+		MaxBytes int64         `json:"max_bytes"`
+	}{sqlText, args, limits.MaxRows, limits.MaxBytes})
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint query: %w", err)
+	}
+
+	sum := sha256.Sum256(fingerprint)
+	return fmt.Sprintf("%s%s:%d:%s", resultCacheKeyPrefix, dataSource.ID, dataSource.UpdatedAt.UnixNano(), hex.EncodeToString(sum[:])), nil
+}
+
+// Get returns the cached result for key, or nil when there is none
+func (c *ResultCache) Get(ctx context.Context, key string) (*CachedResult, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+
+	data, err := c.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result cache: %w", err)
+	}
+
+	var cached CachedResult
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("failed to decode cached result: %w", err)
+	}
+	return &cached, nil
+}
+
+// Set caches a stored result under key for ttl. Results above the entry size limit are skipped.
+func (c *ResultCache) Set(ctx context.Context, key string, result *models.QueryResult, ttl time.Duration) error {
+	if !c.Enabled() || ttl <= 0 {
+		return nil
+	}
+	if c.maxEntryBytes > 0 && int64(result.SizeBytes) > c.maxEntryBytes {
+		return nil
+	}
+
+	data, err := json.Marshal(&CachedResult{
+		QueryID:     result.QueryID,
+		ColumnNames: result.ColumnNames,
+		ColumnTypes: result.ColumnTypes,
+		Data:        result.Data,
+		DataFormat:  result.DataFormat,
+		RowCount:    result.RowCount,
+		Truncated:   result.Truncated,
+		TruncatedBy: result.TruncatedBy,
+		ResultLimit: result.ResultLimit,
+		CachedAt:    result.StoredAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode cached result: %w", err)
+	}
+
+	if err := c.redis.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write result cache: %w", err)
+	}
+	return nil
+}
+
+// SetResultCache enables caching of SELECT results for data sources with a result cache TTL
+func (s *QueryService) SetResultCache(cache *ResultCache) {
+	s.resultCache = cache
+}
+
+// resultCacheKey returns the cache key of a SELECT, or "" when its result is not cached
+func (s *QueryService) resultCacheKey(dataSource *models.DataSource, sqlText string, args []interface{}, limits ResultLimits) string {
+	if !s.resultCache.Enabled() || dataSource.ResultCacheTTLSeconds <= 0 {
+		return ""
+	}
+
+	key, err := ResultCacheKey(dataSource, sqlText, args, limits)
+	if err != nil {
+		log.Printf("[ResultCache] Not caching query on %s: %v", dataSource.Name, err)
+		return ""
+	}
+	return key
+}
+
+// cachedQueryResult stores a cached result for the query and records the cache hit in its history
+func (s *QueryService) cachedQueryResult(query *models.Query, cached *CachedResult, startTime time.Time) (*models.QueryResult, error) {
+	cachedAt := cached.CachedAt
+	queryResult := &models.QueryResult{
+		ID:          uuid.New(),
+		QueryID:     query.ID,
+		RowCount:    cached.RowCount,
+		ColumnNames: cached.ColumnNames,
+		ColumnTypes: cached.ColumnTypes,
+		Data:        cached.Data,
+		DataFormat:  cached.DataFormat,
+		StoredAt:    time.Now(),
+		SizeBytes:   len(cached.Data),
+		Truncated:   cached.Truncated,
+		TruncatedBy: cached.TruncatedBy,
+		ResultLimit: cached.ResultLimit,
+		CachedAt:    &cachedAt,
+	}
+
+	log.Printf("[ExecuteQuery] Serving query %s from the result cache (computed by %s at %s)",
+		query.ID, cached.QueryID, cachedAt.Format(time.RFC3339))
+
+	if err := s.db.Create(queryResult).Error; err != nil {
+		return nil, fmt.Errorf("failed to save query result: %w", err)
+	}
+
+	s.completeQuery(query, queryResult.RowCount, true, startTime)
+	return queryResult, nil
+}
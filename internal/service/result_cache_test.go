@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestResultCacheKey(t *testing.T) {
+	dataSource := &models.DataSource{ID: uuid.New(), UpdatedAt: time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)}
+	limits := ResultLimits{MaxRows: 1000}
+
+	key := func(sqlText string, args []interface{}, limits ResultLimits) string {
+		k, err := ResultCacheKey(dataSource, sqlText, args, limits)
+		require.NoError(t, err)
+		return k
+	}
+
+	base := key(normalizeSQLForExecution("SELECT * FROM orders WHERE id = $1;"), []interface{}{int64(7)}, limits)
+	assert.Contains(t, base, dataSource.ID.String())
+
+	// Whitespace, comments and the trailing semicolon are normalized away
+	assert.Equal(t, base, key(normalizeSQLForExecution("SELECT *\n  FROM orders -- latest\n WHERE id = $1"), []interface{}{int64(7)}, limits))
+
+	// Bound values and the caller's result limits each get their own entry
+	assert.NotEqual(t, base, key(normalizeSQLForExecution("SELECT * FROM orders WHERE id = $1"), []interface{}{int64(8)}, limits))
+	assert.NotEqual(t, base, key(normalizeSQLForExecution("SELECT * FROM orders WHERE id = $1"), []interface{}{int64(7)}, ResultLimits{MaxRows: 10}))
+
+	// Updating the data source starts a new cache generation
+	dataSource.UpdatedAt = dataSource.UpdatedAt.Add(time.Second)
+	assert.NotEqual(t, base, key(normalizeSQLForExecution("SELECT * FROM orders WHERE id = $1"), []interface{}{int64(7)}, limits))
+}
+
+func TestResultCache_DisabledWithoutRedisOrTTL(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	dataSource := &models.DataSource{ID: uuid.New(), ResultCacheTTLSeconds: 60}
+
+	// No cache configured
+	assert.Empty(t, queryService.resultCacheKey(dataSource, "SELECT 1", nil, ResultLimits{}))
+
+	// A cache without Redis is disabled
+	queryService.SetResultCache(NewResultCache(nil, config.ResultCacheConfig{}))
+	assert.Empty(t, queryService.resultCacheKey(dataSource, "SELECT 1", nil, ResultLimits{}))
+}
+
+func TestCachedQueryResult_RecordsCacheHit(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	query := createAsyncTestQuery(t, db, models.StatusRunning, false)
+	computedAt := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	result, err := queryService.cachedQueryResult(query, &CachedResult{
+		QueryID:     uuid.New(),
+		ColumnNames: `["id"]`,
+		ColumnTypes: `["int4"]`,
+		Data:        `[[1],[2]]`,
+		DataFormat:  models.ResultFormatRows,
+		RowCount:    2,
+		CachedAt:    computedAt,
+	}, time.Now())
+	require.NoError(t, err)
+	require.NotNil(t, result.CachedAt)
+	assert.True(t, result.CachedAt.Equal(computedAt))
+
+	// The result is stored for the new query so pagination and export work as usual
+	rows, columns, _, err := queryService.GetPaginatedResults(context.Background(), query.ID, 1, 10, "", "asc")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id"}, columns)
+	assert.Len(t, rows, 2)
+
+	var stored models.Query
+	require.NoError(t, db.First(&stored, "id = ?", query.ID).Error)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+
+	var history models.QueryHistory
+	require.NoError(t, db.First(&history, "query_id = ?", query.ID).Error)
+	assert.True(t, history.CacheHit)
+	assert.Equal(t, 2, *history.RowCount)
+}
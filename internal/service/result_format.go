@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// ResultSet is a stored query result decoded into rows ordered like its columns.
+// Every column is kept, including duplicate names and unnamed expressions.
+type ResultSet struct {
+	Columns     []string
+	ColumnTypes []string
+	Rows        [][]interface{}
+}
+
+// DecodeQueryResult decodes a stored result in either the rows or the legacy objects encoding.
+// Numbers are kept as json.Number so large integers survive the round trip.
+func DecodeQueryResult(result *models.QueryResult) (*ResultSet, error) {
+	var columnNames []string
+	if result.ColumnNames != "" {
+		if err := json.Unmarshal([]byte(result.ColumnNames), &columnNames); err != nil {
+			return nil, fmt.Errorf("failed to parse column names: %w", err)
+		}
+	}
+
+	var columnTypes []string
+	if result.ColumnTypes != "" {
+		if err := json.Unmarshal([]byte(result.ColumnTypes), &columnTypes); err != nil {
+			return nil, fmt.Errorf("failed to parse column types: %w", err)
+		}
+	}
+
+	set := &ResultSet{
+		Columns:     columnNames,
+		ColumnTypes: columnTypes,
+		Rows:        [][]interface{}{},
+	}
+	if result.Data == "" {
+		return set, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(result.Data))
+	decoder.UseNumber()
+
+	if result.DataFormat == models.ResultFormatRows {
+		if err := decoder.Decode(&set.Rows); err != nil {
+			return nil, fmt.Errorf("failed to parse result data: %w", err)
+		}
+		return set, nil
+	}
+
+	// Legacy results are objects keyed by column name
+	var rowMaps []map[string]interface{}
+	if err := decoder.Decode(&rowMaps); err != nil {
+		return nil, fmt.Errorf("failed to parse result data: %w", err)
+	}
+	for _, rowMap := range rowMaps {
+		row := make([]interface{}, len(columnNames))
+		for j, col := range columnNames {
+			row[j] = rowMap[col]
+		}
+		set.Rows = append(set.Rows, row)
+	}
+	return set, nil
+}
+
+// ColumnIndex returns the position of the first column with the given name, or -1
+func (r *ResultSet) ColumnIndex(name string) int {
+	for i, col := range r.Columns {
+		if col == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// RowMaps returns the rows as objects keyed by ResultColumnKeys
+func (r *ResultSet) RowMaps() []map[string]interface{} {
+	return rowsToMaps(r.Columns, r.Rows)
+}
+
+// ResultColumnKeys returns a unique object key for every column. The first column with a
+// name keeps it, later duplicates get a numeric suffix (id, id_2) and columns without a
+// name are called column_N after their 1-based position.
+func ResultColumnKeys(columns []string) []string {
+	keys := make([]string, len(columns))
+	used := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		used[col] = true
+	}
+
+	seen := make(map[string]bool, len(columns))
+	for i, col := range columns {
+		key := col
+		if key == "" {
+			key = "column_" + strconv.Itoa(i+1)
+		}
+		if seen[key] || (col == "" && used[key]) {
+			base := key
+			for n := 2; ; n++ {
+				key = base + "_" + strconv.Itoa(n)
+				if !used[key] && !seen[key] {
+					break
+				}
+			}
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+// rowsToMaps converts ordered rows into objects keyed by ResultColumnKeys
+func rowsToMaps(columns []string, rows [][]interface{}) []map[string]interface{} {
+	keys := ResultColumnKeys(columns)
+	maps := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		m := make(map[string]interface{}, len(keys))
+		for j, key := range keys {
+			if j < len(row) {
+				m[key] = row[j]
+			} else {
+				m[key] = nil
+			}
+		}
+		maps[i] = m
+	}
+	return maps
+}
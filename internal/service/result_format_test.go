@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestDecodeQueryResult_RowsKeepDuplicateColumns(t *testing.T) {
+	set, err := DecodeQueryResult(&models.QueryResult{
+		ColumnNames: `["id","id","?column?"]`,
+		ColumnTypes: `["INT4","INT4","TEXT"]`,
+		Data:        `[[1,10,"x"],[2,20,null]]`,
+		DataFormat:  models.ResultFormatRows,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"id", "id", "?column?"}, set.Columns)
+	assert.Equal(t, []string{"INT4", "INT4", "TEXT"}, set.ColumnTypes)
+	assert.Equal(t, [][]interface{}{
+		{json.Number("1"), json.Number("10"), "x"},
+		{json.Number("2"), json.Number("20"), nil},
+	}, set.Rows)
+
+	assert.Equal(t, []map[string]interface{}{
+		{"id": json.Number("1"), "id_2": json.Number("10"), "?column?": "x"},
+		{"id": json.Number("2"), "id_2": json.Number("20"), "?column?": nil},
+	}, set.RowMaps())
+}
+
+func TestDecodeQueryResult_LegacyObjects(t *testing.T) {
+	// Results stored before the rows encoding have no data format
+	set, err := DecodeQueryResult(&models.QueryResult{
+		ColumnNames: `["name","id"]`,
+		ColumnTypes: `["TEXT","INT8"]`,
+		Data:        `[{"id":9007199254740993,"name":"a"},{"name":"b"}]`,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]interface{}{
+		{"a", json.Number("9007199254740993")},
+		{"b", nil},
+	}, set.Rows)
+}
+
+func TestDecodeQueryResult_Empty(t *testing.T) {
+	set, err := DecodeQueryResult(&models.QueryResult{ColumnNames: `["id"]`, DataFormat: models.ResultFormatRows})
+	require.NoError(t, err)
+	assert.Empty(t, set.Rows)
+
+	_, err = DecodeQueryResult(&models.QueryResult{ColumnNames: `["id"]`, Data: `{`, DataFormat: models.ResultFormatRows})
+	assert.Error(t, err)
+}
+
+func TestResultColumnKeys(t *testing.T) {
+	assert.Equal(t, []string{"id", "name"}, ResultColumnKeys([]string{"id", "name"}))
+	assert.Equal(t, []string{"id", "id_3", "id_2"}, ResultColumnKeys([]string{"id", "id", "id_2"}))
+	assert.Equal(t, []string{"column_1", "count", "count_2"}, ResultColumnKeys([]string{"", "count", "count"}))
+	assert.Equal(t, []string{"column_1_2", "column_1"}, ResultColumnKeys([]string{"", "column_1"}))
+}
+
+func TestGetPaginatedResults_OrderedRows(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	queryID := uuid.New()
+	require.NoError(t, db.Create(&models.QueryResult{
+		ID:          uuid.New(),
+		QueryID:     queryID,
+		ColumnNames: `["id","name","id"]`,
+		ColumnTypes: `["INT4","TEXT","INT4"]`,
+		Data:        `[[1,"b",30],[2,"c",10],[3,"a",20]]`,
+		DataFormat:  models.ResultFormatRows,
+		RowCount:    3,
+	}).Error)
+
+	rows, columns, meta, err := queryService.GetPaginatedResults(context.Background(), queryID, 1, 2, "name", "asc")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"id", "name", "id"}, columns)
+	assert.Equal(t, [][]interface{}{
+		{json.Number("3"), "a", json.Number("20")},
+		{json.Number("1"), "b", json.Number("30")},
+	}, rows)
+	assert.Equal(t, 3, meta.TotalRows)
+	assert.True(t, meta.HasNext)
+
+	// Sorting by a duplicated name uses the first column with that name
+	rows, _, _, err = queryService.GetPaginatedResults(context.Background(), queryID, 1, 10, "id", "desc")
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("3"), rows[0][0])
+}
+
+func TestLoadExportTable_LegacyObjects(t *testing.T) {
+	queryService := &QueryService{}
+
+	table, err := queryService.loadExportTable(&models.QueryResult{
+		ColumnNames: `["id","name"]`,
+		Data:        `[{"name":"a","id":1}]`,
+		DataFormat:  models.ResultFormatObjects,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{json.Number("1"), "a"}}, table.Rows)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+// Limit names reported when a SELECT result is truncated
+const (
+	ResultLimitMaxRows  = "max_rows"
+	ResultLimitMaxBytes = "max_bytes"
+)
+
+// ResultLimits bounds how much of a SELECT result is read and stored (0 = unlimited)
+type ResultLimits struct {
+	MaxRows  int
+	MaxBytes int64
+}
+
+// valueOf returns the value of the named limit
+func (l ResultLimits) valueOf(name string) int64 {
+	switch name {
+	case ResultLimitMaxRows:
+		return int64(l.MaxRows)
+	case ResultLimitMaxBytes:
+		return l.MaxBytes
+	default:
+		return 0
+	}
+}
+
+// SetRoleResultLimits configures the result limits applied to each user role
+func (s *QueryService) SetRoleResultLimits(queryLimits config.QueryLimitsConfig) {
+	roleLimits := make(map[models.UserRole]ResultLimits, len(queryLimits.Roles))
+	for role, limit := range queryLimits.Roles {
+		roleLimits[models.UserRole(role)] = ResultLimits{
+			MaxRows:  limit.MaxRows,
+			MaxBytes: limit.MaxBytes,
+		}
+	}
+	s.roleLimits = roleLimits
+}
+
+// resultLimitsFor resolves the effective limits for a user on a data source.
+// The strictest of the data source, environment and role limits wins.
+func (s *QueryService) resultLimitsFor(userID uuid.UUID, dataSource *models.DataSource) ResultLimits {
+	limits := ResultLimits{
+		MaxRows:  dataSource.MaxResultRows,
+		MaxBytes: dataSource.MaxResultBytes,
+	}
+	environmentMaxRows := s.EnvironmentPolicy(dataSource.Environment).MaxRows
+	limits.MaxRows = int(stricterLimit(int64(limits.MaxRows), int64(environmentMaxRows)))
+
+	var user models.User
+	if err := s.db.Select("role").First(&user, "id = ?", userID).Error; err != nil {
+		return limits
+	}
+
+	roleLimits, ok := s.roleLimits[user.Role]
+	if !ok {
+		return limits
+	}
+
+	limits.MaxRows = int(stricterLimit(int64(limits.MaxRows), int64(roleLimits.MaxRows)))
+	limits.MaxBytes = stricterLimit(limits.MaxBytes, roleLimits.MaxBytes)
+	return limits
+}
+
+// stricterLimit returns the smaller of two limits, treating 0 as unlimited
+func stricterLimit(a, b int64) int64 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// TruncationMessage explains which limit cut off a result and how to get the full data
+func TruncationMessage(truncatedBy string, limit int64) string {
+	switch truncatedBy {
+	case ResultLimitMaxRows:
+		return fmt.Sprintf("Results were truncated to the first %d rows. Export the query to download the full result set.", limit)
+	case ResultLimitMaxBytes:
+		return fmt.Sprintf("Results were truncated at %d bytes. Export the query to download the full result set.", limit)
+	default:
+		return ""
+	}
+}
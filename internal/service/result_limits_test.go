@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestStricterLimit(t *testing.T) {
+	assert.Equal(t, int64(100), stricterLimit(100, 500))
+	assert.Equal(t, int64(100), stricterLimit(500, 100))
+	assert.Equal(t, int64(500), stricterLimit(0, 500), "0 means unlimited")
+	assert.Equal(t, int64(500), stricterLimit(500, 0), "0 means unlimited")
+	assert.Equal(t, int64(0), stricterLimit(0, 0))
+}
+
+func TestSetRoleResultLimits(t *testing.T) {
+	queryService := NewQueryService(nil, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	queryService.SetRoleResultLimits(config.QueryLimitsConfig{
+		Roles: map[string]config.ResultLimitConfig{
+			"viewer": {MaxRows: 500, MaxBytes: 1024},
+		},
+	})
+
+	limits, ok := queryService.roleLimits[models.RoleViewer]
+	assert.True(t, ok)
+	assert.Equal(t, 500, limits.MaxRows)
+	assert.Equal(t, int64(1024), limits.MaxBytes)
+	assert.Equal(t, int64(500), limits.valueOf(ResultLimitMaxRows))
+	assert.Equal(t, int64(1024), limits.valueOf(ResultLimitMaxBytes))
+}
+
+func TestTruncationMessage(t *testing.T) {
+	assert.Contains(t, TruncationMessage(ResultLimitMaxRows, 1000), "first 1000 rows")
+	assert.Contains(t, TruncationMessage(ResultLimitMaxBytes, 2048), "2048 bytes")
+	assert.Contains(t, TruncationMessage(ResultLimitMaxRows, 1000), "Export")
+	assert.Empty(t, TruncationMessage("", 0))
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// Result pagination modes of GET /queries/:id/results
+const (
+	// PaginationModeStored pages through the result stored when the query ran
+	PaginationModeStored = "stored"
+	// PaginationModeDatabase re-runs the query on the data source for every page
+	PaginationModeDatabase = "database"
+)
+
+// ErrCannotPaginateOnDataSource is returned when a query can't be safely re-run as a paged subquery.
+// Callers fall back to the stored result.
+var ErrCannotPaginateOnDataSource = errors.New("query cannot be paginated on the data source")
+
+// lockingClausePattern matches clauses that take row locks or write the result into a table
+var lockingClausePattern = regexp.MustCompile(`\b(FOR\s+(UPDATE|SHARE|NO\s+KEY\s+UPDATE|KEY\s+SHARE)|LOCK\s+IN\s+SHARE\s+MODE|INTO)\b`)
+
+// paginationBlocker returns why a query can't be wrapped in a derived table, or "" if it can.
+// queryText must already be normalized for execution.
+func paginationBlocker(queryText string) string {
+	if DetectOperationType(queryText) != models.OperationSelect {
+		return "only SELECT queries can be paginated on the data source"
+	}
+	if IsMultiQuery(queryText) {
+		return "the query contains more than one statement"
+	}
+
+	upper := strings.ToUpper(queryText)
+	if !strings.HasPrefix(upper, "SELECT") && !strings.HasPrefix(upper, "WITH") && !strings.HasPrefix(upper, "(") {
+		return "only SELECT and WITH queries can be used as a subquery"
+	}
+	if lockingClausePattern.MatchString(upper) {
+		return "the query locks rows or selects INTO a table"
+	}
+	return ""
+}
+
+// GetPaginatedResultsFromDataSource re-runs a SELECT on its data source wrapped in ORDER BY and
+// LIMIT/OFFSET, so sorting uses the SQL types of the columns and only one page is transferred.
+// It returns ErrCannotPaginateOnDataSource when the query can't be wrapped safely or can't be re-run
+// without approval. The row count stops at the result limits of the user.
+func (s *QueryService) GetPaginatedResultsFromDataSource(ctx context.Context, userID uuid.UUID, query *models.Query, dataSource *models.DataSource, page, perPage int, sortColumn, sortDirection string) (*ResultSet, *PaginationMeta, error) {
+	queryText := normalizeSQLForExecution(query.QueryText)
+	if reason := paginationBlocker(queryText); reason != "" {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCannotPaginateOnDataSource, reason)
+	}
+
+	// Placeholders survive the wrapping, so the same arguments bind every statement below
+	sqlText, args, err := bindQuery(query, queryText, dataSource.Type)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perms, err := s.GetEffectivePermissions(ctx, userID, dataSource.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if !perms.CanSelect {
+		return nil, nil, fmt.Errorf("permission denied: group policies do not allow SELECT on this datasource")
+	}
+
+	// Each page is a new execution, so where the environment policy requires approval for
+	// SELECTs the stored result is used instead
+	if s.ApprovalRequired(userID, dataSource, models.OperationSelect) {
+		return nil, nil, fmt.Errorf("%w: %w", ErrCannotPaginateOnDataSource, ErrApprovalRequired)
+	}
+
+	// Pages stop at the row limit the stored result was truncated to
+	maxRows := s.resultLimitsFor(userID, dataSource).MaxRows
+
+	// Counting the rows runs the whole query, so the cost guard applies as when it first ran
+	if err := s.checkRerunCost(ctx, query, dataSource, sqlText, args); err != nil {
+		return nil, nil, err
+	}
+
+	// Re-runs are read-only, so they go to a healthy replica when the data source has one
+	dataSourceDB, endpoint, err := s.connectForRead(dataSource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to data source: %w", err)
+	}
+
+	// Page queries are cancellable and bounded by the statement timeout like any other execution
+	pageID := uuid.New()
+	runCtx, finish := s.startRunningQuery(ctx, pageID, endpoint)
+	defer finish()
+
+	var (
+		set      *ResultSet
+		meta     *PaginationMeta
+		blocking string
+	)
+
+	execErr := dataSourceDB.WithContext(runCtx).Connection(func(conn *gorm.DB) error {
+		if err := s.prepareSession(conn, pageID, dataSource); err != nil {
+			return err
+		}
+		defer s.resetSession(conn, dataSource)
+
+		// The user SQL runs three times below, each time unable to write
+		tx, err := beginReadOnly(conn)
+		if err != nil {
+			return err
+		}
+		defer endReadOnly(tx)
+
+		// The column list decides the sort position. Probing it also catches queries the database
+		// rejects as a derived table, such as duplicate column names on MySQL.
+		columns, err := pageColumns(tx, sqlText, args)
+		if err != nil {
+			if runCtx.Err() != nil || isReadOnlyViolation(err) {
+				return s.classifyExecutionError(runCtx, pageID, dataSource, err)
+			}
+			blocking = fmt.Sprintf("the query can't be used as a subquery: %v", err)
+			return nil
+		}
+
+		totalRows, err := countRows(tx, fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS qb_count", sqlText), args)
+		if err != nil {
+			return s.classifyExecutionError(runCtx, pageID, dataSource, err)
+		}
+
+		if maxRows > 0 && totalRows > int64(maxRows) {
+			totalRows = int64(maxRows)
+		}
+		meta = newPaginationMeta(int(totalRows), page, perPage)
+
+		// Sort by position: names may be duplicated or need dialect-specific quoting
+		set = &ResultSet{Columns: columns, Rows: [][]interface{}{}}
+		pageSQL := fmt.Sprintf("SELECT * FROM (%s) AS qb_page", sqlText)
+		if index := set.ColumnIndex(sortColumn); sortColumn != "" && index >= 0 {
+			direction := "ASC"
+			if sortDirection == "desc" {
+				direction = "DESC"
+			}
+			pageSQL += fmt.Sprintf(" ORDER BY %d %s", index+1, direction)
+		}
+		offset := (meta.Page - 1) * perPage
+		limit := perPage
+		if maxRows > 0 && offset+limit > maxRows {
+			limit = maxRows - offset
+		}
+		pageSQL += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+
+		rows, err := queryRows(tx, pageSQL, args)
+		if err != nil {
+			return s.classifyExecutionError(runCtx, pageID, dataSource, err)
+		}
+		defer rows.Close()
+
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return fmt.Errorf("failed to get column types: %w", err)
+		}
+
+		set.ColumnTypes = make([]string, len(columnTypes))
+		for i, ct := range columnTypes {
+			set.ColumnTypes[i] = ct.DatabaseTypeName()
+		}
+
+		for rows.Next() {
+			values := make([]interface{}, len(columnTypes))
+			valuePtrs := make([]interface{}, len(columnTypes))
+			for i := range values {
+				valuePtrs[i] = &values[i]
+			}
+			if err := rows.Scan(valuePtrs...); err != nil {
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			for i, val := range values {
+				if b, ok := val.([]byte); ok {
+					values[i] = string(b)
+				}
+			}
+			set.Rows = append(set.Rows, values)
+		}
+
+		if err := rows.Err(); err != nil {
+			return s.classifyExecutionError(runCtx, pageID, dataSource, err)
+		}
+		return nil
+	})
+	if execErr != nil {
+		return nil, nil, execErr
+	}
+	if blocking != "" {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCannotPaginateOnDataSource, blocking)
+	}
+
+	return set, meta, nil
+}
+
+// pageColumns asks the data source for the current columns of a query without fetching rows.
+// The stored result is not used because the columns of SELECT * change with the schema.
+func pageColumns(conn *gorm.DB, sqlText string, args []interface{}) ([]string, error) {
+	rows, err := queryRows(conn, fmt.Sprintf("SELECT * FROM (%s) AS qb_columns LIMIT 0", sqlText), args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// countRows runs a COUNT(*) statement
+func countRows(conn *gorm.DB, sqlText string, args []interface{}) (int64, error) {
+	rows, err := queryRows(conn, sqlText, args)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, rows.Err()
+}
+
+// newPaginationMeta clamps page into range and describes the page within totalRows
+func newPaginationMeta(totalRows, page, perPage int) *PaginationMeta {
+	totalPages := (totalRows + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	return &PaginationMeta{
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+		TotalRows:  totalRows,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+	}
+}
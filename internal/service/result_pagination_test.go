@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestPaginationBlocker(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wrappable bool
+	}{
+		{"simple select", "SELECT id, name FROM users WHERE active = true ORDER BY id", true},
+		{"cte", "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", true},
+		{"select with limit", "SELECT * FROM users LIMIT 500", true},
+		{"update", "UPDATE users SET name = 'x'", false},
+		{"show", "SHOW TABLES", false},
+		{"explain", "EXPLAIN SELECT * FROM users", false},
+		{"multiple statements", "SELECT 1; SELECT 2", false},
+		{"for update", "SELECT * FROM users FOR UPDATE", false},
+		{"lock in share mode", "SELECT * FROM users LOCK IN SHARE MODE", false},
+		{"select into", "SELECT * INTO backup_users FROM users", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := paginationBlocker(normalizeSQLForExecution(tt.query))
+			if tt.wrappable {
+				assert.Empty(t, reason)
+			} else {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
+
+func TestNewPaginationMeta(t *testing.T) {
+	meta := newPaginationMeta(250, 3, 100)
+	assert.Equal(t, 3, meta.TotalPages)
+	assert.Equal(t, 3, meta.Page)
+	assert.False(t, meta.HasNext)
+	assert.True(t, meta.HasPrev)
+
+	// Pages past the end are clamped, and an empty result still has one page
+	assert.Equal(t, 3, newPaginationMeta(250, 9, 100).Page)
+	empty := newPaginationMeta(0, 2, 100)
+	assert.Equal(t, 1, empty.Page)
+	assert.Equal(t, 1, empty.TotalPages)
+}
+
+func TestGetPaginatedResultsFromDataSource_FallsBackForUnwrappableQueries(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	query.QueryText = "SELECT * FROM users FOR UPDATE"
+
+	var dataSource models.DataSource
+	require.NoError(t, db.First(&dataSource, "id = ?", query.DataSourceID).Error)
+
+	_, _, err := queryService.GetPaginatedResultsFromDataSource(context.Background(), query.UserID, query, &dataSource, 1, 100, "", "asc")
+	assert.ErrorIs(t, err, ErrCannotPaginateOnDataSource)
+	assert.Contains(t, err.Error(), "locks rows")
+}
+
+func TestGetPaginatedResultsFromDataSource_RequiresSelectPermission(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+
+	// The query owner belongs to no group
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	var dataSource models.DataSource
+	require.NoError(t, db.First(&dataSource, "id = ?", query.DataSourceID).Error)
+
+	_, _, err := queryService.GetPaginatedResultsFromDataSource(context.Background(), query.UserID, query, &dataSource, 1, 100, "", "asc")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permission denied")
+}
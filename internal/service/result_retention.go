@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrResultPurged is returned when the data of a stored result was removed by the retention policy
+var ErrResultPurged = errors.New("the stored result was removed by the retention policy")
+
+// Retention rules reported for purged results
+const (
+	RetentionRuleMaxAge          = "max_age"
+	RetentionRuleMaxTotalBytes   = "max_total_bytes"
+	RetentionRuleKeepLastPerUser = "keep_last_per_user"
+)
+
+// purgeBatchSize bounds the number of results cleared by one UPDATE
+const purgeBatchSize = 500
+
+// RetentionPolicy bounds the stored results of a data source (0 disables a rule)
+type RetentionPolicy struct {
+	MaxAge          time.Duration `json:"max_age"`
+	MaxTotalBytes   int64         `json:"max_total_bytes"`
+	KeepLastPerUser int           `json:"keep_last_per_user"`
+}
+
+// RetentionReport describes what a cleanup run purged
+type RetentionReport struct {
+	DataSources    int            `json:"data_sources"`
+	ResultsPurged  int            `json:"results_purged"`
+	BytesReclaimed int64          `json:"bytes_reclaimed"`
+	ByRule         map[string]int `json:"by_rule"`
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     time.Time      `json:"finished_at"`
+}
+
+// RetentionService purges the data of stored query results according to the retention policy.
+// Query, result and history metadata are kept; only the result rows are removed.
+type RetentionService struct {
+	db       *gorm.DB
+	defaults RetentionPolicy
+}
+
+// NewRetentionService creates a new retention service with the global retention settings
+func NewRetentionService(db *gorm.DB, retention config.RetentionConfig) *RetentionService {
+	return &RetentionService{
+		db: db,
+		defaults: RetentionPolicy{
+			MaxAge:          retention.MaxAge,
+			MaxTotalBytes:   retention.MaxTotalBytes,
+			KeepLastPerUser: retention.KeepLastPerUser,
+		},
+	}
+}
+
+// PolicyFor returns the retention policy of a data source, applying its overrides to the global settings
+func (s *RetentionService) PolicyFor(dataSource *models.DataSource) RetentionPolicy {
+	policy := s.defaults
+	if dataSource.ResultMaxAgeHours != nil {
+		policy.MaxAge = time.Duration(*dataSource.ResultMaxAgeHours) * time.Hour
+	}
+	if dataSource.ResultMaxTotalBytes != nil {
+		policy.MaxTotalBytes = *dataSource.ResultMaxTotalBytes
+	}
+	if dataSource.ResultKeepLastPerUser != nil {
+		policy.KeepLastPerUser = *dataSource.ResultKeepLastPerUser
+	}
+	return policy
+}
+
+// retainedResult is the metadata of a stored result needed to apply the policy
+type retainedResult struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	SizeBytes int64
+	StoredAt  time.Time
+}
+
+// PurgeResults applies the retention policy of every data source, including deleted ones, and
+// reports the results purged and the bytes reclaimed
+func (s *RetentionService) PurgeResults(ctx context.Context, now time.Time) (*RetentionReport, error) {
+	report := &RetentionReport{
+		ByRule:    map[string]int{},
+		StartedAt: time.Now(),
+	}
+
+	var dataSources []models.DataSource
+	if err := s.db.WithContext(ctx).Unscoped().Find(&dataSources).Error; err != nil {
+		return nil, fmt.Errorf("failed to load data sources: %w", err)
+	}
+
+	for i := range dataSources {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := s.purgeDataSource(ctx, &dataSources[i], now, report); err != nil {
+			return report, fmt.Errorf("failed to purge results of data source %s: %w", dataSources[i].Name, err)
+		}
+		report.DataSources++
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// purgeDataSource purges the results of one data source and adds them to the report
+func (s *RetentionService) purgeDataSource(ctx context.Context, dataSource *models.DataSource, now time.Time, report *RetentionReport) error {
+	policy := s.PolicyFor(dataSource)
+	if policy.MaxAge <= 0 && policy.MaxTotalBytes <= 0 && policy.KeepLastPerUser <= 0 {
+		return nil
+	}
+
+	// Queries are joined without the soft delete scope so results of deleted queries are purged too
+	var results []retainedResult
+	err := s.db.WithContext(ctx).Table("query_results").
+		Select("query_results.id, queries.user_id, query_results.size_bytes, query_results.stored_at").
+		Joins("JOIN queries ON queries.id = query_results.query_id").
+		Where("queries.data_source_id = ? AND query_results.purged_at IS NULL", dataSource.ID).
+		Order("query_results.stored_at DESC").
+		Scan(&results).Error
+	if err != nil {
+		return err
+	}
+
+	var (
+		purge      []uuid.UUID
+		purgeBytes int64
+		totalBytes int64
+		perUser    = map[uuid.UUID]int{}
+	)
+
+	// Newest first: the per-user count and the size budget keep the most recent results
+	for _, result := range results {
+		perUser[result.UserID]++
+
+		rule := ""
+		switch {
+		case policy.MaxAge > 0 && result.StoredAt.Before(now.Add(-policy.MaxAge)):
+			rule = RetentionRuleMaxAge
+		case policy.KeepLastPerUser > 0 && perUser[result.UserID] > policy.KeepLastPerUser:
+			rule = RetentionRuleKeepLastPerUser
+		case policy.MaxTotalBytes > 0 && totalBytes+result.SizeBytes > policy.MaxTotalBytes:
+			rule = RetentionRuleMaxTotalBytes
+		}
+
+		if rule == "" {
+			totalBytes += result.SizeBytes
+			continue
+		}
+		purge = append(purge, result.ID)
+		purgeBytes += result.SizeBytes
+		report.ByRule[rule]++
+	}
+
+	for start := 0; start < len(purge); start += purgeBatchSize {
+		end := start + purgeBatchSize
+		if end > len(purge) {
+			end = len(purge)
+		}
+		err := s.db.WithContext(ctx).Model(&models.QueryResult{}).
+			Where("id IN ? AND purged_at IS NULL", purge[start:end]).
+			Updates(map[string]interface{}{
+				"data":        "[]",
+				"data_format": models.ResultFormatRows,
+				"purged_at":   now,
+			}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	report.ResultsPurged += len(purge)
+	report.BytesReclaimed += purgeBytes
+	return nil
+}
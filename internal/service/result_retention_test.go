@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// storeTestResult stores a completed query of userID on the data source with a result and history entry
+func storeTestResult(t *testing.T, db *gorm.DB, dataSourceID, userID uuid.UUID, storedAt time.Time, sizeBytes int) *models.QueryResult {
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  dataSourceID,
+		UserID:        userID,
+		QueryText:     "SELECT id FROM users",
+		OperationType: models.OperationSelect,
+		Status:        models.StatusCompleted,
+	}
+	require.NoError(t, db.Create(query).Error)
+
+	result := &models.QueryResult{
+		ID:          uuid.New(),
+		QueryID:     query.ID,
+		Data:        `[[1],[2]]`,
+		DataFormat:  models.ResultFormatRows,
+		ColumnNames: `["id"]`,
+		ColumnTypes: `["int4"]`,
+		RowCount:    2,
+		StoredAt:    storedAt,
+		SizeBytes:   sizeBytes,
+	}
+	require.NoError(t, db.Create(result).Error)
+
+	require.NoError(t, db.Create(&models.QueryHistory{
+		ID:            uuid.New(),
+		QueryID:       &query.ID,
+		UserID:        userID,
+		DataSourceID:  dataSourceID,
+		QueryText:     query.QueryText,
+		OperationType: models.OperationSelect,
+		Status:        models.StatusCompleted,
+		RowCount:      &result.RowCount,
+		ExecutedAt:    storedAt,
+	}).Error)
+	return result
+}
+
+// isPurged reports whether the retention policy removed the data of a result
+func isPurged(t *testing.T, db *gorm.DB, result *models.QueryResult) bool {
+	var stored models.QueryResult
+	require.NoError(t, db.First(&stored, "id = ?", result.ID).Error)
+	return stored.PurgedAt != nil
+}
+
+func TestPurgeResults_MaxAgeKeepsHistory(t *testing.T) {
+	db := setupTestDB(t)
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	old := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-48*time.Hour), 1000)
+	recent := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-time.Hour), 500)
+
+	retentionService := NewRetentionService(db, config.RetentionConfig{MaxAge: 24 * time.Hour})
+	report, err := retentionService.PurgeResults(context.Background(), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.ResultsPurged)
+	assert.Equal(t, int64(1000), report.BytesReclaimed)
+	assert.Equal(t, map[string]int{RetentionRuleMaxAge: 1}, report.ByRule)
+	assert.True(t, isPurged(t, db, old))
+	assert.False(t, isPurged(t, db, recent))
+
+	// Only the rows are removed; the result metadata and history entry stay
+	var stored models.QueryResult
+	require.NoError(t, db.First(&stored, "id = ?", old.ID).Error)
+	assert.Equal(t, "[]", stored.Data)
+	assert.Equal(t, 2, stored.RowCount)
+	var history int64
+	require.NoError(t, db.Model(&models.QueryHistory{}).Where("query_id = ?", old.QueryID).Count(&history).Error)
+	assert.Equal(t, int64(1), history)
+
+	// A second run finds nothing left to purge
+	report, err = retentionService.PurgeResults(context.Background(), now)
+	require.NoError(t, err)
+	assert.Zero(t, report.ResultsPurged)
+}
+
+func TestPurgeResults_KeepLastPerUser(t *testing.T) {
+	db := setupTestDB(t)
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	other := createTestUser(t, db, models.RoleUser)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	oldest := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-3*time.Hour), 100)
+	middle := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-2*time.Hour), 100)
+	newest := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-time.Hour), 100)
+	otherUser := storeTestResult(t, db, query.DataSourceID, other.ID, now.Add(-5*time.Hour), 100)
+
+	retentionService := NewRetentionService(db, config.RetentionConfig{KeepLastPerUser: 2})
+	report, err := retentionService.PurgeResults(context.Background(), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{RetentionRuleKeepLastPerUser: 1}, report.ByRule)
+	assert.True(t, isPurged(t, db, oldest))
+	assert.False(t, isPurged(t, db, middle))
+	assert.False(t, isPurged(t, db, newest))
+	assert.False(t, isPurged(t, db, otherUser))
+}
+
+func TestPurgeResults_MaxTotalBytesAndOverrides(t *testing.T) {
+	db := setupTestDB(t)
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	oldest := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-3*time.Hour), 400)
+	middle := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-2*time.Hour), 400)
+	newest := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-time.Hour), 400)
+
+	// The data source raises the size budget and disables the global keep-last rule
+	maxTotalBytes, keepLast := int64(1000), 0
+	require.NoError(t, db.Model(&models.DataSource{}).Where("id = ?", query.DataSourceID).Updates(map[string]interface{}{
+		"result_max_total_bytes":    maxTotalBytes,
+		"result_keep_last_per_user": keepLast,
+	}).Error)
+
+	retentionService := NewRetentionService(db, config.RetentionConfig{MaxTotalBytes: 500, KeepLastPerUser: 1})
+	report, err := retentionService.PurgeResults(context.Background(), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{RetentionRuleMaxTotalBytes: 1}, report.ByRule)
+	assert.Equal(t, int64(400), report.BytesReclaimed)
+	assert.True(t, isPurged(t, db, oldest))
+	assert.False(t, isPurged(t, db, middle))
+	assert.False(t, isPurged(t, db, newest))
+}
+
+func TestPurgedResult_ReturnsErrResultPurged(t *testing.T) {
+	db := setupTestDB(t)
+	queryService := NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil)
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	now := time.Now()
+
+	result := storeTestResult(t, db, query.DataSourceID, query.UserID, now.Add(-48*time.Hour), 100)
+	_, err := NewRetentionService(db, config.RetentionConfig{MaxAge: time.Hour}).PurgeResults(context.Background(), now)
+	require.NoError(t, err)
+
+	_, _, _, err = queryService.GetPaginatedResults(context.Background(), result.QueryID, 1, 10, "", "asc")
+	assert.ErrorIs(t, err, ErrResultPurged)
+	_, _, err = queryService.ExportQuery(context.Background(), result.QueryID, "csv")
+	assert.ErrorIs(t, err, ErrResultPurged)
+}
@@ -0,0 +1,511 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSchedule is returned when a schedule can't be saved as given
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ErrScheduleInactive is returned when a disabled schedule is asked to run
+var ErrScheduleInactive = errors.New("schedule is not active")
+
+// defaultMaxAttachmentBytes is the largest CSV attached when no limit is configured
+const defaultMaxAttachmentBytes = 10 * 1024 * 1024
+
+// ScheduleService manages scheduled runs of saved queries and delivers their results
+type ScheduleService struct {
+	db                  *gorm.DB
+	queryService        *QueryService
+	notificationService *NotificationService
+	appURL              string
+	maxAttachmentBytes  int64
+}
+
+// NewScheduleService creates a new schedule service
+func NewScheduleService(db *gorm.DB, queryService *QueryService, notificationService *NotificationService) *ScheduleService {
+	return &ScheduleService{
+		db:                  db,
+		queryService:        queryService,
+		notificationService: notificationService,
+		maxAttachmentBytes:  defaultMaxAttachmentBytes,
+	}
+}
+
+// SetDeliveryOptions sets the base URL of result links and the largest CSV sent as a file
+func (s *ScheduleService) SetDeliveryOptions(appURL string, maxAttachmentBytes int64) {
+	s.appURL = strings.TrimRight(appURL, "/")
+	if maxAttachmentBytes > 0 {
+		s.maxAttachmentBytes = maxAttachmentBytes
+	}
+}
+
+// NextScheduleRun returns the first run of a standard 5-field cron expression after the given time.
+// The expression is evaluated in timezone, which defaults to UTC.
+func NextScheduleRun(expression, timezone string, after time.Time) (time.Time, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %v", expression, err)
+	}
+
+	next := schedule.Next(after.In(location))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never runs", expression)
+	}
+	return next.UTC(), nil
+}
+
+// CreateSchedule validates a new schedule for its owner and stores it with its first run time
+func (s *ScheduleService) CreateSchedule(ctx context.Context, schedule *models.QuerySchedule) error {
+	if schedule.ID == uuid.Nil {
+		schedule.ID = uuid.New()
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if schedule.Delivery == "" {
+		schedule.Delivery = models.ScheduleDeliveryAttachment
+	}
+	schedule.IsActive = true
+
+	if err := s.validateSchedule(ctx, schedule); err != nil {
+		return err
+	}
+
+	next, err := NextScheduleRun(schedule.CronExpression, schedule.Timezone, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	schedule.NextRunAt = &next
+
+	return s.db.Create(schedule).Error
+}
+
+// UpdateSchedule validates and stores changes to a schedule. Enabling a schedule clears the reason it
+// was disabled, and the next run is recalculated from now.
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, schedule *models.QuerySchedule) error {
+	updates := map[string]interface{}{
+		"name":                   schedule.Name,
+		"notification_config_id": schedule.NotificationConfigID,
+		"cron_expression":        schedule.CronExpression,
+		"timezone":               schedule.Timezone,
+		"parameter_values":       schedule.ParameterValues,
+		"delivery":               schedule.Delivery,
+		"is_active":              schedule.IsActive,
+	}
+
+	if schedule.IsActive {
+		if err := s.validateSchedule(ctx, schedule); err != nil {
+			return err
+		}
+		next, err := NextScheduleRun(schedule.CronExpression, schedule.Timezone, time.Now())
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		schedule.NextRunAt = &next
+		schedule.DisabledReason = ""
+		updates["next_run_at"] = next
+		updates["disabled_reason"] = ""
+	} else if _, err := NextScheduleRun(schedule.CronExpression, schedule.Timezone, time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	return s.db.Model(&models.QuerySchedule{}).Where("id = ?", schedule.ID).Updates(updates).Error
+}
+
+// GetSchedule retrieves a schedule by ID
+func (s *ScheduleService) GetSchedule(ctx context.Context, scheduleID string) (*models.QuerySchedule, error) {
+	var schedule models.QuerySchedule
+	if err := s.db.First(&schedule, "id = ?", scheduleID).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ListSchedules lists the schedules of a user, or all schedules when all is set
+func (s *ScheduleService) ListSchedules(ctx context.Context, userID uuid.UUID, all bool, limit, offset int) ([]models.QuerySchedule, int64, error) {
+	var schedules []models.QuerySchedule
+	var total int64
+
+	query := s.db.Model(&models.QuerySchedule{})
+	if !all {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&schedules).Error
+	return schedules, total, err
+}
+
+// DeleteSchedule deletes a schedule and its run history
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, scheduleID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", scheduleID).Delete(&models.QueryScheduleRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.QuerySchedule{}, "id = ?", scheduleID).Error
+	})
+}
+
+// ListScheduleRuns lists the runs of a schedule, newest first
+func (s *ScheduleService) ListScheduleRuns(ctx context.Context, scheduleID uuid.UUID, limit, offset int) ([]models.QueryScheduleRun, int64, error) {
+	var runs []models.QueryScheduleRun
+	var total int64
+
+	query := s.db.Model(&models.QueryScheduleRun{}).Where("schedule_id = ?", scheduleID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("started_at DESC").Limit(limit).Offset(offset).Find(&runs).Error
+	return runs, total, err
+}
+
+// validateSchedule checks the cron expression, the delivery and the saved query, and that the owner
+// may run the query and post to the notification channel
+func (s *ScheduleService) validateSchedule(ctx context.Context, schedule *models.QuerySchedule) error {
+	if _, err := NextScheduleRun(schedule.CronExpression, schedule.Timezone, time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if schedule.Delivery != models.ScheduleDeliveryAttachment && schedule.Delivery != models.ScheduleDeliveryLink {
+		return fmt.Errorf("%w: delivery must be %s or %s", ErrInvalidSchedule, models.ScheduleDeliveryAttachment, models.ScheduleDeliveryLink)
+	}
+
+	query, dataSource, err := s.loadScheduledQuery(schedule)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if query.OperationType != models.OperationSelect || DetectOperationType(query.QueryText) != models.OperationSelect {
+		return fmt.Errorf("%w: only SELECT queries can be scheduled", ErrInvalidSchedule)
+	}
+
+	if err := s.checkOwnerAccess(ctx, schedule, query, dataSource); err != nil {
+		return fmt.Errorf("permission denied: %v", err)
+	}
+
+	// The stored values must bind to the declared parameters of the saved query
+	definitions, err := DecodeQueryParameters(query)
+	if err != nil {
+		return err
+	}
+	values, err := DecodeParameterValues(&models.Query{ParameterValues: schedule.ParameterValues})
+	if err != nil {
+		return err
+	}
+	if _, _, err := BindQueryParameters(query.QueryText, definitions, values, dataSource.Type); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadScheduledQuery loads the saved query of a schedule and its data source
+func (s *ScheduleService) loadScheduledQuery(schedule *models.QuerySchedule) (*models.Query, *models.DataSource, error) {
+	var query models.Query
+	if err := s.db.First(&query, "id = ?", schedule.QueryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("saved query not found")
+		}
+		return nil, nil, fmt.Errorf("failed to load saved query: %w", err)
+	}
+
+	var dataSource models.DataSource
+	if err := s.db.First(&dataSource, "id = ?", query.DataSourceID).Error; err != nil {
+		return nil, nil, fmt.Errorf("data source not found: %w", err)
+	}
+	return &query, &dataSource, nil
+}
+
+// checkOwnerAccess checks that the owner of a schedule can still read the saved query, run SELECT on
+// its data source without approval and post to the notification channel. The error describes what access is missing.
+func (s *ScheduleService) checkOwnerAccess(ctx context.Context, schedule *models.QuerySchedule, query *models.Query, dataSource *models.DataSource) error {
+	var owner models.User
+	if err := s.db.First(&owner, "id = ?", schedule.UserID).Error; err != nil {
+		return errors.New("the owner no longer exists")
+	}
+	if !owner.IsActive {
+		return errors.New("the owner account is deactivated")
+	}
+
+	isAdmin := owner.Role == models.RoleAdmin
+	if !isAdmin && query.UserID != owner.ID {
+		return errors.New("the owner can't access the saved query")
+	}
+
+	perms, err := s.queryService.GetEffectivePermissions(ctx, owner.ID, dataSource.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if !perms.CanSelect {
+		return fmt.Errorf("the owner can no longer run SELECT on data source %s", dataSource.Name)
+	}
+	// Scheduled runs can't wait for approval
+	if s.queryService.ApprovalRequired(owner.ID, dataSource, models.OperationSelect) {
+		return fmt.Errorf("SELECTs of the owner on data source %s require approval", dataSource.Name)
+	}
+
+	var config models.NotificationConfig
+	if err := s.db.First(&config, "id = ?", schedule.NotificationConfigID).Error; err != nil {
+		return errors.New("notification channel not found")
+	}
+	if !isAdmin {
+		var memberships int64
+		s.db.Model(&models.UserGroup{}).Where("user_id = ? AND group_id = ?", owner.ID, config.GroupID).Count(&memberships)
+		if memberships == 0 {
+			return errors.New("the owner is not a member of the group of the notification channel")
+		}
+	}
+	return nil
+}
+
+// ClaimDueSchedules moves every active schedule due at now to its next run time and returns the
+// claimed schedules with NextRunAt set to the run they were claimed for. A schedule claimed by
+// another worker in the meantime is skipped, so each run is claimed once.
+func (s *ScheduleService) ClaimDueSchedules(ctx context.Context, now time.Time) ([]models.QuerySchedule, error) {
+	var due []models.QuerySchedule
+	if err := s.db.Where("is_active = ? AND next_run_at <= ?", true, now).Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to load due schedules: %w", err)
+	}
+
+	claimed := make([]models.QuerySchedule, 0, len(due))
+	for _, schedule := range due {
+		// Runs missed while no worker was polling collapse into this one
+		next, err := NextScheduleRun(schedule.CronExpression, schedule.Timezone, now)
+		if err != nil {
+			s.disableSchedule(&schedule, err.Error())
+			continue
+		}
+
+		claim := s.db.Model(&models.QuerySchedule{}).
+			Where("id = ? AND is_active = ? AND next_run_at = ?", schedule.ID, true, schedule.NextRunAt).
+			Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now})
+		if claim.Error != nil {
+			log.Printf("[Schedules] Failed to claim schedule %s: %v", schedule.ID, claim.Error)
+			continue
+		}
+		if claim.RowsAffected == 1 {
+			claimed = append(claimed, schedule)
+		}
+	}
+	return claimed, nil
+}
+
+// RunSchedule runs the saved query of a schedule as its owner and delivers the result.
+// A schedule whose owner lost access is disabled and the run is recorded as skipped.
+func (s *ScheduleService) RunSchedule(ctx context.Context, scheduleID uuid.UUID, scheduledFor time.Time) (*models.QueryScheduleRun, error) {
+	schedule, err := s.GetSchedule(ctx, scheduleID.String())
+	if err != nil {
+		return nil, fmt.Errorf("schedule not found: %w", err)
+	}
+	if !schedule.IsActive {
+		return nil, ErrScheduleInactive
+	}
+
+	run := &models.QueryScheduleRun{
+		ID:           uuid.New(),
+		ScheduleID:   schedule.ID,
+		Status:       models.ScheduleRunRunning,
+		ScheduledFor: scheduledFor,
+		StartedAt:    time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to record run: %w", err)
+	}
+
+	saved, dataSource, err := s.loadScheduledQuery(schedule)
+	if err != nil {
+		return s.skipRun(schedule, run, err.Error()), nil
+	}
+	if err := s.checkOwnerAccess(ctx, schedule, saved, dataSource); err != nil {
+		return s.skipRun(schedule, run, err.Error()), nil
+	}
+
+	// The run is a queued query of the owner, so it shows up in their history with its result
+	query := &models.Query{
+		ID:              uuid.New(),
+		DataSourceID:    saved.DataSourceID,
+		UserID:          schedule.UserID,
+		QueryText:       saved.QueryText,
+		OperationType:   models.OperationSelect,
+		Name:            saved.Name,
+		Description:     fmt.Sprintf("Scheduled run of %q", schedule.Name),
+		Status:          models.StatusPending,
+		IsAsync:         true,
+		Parameters:      saved.Parameters,
+		ParameterValues: schedule.ParameterValues,
+	}
+	if err := s.db.Create(query).Error; err != nil {
+		return s.finishRun(run, map[string]interface{}{
+			"status":        models.ScheduleRunFailed,
+			"error_message": fmt.Sprintf("failed to create query: %v", err),
+		}), nil
+	}
+	run.QueryID = &query.ID
+	s.db.Model(run).Update("query_id", query.ID)
+
+	// Scheduled reports are delivered as of their run time, never from the result cache
+	executed, execErr := s.queryService.RunQueuedQueryWithOptions(ctx, query.ID, ExecuteOptions{Refresh: true})
+	if execErr != nil && strings.Contains(execErr.Error(), "permission denied") {
+		// Permissions changed between the check and the execution
+		return s.skipRun(schedule, run, execErr.Error()), nil
+	}
+
+	result := &ScheduledResult{
+		ScheduleName:   schedule.Name,
+		QueryName:      saved.Name,
+		DataSourceName: dataSource.Name,
+		Status:         models.ScheduleRunSucceeded,
+		ResultURL:      s.resultURL(query.ID),
+	}
+	updates := map[string]interface{}{"status": models.ScheduleRunSucceeded}
+
+	if execErr != nil {
+		result.Status = models.ScheduleRunFailed
+		result.ErrorMessage = execErr.Error()
+		updates["status"] = models.ScheduleRunFailed
+		updates["error_message"] = execErr.Error()
+	} else if executed != nil && executed.RowCount != nil {
+		result.RowCount = *executed.RowCount
+		updates["row_count"] = *executed.RowCount
+	}
+
+	delivery, deliveryErr := s.deliver(ctx, schedule, query.ID, result)
+	updates["delivery"] = delivery
+	if deliveryErr != nil {
+		log.Printf("[Schedules] Failed to deliver run %s of schedule %s: %v", run.ID, schedule.ID, deliveryErr)
+		updates["delivery_error"] = deliveryErr.Error()
+	}
+
+	return s.finishRun(run, updates), nil
+}
+
+// deliver sends the result of a run to the notification channel of the schedule and records the
+// notification. CSV files are attached only for webhook channels and within the size limit.
+func (s *ScheduleService) deliver(ctx context.Context, schedule *models.QuerySchedule, queryID uuid.UUID, result *ScheduledResult) (models.ScheduleDelivery, error) {
+	var config models.NotificationConfig
+	if err := s.db.First(&config, "id = ?", schedule.NotificationConfigID).Error; err != nil {
+		return "", fmt.Errorf("notification channel not found: %w", err)
+	}
+	if !config.IsActive {
+		return "", errors.New("notification channel is inactive")
+	}
+
+	if result.Status == models.ScheduleRunSucceeded {
+		var stored models.QueryResult
+		if err := s.db.Select("truncated").Where("query_id = ?", queryID).First(&stored).Error; err == nil {
+			result.Truncated = stored.Truncated
+		}
+
+		if schedule.Delivery == models.ScheduleDeliveryAttachment && config.Channel == models.NotificationChannelWebhook {
+			data, _, err := s.queryService.ExportQuery(ctx, queryID, "csv")
+			switch {
+			case err != nil:
+				log.Printf("[Schedules] Failed to export result of query %s, sending a link: %v", queryID, err)
+			case int64(len(data)) > s.maxAttachmentBytes:
+				log.Printf("[Schedules] CSV of query %s is %d bytes, sending a link", queryID, len(data))
+			default:
+				result.Attachment = data
+				result.FileName = scheduleFileName(schedule, time.Now())
+			}
+		}
+	}
+
+	delivery, sendErr := s.notificationService.SendScheduledResult(ctx, &config, result)
+	s.recordNotification(&config, queryID, result, sendErr)
+	return delivery, sendErr
+}
+
+// recordNotification stores a sent or failed delivery in the notification log
+func (s *ScheduleService) recordNotification(config *models.NotificationConfig, queryID uuid.UUID, result *ScheduledResult, sendErr error) {
+	payload := fmt.Sprintf(`{"schedule":%q,"status":%q,"row_count":%d,"result_url":%q,"attachment":%t}`,
+		result.ScheduleName, result.Status, result.RowCount, result.ResultURL, result.Attachment != nil)
+
+	notification := &models.Notification{
+		ID:                   uuid.New(),
+		NotificationConfigID: &config.ID,
+		QueryID:              &queryID,
+		Type:                 models.NotificationQueryResult,
+		Status:               models.NotificationStatusSent,
+		Payload:              payload,
+	}
+	if sendErr != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.LastError = sendErr.Error()
+	} else {
+		now := time.Now()
+		notification.SentAt = &now
+	}
+
+	if err := s.db.Create(notification).Error; err != nil {
+		log.Printf("[Schedules] Failed to record notification: %v", err)
+	}
+}
+
+// skipRun disables a schedule whose owner lost access and records why the run did not happen
+func (s *ScheduleService) skipRun(schedule *models.QuerySchedule, run *models.QueryScheduleRun, reason string) *models.QueryScheduleRun {
+	log.Printf("[Schedules] Disabling schedule %s: %s", schedule.ID, reason)
+	s.disableSchedule(schedule, reason)
+	return s.finishRun(run, map[string]interface{}{
+		"status":        models.ScheduleRunSkipped,
+		"error_message": "schedule disabled: " + reason,
+	})
+}
+
+// disableSchedule deactivates a schedule and stores the reason
+func (s *ScheduleService) disableSchedule(schedule *models.QuerySchedule, reason string) {
+	schedule.IsActive = false
+	schedule.DisabledReason = reason
+	s.db.Model(&models.QuerySchedule{}).Where("id = ?", schedule.ID).Updates(map[string]interface{}{
+		"is_active":       false,
+		"disabled_reason": reason,
+	})
+}
+
+// finishRun stores the outcome of a run and returns its final state
+func (s *ScheduleService) finishRun(run *models.QueryScheduleRun, updates map[string]interface{}) *models.QueryScheduleRun {
+	updates["finished_at"] = time.Now()
+	if err := s.db.Model(run).Updates(updates).Error; err != nil {
+		log.Printf("[Schedules] Failed to record outcome of run %s: %v", run.ID, err)
+	}
+
+	var current models.QueryScheduleRun
+	if err := s.db.First(&current, "id = ?", run.ID).Error; err != nil {
+		return run
+	}
+	return &current
+}
+
+// resultURL links to a query in the history page of the web app
+func (s *ScheduleService) resultURL(queryID uuid.UUID) string {
+	return fmt.Sprintf("%s/dashboard/history?query_id=%s", s.appURL, queryID)
+}
+
+// scheduleFileName names the CSV of a run after the schedule and the run date
+func scheduleFileName(schedule *models.QuerySchedule, at time.Time) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, schedule.Name)
+	return fmt.Sprintf("%s_%s.csv", name, at.UTC().Format("20060102_1504"))
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestNextScheduleRun(t *testing.T) {
+	after := time.Date(2024, 3, 10, 8, 30, 0, 0, time.UTC)
+
+	next, err := NextScheduleRun("0 9 * * *", "", after)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC), next)
+
+	// 09:00 in Jakarta (UTC+7) has already passed at 08:30 UTC
+	next, err = NextScheduleRun("0 9 * * *", "Asia/Jakarta", after)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC), next)
+
+	next, err = NextScheduleRun("@hourly", "UTC", after)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC), next)
+
+	_, err = NextScheduleRun("every day", "UTC", after)
+	assert.ErrorContains(t, err, "invalid cron expression")
+	_, err = NextScheduleRun("0 9 * * *", "Mars/Olympus", after)
+	assert.ErrorContains(t, err, "unknown timezone")
+}
+
+// createTestSchedule stores an active schedule for the saved query, due at nextRun
+func createTestSchedule(query *models.Query, nextRun time.Time) *models.QuerySchedule {
+	return &models.QuerySchedule{
+		ID:                   uuid.New(),
+		QueryID:              query.ID,
+		UserID:               query.UserID,
+		NotificationConfigID: uuid.New(),
+		Name:                 "Daily orders",
+		CronExpression:       "0 9 * * *",
+		Timezone:             "UTC",
+		Delivery:             models.ScheduleDeliveryAttachment,
+		IsActive:             true,
+		NextRunAt:            &nextRun,
+	}
+}
+
+func TestCreateSchedule_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	scheduleService := NewScheduleService(db, NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil), nil)
+
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+
+	schedule := createTestSchedule(query, time.Now())
+	schedule.CronExpression = "61 * * * *"
+	assert.ErrorIs(t, scheduleService.CreateSchedule(context.Background(), schedule), ErrInvalidSchedule)
+
+	schedule = createTestSchedule(query, time.Now())
+	schedule.QueryID = uuid.New()
+	err := scheduleService.CreateSchedule(context.Background(), schedule)
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+	assert.ErrorContains(t, err, "saved query not found")
+
+	require.NoError(t, db.Model(query).Updates(map[string]interface{}{
+		"query_text":     "DELETE FROM users",
+		"operation_type": models.OperationDelete,
+	}).Error)
+	schedule = createTestSchedule(query, time.Now())
+	assert.ErrorContains(t, scheduleService.CreateSchedule(context.Background(), schedule), "only SELECT queries")
+
+	// The owner belongs to no group, so it can't run SELECT on the data source
+	require.NoError(t, db.Model(query).Updates(map[string]interface{}{
+		"query_text":     "SELECT * FROM users",
+		"operation_type": models.OperationSelect,
+	}).Error)
+	schedule = createTestSchedule(query, time.Now())
+	assert.ErrorContains(t, scheduleService.CreateSchedule(context.Background(), schedule), "permission denied")
+}
+
+func TestClaimDueSchedules_ClaimsEachRunOnce(t *testing.T) {
+	db := setupTestDB(t)
+	scheduleService := NewScheduleService(db, NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil), nil)
+
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	now := time.Date(2024, 3, 10, 9, 0, 30, 0, time.UTC)
+
+	due := createTestSchedule(query, time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC))
+	require.NoError(t, db.Create(due).Error)
+	later := createTestSchedule(query, time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC))
+	require.NoError(t, db.Create(later).Error)
+
+	claimed, err := scheduleService.ClaimDueSchedules(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, due.ID, claimed[0].ID)
+	assert.True(t, claimed[0].NextRunAt.Equal(*due.NextRunAt))
+
+	var stored models.QuerySchedule
+	require.NoError(t, db.First(&stored, "id = ?", due.ID).Error)
+	assert.True(t, stored.NextRunAt.Equal(time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)))
+
+	claimed, err = scheduleService.ClaimDueSchedules(context.Background(), now)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func TestRunSchedule_DisablesWhenOwnerLosesAccess(t *testing.T) {
+	db := setupTestDB(t)
+	scheduleService := NewScheduleService(db, NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil), nil)
+
+	// The owner belongs to no group, as if it had been removed from the group granting access
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	schedule := createTestSchedule(query, time.Now())
+	require.NoError(t, db.Create(schedule).Error)
+
+	run, err := scheduleService.RunSchedule(context.Background(), schedule.ID, *schedule.NextRunAt)
+	require.NoError(t, err)
+	assert.Equal(t, models.ScheduleRunSkipped, run.Status)
+	assert.Contains(t, run.ErrorMessage, "can no longer run SELECT")
+	assert.Nil(t, run.QueryID)
+	assert.NotNil(t, run.FinishedAt)
+
+	var stored models.QuerySchedule
+	require.NoError(t, db.First(&stored, "id = ?", schedule.ID).Error)
+	assert.False(t, stored.IsActive)
+	assert.Contains(t, stored.DisabledReason, "can no longer run SELECT")
+
+	_, err = scheduleService.RunSchedule(context.Background(), schedule.ID, *schedule.NextRunAt)
+	assert.ErrorIs(t, err, ErrScheduleInactive)
+
+	runs, total, err := scheduleService.ListScheduleRuns(context.Background(), schedule.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, run.ID, runs[0].ID)
+}
+
+func TestRunSchedule_DisablesWhenSavedQueryIsDeleted(t *testing.T) {
+	db := setupTestDB(t)
+	scheduleService := NewScheduleService(db, NewQueryService(db, NewLegacyKeyring("test-encryption-key-32-chars-long!"), nil, nil), nil)
+
+	query := createAsyncTestQuery(t, db, models.StatusCompleted, false)
+	schedule := createTestSchedule(query, time.Now())
+	require.NoError(t, db.Create(schedule).Error)
+	require.NoError(t, db.Delete(query).Error)
+
+	run, err := scheduleService.RunSchedule(context.Background(), schedule.ID, *schedule.NextRunAt)
+	require.NoError(t, err)
+	assert.Equal(t, models.ScheduleRunSkipped, run.Status)
+	assert.Contains(t, run.ErrorMessage, "saved query not found")
+}
+
+func TestSendScheduledResult_WebhookAttachment(t *testing.T) {
+	var (
+		payload  string
+		fileName string
+		file     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		payload = r.FormValue("payload")
+		f, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		fileName, file = header.Filename, string(data)
+	}))
+	defer server.Close()
+
+	notificationService := NewNotificationService(nil)
+	delivery, err := notificationService.SendScheduledResult(context.Background(), &models.NotificationConfig{
+		WebhookURL: server.URL,
+		Channel:    models.NotificationChannelWebhook,
+	}, &ScheduledResult{
+		ScheduleName: "Daily orders",
+		Status:       models.ScheduleRunSucceeded,
+		RowCount:     1,
+		ResultURL:    "http://app/dashboard/history?query_id=1",
+		FileName:     "Daily_orders.csv",
+		Attachment:   []byte("id\n1\n"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ScheduleDeliveryAttachment, delivery)
+	assert.Equal(t, "Daily_orders.csv", fileName)
+	assert.Equal(t, "id\n1\n", file)
+	assert.Contains(t, payload, `"row_count":1`)
+	assert.Contains(t, payload, `"file_name":"Daily_orders.csv"`)
+}
+
+func TestSendScheduledResult_GoogleChatSendsLink(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	notificationService := NewNotificationService(nil)
+	delivery, err := notificationService.SendScheduledResult(context.Background(), &models.NotificationConfig{
+		WebhookURL: server.URL,
+		Channel:    models.NotificationChannelGoogleChat,
+	}, &ScheduledResult{
+		ScheduleName: "Daily orders",
+		Status:       models.ScheduleRunSucceeded,
+		ResultURL:    "http://app/dashboard/history?query_id=1",
+		Attachment:   []byte("id\n1\n"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ScheduleDeliveryLink, delivery)
+	assert.Contains(t, body, "http://app/dashboard/history?query_id=1")
+	assert.NotContains(t, body, "id\\n1")
+}
@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+var (
+	// ErrInvalidCredentialSource is returned for a credential source or reference that can't be used
+	ErrInvalidCredentialSource = errors.New("invalid credential source")
+
+	// ErrSecretUnavailable is returned when an external secret can't be read
+	ErrSecretUnavailable = errors.New("secret unavailable")
+)
+
+// Defaults of the secret providers, also used when a setting is left empty
+const (
+	defaultSecretCacheTTL      = time.Minute
+	defaultSecretEnvPrefix     = "QUERYBASE_SECRET_"
+	defaultSecretFileDir       = "/run/secrets"
+	defaultSecretHTTPField     = "value"
+	defaultSecretHTTPTimeout   = 5 * time.Second
+	maxSecretHTTPResponseBytes = 1 << 20
+)
+
+// envVarName matches the names of environment variables
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ConnectionCredentials are the decrypted secrets used to connect to a data source
+type ConnectionCredentials struct {
+	Password string
+	// PEM-encoded TLS material; empty when not configured
+	TLSCACert     string
+	TLSClientCert string
+	TLSClientKey  string
+	// Credentials of the SSH bastion; empty when not configured
+	SSHPrivateKey string
+	SSHPassword   string
+}
+
+// resolveCredentials returns everything needed to connect to a data source: the password, read from
+// its credential source, and the decrypted TLS material and SSH credentials
+func resolveCredentials(ctx context.Context, decrypt func(string) (string, error), secrets *SecretResolver, dataSource *models.DataSource) (*ConnectionCredentials, error) {
+	credentials, err := decryptCredentials(decrypt, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dataSource.CredentialSource {
+	case "", models.CredentialSourceEncrypted:
+		if credentials.Password, err = decrypt(dataSource.GetPassword()); err != nil {
+			return nil, fmt.Errorf("failed to decrypt password: %w", err)
+		}
+	default:
+		if credentials.Password, err = secrets.Resolve(ctx, dataSource.CredentialSource, dataSource.CredentialRef); err != nil {
+			return nil, err
+		}
+	}
+	return credentials, nil
+}
+
+// decryptCredentials decrypts the stored TLS material and SSH credentials of a data source with a
+// service's decrypt function. The password is left empty.
+func decryptCredentials(decrypt func(string) (string, error), dataSource *models.DataSource) (*ConnectionCredentials, error) {
+	credentials := &ConnectionCredentials{}
+
+	// Unset TLS material and SSH credentials are stored as an empty string, not as a ciphertext
+	for _, field := range []struct {
+		encrypted string
+		plain     *string
+	}{
+		{dataSource.EncryptedTLSCACert, &credentials.TLSCACert},
+		{dataSource.EncryptedTLSClientCert, &credentials.TLSClientCert},
+		{dataSource.EncryptedTLSClientKey, &credentials.TLSClientKey},
+		{dataSource.EncryptedSSHPrivateKey, &credentials.SSHPrivateKey},
+		{dataSource.EncryptedSSHPassword, &credentials.SSHPassword},
+	} {
+		if field.encrypted == "" {
+			continue
+		}
+		var err error
+		if *field.plain, err = decrypt(field.encrypted); err != nil {
+			return nil, fmt.Errorf("failed to decrypt TLS and SSH settings: %w", err)
+		}
+	}
+	return credentials, nil
+}
+
+// credentialSource checks the credential source and reference of a data source. The reference is
+// only kept for external sources.
+func (s *DataSourceService) credentialSource(dsType models.DataSourceType, source, ref string) (models.CredentialSource, string, error) {
+	credentialSource, err := NormalizeCredentialSource(source)
+	if err != nil {
+		return "", "", err
+	}
+	if credentialSource == models.CredentialSourceEncrypted {
+		return credentialSource, "", nil
+	}
+	if dsType == models.DataSourceTypeSQLite {
+		return "", "", fmt.Errorf("%w: SQLite data sources have no password", ErrInvalidCredentialSource)
+	}
+	ref = strings.TrimSpace(ref)
+	if err := s.connections.secrets.Validate(credentialSource, ref); err != nil {
+		return "", "", err
+	}
+	return credentialSource, ref, nil
+}
+
+// setCredentialSource validates where the password of a new data source is read from and sets it
+func (s *DataSourceService) setCredentialSource(dataSource *models.DataSource, req *CreateDataSourceInput) error {
+	source, ref, err := s.credentialSource(dataSource.Type, req.CredentialSource, req.CredentialRef)
+	if err != nil {
+		return err
+	}
+	switch {
+	case source != models.CredentialSourceEncrypted && req.Password != "":
+		return fmt.Errorf("%w: a password can't be stored when it is read from %s", ErrInvalidCredentialSource, source)
+	case source == models.CredentialSourceEncrypted && req.Password == "" && dataSource.Type != models.DataSourceTypeSQLite:
+		return fmt.Errorf("%w: a password is required unless it is read from a secret provider", ErrInvalidCredentialSource)
+	}
+	dataSource.CredentialSource = source
+	dataSource.CredentialRef = ref
+	return nil
+}
+
+// credentialSourceUpdates validates where the password of a data source is read from after an update
+// and returns the columns to change
+func (s *DataSourceService) credentialSourceUpdates(dataSource *models.DataSource, req *UpdateDataSourceInput) (map[string]interface{}, error) {
+	dsType := dataSource.Type
+	if req.Type != "" {
+		dsType = models.DataSourceType(req.Type)
+	}
+	source := string(dataSource.CredentialSource)
+	if req.CredentialSource != "" {
+		source = req.CredentialSource
+	}
+	ref := dataSource.CredentialRef
+	if req.CredentialRef != nil {
+		ref = *req.CredentialRef
+	}
+
+	credentialSource, ref, err := s.credentialSource(dsType, source, ref)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"credential_source": credentialSource,
+		"credential_ref":    ref,
+	}
+
+	switch {
+	case credentialSource != models.CredentialSourceEncrypted && req.Password != "":
+		return nil, fmt.Errorf("%w: a password can't be stored when it is read from %s", ErrInvalidCredentialSource, credentialSource)
+	case credentialSource != models.CredentialSourceEncrypted && !dataSource.UsesExternalCredentials():
+		// The stored password is no longer used, so it is not kept
+		encryptedPassword, err := s.encryptPassword("")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt password: %w", err)
+		}
+		updates["encrypted_password"] = encryptedPassword
+	case credentialSource == models.CredentialSourceEncrypted && dataSource.UsesExternalCredentials() &&
+		req.Password == "" && dsType != models.DataSourceTypeSQLite:
+		return nil, fmt.Errorf("%w: a password is required to store it again", ErrInvalidCredentialSource)
+	}
+	return updates, nil
+}
+
+// SecretProvider reads secrets from an external store
+type SecretProvider interface {
+	// Validate checks a reference without reading the secret
+	Validate(ref string) error
+
+	// Resolve reads the secret a reference names
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolver reads data source passwords from their external credential sources. Resolved
+// secrets are cached for a short TTL, so rotated secrets are picked up without reading the store
+// on every connection.
+type SecretResolver struct {
+	providers map[models.CredentialSource]SecretProvider
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+// cachedSecret is a resolved secret and when it has to be read again
+type cachedSecret struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewSecretResolver creates a resolver with the environment, file and, when configured, HTTP providers
+func NewSecretResolver(secretsConfig config.SecretsConfig) *SecretResolver {
+	ttl := secretsConfig.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultSecretCacheTTL
+	}
+	envPrefix := secretsConfig.EnvPrefix
+	if envPrefix == "" {
+		envPrefix = defaultSecretEnvPrefix
+	}
+	fileDir := secretsConfig.FileDir
+	if fileDir == "" {
+		fileDir = defaultSecretFileDir
+	}
+
+	resolver := &SecretResolver{
+		providers: map[models.CredentialSource]SecretProvider{
+			models.CredentialSourceEnv:  &envSecretProvider{prefix: envPrefix},
+			models.CredentialSourceFile: &fileSecretProvider{dir: fileDir},
+		},
+		ttl:   ttl,
+		cache: make(map[string]cachedSecret),
+	}
+	if secretsConfig.HTTP.URL != "" {
+		resolver.providers[models.CredentialSourceHTTP] = newHTTPSecretProvider(secretsConfig.HTTP)
+	}
+	return resolver
+}
+
+// NormalizeCredentialSource checks a credential source; an empty source stores the password encrypted
+func NormalizeCredentialSource(source string) (models.CredentialSource, error) {
+	switch credentialSource := models.CredentialSource(strings.ToLower(strings.TrimSpace(source))); credentialSource {
+	case "":
+		return models.CredentialSourceEncrypted, nil
+	case models.CredentialSourceEncrypted, models.CredentialSourceEnv, models.CredentialSourceFile, models.CredentialSourceHTTP:
+		return credentialSource, nil
+	default:
+		return "", fmt.Errorf("%w: unknown source %q", ErrInvalidCredentialSource, source)
+	}
+}
+
+// Validate checks that a reference can be resolved by its source, without reading the secret
+func (r *SecretResolver) Validate(source models.CredentialSource, ref string) error {
+	if source == models.CredentialSourceEncrypted {
+		return nil
+	}
+	provider, ok := r.providers[source]
+	if !ok {
+		return fmt.Errorf("%w: the %s provider is not configured", ErrInvalidCredentialSource, source)
+	}
+	if ref == "" {
+		return fmt.Errorf("%w: a reference is required", ErrInvalidCredentialSource)
+	}
+	return provider.Validate(ref)
+}
+
+// Resolve returns the secret a reference names, from the cache while it is fresh
+func (r *SecretResolver) Resolve(ctx context.Context, source models.CredentialSource, ref string) (string, error) {
+	if err := r.Validate(source, ref); err != nil {
+		return "", err
+	}
+
+	key := string(source) + "\x00" + ref
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	value, err := r.providers[source].Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s secret %q: %v", ErrSecretUnavailable, source, ref, err)
+	}
+
+	r.mu.Lock()
+	r.cache[key] = cachedSecret{value: value, expiresAt: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return value, nil
+}
+
+// envSecretProvider reads secrets from environment variables with a prefix
+type envSecretProvider struct {
+	prefix string
+}
+
+// Validate checks that the reference is a variable name with the prefix
+func (p *envSecretProvider) Validate(ref string) error {
+	if !envVarName.MatchString(ref) {
+		return fmt.Errorf("%w: %q is not an environment variable name", ErrInvalidCredentialSource, ref)
+	}
+	if !strings.HasPrefix(ref, p.prefix) {
+		return fmt.Errorf("%w: environment variables must start with %s", ErrInvalidCredentialSource, p.prefix)
+	}
+	return nil
+}
+
+// Resolve reads the variable
+func (p *envSecretProvider) Resolve(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", errors.New("the environment variable is not set")
+	}
+	return value, nil
+}
+
+// fileSecretProvider reads secrets from files in a directory, like Docker and Kubernetes secrets
+type fileSecretProvider struct {
+	dir string
+}
+
+// path returns the file a reference names, which must be inside the directory
+func (p *fileSecretProvider) path(ref string) (string, error) {
+	if filepath.IsAbs(ref) {
+		return "", fmt.Errorf("%w: file references are relative to %s", ErrInvalidCredentialSource, p.dir)
+	}
+	path := filepath.Join(p.dir, ref)
+	if rel, err := filepath.Rel(p.dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q is outside %s", ErrInvalidCredentialSource, ref, p.dir)
+	}
+	return path, nil
+}
+
+// Validate checks that the reference stays inside the directory
+func (p *fileSecretProvider) Validate(ref string) error {
+	_, err := p.path(ref)
+	return err
+}
+
+// Resolve reads the file. A trailing newline, which editors and shells tend to add, is not part of the secret.
+func (p *fileSecretProvider) Resolve(_ context.Context, ref string) (string, error) {
+	path, err := p.path(ref)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// httpSecretProvider reads secrets from an HTTP secrets manager
+type httpSecretProvider struct {
+	baseURL    string
+	token      string
+	valueField string
+	client     *http.Client
+}
+
+// newHTTPSecretProvider creates the provider of an HTTP secrets manager
+func newHTTPSecretProvider(httpConfig config.SecretsHTTPConfig) *httpSecretProvider {
+	valueField := httpConfig.ValueField
+	if valueField == "" {
+		valueField = defaultSecretHTTPField
+	}
+	timeout := httpConfig.Timeout
+	if timeout <= 0 {
+		timeout = defaultSecretHTTPTimeout
+	}
+	return &httpSecretProvider{
+		baseURL:    strings.TrimRight(httpConfig.URL, "/"),
+		token:      httpConfig.Token,
+		valueField: valueField,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Validate checks that the reference is a path of non-empty segments
+func (p *httpSecretProvider) Validate(ref string) error {
+	for _, segment := range strings.Split(ref, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: invalid secret name %q", ErrInvalidCredentialSource, ref)
+		}
+	}
+	return nil
+}
+
+// Resolve fetches the secret with GET {baseURL}/{ref}
+func (p *httpSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/"+strings.Join(segments, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secrets manager responded %s", resp.Status)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSecretHTTPResponseBytes)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	value, ok := body[p.valueField].(string)
+	if !ok {
+		return "", fmt.Errorf("secrets manager response has no %q string", p.valueField)
+	}
+	return value, nil
+}
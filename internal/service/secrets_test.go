@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/config"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestSecretResolver_EnvAndFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "warehouse"), []byte("from-file\n"), 0o600))
+	t.Setenv("QUERYBASE_SECRET_WAREHOUSE", "from-env")
+	t.Setenv("DATABASE_PASSWORD", "not-for-data-sources")
+
+	resolver := NewSecretResolver(config.SecretsConfig{FileDir: dir})
+	ctx := context.Background()
+
+	value, err := resolver.Resolve(ctx, models.CredentialSourceEnv, "QUERYBASE_SECRET_WAREHOUSE")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", value)
+
+	// The trailing newline of the file is not part of the secret
+	value, err = resolver.Resolve(ctx, models.CredentialSourceFile, "warehouse")
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", value)
+
+	// Only variables with the prefix and files inside the directory can be read
+	_, err = resolver.Resolve(ctx, models.CredentialSourceEnv, "DATABASE_PASSWORD")
+	assert.ErrorIs(t, err, ErrInvalidCredentialSource)
+	for _, ref := range []string{"../warehouse", "/etc/passwd", "nested/../../warehouse"} {
+		assert.ErrorIs(t, resolver.Validate(models.CredentialSourceFile, ref), ErrInvalidCredentialSource, ref)
+	}
+
+	_, err = resolver.Resolve(ctx, models.CredentialSourceEnv, "QUERYBASE_SECRET_MISSING")
+	assert.ErrorIs(t, err, ErrSecretUnavailable)
+
+	// The HTTP provider is only available once it is configured
+	assert.ErrorIs(t, resolver.Validate(models.CredentialSourceHTTP, "warehouse"), ErrInvalidCredentialSource)
+}
+
+func TestSecretResolver_HTTPAndCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secrets/prod/warehouse" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"password": "from-http"})
+	}))
+	defer server.Close()
+
+	resolver := NewSecretResolver(config.SecretsConfig{
+		CacheTTL: 50 * time.Millisecond,
+		HTTP:     config.SecretsHTTPConfig{URL: server.URL + "/v1/secrets/", Token: "vault-token", ValueField: "password"},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		value, err := resolver.Resolve(ctx, models.CredentialSourceHTTP, "prod/warehouse")
+		require.NoError(t, err)
+		assert.Equal(t, "from-http", value)
+	}
+	assert.EqualValues(t, 1, requests.Load(), "the secret is cached")
+
+	// A rotated secret is read again once the cache expires
+	time.Sleep(60 * time.Millisecond)
+	_, err := resolver.Resolve(ctx, models.CredentialSourceHTTP, "prod/warehouse")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, requests.Load())
+
+	_, err = resolver.Resolve(ctx, models.CredentialSourceHTTP, "prod/missing")
+	assert.ErrorIs(t, err, ErrSecretUnavailable)
+	assert.ErrorIs(t, resolver.Validate(models.CredentialSourceHTTP, "prod/../admin"), ErrInvalidCredentialSource)
+}
+
+func TestDataSourceService_CredentialSource(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey))
+	t.Setenv("QUERYBASE_SECRET_WAREHOUSE", "from-env")
+	ctx := context.Background()
+
+	input := func() *CreateDataSourceInput {
+		return &CreateDataSourceInput{
+			Name: "warehouse", Type: string(models.DataSourceTypePostgreSQL), Host: "db.internal", Port: 5432,
+			DatabaseName: "dw", Username: "querybase",
+			CredentialSource: "env", CredentialRef: "QUERYBASE_SECRET_WAREHOUSE",
+		}
+	}
+
+	// A password read from a secret provider is never stored
+	withPassword := input()
+	withPassword.Password = "secret"
+	_, err := service.CreateDataSource(ctx, withPassword)
+	assert.ErrorIs(t, err, ErrInvalidCredentialSource)
+
+	withoutPassword := input()
+	withoutPassword.CredentialSource = ""
+	_, err = service.CreateDataSource(ctx, withoutPassword)
+	assert.ErrorIs(t, err, ErrInvalidCredentialSource)
+
+	dataSource, err := service.CreateDataSource(ctx, input())
+	require.NoError(t, err)
+	assert.Equal(t, models.CredentialSourceEnv, dataSource.CredentialSource)
+
+	credentials, err := resolveCredentials(ctx, service.decryptPassword, service.connections.secrets, dataSource)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", credentials.Password)
+
+	// Switching back to a stored password needs the password
+	_, err = service.UpdateDataSource(ctx, dataSource.ID.String(), &UpdateDataSourceInput{CredentialSource: "encrypted"})
+	assert.ErrorIs(t, err, ErrInvalidCredentialSource)
+
+	updated, err := service.UpdateDataSource(ctx, dataSource.ID.String(), &UpdateDataSourceInput{CredentialSource: "encrypted", Password: "rotated"})
+	require.NoError(t, err)
+	assert.Equal(t, models.CredentialSourceEncrypted, updated.CredentialSource)
+	assert.Empty(t, updated.CredentialRef)
+	credentials, err = resolveCredentials(ctx, service.decryptPassword, service.connections.secrets, updated)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", credentials.Password)
+
+	// Moving to a secret provider drops the stored password
+	ref := "QUERYBASE_SECRET_WAREHOUSE"
+	updated, err = service.UpdateDataSource(ctx, dataSource.ID.String(), &UpdateDataSourceInput{CredentialSource: "env", CredentialRef: &ref})
+	require.NoError(t, err)
+	password, err := service.decryptPassword(updated.EncryptedPassword)
+	require.NoError(t, err)
+	assert.Empty(t, password)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidSessionInit is returned when a session init statement is not a single SET statement
+	ErrInvalidSessionInit = errors.New("invalid session init statement")
+
+	// ErrReadOnlyViolation is returned when a read query tried to write inside its read-only transaction
+	ErrReadOnlyViolation = errors.New("query tried to write in a read-only transaction")
+)
+
+// sessionInitStatement matches the statements allowed to initialize a session, e.g.
+// "SET search_path TO analytics", "SET lock_timeout = '5s'" or "SET time_zone = '+00:00'"
+var sessionInitStatement = regexp.MustCompile(`(?is)^SET\s+\S.*$`)
+
+// NormalizeSessionInitStatements trims the statements and checks that each is a single SET statement.
+// Session init runs on every connection, so anything else is rejected.
+func NormalizeSessionInitStatements(statements []string) ([]string, error) {
+	normalized := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+		if !sessionInitStatement.MatchString(statement) {
+			return nil, fmt.Errorf("%w: %q must be a SET statement", ErrInvalidSessionInit, statement)
+		}
+		if strings.Contains(statement, ";") {
+			return nil, fmt.Errorf("%w: %q must be a single statement", ErrInvalidSessionInit, statement)
+		}
+		normalized = append(normalized, statement)
+	}
+	return normalized, nil
+}
+
+// EncodeSessionInitStatements serializes the session init statements of a data source; none store NULL
+func EncodeSessionInitStatements(statements []string) (*string, error) {
+	if len(statements) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(statements)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize session init statements: %w", err)
+	}
+	s := string(encoded)
+	return &s, nil
+}
+
+// DecodeSessionInitStatements reads the stored session init statements of a data source
+func DecodeSessionInitStatements(dataSource *models.DataSource) ([]string, error) {
+	if dataSource.SessionInitStatements == nil || *dataSource.SessionInitStatements == "" {
+		return nil, nil
+	}
+	var statements []string
+	if err := json.Unmarshal([]byte(*dataSource.SessionInitStatements), &statements); err != nil {
+		return nil, fmt.Errorf("failed to parse session init statements: %w", err)
+	}
+	return statements, nil
+}
+
+// sessionInitConnector opens driver connections and runs the session init statements on each,
+// so pooled connections are initialized no matter which code path uses them
+type sessionInitConnector struct {
+	driver.Connector
+	statements []string
+}
+
+// Connect opens a connection and initializes its session
+func (c *sessionInitConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range c.statements {
+		if err := execDriverStatement(ctx, conn, statement); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("session init statement %q failed: %w", statement, err)
+		}
+	}
+	return conn, nil
+}
+
+// Close closes the wrapped connector when it has resources of its own. database/sql calls it when the pool is closed.
+func (c *sessionInitConnector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// execDriverStatement runs a statement without arguments on a driver connection
+func execDriverStatement(ctx context.Context, conn driver.Conn, statement string) error {
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		return fmt.Errorf("driver connection %T can't execute statements", conn)
+	}
+	_, err := execer.ExecContext(ctx, statement, nil)
+	return err
+}
+
+// dsnConnector opens connections of a driver that has no connectors of its own, as sql.Open does
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+// Connect opens a connection with the DSN
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver returns the driver of the connector
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openSessionDB opens a database/sql pool through a driver whose connections run the session init statements
+func openSessionDB(drv driver.Driver, dsn string, statements []string) (*sql.DB, error) {
+	var connector driver.Connector
+	if driverContext, ok := drv.(driver.DriverContext); ok {
+		var err error
+		if connector, err = driverContext.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	} else {
+		connector = &dsnConnector{driver: drv, dsn: dsn}
+	}
+	return openConnectorDB(connector, statements), nil
+}
+
+// openConnectorDB opens a database/sql pool on a connector whose connections run the session init statements
+func openConnectorDB(connector driver.Connector, statements []string) *sql.DB {
+	if len(statements) > 0 {
+		connector = &sessionInitConnector{Connector: connector, statements: statements}
+	}
+	return sql.OpenDB(connector)
+}
+
+// beginReadOnly starts a read-only transaction for a read query. Nothing can be written in it,
+// so callers always end it with endReadOnly.
+func beginReadOnly(db *gorm.DB) (*gorm.DB, error) {
+	tx := db.Begin(&sql.TxOptions{ReadOnly: true})
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to start read-only transaction: %w", tx.Error)
+	}
+
+	// SQLite has no read-only transactions; query_only rejects writes on the connection instead
+	if tx.Dialector.Name() == "sqlite" {
+		if err := tx.Exec("PRAGMA query_only = ON").Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to start read-only transaction: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// endReadOnly rolls back a read-only transaction. On SQLite, query_only is reset first so the
+// pooled connection can write again; a transaction aborted by a cancelled context discards its connection.
+func endReadOnly(tx *gorm.DB) {
+	if tx.Dialector.Name() == "sqlite" {
+		tx.Exec("PRAGMA query_only = OFF")
+	}
+	tx.Rollback()
+}
+
+// isReadOnlyViolation detects writes rejected by a read-only transaction
+func isReadOnlyViolation(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "read-only transaction") || // PostgreSQL SQLSTATE 25006
+		strings.Contains(msg, "read only transaction") || // MySQL error 1792
+		strings.Contains(msg, "attempt to write a readonly database") // SQLite with query_only
+}
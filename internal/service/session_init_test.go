@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+)
+
+func TestNormalizeSessionInitStatements(t *testing.T) {
+	statements, err := NormalizeSessionInitStatements([]string{
+		"  SET search_path TO analytics, public; ",
+		"",
+		"set lock_timeout = '5s'",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SET search_path TO analytics, public", "set lock_timeout = '5s'"}, statements)
+
+	// Only single SET statements may run on every connection
+	for _, statement := range []string{
+		"DELETE FROM users",
+		"SET",
+		"SET work_mem = '64MB'; DROP TABLE users",
+		"RESET ALL",
+	} {
+		_, err := NormalizeSessionInitStatements([]string{statement})
+		assert.ErrorIs(t, err, ErrInvalidSessionInit, statement)
+	}
+
+	// Stored as a JSON array, with no statements stored as NULL
+	encoded, err := EncodeSessionInitStatements(statements)
+	require.NoError(t, err)
+	decoded, err := DecodeSessionInitStatements(&models.DataSource{SessionInitStatements: encoded})
+	require.NoError(t, err)
+	assert.Equal(t, statements, decoded)
+
+	encoded, err = EncodeSessionInitStatements(nil)
+	require.NoError(t, err)
+	assert.Nil(t, encoded)
+}
+
+func TestConnectionFingerprint_SessionInit(t *testing.T) {
+	dataSource := &models.DataSource{ID: uuid.New(), Type: models.DataSourceTypeMySQL, Host: "db", Port: 3306}
+	base := connectionFingerprint(dataSource, &ConnectionCredentials{Password: "secret"})
+
+	// Pools opened with other session settings are replaced
+	encoded, err := EncodeSessionInitStatements([]string{"SET time_zone = '+00:00'"})
+	require.NoError(t, err)
+	changed := *dataSource
+	changed.SessionInitStatements = encoded
+	assert.NotEqual(t, base, connectionFingerprint(&changed, &ConnectionCredentials{Password: "secret"}))
+}
+
+// fakeConnector hands out fakeConns that record the statements executed on them
+type fakeConnector struct {
+	conn *fakeConn
+}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	executed []string
+	failOn   string
+	closed   bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query == c.failOn {
+		return nil, errors.New("unrecognized configuration parameter")
+	}
+	c.executed = append(c.executed, query)
+	return driver.RowsAffected(0), nil
+}
+
+func TestSessionInitConnector(t *testing.T) {
+	statements := []string{"SET search_path TO analytics", "SET lock_timeout = '5s'"}
+
+	conn := &fakeConn{}
+	connector := &sessionInitConnector{Connector: &fakeConnector{conn: conn}, statements: statements}
+	opened, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Same(t, conn, opened)
+	assert.Equal(t, statements, conn.executed)
+
+	// A connection whose session can't be initialized is closed, not handed to the pool
+	conn = &fakeConn{failOn: "SET lock_timeout = '5s'"}
+	connector = &sessionInitConnector{Connector: &fakeConnector{conn: conn}, statements: statements}
+	_, err = connector.Connect(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SET lock_timeout")
+	assert.True(t, conn.closed)
+}
@@ -24,15 +24,12 @@ type SQLParseResult struct {
 
 // ParseAndValidateSQL parses and validates SQL using dialect-specific parsers
 func ParseAndValidateSQL(sql string, dialect models.DataSourceType) (*SQLParseResult, error) {
-	switch dialect {
-	case models.DataSourceTypePostgreSQL:
-		return parsePostgreSQL(sql)
-	case models.DataSourceTypeMySQL:
-		return parseMySQL(sql)
-	default:
+	driver, err := LookupDataSourceDriver(dialect)
+	if err != nil {
 		// Fallback to basic validation for unsupported dialects
 		return parseGeneric(sql)
 	}
+	return driver.ParseSQL(sql)
 }
 
 // parsePostgreSQL uses pg_query_go (real PostgreSQL parser)
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// sqliteBusyTimeoutMs is how long a SQLite connection waits for another connection's lock
+const sqliteBusyTimeoutMs = 5000
+
+// ErrInvalidSQLitePath is returned when a SQLite data source has no usable database file path
+var ErrInvalidSQLitePath = errors.New("invalid SQLite file path")
+
+// NormalizeSQLitePath checks that a SQLite database file path is absolute and cleans it.
+// Relative paths would depend on the working directory of the server and worker.
+func NormalizeSQLitePath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", fmt.Errorf("%w: a file path is required", ErrInvalidSQLitePath)
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%w: %q must be an absolute path", ErrInvalidSQLitePath, path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// sqliteDSN builds the DSN of a SQLite database file. The file is opened read-write but never
+// created, so a mistyped path fails instead of governing an empty database.
+func sqliteDSN(path string) string {
+	dsn := url.URL{
+		Scheme:   "file",
+		Path:     path,
+		RawQuery: fmt.Sprintf("mode=rw&_busy_timeout=%d&_foreign_keys=on", sqliteBusyTimeoutMs),
+	}
+	return dsn.String()
+}
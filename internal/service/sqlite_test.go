@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourorg/querybase/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const sqliteTestEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+// createSQLiteDataSource creates a SQLite database file with an orders table and registers it as a data source
+func createSQLiteDataSource(t *testing.T, db *gorm.DB) *models.DataSource {
+	path := filepath.Join(t.TempDir(), "edge.db")
+	fixture, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, fixture.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT NOT NULL DEFAULT 'open', payload BLOB)`).Error)
+	require.NoError(t, fixture.Exec(`INSERT INTO orders (id, status, payload) VALUES (1, 'open', x'CAFE'), (2, 'shipped', NULL)`).Error)
+	sqlDB, err := fixture.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	dataSource, err := NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey)).CreateDataSource(context.Background(), &CreateDataSourceInput{
+		Name:     "edge-" + uuid.New().String(),
+		Type:     string(models.DataSourceTypeSQLite),
+		FilePath: path,
+	})
+	require.NoError(t, err)
+	return dataSource
+}
+
+func TestSQLiteDataSource_SchemaAndQueries(t *testing.T) {
+	db := setupTestDB(t)
+	dataSource := createSQLiteDataSource(t, db)
+	assert.Equal(t, "main", dataSource.DatabaseName)
+
+	// Relative paths depend on the working directory of each process, so they are rejected
+	_, err := NewDataSourceService(db, NewLegacyKeyring(sqliteTestEncryptionKey)).CreateDataSource(context.Background(), &CreateDataSourceInput{
+		Name: "relative", Type: string(models.DataSourceTypeSQLite), FilePath: "edge.db",
+	})
+	assert.ErrorIs(t, err, ErrInvalidSQLitePath)
+
+	schema, err := NewSchemaService(db, NewLegacyKeyring(sqliteTestEncryptionKey)).GetSchema(context.Background(), dataSource.ID.String())
+	require.NoError(t, err)
+	require.Len(t, schema.Tables, 1)
+	orders := schema.Tables[0]
+	assert.Equal(t, "orders", orders.TableName)
+	require.Len(t, orders.Columns, 3)
+	assert.True(t, orders.Columns[0].IsPrimaryKey)
+	assert.False(t, orders.Columns[1].IsNullable)
+	require.NotNil(t, orders.Columns[1].ColumnDefault)
+	assert.Equal(t, "'open'", *orders.Columns[1].ColumnDefault)
+
+	queryService := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	// An admin passes the permission check
+	user := createTestUser(t, db, models.RoleAdmin)
+	query := &models.Query{
+		ID:            uuid.New(),
+		DataSourceID:  dataSource.ID,
+		UserID:        user.ID,
+		QueryText:     "SELECT id, status FROM orders ORDER BY id",
+		OperationType: models.OperationSelect,
+		Status:        models.StatusPending,
+	}
+	require.NoError(t, db.Create(query).Error)
+
+	result, err := queryService.ExecuteQuery(context.Background(), query, dataSource)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.RowCount)
+
+	// SQLite plans are read with EXPLAIN QUERY PLAN, which has no ANALYZE form
+	plan, err := queryService.ExplainQuery(context.Background(), "SELECT * FROM orders WHERE id = 1", dataSource, false)
+	require.NoError(t, err)
+	assert.NotEmpty(t, plan.Plan)
+	_, err = queryService.ExplainQuery(context.Background(), "SELECT * FROM orders", dataSource, true)
+	assert.Error(t, err)
+}
+
+func TestSQLiteDataSource_ReadOnlyAndAudit(t *testing.T) {
+	db := setupTestDB(t)
+	dataSource := createSQLiteDataSource(t, db)
+
+	queryService := NewQueryService(db, NewLegacyKeyring(sqliteTestEncryptionKey), nil, nil)
+	dataSourceDB, err := queryService.connectToDataSource(dataSource)
+	require.NoError(t, err)
+	sqlDB, err := dataSourceDB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	// Reads can't write, and the connection can write again once the read is done
+	tx, err := beginReadOnly(dataSourceDB)
+	require.NoError(t, err)
+	err = tx.Exec("DELETE FROM orders").Error
+	require.Error(t, err)
+	assert.True(t, isReadOnlyViolation(err))
+	endReadOnly(tx)
+
+	auditService := NewAuditService(db)
+	capability, err := auditService.TestAuditCapability(context.Background(), dataSourceDB, dataSource)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuditCapabilityFull, capability)
+
+	// Writes are audited through TEMP triggers that leave the database file untouched
+	tx = dataSourceDB.Begin()
+	require.NoError(t, tx.Error)
+	defer tx.Rollback()
+
+	audit, err := auditService.ExecuteWithAudit(context.Background(), tx, "UPDATE orders SET status = 'closed' WHERE id = 1", dataSource, models.AuditModeFull, 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuditModeFull, audit.AuditMode)
+	assert.Equal(t, 1, audit.AffectedRows)
+	require.Len(t, audit.BeforeData, 1)
+	require.Len(t, audit.AfterData, 1)
+	assert.Equal(t, "open", audit.BeforeData[0]["status"])
+	assert.Equal(t, "CAFE", audit.BeforeData[0]["payload"])
+	assert.Equal(t, "closed", audit.AfterData[0]["status"])
+
+	var triggers int64
+	require.NoError(t, tx.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger'").Scan(&triggers).Error)
+	assert.Zero(t, triggers)
+}
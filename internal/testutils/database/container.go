@@ -117,6 +117,8 @@ func migrateSchema(db *gorm.DB) error {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+		&models.DataSourceHealthCheck{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -127,6 +129,8 @@ func migrateSchema(db *gorm.DB) error {
 		&models.QueryTransactionStatement{},
 		&models.NotificationConfig{},
 		&models.Notification{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
 	)
 }
 
@@ -76,6 +76,8 @@ func MigrateTestSchema(db *gorm.DB) error {
 		&models.UserGroup{},
 		&models.DataSource{},
 		&models.DataSourcePermission{},
+		&models.DataSourceReplica{},
+		&models.DataSourceHealthCheck{},
 		&models.Query{},
 		&models.QueryResult{},
 		&models.QueryHistory{},
@@ -86,6 +88,8 @@ func MigrateTestSchema(db *gorm.DB) error {
 		&models.QueryTransactionStatement{},
 		&models.NotificationConfig{},
 		&models.Notification{},
+		&models.QuerySchedule{},
+		&models.QueryScheduleRun{},
 	)
 }
 
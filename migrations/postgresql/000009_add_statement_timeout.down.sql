@@ -0,0 +1,10 @@
+-- Rollback: Remove per-datasource statement timeout
+-- Version: 000009
+
+-- PostgreSQL cannot drop a value from an enum type, so 'cancelled' rows are
+-- folded into 'failed' and the value is left in place.
+UPDATE queries SET status = 'failed' WHERE status = 'cancelled';
+UPDATE query_history SET status = 'failed' WHERE status = 'cancelled';
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS statement_timeout_seconds;
@@ -0,0 +1,11 @@
+-- Migration: Add per-datasource statement timeout and cancelled query status
+-- Version: 000009
+
+-- Cancelled queries are tracked separately from failures
+ALTER TYPE query_status ADD VALUE IF NOT EXISTS 'cancelled';
+
+-- Add statement timeout to data_sources table
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS statement_timeout_seconds INTEGER NOT NULL DEFAULT 300;
+
+COMMENT ON COLUMN data_sources.statement_timeout_seconds IS 'Maximum execution time for a single statement, applied as statement_timeout (PostgreSQL) or MAX_EXECUTION_TIME (MySQL)';
@@ -0,0 +1,11 @@
+-- Rollback: Remove per-datasource result limits and truncation metadata
+-- Version: 000010
+
+ALTER TABLE query_results
+    DROP COLUMN IF EXISTS result_limit,
+    DROP COLUMN IF EXISTS truncated_by,
+    DROP COLUMN IF EXISTS truncated;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS max_result_bytes,
+    DROP COLUMN IF EXISTS max_result_rows;
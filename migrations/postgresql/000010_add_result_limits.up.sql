@@ -0,0 +1,20 @@
+-- Migration: Add per-datasource result limits and truncation metadata
+-- Version: 000010
+
+-- Add result limits to data_sources table
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS max_result_rows INTEGER NOT NULL DEFAULT 10000,
+    ADD COLUMN IF NOT EXISTS max_result_bytes BIGINT NOT NULL DEFAULT 52428800;
+
+COMMENT ON COLUMN data_sources.max_result_rows IS 'Maximum number of rows kept from a SELECT result (0 = no data source limit)';
+COMMENT ON COLUMN data_sources.max_result_bytes IS 'Maximum serialized size in bytes kept from a SELECT result (0 = no data source limit)';
+
+-- Record whether a stored result was cut off and by which limit
+ALTER TABLE query_results
+    ADD COLUMN IF NOT EXISTS truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS truncated_by VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS result_limit BIGINT;
+
+COMMENT ON COLUMN query_results.truncated IS 'True when the result was cut off by a row or byte limit';
+COMMENT ON COLUMN query_results.truncated_by IS 'Limit that was hit: max_rows or max_bytes';
+COMMENT ON COLUMN query_results.result_limit IS 'Value of the limit that was hit';
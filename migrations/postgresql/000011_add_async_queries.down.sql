@@ -0,0 +1,7 @@
+-- Rollback: Remove asynchronous query marker
+-- Version: 000011
+
+DROP INDEX IF EXISTS idx_queries_async_pending;
+
+ALTER TABLE queries
+    DROP COLUMN IF EXISTS is_async;
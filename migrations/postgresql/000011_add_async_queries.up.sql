@@ -0,0 +1,10 @@
+-- Migration: Mark queries submitted for asynchronous execution
+-- Version: 000011
+
+ALTER TABLE queries
+    ADD COLUMN IF NOT EXISTS is_async BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN queries.is_async IS 'True when the query was queued for execution by a worker';
+
+-- Workers claim queued queries by status
+CREATE INDEX IF NOT EXISTS idx_queries_async_pending ON queries(id) WHERE is_async = TRUE AND status = 'pending';
@@ -0,0 +1,6 @@
+-- Rollback: Remove query result data format
+-- Version: 000012
+
+-- Results stored as rows can no longer be read after this rollback
+ALTER TABLE query_results
+    DROP COLUMN IF EXISTS data_format;
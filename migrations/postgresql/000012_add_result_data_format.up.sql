@@ -0,0 +1,8 @@
+-- Migration: Store query results as arrays of values in column order
+-- Version: 000012
+
+-- Existing rows keep the legacy encoding (an array of objects keyed by column name)
+ALTER TABLE query_results
+    ADD COLUMN IF NOT EXISTS data_format VARCHAR(20) NOT NULL DEFAULT 'objects';
+
+COMMENT ON COLUMN query_results.data_format IS 'Encoding of data: objects (legacy, keyed by column name) or rows (arrays in column_names order)';
@@ -0,0 +1,6 @@
+-- Rollback: Remove named query parameters
+-- Version: 000013
+
+ALTER TABLE queries
+    DROP COLUMN IF EXISTS parameter_values,
+    DROP COLUMN IF EXISTS parameters;
@@ -0,0 +1,9 @@
+-- Migration: Add named parameters to queries
+-- Version: 000013
+
+ALTER TABLE queries
+    ADD COLUMN IF NOT EXISTS parameters JSONB,
+    ADD COLUMN IF NOT EXISTS parameter_values JSONB;
+
+COMMENT ON COLUMN queries.parameters IS 'Declared :name parameters: name, type, default and allowed values';
+COMMENT ON COLUMN queries.parameter_values IS 'Values bound to the parameters when the query ran';
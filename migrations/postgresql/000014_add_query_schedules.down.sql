@@ -0,0 +1,10 @@
+-- Rollback: Remove scheduled queries
+-- Version: 000014
+
+DROP TABLE IF EXISTS query_schedule_runs;
+
+DROP TRIGGER IF EXISTS update_query_schedules_updated_at ON query_schedules;
+DROP TABLE IF EXISTS query_schedules;
+
+ALTER TABLE notification_configs
+    DROP COLUMN IF EXISTS channel;
@@ -0,0 +1,52 @@
+-- Migration: Scheduled runs of saved queries with result delivery
+-- Version: 000014
+
+ALTER TABLE notification_configs
+    ADD COLUMN IF NOT EXISTS channel VARCHAR(20) NOT NULL DEFAULT 'google_chat';
+
+COMMENT ON COLUMN notification_configs.channel IS 'google_chat or webhook; only webhook channels receive file attachments';
+
+CREATE TABLE IF NOT EXISTS query_schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    query_id UUID NOT NULL REFERENCES queries(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notification_config_id UUID NOT NULL REFERENCES notification_configs(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    cron_expression VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    parameter_values JSONB,
+    delivery VARCHAR(20) NOT NULL DEFAULT 'attachment',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    disabled_reason TEXT,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON COLUMN query_schedules.user_id IS 'Owner; runs use the current permissions of this user';
+COMMENT ON COLUMN query_schedules.disabled_reason IS 'Set when the schedule was disabled because its owner lost access';
+
+CREATE INDEX IF NOT EXISTS idx_query_schedules_query_id ON query_schedules(query_id);
+CREATE INDEX IF NOT EXISTS idx_query_schedules_user_id ON query_schedules(user_id);
+-- The worker polls active schedules by next run time
+CREATE INDEX IF NOT EXISTS idx_query_schedules_due ON query_schedules(next_run_at) WHERE is_active = TRUE;
+
+CREATE TRIGGER update_query_schedules_updated_at BEFORE UPDATE ON query_schedules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS query_schedule_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    schedule_id UUID NOT NULL REFERENCES query_schedules(id) ON DELETE CASCADE,
+    query_id UUID REFERENCES queries(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL,
+    row_count INTEGER,
+    delivery VARCHAR(20),
+    delivery_error TEXT,
+    error_message TEXT,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_schedule_runs_schedule ON query_schedule_runs(schedule_id, started_at DESC);
@@ -0,0 +1,12 @@
+-- Rollback: Remove result retention policy
+-- Version: 000015
+
+DROP INDEX IF EXISTS idx_query_results_not_purged;
+
+ALTER TABLE query_results
+    DROP COLUMN IF EXISTS purged_at;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS result_max_age_hours,
+    DROP COLUMN IF EXISTS result_max_total_bytes,
+    DROP COLUMN IF EXISTS result_keep_last_per_user;
@@ -0,0 +1,20 @@
+-- Migration: Result retention policy
+-- Version: 000015
+
+-- Per data source overrides of the global retention settings (NULL = use the global setting)
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS result_max_age_hours INTEGER,
+    ADD COLUMN IF NOT EXISTS result_max_total_bytes BIGINT,
+    ADD COLUMN IF NOT EXISTS result_keep_last_per_user INTEGER;
+
+COMMENT ON COLUMN data_sources.result_max_age_hours IS 'Stored results older than this are purged (NULL = global setting, 0 = no age limit)';
+COMMENT ON COLUMN data_sources.result_max_total_bytes IS 'Oldest stored results are purged beyond this total size (NULL = global setting, 0 = no size limit)';
+COMMENT ON COLUMN data_sources.result_keep_last_per_user IS 'Only the newest N stored results of each user are kept (NULL = global setting, 0 = keep all)';
+
+-- Purged results keep their metadata; only the data is removed
+ALTER TABLE query_results
+    ADD COLUMN IF NOT EXISTS purged_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN query_results.purged_at IS 'Set when the retention policy removed the result data';
+
+CREATE INDEX IF NOT EXISTS idx_query_results_not_purged ON query_results(stored_at DESC) WHERE purged_at IS NULL;
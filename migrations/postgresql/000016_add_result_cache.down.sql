@@ -0,0 +1,11 @@
+-- Rollback: Remove result cache
+-- Version: 000016
+
+ALTER TABLE query_history
+    DROP COLUMN IF EXISTS cache_hit;
+
+ALTER TABLE query_results
+    DROP COLUMN IF EXISTS cached_at;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS result_cache_ttl_seconds;
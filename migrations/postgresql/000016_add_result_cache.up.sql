@@ -0,0 +1,19 @@
+-- Migration: Result cache
+-- Version: 000016
+
+-- Opt-in per data source: SELECT results are cached in Redis for this many seconds
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS result_cache_ttl_seconds INTEGER NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN data_sources.result_cache_ttl_seconds IS 'SELECT results are cached in Redis this long (0 = cache disabled)';
+
+-- Results served from the cache record when the rows were computed
+ALTER TABLE query_results
+    ADD COLUMN IF NOT EXISTS cached_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN query_results.cached_at IS 'Set when the rows came from the result cache; the time they were computed';
+
+ALTER TABLE query_history
+    ADD COLUMN IF NOT EXISTS cache_hit BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN query_history.cache_hit IS 'The execution was served from the result cache';
@@ -0,0 +1,5 @@
+-- Rollback: Remove query history search indexes
+-- Version: 000017
+
+DROP INDEX IF EXISTS idx_query_history_execution_time_ms;
+DROP INDEX IF EXISTS idx_query_history_user_executed_at;
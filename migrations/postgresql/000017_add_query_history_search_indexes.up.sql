@@ -0,0 +1,8 @@
+-- Migration: Query history search indexes
+-- Version: 000017
+
+-- Per-user history pages, newest first
+CREATE INDEX IF NOT EXISTS idx_query_history_user_executed_at ON query_history(user_id, executed_at DESC);
+
+-- Slow query investigation: minimum duration filter and sorting by duration
+CREATE INDEX IF NOT EXISTS idx_query_history_execution_time_ms ON query_history(execution_time_ms DESC) WHERE execution_time_ms IS NOT NULL;
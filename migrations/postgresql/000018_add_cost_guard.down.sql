@@ -0,0 +1,15 @@
+-- Rollback: Remove EXPLAIN cost guard
+-- Version: 000018
+
+ALTER TABLE queries
+    DROP COLUMN IF EXISTS cost_guard_rule,
+    DROP COLUMN IF EXISTS estimated_rows,
+    DROP COLUMN IF EXISTS estimated_cost;
+
+ALTER TABLE data_sources
+    DROP CONSTRAINT IF EXISTS data_sources_cost_guard_action_check;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS cost_guard_action,
+    DROP COLUMN IF EXISTS cost_guard_max_rows,
+    DROP COLUMN IF EXISTS cost_guard_max_cost;
@@ -0,0 +1,22 @@
+-- Migration: EXPLAIN cost guard
+-- Version: 000018
+
+-- Per data source thresholds checked against the planner estimate before a SELECT runs
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS cost_guard_max_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cost_guard_max_rows BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cost_guard_action VARCHAR(20) NOT NULL DEFAULT 'block';
+
+ALTER TABLE data_sources
+    ADD CONSTRAINT data_sources_cost_guard_action_check
+    CHECK (cost_guard_action IN ('block', 'warn', 'approval'));
+
+COMMENT ON COLUMN data_sources.cost_guard_max_cost IS 'Highest planner cost a SELECT may have (0 = rule disabled)';
+COMMENT ON COLUMN data_sources.cost_guard_max_rows IS 'Highest planner row estimate a SELECT may have (0 = rule disabled)';
+COMMENT ON COLUMN data_sources.cost_guard_action IS 'What happens when a threshold is exceeded: block, warn or approval';
+
+-- The estimate a query was checked against, and the rule it exceeded
+ALTER TABLE queries
+    ADD COLUMN IF NOT EXISTS estimated_cost DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS estimated_rows DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS cost_guard_rule VARCHAR(20);
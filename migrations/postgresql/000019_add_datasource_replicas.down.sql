@@ -0,0 +1,7 @@
+-- Rollback: Remove read replicas
+-- Version: 000019
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS max_replica_lag_seconds;
+
+DROP TABLE IF EXISTS data_source_replicas;
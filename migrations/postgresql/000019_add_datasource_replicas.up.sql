@@ -0,0 +1,26 @@
+-- Migration: Read replicas
+-- Version: 000019
+
+-- Read replica endpoints of a data source; they share its database name and credentials
+CREATE TABLE IF NOT EXISTS data_source_replicas (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    data_source_id UUID NOT NULL REFERENCES data_sources(id) ON DELETE CASCADE,
+    host VARCHAR(255) NOT NULL,
+    port INTEGER NOT NULL,
+    is_healthy BOOLEAN NOT NULL DEFAULT FALSE,
+    lag_seconds DOUBLE PRECISION,
+    last_checked_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (data_source_id, host, port)
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_source_replicas_data_source_id ON data_source_replicas(data_source_id);
+
+COMMENT ON COLUMN data_source_replicas.is_healthy IS 'Reachable with a measurable lag at the last health check';
+COMMENT ON COLUMN data_source_replicas.lag_seconds IS 'Replication lag at the last health check';
+
+-- Reads fall back to the primary when every replica lags more than this
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS max_replica_lag_seconds INTEGER NOT NULL DEFAULT 30;
@@ -0,0 +1,5 @@
+-- Rollback: Remove session init statements
+-- Version: 000020
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS session_init_statements;
@@ -0,0 +1,9 @@
+-- Migration: Session init statements
+-- Version: 000020
+
+-- SET statements run on every connection QueryBase opens to the data source, e.g.
+-- ["SET search_path TO analytics", "SET lock_timeout = '5s'"]
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS session_init_statements JSONB;
+
+COMMENT ON COLUMN data_sources.session_init_statements IS 'JSON array of SET statements run on every new connection';
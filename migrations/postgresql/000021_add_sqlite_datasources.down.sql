@@ -0,0 +1,7 @@
+-- Rollback: Remove SQLite data sources
+-- Version: 000021
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS file_path;
+
+-- PostgreSQL can't drop a value from an enum, so 'sqlite' stays in data_source_type
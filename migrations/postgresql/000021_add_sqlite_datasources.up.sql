@@ -0,0 +1,10 @@
+-- Migration: SQLite data sources
+-- Version: 000021
+
+ALTER TYPE data_source_type ADD VALUE IF NOT EXISTS 'sqlite';
+
+-- SQLite data sources are a database file on the QueryBase host; host, port and credentials stay empty
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS file_path TEXT NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN data_sources.file_path IS 'Absolute path of the database file of a SQLite data source';
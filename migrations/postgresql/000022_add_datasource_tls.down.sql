@@ -0,0 +1,12 @@
+-- Rollback: Remove data source TLS settings
+-- Version: 000022
+
+ALTER TABLE data_sources
+    DROP CONSTRAINT IF EXISTS chk_data_sources_tls_mode;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS encrypted_tls_client_key,
+    DROP COLUMN IF EXISTS encrypted_tls_client_cert,
+    DROP COLUMN IF EXISTS encrypted_tls_ca_cert,
+    DROP COLUMN IF EXISTS tls_server_name,
+    DROP COLUMN IF EXISTS tls_mode;
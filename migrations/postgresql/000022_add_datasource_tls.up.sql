@@ -0,0 +1,16 @@
+-- Migration: Data source TLS settings
+-- Version: 000022
+
+-- TLS mode follows PostgreSQL's sslmode: disable, require, verify-ca or verify-full.
+-- Certificates and the client key are PEM, encrypted like passwords.
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS tls_mode VARCHAR(20) NOT NULL DEFAULT 'disable',
+    ADD COLUMN IF NOT EXISTS tls_server_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS encrypted_tls_ca_cert TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS encrypted_tls_client_cert TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS encrypted_tls_client_key TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE data_sources
+    ADD CONSTRAINT chk_data_sources_tls_mode CHECK (tls_mode IN ('disable', 'require', 'verify-ca', 'verify-full'));
+
+COMMENT ON COLUMN data_sources.tls_server_name IS 'Name the server certificate must have in verify-full mode; empty uses the host';
@@ -0,0 +1,13 @@
+-- Rollback: Remove data source SSH tunnels
+-- Version: 000023
+
+ALTER TABLE data_sources
+    DROP CONSTRAINT IF EXISTS chk_data_sources_ssh_port;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS ssh_known_hosts,
+    DROP COLUMN IF EXISTS encrypted_ssh_password,
+    DROP COLUMN IF EXISTS encrypted_ssh_private_key,
+    DROP COLUMN IF EXISTS ssh_user,
+    DROP COLUMN IF EXISTS ssh_port,
+    DROP COLUMN IF EXISTS ssh_host;
@@ -0,0 +1,17 @@
+-- Migration: Data source SSH tunnels
+-- Version: 000023
+
+-- A data source with an ssh_host is reached through that bastion. The private key and
+-- password are encrypted like the database password; ssh_known_hosts pins the bastion's host key.
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS ssh_host VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ssh_port INTEGER NOT NULL DEFAULT 22,
+    ADD COLUMN IF NOT EXISTS ssh_user VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS encrypted_ssh_private_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS encrypted_ssh_password TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ssh_known_hosts TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE data_sources
+    ADD CONSTRAINT chk_data_sources_ssh_port CHECK (ssh_port BETWEEN 1 AND 65535);
+
+COMMENT ON COLUMN data_sources.ssh_host IS 'SSH bastion the data source is reached through; empty connects directly';
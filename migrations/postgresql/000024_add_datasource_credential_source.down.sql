@@ -0,0 +1,9 @@
+-- Rollback: Remove data source credential sources
+-- Version: 000024
+
+ALTER TABLE data_sources
+    DROP CONSTRAINT IF EXISTS chk_data_sources_credential_source;
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS credential_ref,
+    DROP COLUMN IF EXISTS credential_source;
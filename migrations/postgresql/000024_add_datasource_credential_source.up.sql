@@ -0,0 +1,12 @@
+-- Migration: Data source credential sources
+-- Version: 000024
+
+-- The password of a data source is stored encrypted, or read at connect time from an
+-- environment variable, a mounted file or the HTTP secrets manager. credential_ref names
+-- the variable, file or secret; the secret itself is never stored.
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS credential_source VARCHAR(20) NOT NULL DEFAULT 'encrypted',
+    ADD COLUMN IF NOT EXISTS credential_ref VARCHAR(512) NOT NULL DEFAULT '';
+
+ALTER TABLE data_sources
+    ADD CONSTRAINT chk_data_sources_credential_source CHECK (credential_source IN ('encrypted', 'env', 'file', 'http'));
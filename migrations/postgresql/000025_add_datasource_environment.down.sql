@@ -0,0 +1,5 @@
+-- Rollback: Remove data source environments
+-- Version: 000025
+
+ALTER TABLE data_sources
+    DROP COLUMN IF EXISTS environment;
@@ -0,0 +1,8 @@
+-- Migration: Data source environments
+-- Version: 000025
+
+-- The environment of a data source (dev, staging, prod or a custom name) selects the policy
+-- its queries follow: required approvals, SELECT approval, row limits and admin execution.
+-- Existing data sources are treated as prod, which keeps their current approval rules.
+ALTER TABLE data_sources
+    ADD COLUMN IF NOT EXISTS environment VARCHAR(32) NOT NULL DEFAULT 'prod';
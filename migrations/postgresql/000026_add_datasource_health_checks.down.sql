@@ -0,0 +1,4 @@
+-- Rollback: Remove data source health history
+-- Version: 000026
+
+DROP TABLE IF EXISTS data_source_health_checks;
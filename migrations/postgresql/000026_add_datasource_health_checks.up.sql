@@ -0,0 +1,25 @@
+-- Migration: Data source health history
+-- Version: 000026
+
+-- Every health probe of a data source, from health checks and periodic schema syncs.
+-- Probes older than health_history.retention are deleted as new ones are recorded.
+CREATE TABLE IF NOT EXISTS data_source_health_checks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    data_source_id UUID NOT NULL REFERENCES data_sources(id) ON DELETE CASCADE,
+    checked_at TIMESTAMPTZ NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    connect_latency_ms BIGINT,
+    ping_latency_ms BIGINT,
+    error_class VARCHAR(32) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    server_version VARCHAR(255) NOT NULL DEFAULT '',
+    replica_lag_seconds DOUBLE PRECISION,
+    CONSTRAINT chk_data_source_health_checks_status CHECK (status IN ('healthy', 'degraded', 'unhealthy'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_source_health_checks_checked_at ON data_source_health_checks(data_source_id, checked_at);
+
+COMMENT ON COLUMN data_source_health_checks.connect_latency_ms IS 'Time to open a connection; NULL when it failed';
+COMMENT ON COLUMN data_source_health_checks.ping_latency_ms IS 'Round trip on the open connection; NULL when it failed';
+COMMENT ON COLUMN data_source_health_checks.replica_lag_seconds IS 'Largest lag of the replicas; NULL without measured replicas';
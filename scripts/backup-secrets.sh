@@ -14,7 +14,7 @@ backup_keys() {
     local backup_file="$BACKUP_DIR/keys_$timestamp.env"
     
     if [ -f "$ENV_FILE" ]; then
-        grep -E "^(JWT_SECRET|ENCRYPTION_KEY)=" "$ENV_FILE" > "$backup_file"
+        grep -E "^(JWT_SECRET|ENCRYPTION_ACTIVE_KEY|ENCRYPTION_KEYS|ENCRYPTION_LEGACY_KEY)=" "$ENV_FILE" > "$backup_file"
         chmod 600 "$backup_file"
         echo "✅ Keys backed up to: $backup_file"
         
@@ -52,31 +52,22 @@ restore_keys() {
     # Backup current keys first
     backup_keys
     
-    # Extract keys from backup
-    local jwt_secret=$(grep "^JWT_SECRET=" "$backup_file" | cut -d'=' -f2)
-    local enc_key=$(grep "^ENCRYPTION_KEY=" "$backup_file" | cut -d'=' -f2)
-    
-    # Update .env file
+    # Update .env file with every key of the backup
     if [ -f "$ENV_FILE" ]; then
-        # Update or add JWT_SECRET
-        if grep -q "^JWT_SECRET=" "$ENV_FILE"; then
-            sed -i.bak "s/^JWT_SECRET=.*/JWT_SECRET=$jwt_secret/" "$ENV_FILE"
-            rm -f "$ENV_FILE.bak"
-        else
-            echo "JWT_SECRET=$jwt_secret" >> "$ENV_FILE"
-        fi
-        
-        # Update or add ENCRYPTION_KEY
-        if grep -q "^ENCRYPTION_KEY=" "$ENV_FILE"; then
-            sed -i.bak "s/^ENCRYPTION_KEY=.*/ENCRYPTION_KEY=$enc_key/" "$ENV_FILE"
-            rm -f "$ENV_FILE.bak"
-        else
-            echo "ENCRYPTION_KEY=$enc_key" >> "$ENV_FILE"
-        fi
-        
+        for name in JWT_SECRET ENCRYPTION_ACTIVE_KEY ENCRYPTION_KEYS ENCRYPTION_LEGACY_KEY; do
+            local value=$(grep "^$name=" "$backup_file" | cut -d'=' -f2-)
+            if grep -q "^$name=" "$ENV_FILE"; then
+                sed -i.bak "s/^$name=.*/$name=$value/" "$ENV_FILE"
+                rm -f "$ENV_FILE.bak"
+            else
+                echo "$name=$value" >> "$ENV_FILE"
+            fi
+        done
+
         echo "✅ Keys restored successfully!"
+        local jwt_secret=$(grep "^JWT_SECRET=" "$backup_file" | cut -d'=' -f2)
         echo "JWT_SECRET: ${jwt_secret:0:8}...${jwt_secret: -8}"
-        echo "ENCRYPTION_KEY: ${enc_key:0:8}...${enc_key: -8}"
+        echo "Encryption keys: $(grep "^ENCRYPTION_KEYS=" "$backup_file" | cut -d'=' -f2- | sed -E 's/:[^,]*/:.../g')"
         echo ""
         echo "⚠️  Restart your application to use the restored keys"
     fi
@@ -8,6 +8,9 @@ import { EmptyState } from '@/components/ui/EmptyState';
 import { QueryError } from '@/components/ui/Alert';
 import { ArrowsUpDownIcon, FunnelIcon, ArrowDownIcon, ArrowUpIcon, ArrowsPointingOutIcon, ArrowsPointingInIcon } from '@heroicons/react/24/outline';
 
+// Duplicate column names get a unique key in the row objects
+const columnKey = (column: ColumnInfo) => column.key ?? column.name;
+
 interface QueryResultsProps {
   queryId: string;
   results: QueryResult | null;
@@ -200,15 +203,15 @@ export default function QueryResults({
             <tr>
               {columns.map((column) => (
                 <th
-                  key={column.name}
-                  onClick={() => handleSort(column.name)}
+                  key={columnKey(column)}
+                  onClick={() => handleSort(columnKey(column))}
                   className="px-4 py-3 text-left text-xs font-bold text-slate-500 dark:text-slate-400 uppercase tracking-widest whitespace-nowrap cursor-pointer hover:bg-slate-500/10 transition-colors group/th"
                 >
                   <div className="flex flex-col gap-0.5">
                     <div className="flex items-center gap-2">
                       <span className="text-slate-700 dark:text-slate-300 group-hover/th:text-blue-500 transition-colors">{column.name}</span>
                       <span className="text-slate-400">
-                        {sortConfig.key === column.name ? (
+                        {sortConfig.key === columnKey(column) ? (
                           sortConfig.direction === 'asc' ? <ArrowUpIcon className="h-3 w-3" /> : <ArrowDownIcon className="h-3 w-3" />
                         ) : (
                           <ArrowsUpDownIcon className="h-3 w-3 opacity-0 group-hover/th:opacity-100 transition-opacity" />
@@ -225,12 +228,12 @@ export default function QueryResults({
             {isFilterVisible && (
               <tr className="bg-slate-50 dark:bg-slate-900/80 border-b border-slate-200 dark:border-white/5 animate-in slide-in-from-top-1 duration-200">
                 {columns.map((column) => (
-                  <th key={`filter-${column.name}`} className="px-2 py-2">
+                  <th key={`filter-${columnKey(column)}`} className="px-2 py-2">
                     <input
                       type="text"
                       placeholder={`Filter...`}
-                      value={filterTerms[column.name] || ''}
-                      onChange={(e) => handleFilterChange(column.name, e.target.value)}
+                      value={filterTerms[columnKey(column)] || ''}
+                      onChange={(e) => handleFilterChange(columnKey(column), e.target.value)}
                       className="w-full bg-white dark:bg-slate-800 border border-slate-200 dark:border-white/10 rounded-lg px-2 py-1 text-[10px] font-bold text-slate-700 dark:text-slate-200 focus:outline-none focus:ring-1 focus:ring-blue-500/50 placeholder:text-slate-400/50"
                     />
                   </th>
@@ -244,11 +247,11 @@ export default function QueryResults({
                 <tr key={rowIndex} className="hover:bg-blue-50/50 dark:hover:bg-blue-900/10 transition-colors group">
                   {columns.map((column) => (
                     <td
-                      key={column.name}
+                      key={columnKey(column)}
                       className="px-4 py-2 text-xs text-slate-700 dark:text-slate-300 max-w-xs truncate group-hover:text-slate-900 dark:group-hover:text-white transition-colors"
-                      title={String(row[column.name])}
+                      title={String(row[columnKey(column)])}
                     >
-                      {formatCellValue(row[column.name])}
+                      {formatCellValue(row[columnKey(column)])}
                     </td>
                   ))}
                 </tr>
@@ -85,11 +85,13 @@ export interface QueryResult {
   row_count: number;
   columns: ColumnInfo[];
   data: Record<string, unknown>[];
+  rows?: unknown[][];
 }
 
 export interface ColumnInfo {
   name: string;
   type: string;
+  key?: string; // key of the column in data rows, differs from name for duplicate names
 }
 
 export interface ExecuteQueryRequest {
@@ -104,6 +106,7 @@ export interface PaginatedResults {
   row_count: number;
   columns: ColumnInfo[];
   data: Record<string, unknown>[];
+  rows?: unknown[][];
   metadata: {
     page: number;
     per_page: number;